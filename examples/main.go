@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"github.com/MetaRPC/GoMT4/config"
 	"github.com/MetaRPC/GoMT4/mt4"
-	"github.com/google/uuid"
 	"log"
 )
 
@@ -17,7 +16,7 @@ func main() {
 	}
 
 	// Creating an account
-	account, err := mt4.NewMT4Account(uint64(cfg.Login), cfg.Password, "", uuid.Nil)
+	account, err := mt4.NewMT4Account(uint64(cfg.Login), cfg.Password)
 	if err != nil {
 		log.Fatalf("❌ Failed to create MT4 account: %v", err)
 	}
@@ -83,6 +82,7 @@ func main() {
 		svc.StreamOpenedOrderProfits(ctx) // stream profits on open orders
 		svc.StreamOpenedOrderTickets(ctx) // ticket streaming
 		svc.StreamTradeUpdates(ctx)       // stream trade events
+		svc.StreamWithHandlers(ctx)       // ticks + trade events via callbacks
 	}
 
 	// --- 🧾 improved story streams (pages/chunks) ---
@@ -2,26 +2,23 @@ package mt4
 
 import (
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"math/rand"
+	"sync/atomic"
 	"time"
 
 	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
 
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// Retry/backoff settings.
+// Default retry/backoff settings (see DefaultRetryPolicy).
 const (
 	backoffBase = 300 * time.Millisecond // initial backoff
 	backoffMax  = 5 * time.Second        // cap for backoff
@@ -46,18 +43,6 @@ func waitWithCtx(ctx context.Context, d time.Duration) error {
 	}
 }
 
-// backoffDelay returns exponential backoff with jitter, capped.
-func backoffDelay(attempt int) time.Duration {
-	// exponential: base << attempt
-	d := backoffBase << attempt
-	if d > backoffMax {
-		d = backoffMax
-	}
-	// jitter in [-jitterRange, +jitterRange]
-	j := time.Duration(rand.Int63n(int64(jitterRange*2))) - jitterRange
-	return d + j
-}
-
 // MT4Account represents a client session for interacting with the MT4 terminal API over gRPC.
 type MT4Account struct {
 
@@ -67,122 +52,214 @@ type MT4Account struct {
 	// Password for the user account.
 	Password string
 
-	// Host is the IP/domain of the MT4 server.
-	Host string
-
-	// Port is the MT4 server port (typically 443).
-	Port int
-
-	// ServerName is the MT4 server name (used for cluster connections).
-	ServerName string
-
-	// BaseChartSymbol is the default chart symbol (e.g., "EURUSD").
-	BaseChartSymbol string
-
-	// ConnectTimeout is the timeout for connection readiness, in seconds.
-	ConnectTimeout int
-
 	// GrpcServer is the address (host:port) of the gRPC API endpoint.
 	GrpcServer string
 
-	// GrpcConn is the underlying gRPC client connection (must be closed when done).
+	// GrpcConn is the underlying gRPC client connection (closed by Disconnect unless shared via WithClientConn).
 	GrpcConn *grpc.ClientConn
 
-	// Per-service gRPC API clients.
+	// Per-service gRPC API clients (set by NewMT4Account, never reassigned).
 	ConnectionClient   pb.ConnectionClient
 	SubscriptionClient pb.SubscriptionServiceClient
 	AccountClient      pb.AccountHelperClient
 	TradeClient        pb.TradingHelperClient
 	MarketInfoClient   pb.MarketInfoClient
 	AccountHelper      pb.AccountHelperClient
-	// Id is a unique identifier (UUID) for this account session/instance.
-	Id uuid.UUID
+
+	// RetryPolicy overrides DefaultRetryPolicy for this account (nil = defaults).
+	// Can be overridden per call via ContextWithRetryPolicy.
+	RetryPolicy *RetryPolicy
+
+	// TickStallPolicy is the default watchdog of OnSymbolTick streams (nil = none).
+	// Can be overridden per stream via ContextWithStallPolicy.
+	TickStallPolicy *StallPolicy
+
+	// DeliveryPolicy is the default delivery of stream messages (nil = unbuffered, blocking).
+	// Can be overridden per stream via ContextWithDeliveryPolicy.
+	DeliveryPolicy *DeliveryPolicy
+
+	// TradeValidation enables the pre-trade checks of OrderSend / OrderModify (nil = off).
+	// Can be overridden per call via ContextWithValidationPolicy.
+	TradeValidation *ValidationPolicy
+
+	// Timeouts are the per-call deadlines used when the caller's context has none
+	// (zero fields = DefaultTimeouts).
+	Timeouts Timeouts
+
+	// Logger receives retry/reconnect diagnostics (nil = silent).
+	Logger Logger
+
+	// DisableAutoReestablish turns off reconnecting with the remembered Connect parameters
+	// when the terminal instance is lost (TERMINAL_INSTANCE_NOT_FOUND); calls then just retry.
+	DisableAutoReestablish bool
+
+	// BrokerCache remembers the server found by ConnectByBroker for later runs (nil = no cache).
+	BrokerCache BrokerCache
+
+	// sharedConn is set for accounts created with WithClientConn: Disconnect leaves GrpcConn open.
+	sharedConn bool
+
+	// connectSlots is the AccountPool-wide connect limit (nil outside a pool).
+	connectSlots chan struct{}
+
+	// orderCache serves OrderSelect / OrdersTotal while attached (see NewOrderCache).
+	orderCache atomic.Pointer[OrderCache]
+
+	// riskGuard enforces account risk limits on order calls while attached (see NewRiskGuard).
+	riskGuard atomic.Pointer[RiskGuard]
+
+	// tickHub is the shared hub returned by TickHub (started on first use).
+	tickHub atomic.Pointer[TickHub]
+
+	// symbolSpecs caches SymbolParams for the pre-trade checks.
+	symbolSpecs symbolParamsCache
+
+	// sess holds the terminal session and lifecycle state (see Session, State, StateChanges).
+	sess sessionHolder
 }
 
-// NewMT4Account initializes a new MT4Account and establishes the underlying gRPC connection.
-// Returns a pointer to the account object and any error encountered while connecting.
-func NewMT4Account(user uint64, password string, grpcServer string, id uuid.UUID) (*MT4Account, error) {
-	// If no endpoint specified, use production default
-	if grpcServer == "" {
-		grpcServer = "mt4.mrpc.pro:443"
+// NewMT4Account initializes a new MT4Account and creates the underlying gRPC client connection.
+// The connection is established lazily, on the first call (see grpc.NewClient).
+//
+// Parameters:
+//   - user: MT4 account login number.
+//   - password: Account password.
+//   - opts: Optional settings (WithEndpoint, WithTLSConfig, WithInsecure, WithKeepalive,
+//     WithDialOptions, WithDefaultTimeouts, WithRetryPolicy, WithLogger, ...).
+//
+// Returns:
+//   - Pointer to the account object (not yet connected to a terminal; call ConnectByServerName or ConnectByHostPort).
+//   - Error if the gRPC client cannot be created (e.g. invalid target).
+//
+// Example:
+//
+//	account, err := mt4.NewMT4Account(login, password,
+//	    mt4.WithKeepalive(keepalive.ClientParameters{Time: 30 * time.Second}),
+//	    mt4.WithDefaultTimeouts(mt4.Timeouts{Trade: 10 * time.Second}),
+//	)
+func NewMT4Account(user uint64, password string, opts ...Option) (*MT4Account, error) {
+	o := accountOptions{endpoint: DefaultEndpoint}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
 	}
 
-	config := &tls.Config{
-		InsecureSkipVerify: false,
-	}
-	conn, err := grpc.Dial(grpcServer, grpc.WithTransportCredentials(credentials.NewTLS(config)))
-	if err != nil {
-		return nil, err
+	conn := o.conn
+	if conn != nil {
+		o.endpoint = conn.Target()
+	} else {
+		var err error
+		if conn, err = grpc.NewClient(o.endpoint, o.grpcDialOptions()...); err != nil {
+			return nil, err
+		}
 	}
 
 	// Instantiate API service clients using the shared gRPC connection
-	return &MT4Account{
+	account := &MT4Account{
 		User:               user,
 		Password:           password,
-		GrpcServer:         grpcServer,
+		GrpcServer:         o.endpoint,
 		GrpcConn:           conn,
 		ConnectionClient:   pb.NewConnectionClient(conn),
 		SubscriptionClient: pb.NewSubscriptionServiceClient(conn),
 		AccountClient:      pb.NewAccountHelperClient(conn),
 		TradeClient:        pb.NewTradingHelperClient(conn),
 		MarketInfoClient:   pb.NewMarketInfoClient(conn),
-		Id:                 id,
-		Port:               443,
-		ConnectTimeout:     30,
-	}, nil
+		RetryPolicy:        o.retryPolicy,
+		DeliveryPolicy:     o.delivery,
+		TickStallPolicy:    o.tickStall,
+		TradeValidation:    o.validation,
+		Timeouts:           o.timeouts,
+		Logger:             o.logger,
+
+		DisableAutoReestablish: o.noReestablish,
+		BrokerCache:            o.brokerCache,
+
+		sharedConn: o.conn != nil,
+	}
+
+	// A preset session id attaches to an already running terminal instance.
+	if o.id != uuid.Nil {
+		account.sess.session = Session{Id: o.id, Port: 443, ConnectTimeout: 30}
+		account.sess.state = StateConnected
+	}
+	return account, nil
 }
 
-// isConnected returns true if this account is associated with any host or server name.
+// NewMT4AccountWithEndpoint is the previous NewMT4Account signature (TLS with system roots).
+// An empty grpcServer selects DefaultEndpoint.
+//
+// Deprecated: use NewMT4Account(user, password, WithEndpoint(grpcServer), WithSessionID(id)).
+func NewMT4AccountWithEndpoint(user uint64, password string, grpcServer string, id uuid.UUID) (*MT4Account, error) {
+	return NewMT4Account(user, password, WithEndpoint(grpcServer), WithSessionID(id))
+}
+
+// isConnected returns true if this account has a terminal session and is not closed.
 func (a *MT4Account) isConnected() bool {
-	if a == nil {
+	if a == nil || a.GrpcConn == nil {
 		return false
 	}
-	return a.GrpcConn != nil && a.Id != uuid.Nil
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.state != StateClosed && a.sess.session.Id != uuid.Nil
 }
 
+func (a *MT4Account) ensureConnectionClient() error {
+	if a.ConnectionClient == nil {
+		return ErrNotConnected
+	}
+	return nil
+}
 func (a *MT4Account) ensureSubscriptionClient() error {
 	if a.SubscriptionClient == nil {
-		return errors.New("not connected")
+		return ErrNotConnected
 	}
 	return nil
 }
 func (a *MT4Account) ensureAccountClient() error {
 	if a.AccountClient == nil {
-		return errors.New("not connected")
+		return ErrNotConnected
 	}
 	return nil
 }
 func (a *MT4Account) ensureTradeClient() error {
 	if a.TradeClient == nil {
-		return errors.New("not connected")
+		return ErrNotConnected
 	}
 	return nil
 }
 func (a *MT4Account) ensureMarketInfoClient() error {
 	if a.MarketInfoClient == nil {
-		return errors.New("not connected")
+		return ErrNotConnected
 	}
 	return nil
 }
 
 // getHeaders builds the gRPC metadata headers (adds "id" if present).
 func (a *MT4Account) getHeaders() metadata.MD {
-	if a.Id == uuid.Nil {
+	return headersFor(a.sessionID())
+}
+
+// headersFor builds the gRPC metadata headers for session id (nil for uuid.Nil).
+func headersFor(id uuid.UUID) metadata.MD {
+	if id == uuid.Nil {
 		return nil
 	}
-	return metadata.Pairs("id", a.Id.String())
+	return metadata.Pairs("id", id.String())
 }
 
-// wrapAPIError converts pb.Error into a Go error with code + message.
+// wrapAPIError converts pb.Error into *APIError (returned as error; nil stays nil).
 func wrapAPIError(apiErr *pb.Error) error {
 	if apiErr == nil {
 		return nil
 	}
-	return fmt.Errorf("API error (code=%s): %s", apiErr.GetErrorCode(), apiErr.GetErrorMessage())
+	return NewAPIError(apiErr)
 }
 
 // ConnectByHostPort connects to the MT4 terminal using a host/port pair.
-// Updates the session state fields (Host, Port, etc.) upon success.
+// Updates the session (see Session) upon success; the parameters are remembered
+// so a lost terminal instance can be re-established automatically.
 func (a *MT4Account) ConnectByHostPort(
 	ctx context.Context,
 	host string,
@@ -196,55 +273,18 @@ func (a *MT4Account) ConnectByHostPort(
 		ctx = context.Background()
 	}
 
-	// Build request
-	req := &pb.ConnectRequest{
-		User:                                   a.User,
-		Password:                               a.Password,
-		Host:                                   host,
-		Port:                                   int32(port),
-		BaseChartSymbol:                        proto.String(baseChartSymbol),
-		WaitForTerminalIsAlive:                 proto.Bool(waitForTerminalIsAlive),
-		TerminalReadinessWaitingTimeoutSeconds: proto.Int32(int32(timeoutSeconds)),
-	}
-
-	// Call
-	md := a.getHeaders()
-	ctx = metadata.NewOutgoingContext(ctx, md)
-
-	res, err := a.ConnectionClient.Connect(ctx, req)
-	if err != nil {
-		return err
-	}
-	if err := wrapAPIError(res.GetError()); err != nil {
-		return err
-	}
-
-	// Store session props first (needed for isConnected & headers on health-check)
-	a.Host = host
-	a.Port = port
-	a.BaseChartSymbol = baseChartSymbol
-	a.ConnectTimeout = timeoutSeconds
-
-	if data := res.GetData(); data != nil && data.GetTerminalInstanceGuid() != "" {
-		if id, parseErr := uuid.Parse(data.GetTerminalInstanceGuid()); parseErr == nil {
-			a.Id = id
-		}
-	}
-
-	// --- Health-check: ensure terminal is really ready
-	{
-		hctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-		defer cancel()
-		if _, err := a.AccountSummary(hctx); err != nil {
-			_ = a.Disconnect()
-			return fmt.Errorf("health-check (AccountSummary) failed after ConnectByHostPort: %w", err)
-		}
-	}
-
-	return nil
+	return a.connect(ctx, Session{
+		Host:                   host,
+		Port:                   port,
+		BaseChartSymbol:        baseChartSymbol,
+		WaitForTerminalIsAlive: waitForTerminalIsAlive,
+		ConnectTimeout:         timeoutSeconds,
+	}, "ConnectByHostPort")
 }
 
 // ConnectByServerName connects to the MT4 terminal using the cluster/server name.
+// Updates the session (see Session) upon success; the parameters are remembered
+// so a lost terminal instance can be re-established automatically.
 func (a *MT4Account) ConnectByServerName(
 	ctx context.Context,
 	serverName string,
@@ -257,49 +297,162 @@ func (a *MT4Account) ConnectByServerName(
 		ctx = context.Background()
 	}
 
-	req := &pb.ConnectExRequest{
-		User:                                   a.User,
-		Password:                               a.Password,
-		MtClusterName:                          serverName,
-		BaseChartSymbol:                        proto.String(baseChartSymbol),
-		TerminalReadinessWaitingTimeoutSeconds: proto.Int32(int32(timeoutSeconds)),
-	}
+	return a.connect(ctx, Session{
+		ServerName:             serverName,
+		BaseChartSymbol:        baseChartSymbol,
+		WaitForTerminalIsAlive: waitForTerminalIsAlive,
+		ConnectTimeout:         timeoutSeconds,
+	}, "ConnectByServerName")
+}
 
-	md := a.getHeaders()
-	ctx = metadata.NewOutgoingContext(ctx, md)
+// connect opens a terminal session described by params, stores it and health-checks it.
+// method names the public entry point in error messages.
+func (a *MT4Account) connect(ctx context.Context, params Session, method string) error {
+	return a.connectWith(ctx, params, method, a.openSession)
+}
+
+// sessionOpener issues the connect RPC for params and returns the resulting session.
+type sessionOpener func(ctx context.Context, params Session, md metadata.MD) (Session, error)
+
+// connectWith is connect with a custom connect RPC (see ConnectWithProgress).
+func (a *MT4Account) connectWith(ctx context.Context, params Session, method string, open sessionOpener) error {
+	// One connect at a time; enter StateConnecting.
+	a.sess.connectMu.Lock()
+	defer a.sess.connectMu.Unlock()
+	release, err := a.acquireConnectSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	prev, err := a.beginConnect()
+	if err != nil {
+		return err
+	}
 
-	res, err := a.ConnectionClient.ConnectEx(ctx, req)
+	sess, err := open(ctx, params, a.getHeaders())
 	if err != nil {
+		a.abortConnect(prev, err)
 		return err
 	}
-	if err := wrapAPIError(res.GetError()); err != nil {
+
+	// Store session props first (needed for isConnected & headers on health-check)
+	a.storeSession(sess)
+
+	if err := a.healthCheck(ctx, method); err != nil {
+		a.failConnect(err)
 		return err
 	}
 
-	a.ServerName = serverName
-	a.BaseChartSymbol = baseChartSymbol
-	a.ConnectTimeout = timeoutSeconds
+	a.setState(StateConnected, nil)
+	return nil
+}
+
+// openSession calls Connect, ConnectProxy (params.Proxy set) or ConnectEx (params.ServerName set)
+// and returns the resulting session.
+// If the server does not report a terminal instance id, the current session id is kept.
+func (a *MT4Account) openSession(ctx context.Context, params Session, md metadata.MD) (Session, error) {
+	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	if data := res.GetData(); data != nil && data.GetTerminalInstanceGuid() != "" {
-		if id, parseErr := uuid.Parse(data.GetTerminalInstanceGuid()); parseErr == nil {
-			a.Id = id
+	var guid string
+	switch {
+	case params.ServerName != "":
+		res, err := a.ConnectionClient.ConnectEx(ctx, a.connectExRequest(params))
+		if err == nil {
+			err = wrapAPIError(res.GetError())
 		}
+		if err != nil {
+			return Session{}, err
+		}
+		guid = res.GetData().GetTerminalInstanceGuid()
+	case params.Proxy.Host != "":
+		res, err := a.ConnectionClient.ConnectProxy(ctx, a.connectProxyRequest(params))
+		if err == nil {
+			err = wrapAPIError(res.GetError())
+		}
+		if err != nil {
+			return Session{}, err
+		}
+		guid = res.GetData().GetUniqueIdentifier()
+	default:
+		res, err := a.ConnectionClient.Connect(ctx, a.connectRequest(params))
+		if err == nil {
+			err = wrapAPIError(res.GetError())
+		}
+		if err != nil {
+			return Session{}, err
+		}
+		guid = res.GetData().GetTerminalInstanceGuid()
 	}
 
-	// --- Health-check: ensure terminal is really ready
-	{
-		hctx, cancel := context.WithTimeout(ctx, 3*time.Second)
-		defer cancel()
-		if _, err := a.AccountSummary(hctx); err != nil {
-			_ = a.Disconnect()
-			return fmt.Errorf("health-check (AccountSummary) failed after ConnectByServerName: %w", err)
+	return a.newSession(params, guid), nil
+}
+
+// newSession returns params as a session established now with terminal instance guid
+// (the current session id is kept if guid is empty or invalid).
+func (a *MT4Account) newSession(params Session, guid string) Session {
+	sess := params
+	sess.Id = a.sessionID()
+	sess.ConnectedAt = time.Now()
+	if guid != "" {
+		if id, parseErr := uuid.Parse(guid); parseErr == nil {
+			sess.Id = id
 		}
 	}
+	return sess
+}
+
+// connectRequest builds the Connect / ConnectStream request for params.
+func (a *MT4Account) connectRequest(params Session) *pb.ConnectRequest {
+	return &pb.ConnectRequest{
+		User:                                   a.User,
+		Password:                               a.Password,
+		Host:                                   params.Host,
+		Port:                                   int32(params.Port),
+		BaseChartSymbol:                        proto.String(params.BaseChartSymbol),
+		WaitForTerminalIsAlive:                 proto.Bool(params.WaitForTerminalIsAlive),
+		TerminalReadinessWaitingTimeoutSeconds: proto.Int32(int32(params.ConnectTimeout)),
+	}
+}
+
+// connectExRequest builds the ConnectEx / ConnectExStream request for params.
+func (a *MT4Account) connectExRequest(params Session) *pb.ConnectExRequest {
+	return &pb.ConnectExRequest{
+		User:                                   a.User,
+		Password:                               a.Password,
+		MtClusterName:                          params.ServerName,
+		BaseChartSymbol:                        proto.String(params.BaseChartSymbol),
+		TerminalReadinessWaitingTimeoutSeconds: proto.Int32(int32(params.ConnectTimeout)),
+	}
+}
+
+// connectProxyRequest builds the ConnectProxy request for params.
+func (a *MT4Account) connectProxyRequest(params Session) *pb.ConnectProxyRequest {
+	return &pb.ConnectProxyRequest{
+		User:          a.User,
+		Password:      a.Password,
+		Host:          params.Host,
+		Port:          int32(params.Port),
+		ProxyType:     params.Proxy.Type,
+		ProxyHost:     params.Proxy.Host,
+		ProxyPort:     uint32(params.Proxy.Port),
+		ProxyUser:     params.Proxy.User,
+		ProxyPassword: params.Proxy.Password,
+	}
+}
 
+// healthCheck ensures the terminal is really ready (AccountSummary with Timeouts.HealthCheck).
+// It never triggers session re-establishment itself.
+func (a *MT4Account) healthCheck(ctx context.Context, method string) error {
+	hctx, cancel := context.WithTimeout(withoutReestablish(ctx), a.timeouts().HealthCheck)
+	defer cancel()
+	if _, err := a.AccountSummary(hctx); err != nil {
+		return fmt.Errorf("health-check (AccountSummary) failed after %s: %w", method, err)
+	}
 	return nil
 }
 
 // ExecuteWithReconnect retries a gRPC call on recoverable errors (network/instance-not-found).
+// Retries follow the account RetryPolicy for OperationRead (see ContextWithRetryPolicy for per-call overrides).
 //
 // T:          Type of the response object (e.g., *pb.AccountSummaryReply)
 // a:          Pointer to MT4Account (used for headers, etc.)
@@ -313,23 +466,73 @@ func ExecuteWithReconnect[T any](
 	ctx context.Context,
 	grpcCall func(metadata.MD) (T, error),
 	errorSelector func(T) *pb.Error,
+) (T, error) {
+	return executeWithReconnect(a, ctx, OperationRead, grpcCall, errorSelector, nil)
+}
+
+// executeWithReconnect is the retry loop behind ExecuteWithReconnect.
+// kind selects the per-operation part of the retry policy.
+//
+// beforeRetry (optional) runs before every retry that follows a recoverable failure,
+// i.e. when the previous attempt may or may not have reached the terminal.
+// It returns done=true together with a result when the operation is known to have
+// been executed already, in which case that result is returned instead of re-sending.
+// If beforeRetry itself fails, nothing is re-sent: the loop backs off and reconciles again.
+func executeWithReconnect[T any](
+	a *MT4Account,
+	ctx context.Context,
+	kind OperationKind,
+	grpcCall func(metadata.MD) (T, error),
+	errorSelector func(T) *pb.Error,
+	beforeRetry func(context.Context) (T, bool, error),
 ) (T, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
+	policy := a.retryPolicyFor(ctx, kind)
+	maxAttempts := policy.attempts()
+	internal := reestablishDisabled(ctx) // health-check: leave the session state alone
+
 	var zeroT T
 	var lastErr error
+	pending := false // previous attempt failed in an ambiguous way
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		// Reconcile before re-sending a call that might already have been executed.
+		if pending && beforeRetry != nil {
+			res, done, err := beforeRetry(ctx)
+			if err != nil {
+				lastErr = fmt.Errorf("reconcile before retry: %w", err)
+				a.logf("mt4: %s call: %v (attempt %d/%d)", kind, lastErr, attempt+1, maxAttempts)
+				if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
+					return zeroT, werr
+				}
+				continue
+			}
+			if done {
+				return res, nil
+			}
+		}
+		pending = false
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		headers := a.getHeaders()
+		sessionID := a.sessionID()
+		headers := headersFor(sessionID)
 
 		res, err := grpcCall(headers)
 		if err != nil {
 			// Transient transport error? Retry with backoff.
-			if s, ok := status.FromError(err); ok && s.Code() == codes.Unavailable {
+			if policy.retryableTransport(err) {
 				lastErr = err
-				if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+				pending = true
+				if !internal {
+					a.markReconnecting(err)
+				}
+				if attempt+1 >= maxAttempts {
+					break
+				}
+				a.logf("mt4: %s call: %v (attempt %d/%d)", kind, err, attempt+1, maxAttempts)
+				if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 					return zeroT, werr // context canceled/deadline
 				}
 				continue
@@ -340,11 +543,22 @@ func ExecuteWithReconnect[T any](
 
 		// API-level error handling (non-transport)
 		if apiErr := errorSelector(res); apiErr != nil {
-			code := apiErr.GetErrorCode()
-			// Treat missing terminal as transient, allow reconnects.
-			if code == "TERMINAL_INSTANCE_NOT_FOUND" || code == "TERMINAL_REGISTRY_TERMINAL_NOT_FOUND" {
-				lastErr = fmt.Errorf("api error %s: %s", apiErr.GetErrorCode(), apiErr.GetErrorMessage())
-				if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+			// Missing terminal / busy server etc. are retried according to the policy.
+			if retry, ambiguous := policy.retryableAPI(apiErr); retry {
+				lastErr = wrapAPIError(apiErr)
+				pending = ambiguous
+				if ambiguous && !internal {
+					a.markReconnecting(lastErr) // terminal instance lost
+				}
+				if attempt+1 >= maxAttempts {
+					break
+				}
+				// Lost terminal instance: get a new one and retry at once.
+				if a.tryReestablish(ctx, sessionID, lastErr) {
+					continue
+				}
+				a.logf("mt4: %s call: %v (attempt %d/%d)", kind, lastErr, attempt+1, maxAttempts)
+				if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 					return zeroT, werr
 				}
 				continue
@@ -355,11 +569,17 @@ func ExecuteWithReconnect[T any](
 		}
 
 		// Success
+		if !internal {
+			a.markConnected()
+		}
 		return res, nil
 	}
 
 	if lastErr == nil {
-		lastErr = fmt.Errorf("unknown error after %d retries", maxRetries)
+		lastErr = fmt.Errorf("unknown error after %d attempts", maxAttempts)
+	}
+	if maxAttempts == 1 {
+		return zeroT, lastErr
 	}
 	return zeroT, fmt.Errorf("exceeded retries: %w", lastErr)
 }
@@ -385,13 +605,13 @@ func (a *MT4Account) AccountSummary(ctx context.Context) (*pb.AccountSummaryData
 	// If caller didn't set a deadline, add a short per-call timeout to avoid hanging RPCs.
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read)
 		defer cancel()
 	}
 
 	// 2) Ensure the account is connected to a server before making a request.
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -497,6 +717,9 @@ func (a *MT4Account) AccountCurrency(ctx context.Context) (string, error) {
 
 // ExecuteStreamWithReconnect wraps a gRPC server-streaming call with automatic reconnection
 // on network and recoverable API errors, sending extracted data to a channel.
+// Retries follow the account RetryPolicy for OperationStream; delivery to dataCh follows the
+// DeliveryPolicy of ctx / the account (default: unbuffered, blocking); a StallPolicy in ctx
+// re-opens the stream when it stays silent.
 // - ctx: Context for cancellation and deadline
 // - a:   Your session/account struct (for session headers etc.)
 // - request: The protobuf request message
@@ -520,7 +743,11 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 		ctx = context.Background()
 	}
 
-	dataCh := make(chan TData)
+	policy := a.retryPolicyFor(ctx, OperationStream)
+	maxAttempts := policy.attempts()
+
+	// dataCh is buffered / conflated according to the stream's DeliveryPolicy
+	out := newDeliverer[TData](ctx, a.deliveryPolicyFor(ctx))
 	errCh := make(chan error, 1)
 
 	go func() {
@@ -531,22 +758,35 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 				default:
 				}
 			}
-			close(dataCh)
+			out.close()
 			close(errCh)
 		}()
 
 		attempt := 0
 
+		// Stall watchdog (see StallPolicy): each attempt runs on its own cancelable context.
+		stallPolicy, _ := StallPolicyFromContext(ctx)
+		stalls := 0 // consecutive stalls without a message in between
+		stopStream := func() {}
+		defer func() { stopStream() }()
+
 		for {
-			headers := a.getHeaders()
+			sessionID := a.sessionID()
+			headers := headersFor(sessionID)
+
+			stopStream()
+			streamCtx, cancelStream := context.WithCancel(ctx)
+			stopStream = cancelStream
 
 			// Try to open stream with retries
 			var stream grpc.ClientStream
-			for ; attempt < maxRetries; attempt++ {
-				s, err := streamInvoker(request, headers, ctx)
+			for ; attempt < maxAttempts; attempt++ {
+				s, err := streamInvoker(request, headers, streamCtx)
 				if err != nil {
-					if st, ok := status.FromError(err); ok && st.Code() == codes.Unavailable {
-						if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+					if policy.retryableTransport(err) {
+						a.markReconnecting(err)
+						a.logf("mt4: open stream: %v (attempt %d/%d)", err, attempt+1, maxAttempts)
+						if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 							errCh <- werr
 							return
 						}
@@ -566,30 +806,56 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 
 			attempt = 0 // reset on success
 
+			watchdog := startStallWatchdog(stallPolicy, cancelStream)
+			stopStream = func() {
+				watchdog.stop()
+				cancelStream()
+			}
+
 			// Receive loop
 			for {
 				reply := newReply()
 				recvErr := stream.RecvMsg(reply)
 				if recvErr != nil {
-					if st, ok := status.FromError(recvErr); ok && st.Code() == codes.Unavailable {
+					// Silent stream cancelled by the watchdog: re-open at once.
+					if watchdog.fired() && ctx.Err() == nil {
+						stalls++
+						stall := StreamStall{Stream: streamName(request), Silence: watchdog.silence(), Attempt: stalls, Time: time.Now()}
+						// Local to this stream: the session and the other streams may be fine.
+						a.publishStall(stall)
+						if stalls >= maxAttempts {
+							errCh <- fmt.Errorf("stream silent %v, %d stalls in a row: %w", stall.Silence.Round(time.Millisecond), stalls, ErrStreamStalled)
+							return
+						}
+						a.logf("mt4: stream silent for %v, resubscribing (stall %d/%d)", stall.Silence.Round(time.Millisecond), stalls, maxAttempts)
+						if stallPolicy.OnStall != nil {
+							stallPolicy.OnStall(stall)
+						}
+						break // reconnect
+					}
+					if policy.retryableTransport(recvErr) {
+						a.markReconnecting(recvErr)
 						attempt++
-						if attempt >= maxRetries {
+						if attempt >= maxAttempts {
 							errCh <- fmt.Errorf("exceeded retries after stream recv: %w", recvErr)
 							return
 						}
-						if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+						a.logf("mt4: stream recv: %v, reconnecting (attempt %d/%d)", recvErr, attempt, maxAttempts)
+						if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 							errCh <- werr
 							return
 						}
 						break // reconnect
 					}
 					if errors.Is(recvErr, io.EOF) {
+						a.markReconnecting(recvErr)
 						attempt++
-						if attempt >= maxRetries {
+						if attempt >= maxAttempts {
 							errCh <- fmt.Errorf("exceeded retries after EOF")
 							return
 						}
-						if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+						a.logf("mt4: stream closed by server, reconnecting (attempt %d/%d)", attempt, maxAttempts)
+						if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 							errCh <- werr
 							return
 						}
@@ -605,15 +871,21 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 
 				// API-level error
 				if apiErr := getError(reply); apiErr != nil {
-					code := apiErr.GetErrorCode()
-					if code == "TERMINAL_INSTANCE_NOT_FOUND" || code == "TERMINAL_REGISTRY_TERMINAL_NOT_FOUND" {
+					if retry, ambiguous := policy.retryableAPI(apiErr); retry {
+						if ambiguous {
+							a.markReconnecting(wrapAPIError(apiErr)) // terminal instance lost
+						}
 						attempt++
-						if attempt >= maxRetries {
-							errCh <- fmt.Errorf("exceeded retries after api error %s: %s",
-								apiErr.GetErrorCode(), apiErr.GetErrorMessage())
+						if attempt >= maxAttempts {
+							errCh <- fmt.Errorf("exceeded retries after api error: %w", wrapAPIError(apiErr))
 							return
 						}
-						if werr := waitWithCtx(ctx, backoffDelay(attempt)); werr != nil {
+						// Lost terminal instance: get a new one and re-open at once.
+						if a.tryReestablish(ctx, sessionID, wrapAPIError(apiErr)) {
+							break // reconnect
+						}
+						a.logf("mt4: stream api error: %v, reconnecting (attempt %d/%d)", wrapAPIError(apiErr), attempt, maxAttempts)
+						if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
 							errCh <- werr
 							return
 						}
@@ -624,11 +896,12 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 				}
 
 				// Forward data
+				watchdog.kick()
+				stalls = 0
+				a.markConnected()
 				if data, ok := getData(reply); ok {
-					select {
-					case dataCh <- data:
-					case <-ctx.Done():
-						errCh <- ctx.Err()
+					if err := out.send(ctx, data); err != nil {
+						errCh <- err
 						return
 					}
 				}
@@ -636,7 +909,7 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 		}
 	}()
 
-	return dataCh, errCh
+	return out.ch, errCh
 }
 
 //=== 📂 Order Operations ===
@@ -663,6 +936,10 @@ func ExecuteStreamWithReconnect[TRequest any, TReply any, TData any](
 // The method wraps the gRPC call to the TradeClient.OrderSend method, preparing all optional fields if provided.
 // It uses ExecuteWithReconnect to automatically retry on transient network or session errors,
 // and checks for application-level errors returned by the terminal via the response.Error field.
+// With TradeValidation (or ContextWithValidationPolicy) the request is checked against the symbol
+// specification first and refused with a *ValidationError (see ValidateOrderSend).
+// With an attached RiskGuard the order is then checked against its limits and refused with a
+// *RiskError (ErrRiskLimit, ErrKillSwitch).
 func (a *MT4Account) OrderSend(
 	ctx context.Context,
 	symbol string,
@@ -680,20 +957,39 @@ func (a *MT4Account) OrderSend(
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if _, ok := ctx.Deadline(); !ok {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 5*time.Second) // trades usually tolerate a slightly longer timeout
-		defer cancel()
-	}
 
 	// Ensure connection before making the call.
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureTradeClient(); err != nil {
 		return nil, err
 	}
 
+	// Pre-trade checks (see ValidationPolicy) run under the read deadline; the normalized values are sent.
+	checkCtx, cancelChecks := a.withReadTimeout(ctx)
+	defer cancelChecks()
+	if policy, ok := a.validationPolicyFor(checkCtx); ok {
+		chk, err := a.validateOrderSend(checkCtx, policy, symbol, operationType, volume, price, stoploss, takeprofit)
+		if err != nil {
+			return nil, err
+		}
+		volume, price, stoploss, takeprofit = chk.Volume, chk.Price, chk.StopLoss, chk.TakeProfit
+	}
+
+	// Account risk limits and kill switch (see NewRiskGuard).
+	if err := a.riskCheckSend(checkCtx, symbol, operationType, volume, price); err != nil {
+		return nil, err
+	}
+	cancelChecks()
+
+	// The trade deadline covers the order itself, not the checks before it.
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // trades usually tolerate a slightly longer timeout
+		defer cancel()
+	}
+
 	// Build request with optional fields preserved as pointers.
 	req := &pb.OrderSendRequest{
 		Symbol:        symbol,
@@ -733,8 +1029,8 @@ func (a *MT4Account) OrderSend(
 		return reply.GetError()
 	}
 
-	// Execute with reconnect/retry semantics.
-	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	// Execute with reconnect/retry semantics (trade part of the retry policy).
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -770,12 +1066,12 @@ func (a *MT4Account) OrderClose(
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 5*time.Second) // closing trades may take a bit longer
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // closing trades may take a bit longer
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureTradeClient(); err != nil {
 		return nil, err
@@ -803,7 +1099,7 @@ func (a *MT4Account) OrderClose(
 		return reply.GetError()
 	}
 
-	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -845,18 +1141,26 @@ func (a *MT4Account) OrderDelete(ctx context.Context, ticket int32) (*pb.OrderCl
 // Note:
 //   - This method does not query closed or pending orders — only currently opened ones.
 //   - Matching is done locally by comparing tickets from the retrieved list.
+//   - With an attached OrderCache (NewOrderCache), known tickets are answered from memory.
 
 func (a *MT4Account) OrderSelect(ctx context.Context, ticket int32) (*pb.OpenedOrderInfo, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
 	}
 
+	// Served locally when an OrderCache is attached; unknown tickets may just not be streamed yet.
+	if c := a.orderCache.Load(); c != nil && c.running() {
+		if order, ok := c.OrderSelect(ticket); ok {
+			return order, nil
+		}
+	}
+
 	orders, err := a.OpenedOrders(ctx)
 	if err != nil {
 		return nil, err
@@ -903,12 +1207,12 @@ func (a *MT4Account) OrderCloseBy(
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 5*time.Second) // close-by may take a bit longer
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // close-by may take a bit longer
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureTradeClient(); err != nil {
 		return nil, err
@@ -927,7 +1231,7 @@ func (a *MT4Account) OrderCloseBy(
 		return reply.GetError()
 	}
 
-	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -949,6 +1253,7 @@ func (a *MT4Account) OrderCloseBy(
 // Note:
 //   - This is a runtime query and reflects the current state of the trading account.
 //   - If the connection to the terminal is not established, an error is returned immediately.
+//   - With an attached OrderCache (NewOrderCache), the count is answered from memory.
 
 // OrdersTotal returns the total number of currently opened orders.
 func (a *MT4Account) OrdersTotal(ctx context.Context) (int32, error) {
@@ -958,12 +1263,16 @@ func (a *MT4Account) OrdersTotal(ctx context.Context) (int32, error) {
 	}
 
 	if !a.isConnected() {
-		return 0, errors.New("not connected")
+		return 0, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return 0, err
 	}
 
+	if c := a.orderCache.Load(); c != nil && c.running() {
+		return int32(c.OrdersTotal()), nil
+	}
+
 	orders, err := a.OpenedOrders(ctx)
 	if err != nil {
 		return 0, err
@@ -1000,6 +1309,9 @@ func (a *MT4Account) OrdersTotal(ctx context.Context) (int32, error) {
 // Note:
 //   - Only pending orders can have price or expiration modified.
 //   - The order must still be valid (not closed or already filled).
+//   - With TradeValidation (or ContextWithValidationPolicy) the request is checked first,
+//     including the freeze level (see ValidateOrderModify).
+//   - With an attached RiskGuard, its trading hours and order rate apply (*RiskError).
 func (a *MT4Account) OrderModify(
 	ctx context.Context,
 	ticket int32,
@@ -1010,19 +1322,38 @@ func (a *MT4Account) OrderModify(
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if _, ok := ctx.Deadline(); !ok {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 5*time.Second) // order modify can take slightly longer
-		defer cancel()
-	}
 
 	if !a.isConnected() {
-		return false, errors.New("not connected")
+		return false, ErrNotConnected
 	}
 	if err := a.ensureTradeClient(); err != nil {
 		return false, err
 	}
 
+	// Pre-trade checks (see ValidationPolicy) run under the read deadline; the normalized values are sent.
+	checkCtx, cancelChecks := a.withReadTimeout(ctx)
+	defer cancelChecks()
+	if policy, ok := a.validationPolicyFor(checkCtx); ok {
+		chk, err := a.validateOrderModify(checkCtx, policy, ticket, price, stoploss, takeprofit)
+		if err != nil {
+			return false, err
+		}
+		price, stoploss, takeprofit = chk.Price, chk.StopLoss, chk.TakeProfit
+	}
+
+	// Account risk limits (see NewRiskGuard).
+	if err := a.riskCheckModify(); err != nil {
+		return false, err
+	}
+	cancelChecks()
+
+	// The trade deadline covers the order itself, not the checks before it.
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // order modify can take slightly longer
+		defer cancel()
+	}
+
 	req := &pb.OrderModifyRequest{
 		OrderTicket: ticket,
 	}
@@ -1049,7 +1380,7 @@ func (a *MT4Account) OrderModify(
 		return reply.GetError()
 	}
 
-	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, nil)
 	if err != nil {
 		return false, err
 	}
@@ -1077,13 +1408,13 @@ func (a *MT4Account) OpenedOrders(ctx context.Context) (*pb.OpenedOrdersData, er
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call; 2–3s достаточно
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	// Check if the account is connected (either by host/port or server name).
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1131,13 +1462,13 @@ func (a *MT4Account) OpenedOrdersTickets(ctx context.Context) (*pb.OpenedOrdersT
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call; short timeout
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call; short timeout
 		defer cancel()
 	}
 
 	// Ensure the account is connected before making any requests.
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1195,13 +1526,13 @@ func (a *MT4Account) OrdersHistory(
 	// History calls may scan larger ranges; give them a bit more time.
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 8*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().History)
 		defer cancel()
 	}
 
 	// Check that the account is connected before calling the API.
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1375,12 +1706,12 @@ func (a *MT4Account) Quote(ctx context.Context, symbol string) (*pb.QuoteData, e
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // quote is a fast read
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // quote is a fast read
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureMarketInfoClient(); err != nil {
 		return nil, err
@@ -1424,12 +1755,12 @@ func (a *MT4Account) QuoteMany(ctx context.Context, symbols []string) (*pb.Quote
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // fast read
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // fast read
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureMarketInfoClient(); err != nil {
 		return nil, err
@@ -1472,13 +1803,13 @@ func (a *MT4Account) ShowAllSymbols(ctx context.Context) (*pb.SymbolsData, error
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	// Ensure the account is connected to a server.
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureMarketInfoClient(); err != nil {
 		return nil, err
@@ -1525,12 +1856,12 @@ func (a *MT4Account) SymbolParams(ctx context.Context, symbol string) (*pb.Symbo
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, fmt.Errorf("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1592,12 +1923,12 @@ func (a *MT4Account) QuoteHistory(
 	// History calls may scan larger ranges; give them a bit more time.
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 8*time.Second)
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().History)
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureMarketInfoClient(); err != nil {
 		return nil, err
@@ -1641,12 +1972,12 @@ func (a *MT4Account) Symbols(ctx context.Context) (*pb.SymbolsData, error) {
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureMarketInfoClient(); err != nil {
 		return nil, err
@@ -1686,12 +2017,12 @@ func (a *MT4Account) SymbolParamsMany(ctx context.Context, symbols []string) (*p
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1738,12 +2069,12 @@ func (a *MT4Account) TickValueWithSize(ctx context.Context, symbolNames []string
 	}
 	if _, ok := ctx.Deadline(); !ok {
 		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, 3*time.Second) // read-only call
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
 		defer cancel()
 	}
 
 	if !a.isConnected() {
-		return nil, errors.New("not connected")
+		return nil, ErrNotConnected
 	}
 	if err := a.ensureAccountClient(); err != nil {
 		return nil, err
@@ -1796,7 +2127,7 @@ func (a *MT4Account) OnTrade(ctx context.Context) (<-chan *pb.OnTradeData, <-cha
 		go func() {
 			defer close(dataCh)
 			defer close(errCh)
-			errCh <- errors.New("not connected")
+			errCh <- ErrNotConnected
 		}()
 		return dataCh, errCh
 	}
@@ -1853,7 +2184,7 @@ func (a *MT4Account) OnOpenedOrdersProfit(ctx context.Context, intervalMs int32)
 		go func() {
 			defer close(dataCh)
 			defer close(errCh)
-			errCh <- errors.New("not connected")
+			errCh <- ErrNotConnected
 		}()
 		return dataCh, errCh
 	}
@@ -1869,6 +2200,9 @@ func (a *MT4Account) OnOpenedOrdersProfit(ctx context.Context, intervalMs int32)
 		return dataCh, errCh
 	}
 
+	// re-open the stream if no update arrives for 3 intervals (see StallPolicy)
+	ctx = withDefaultStallPolicy(ctx, intervalStallPolicy(intervalMs))
+
 	req := &pb.OnOpenedOrdersProfitRequest{
 		TimerPeriodMilliseconds: intervalMs,
 	}
@@ -1912,7 +2246,7 @@ func (a *MT4Account) OnOpenedOrdersTickets(ctx context.Context, intervalMs int32
 		go func() {
 			defer close(dataCh)
 			defer close(errCh)
-			errCh <- errors.New("not connected")
+			errCh <- ErrNotConnected
 		}()
 		return dataCh, errCh
 	}
@@ -1928,6 +2262,9 @@ func (a *MT4Account) OnOpenedOrdersTickets(ctx context.Context, intervalMs int32
 		return dataCh, errCh
 	}
 
+	// re-open the stream if no update arrives for 3 intervals (see StallPolicy)
+	ctx = withDefaultStallPolicy(ctx, intervalStallPolicy(intervalMs))
+
 	req := &pb.OnOpenedOrdersTicketsRequest{
 		PullIntervalMilliseconds: intervalMs,
 	}
@@ -1975,7 +2312,7 @@ func (a *MT4Account) OnSymbolTick(
 		go func() {
 			defer close(dataCh)
 			defer close(errCh)
-			errCh <- errors.New("not connected")
+			errCh <- ErrNotConnected
 		}()
 		return dataCh, errCh
 	}
@@ -1991,6 +2328,9 @@ func (a *MT4Account) OnSymbolTick(
 		return dataCh, errCh
 	}
 
+	// Tick watchdog from the account unless the caller set one (see StallPolicy)
+	ctx = withDefaultStallPolicy(ctx, a.TickStallPolicy)
+
 	// Build the request message for the stream
 	req := &pb.OnSymbolTickRequest{SymbolNames: symbols}
 
@@ -2024,35 +2364,40 @@ func (a *MT4Account) OnSymbolTick(
 //=========== Working moments =============
 //-----------------------------------------
 
-// Disconnect closes the gRPC connection and resets client state.
-// Safe to call multiple times.
+// Disconnect releases the terminal (server-side Logout, for sessions opened by this account's
+// Connect* methods), closes the gRPC connection (unless shared, see WithClientConn) and moves
+// the account to StateClosed.
+// A closed account cannot be reconnected; create a new one with NewMT4Account.
+// Safe to call multiple times and concurrently with running calls and streams.
 func (a *MT4Account) Disconnect() error {
 	// nothing to do
 	if a == nil {
 		return nil
 	}
 
-	// close gRPC conn if present
-	var closeErr error
-	if a.GrpcConn != nil {
-		closeErr = a.GrpcConn.Close()
+	// release the terminal instance on the server (not for sessions attached via WithSessionID)
+	var logoutErr error
+	if sess := a.Session(); a.State() != StateClosed && sess.Id != uuid.Nil && (sess.Host != "" || sess.ServerName != "") {
+		ctx, cancel := context.WithTimeout(context.Background(), a.timeouts().Read)
+		if _, err := a.Logout(ctx); err != nil {
+			logoutErr = fmt.Errorf("logout: %w", err)
+		}
+		cancel()
 	}
 
-	// hard-reset connection-related fields
-	a.GrpcConn = nil
-	a.ConnectionClient = nil
-	a.SubscriptionClient = nil
-	a.AccountClient = nil
-	a.TradeClient = nil
-	a.MarketInfoClient = nil
-	a.AccountHelper = nil
-
-	// wipe runtime connection markers
-	a.Id = uuid.Nil
-	a.Host = ""
-	a.ServerName = ""
-	a.BaseChartSymbol = ""
-	// keep a.User / a.Password / a.GrpcServer as they are config
+	a.sess.mu.Lock()
+	if a.sess.state == StateClosed {
+		a.sess.mu.Unlock()
+		return logoutErr
+	}
+	// wipe runtime session; User / Password / GrpcServer are config and stay
+	a.sess.session = Session{}
+	a.setStateLocked(StateClosed, nil)
+	a.sess.mu.Unlock()
 
-	return closeErr
+	// close gRPC conn if present and owned (running calls and streams fail with codes.Canceled)
+	if a.GrpcConn != nil && !a.sharedConn {
+		return errors.Join(logoutErr, a.GrpcConn.Close())
+	}
+	return logoutErr
 }
@@ -0,0 +1,96 @@
+package mt4_test
+
+import (
+	"errors"
+	"testing"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReadRetriesTransientErrors(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNext("Quote", 3, errUnavailable)
+
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if got := srv.Calls("Quote"); got != 4 {
+		t.Errorf("Quote calls = %d, want 4", got)
+	}
+}
+
+func TestNonRetryableTransportErrorFailsFast(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNext("Quote", 1, status.Error(codes.InvalidArgument, "bad symbol"))
+
+	_, err := account.Quote(testContext(t), "EURUSD")
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Quote error = %v, want InvalidArgument", err)
+	}
+	if got := srv.Calls("Quote"); got != 1 {
+		t.Errorf("Quote calls = %d, want 1", got)
+	}
+}
+
+func TestAccountRetryPolicyLimitsAttempts(t *testing.T) {
+	srv, account := newTestAccount(t)
+	account.RetryPolicy = &mt4.RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   fastRetries.BaseDelay,
+		MaxDelay:    fastRetries.MaxDelay,
+	}
+	srv.FailNext("AccountSummary", 10, errUnavailable)
+
+	_, err := account.AccountSummary(testContext(t))
+	if status.Code(errors.Unwrap(err)) != codes.Unavailable {
+		t.Fatalf("AccountSummary error = %v, want exceeded retries wrapping Unavailable", err)
+	}
+	if got := srv.Calls("AccountSummary"); got != 3+1 { // +1: health-check at connect
+		t.Errorf("AccountSummary calls = %d, want 4", got)
+	}
+}
+
+func TestContextRetryPolicyOverridesTrades(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNext("OrderSend", 5, errUnavailable)
+
+	ctx := mt4.ContextWithRetryPolicy(testContext(t), &mt4.RetryPolicy{Trades: &mt4.RetryPolicy{MaxAttempts: 1}})
+	_, err := account.OrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("OrderSend error = %v, want the Unavailable of the single attempt", err)
+	}
+	if got := srv.Calls("OrderSend"); got != 1 {
+		t.Errorf("OrderSend calls = %d, want 1", got)
+	}
+
+	// The override applies to trades only: reads keep retrying.
+	srv.FailNext("Quote", 2, errUnavailable)
+	if _, err := account.Quote(ctx, "EURUSD"); err != nil {
+		t.Errorf("Quote with trade-only override: %v", err)
+	}
+}
+
+func TestRetryableMqlErrorCodes(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNextAPI("OrderSend", 2, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_CONTEXT_BUSY)
+
+	// Not retried by default.
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if !mt4.IsTradeContextBusy(err) {
+		t.Fatalf("OrderSend error = %v, want trade context busy", err)
+	}
+
+	ctx := mt4.ContextWithRetryPolicy(testContext(t), &mt4.RetryPolicy{
+		RetryableMqlErrorCodes: []pb.MqlErrorCode{pb.MqlErrorCode_ERR_TRADE_CONTEXT_BUSY},
+	})
+	if _, err := account.OrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("OrderSend with busy retries: %v", err)
+	}
+	if got := srv.Calls("OrderSend"); got != 3 {
+		t.Errorf("OrderSend calls = %d, want 3", got)
+	}
+}
@@ -501,6 +501,39 @@ func (s *MT4Service) StreamTradeUpdates(ctx context.Context) {
 	}
 }
 
+// StreamWithHandlers consumes ticks and trade events through callbacks instead of channels.
+//
+// Prints every tick and classified trade event for 30 seconds or until a stream fails.
+
+func (s *MT4Service) StreamWithHandlers(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	sub, err := s.account.Subscribe(ctx, Handler{
+		Symbols: []string{"EURUSD", "GBPUSD"},
+		OnTick: func(t *Tick) {
+			fmt.Printf("[Tick] %s | Bid: %.5f | Ask: %.5f\n", t.GetSymbol(), t.GetBid(), t.GetAsk())
+		},
+		OnTradeEvent: func(e TradeEvent) {
+			fmt.Printf("[Trade] %v | Ticket: %d | Equity: %.2f\n", e.Kind, e.Ticket, e.Account.GetEquity())
+		},
+		OnReconnect: func(ch StateChange) { fmt.Println("🔁 Reconnected") },
+		OnError:     func(err error) { log.Printf("❌ Stream error: %v", err) },
+	})
+	if err != nil {
+		log.Printf("❌ Subscribe error: %v", err)
+		return
+	}
+	defer sub.Close()
+
+	fmt.Println("🔄 Streaming with handlers...")
+	select {
+	case <-sub.Done():
+	case <-ctx.Done():
+		fmt.Println("⏱️ Timeout reached.")
+	}
+}
+
 // streamorderhistory — a page-by-page stream of the order history.
 // Proxies the OrdersHistoryStream from MT4Account.
 func (s *MT4Service) StreamOrdersHistory(
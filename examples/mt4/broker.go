@@ -0,0 +1,342 @@
+package mt4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//=== 📂 Broker discovery ===
+
+// MinBrokerMatchScore is the lowest fuzzy score kept by MatchBrokerServers.
+const MinBrokerMatchScore = 0.3
+
+// BrokerServer is one MT4 server of a broker, as listed by GetBrokerServersByBrokerName.
+type BrokerServer struct {
+	// Company is the broker company name (e.g. "FreshForex Ltd").
+	Company string
+
+	// Name is the server (cluster) name accepted by ConnectByServerName.
+	Name string
+
+	// Access are the server's access points ("host:port").
+	Access []string
+
+	// Score is the fuzzy match score against the query (0..1, 1 = exact).
+	Score float64
+}
+
+// DiscoverBrokerServers lists the servers of brokers matching brokerName, best match first
+// (see MatchBrokerServers). It can be called before connecting.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//   - brokerName: Broker name as users know it, optionally with a server hint (e.g. "FreshForex demo").
+//
+// Returns:
+//   - Matching servers sorted by Score (empty if none).
+//   - Error if the gRPC/API call fails.
+func (a *MT4Account) DiscoverBrokerServers(ctx context.Context, brokerName string) ([]BrokerServer, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	servers, err := a.listBrokerServers(ctx, brokerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// The directory matches company names literally: retry with the first word
+	// when the full query (e.g. "FreshForex demo") finds nothing.
+	if len(servers) == 0 {
+		if words := strings.Fields(brokerName); len(words) > 1 {
+			if servers, err = a.listBrokerServers(ctx, words[0]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return MatchBrokerServers(servers, brokerName), nil
+}
+
+// listBrokerServers flattens the GetBrokerServersByBrokerName reply.
+func (a *MT4Account) listBrokerServers(ctx context.Context, brokerName string) ([]BrokerServer, error) {
+	data, err := a.GetBrokerServersByBrokerName(ctx, brokerName)
+	if err != nil {
+		return nil, err
+	}
+	var servers []BrokerServer
+	for _, company := range data.GetResult() {
+		for _, s := range company.GetResults() {
+			servers = append(servers, BrokerServer{
+				Company: company.GetCompany(),
+				Name:    s.GetName(),
+				Access:  s.GetAccess(),
+			})
+		}
+	}
+	return servers, nil
+}
+
+// MatchBrokerServers scores servers against query and returns those scoring at least
+// MinBrokerMatchScore, best first (ties keep their original order).
+// The score of a server is the better of its company and server name scores; names are
+// compared case-insensitively ignoring punctuation, so "freshforex" matches
+// "FreshForex-Real" exactly as a prefix.
+func MatchBrokerServers(servers []BrokerServer, query string) []BrokerServer {
+	q := normalizeBrokerName(query)
+	matched := make([]BrokerServer, 0, len(servers))
+	for _, s := range servers {
+		s.Score = max(fuzzyScore(q, normalizeBrokerName(s.Company)), fuzzyScore(q, normalizeBrokerName(s.Name)))
+		if s.Score >= MinBrokerMatchScore {
+			matched = append(matched, s)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return matched[i].Score > matched[j].Score })
+	return matched
+}
+
+// normalizeBrokerName lower-cases s and drops everything but letters and digits.
+func normalizeBrokerName(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// fuzzyScore compares normalized names: 1 = equal, 0.9 = prefix, 0.8 = substring,
+// otherwise 0.7 × the Dice coefficient of their character bigrams.
+func fuzzyScore(q, s string) float64 {
+	switch {
+	case q == "" || s == "":
+		return 0
+	case q == s:
+		return 1
+	case strings.HasPrefix(s, q):
+		return 0.9
+	case strings.Contains(s, q):
+		return 0.8
+	}
+	return 0.7 * diceBigrams(q, s)
+}
+
+// diceBigrams returns 2·|common bigrams| / (|bigrams(a)| + |bigrams(b)|).
+func diceBigrams(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) < 2 || len(rb) < 2 {
+		return 0
+	}
+	counts := make(map[[2]rune]int, len(ra)-1)
+	for i := 0; i+1 < len(ra); i++ {
+		counts[[2]rune{ra[i], ra[i+1]}]++
+	}
+	common := 0
+	for i := 0; i+1 < len(rb); i++ {
+		bg := [2]rune{rb[i], rb[i+1]}
+		if counts[bg] > 0 {
+			counts[bg]--
+			common++
+		}
+	}
+	return 2 * float64(common) / float64(len(ra)-1+len(rb)-1)
+}
+
+//=== 📂 Connect by broker ===
+
+// ConnectByBroker connects with ConnectByServerName to the first server of brokerName that
+// accepts the login. The server remembered in BrokerCache (if any) is tried first, then the
+// servers from DiscoverBrokerServers, best match first. The winner is stored in BrokerCache.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout of the whole search.
+//   - brokerName: Broker name as users know it (e.g. "FreshForex").
+//   - baseChartSymbol, waitForTerminalIsAlive, timeoutSeconds: As for ConnectByServerName.
+//
+// Returns:
+//   - The server that accepted the login.
+//   - ErrNoBrokerServer joined with every per-server error if none did; ctx errors and
+//     ErrAccountClosed stop the search at once.
+func (a *MT4Account) ConnectByBroker(
+	ctx context.Context,
+	brokerName string,
+	baseChartSymbol string,
+	waitForTerminalIsAlive bool,
+	timeoutSeconds int,
+) (BrokerServer, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var errs []error
+	tried := make(map[string]bool)
+	try := func(s BrokerServer) (bool, error) {
+		tried[s.Name] = true
+		err := a.ConnectByServerName(ctx, s.Name, baseChartSymbol, waitForTerminalIsAlive, timeoutSeconds)
+		if err == nil {
+			a.logf("mt4: broker %q: connected to %s", brokerName, s.Name)
+			if a.BrokerCache != nil {
+				if cerr := a.BrokerCache.Store(a.User, brokerName, s.Name); cerr != nil {
+					a.logf("mt4: broker cache: %v", cerr)
+				}
+			}
+			return true, nil
+		}
+		a.logf("mt4: broker %q: %s: %v", brokerName, s.Name, err)
+		if ctx.Err() != nil || errors.Is(err, ErrAccountClosed) {
+			return false, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", s.Name, err))
+		return false, nil
+	}
+
+	// 1) Remembered server from a previous run.
+	if a.BrokerCache != nil {
+		if name, ok := a.BrokerCache.Lookup(a.User, brokerName); ok {
+			cached := BrokerServer{Name: name, Score: 1}
+			if ok, err := try(cached); ok {
+				return cached, nil
+			} else if err != nil {
+				return BrokerServer{}, err
+			}
+		}
+	}
+
+	// 2) Directory candidates.
+	candidates, err := a.DiscoverBrokerServers(ctx, brokerName)
+	if err != nil {
+		return BrokerServer{}, errors.Join(append(errs, err)...)
+	}
+	for _, s := range candidates {
+		if tried[s.Name] {
+			continue
+		}
+		if ok, err := try(s); ok {
+			return s, nil
+		} else if err != nil {
+			return BrokerServer{}, err
+		}
+	}
+	return BrokerServer{}, errors.Join(append([]error{fmt.Errorf("%w: %q", ErrNoBrokerServer, brokerName)}, errs...)...)
+}
+
+//=== 📂 Broker cache ===
+
+// BrokerCache remembers which server accepted a login for a broker name (see ConnectByBroker).
+// Implementations must be safe for concurrent use.
+type BrokerCache interface {
+	// Lookup returns the server remembered for login and brokerName.
+	Lookup(login uint64, brokerName string) (server string, ok bool)
+
+	// Store remembers server for login and brokerName.
+	Store(login uint64, brokerName, server string) error
+}
+
+// FileBrokerCache is a BrokerCache persisted as JSON in a local file, so later runs
+// connect to the right server directly.
+type FileBrokerCache struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]string
+}
+
+// NewFileBrokerCache returns a cache stored at path (created on first Store).
+func NewFileBrokerCache(path string) *FileBrokerCache {
+	return &FileBrokerCache{path: path}
+}
+
+// DefaultBrokerCachePath returns "<user cache dir>/gomt4/brokers.json".
+func DefaultBrokerCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gomt4", "brokers.json"), nil
+}
+
+// Lookup implements BrokerCache. A missing, unreadable or corrupt file is an empty cache.
+func (c *FileBrokerCache) Lookup(login uint64, brokerName string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return "", false
+	}
+	server, ok := c.entries[brokerCacheKey(login, brokerName)]
+	return server, ok
+}
+
+// Store implements BrokerCache. The file is replaced atomically.
+// An unreadable or corrupt file is reported and left untouched.
+func (c *FileBrokerCache) Store(login uint64, brokerName, server string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	key := brokerCacheKey(login, brokerName)
+	if c.entries[key] == server {
+		return nil
+	}
+	c.entries[key] = server
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".brokers-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// loadLocked reads the file once. Caller holds c.mu.
+// The entries are only kept if the whole file decodes ("null" is an empty cache).
+func (c *FileBrokerCache) loadLocked() error {
+	if c.loaded {
+		return nil
+	}
+	var entries map[string]string
+	data, err := os.ReadFile(c.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("broker cache %s: %w", c.path, err)
+		}
+	}
+	if entries == nil {
+		entries = make(map[string]string)
+	}
+	c.entries, c.loaded = entries, true
+	return nil
+}
+
+// brokerCacheKey is "<login>/<normalized broker name>".
+func brokerCacheKey(login uint64, brokerName string) string {
+	return strconv.FormatUint(login, 10) + "/" + normalizeBrokerName(brokerName)
+}
@@ -0,0 +1,152 @@
+package mt4_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+func TestMatchBrokerServers(t *testing.T) {
+	servers := []mt4.BrokerServer{
+		{Company: "FreshForex Ltd", Name: "FreshForex-Real"},
+		{Company: "FreshForex Ltd", Name: "FreshForex-Demo"},
+		{Company: "Other Markets", Name: "Other-Live"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+		score float64
+	}{
+		{"FreshForex-Demo", []string{"FreshForex-Demo", "FreshForex-Real"}, 1},
+		{"freshforex", []string{"FreshForex-Real", "FreshForex-Demo"}, 0.9},
+		{"forex", []string{"FreshForex-Real", "FreshForex-Demo"}, 0.8},
+		{"Other", []string{"Other-Live"}, 0.9},
+		{"zzz", nil, 0},
+		{"", nil, 0},
+	}
+	for _, tt := range tests {
+		got := mt4.MatchBrokerServers(servers, tt.query)
+		var names []string
+		for _, s := range got {
+			names = append(names, s.Name)
+		}
+		if len(names) != len(tt.want) {
+			t.Errorf("%q: matched %v, want %v", tt.query, names, tt.want)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.want[i] {
+				t.Errorf("%q: matched %v, want %v", tt.query, names, tt.want)
+				break
+			}
+		}
+		if len(got) > 0 && got[0].Score != tt.score {
+			t.Errorf("%q: best score = %v, want %v", tt.query, got[0].Score, tt.score)
+		}
+	}
+}
+
+func TestFileBrokerCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "brokers.json")
+	c := mt4.NewFileBrokerCache(path)
+	if _, ok := c.Lookup(1, "FreshForex"); ok {
+		t.Fatal("empty cache hit")
+	}
+	if err := c.Store(1, "FreshForex", "FreshForex-Real"); err != nil {
+		t.Fatalf("Store: %v", err)
+	}
+
+	// A new instance reads the file; broker names are normalized.
+	server, ok := mt4.NewFileBrokerCache(path).Lookup(1, "fresh forex")
+	if !ok || server != "FreshForex-Real" {
+		t.Errorf("Lookup = %q, %v", server, ok)
+	}
+	if _, ok := mt4.NewFileBrokerCache(path).Lookup(2, "FreshForex"); ok {
+		t.Error("Lookup hit for another login")
+	}
+}
+
+func TestFileBrokerCacheNullFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brokers.json")
+	if err := os.WriteFile(path, []byte("null"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := mt4.NewFileBrokerCache(path)
+	if _, ok := c.Lookup(1, "FreshForex"); ok {
+		t.Fatal("null file hit")
+	}
+	if err := c.Store(1, "FreshForex", "FreshForex-Real"); err != nil {
+		t.Fatalf("Store on a null file: %v", err)
+	}
+	if server, ok := mt4.NewFileBrokerCache(path).Lookup(1, "FreshForex"); !ok || server != "FreshForex-Real" {
+		t.Errorf("Lookup = %q, %v", server, ok)
+	}
+}
+
+func TestFileBrokerCacheCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "brokers.json")
+	corrupt := []byte(`{"1/freshforex": `)
+	if err := os.WriteFile(path, corrupt, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c := mt4.NewFileBrokerCache(path)
+	if _, ok := c.Lookup(1, "FreshForex"); ok {
+		t.Fatal("corrupt file hit")
+	}
+	if err := c.Store(1, "FreshForex", "FreshForex-Real"); err == nil {
+		t.Fatal("Store overwrote a corrupt file without an error")
+	}
+	if data, _ := os.ReadFile(path); string(data) != string(corrupt) {
+		t.Errorf("corrupt file rewritten: %q", data)
+	}
+}
+
+func TestConnectByBrokerUsesCache(t *testing.T) {
+	srv := mt4test.NewServer()
+	t.Cleanup(srv.Close) // after the accounts' Disconnect
+	srv.AddBrokerServer("Example Markets", "Example-Demo")
+	cache := mt4.NewFileBrokerCache(filepath.Join(t.TempDir(), "brokers.json"))
+
+	connect := func() mt4.BrokerServer {
+		account, err := mt4.NewMT4Account(100000, "", append(srv.AccountOptions(), mt4.WithBrokerCache(cache))...)
+		if err != nil {
+			t.Fatalf("NewMT4Account: %v", err)
+		}
+		t.Cleanup(func() { _ = account.Disconnect() })
+		server, err := account.ConnectByBroker(testContext(t), "Example", "EURUSD", true, 30)
+		if err != nil {
+			t.Fatalf("ConnectByBroker: %v", err)
+		}
+		return server
+	}
+
+	if s := connect(); s.Name != "Example-Demo" {
+		t.Fatalf("server = %+v", s)
+	}
+	lookups := srv.Calls("GetBrokerServersByBrokerName")
+	if s := connect(); s.Name != "Example-Demo" {
+		t.Fatalf("cached server = %+v", s)
+	}
+	if got := srv.Calls("GetBrokerServersByBrokerName"); got != lookups {
+		t.Errorf("directory queried again (%d → %d) despite the cache", lookups, got)
+	}
+}
+
+func TestConnectByBrokerNoServer(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	srv.AddBrokerServer("Example Markets", "Example-Demo")
+	account, err := mt4.NewMT4Account(100000, "", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	if _, err := account.ConnectByBroker(testContext(t), "Unknown Broker", "EURUSD", true, 30); !errors.Is(err, mt4.ErrNoBrokerServer) {
+		t.Errorf("ConnectByBroker = %v, want ErrNoBrokerServer", err)
+	}
+}
@@ -0,0 +1,319 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Bulk order operations ===
+//
+// Flattening an account is a loop over OpenedOrders calling OrderClose (positions) or
+// OrderDelete (pending orders). The bulk helpers run that loop with bounded parallelism and
+// report one BulkResult per order:
+//
+//	CloseAll          every position and pending order
+//	CloseWhere        the orders passing an OrderFilter (symbol, magic, types, profit sign)
+//	DeleteAllPending  every pending order
+//	CloseNetted       the positions of a symbol, opposite ones paired with OrderCloseBy
+//	                  (one spread instead of two), the rest closed at market
+//
+// Their trade calls also retry requotes (ERR_REQUOTE, ERR_PRICE_CHANGED, ERR_OFF_QUOTES) and a
+// busy trade context, and make exactly BulkOptions.RequoteRetries+1 attempts in place of the
+// account's MaxAttempts (RequoteRetries 0 = a single attempt): those are definite rejections,
+// and closing a ticket twice cannot happen.
+
+const (
+	// DefaultBulkConcurrency is the number of parallel requests when BulkOptions leaves it zero.
+	DefaultBulkConcurrency = 4
+
+	// DefaultBulkRequoteRetries is the requote retry count when BulkOptions leaves it nil.
+	DefaultBulkRequoteRetries = 3
+)
+
+// bulkRetryCodes are the MQL rejections a bulk operation retries.
+var bulkRetryCodes = []pb.MqlErrorCode{
+	pb.MqlErrorCode_ERR_REQUOTE,
+	pb.MqlErrorCode_ERR_PRICE_CHANGED,
+	pb.MqlErrorCode_ERR_OFF_QUOTES,
+	pb.MqlErrorCode_ERR_TRADE_CONTEXT_BUSY,
+}
+
+// BulkOptions configures a bulk operation (nil = defaults).
+type BulkOptions struct {
+	// Concurrency is the number of requests in flight (0 = DefaultBulkConcurrency).
+	Concurrency int
+
+	// RequoteRetries is how often a failed close is retried, requotes included; it replaces
+	// the account's MaxAttempts (nil = DefaultBulkRequoteRetries, 0 = no retries, negative =
+	// only the account's retry policy).
+	RequoteRetries *int32
+
+	// Slippage is passed to OrderClose for positions (nil = server default).
+	Slippage *int32
+}
+
+// BulkResult is the outcome for one order of a bulk operation.
+type BulkResult struct {
+	// Ticket, Symbol, Type and Lots describe the order as selected.
+	Ticket int32
+	Symbol string
+	Type   pb.OpenedOrderType
+	Lots   float64
+
+	// Data is the OrderClose / OrderDelete reply.
+	Data *pb.OrderCloseDeleteData
+
+	// ClosedBy is the opposite ticket and CloseBy the reply when CloseNetted paired the order.
+	ClosedBy int32
+	CloseBy  *pb.OrderCloseByData
+
+	// Err is the error of the order (nil = done).
+	Err error
+}
+
+// CloseAll closes every position and deletes every pending order of the account.
+//
+// Parameters:
+//   - ctx: Context for the OpenedOrders call and the trade calls.
+//   - opts: Parallelism, requote retries and slippage (nil = defaults).
+//
+// Returns:
+//   - One result per order, in ticket order.
+//   - The OpenedOrders error, or the errors of the failed orders joined
+//     ("order #N: ..."; errors.Is works on each of them).
+//
+// Example:
+//
+//	results, err := account.CloseAll(ctx, &mt4.BulkOptions{Concurrency: 8})
+//	for _, r := range results {
+//	    if r.Err != nil { log.Printf("#%d %s: %v", r.Ticket, r.Symbol, r.Err) }
+//	}
+func (a *MT4Account) CloseAll(ctx context.Context, opts *BulkOptions) ([]BulkResult, error) {
+	return a.CloseWhere(ctx, OrderFilter{}, opts)
+}
+
+// CloseWhere closes the positions and deletes the pending orders that pass filter.
+//
+// Parameters:
+//   - ctx: Context for the OpenedOrders call and the trade calls.
+//   - filter: Orders to close (zero value = all).
+//   - opts: Parallelism, requote retries and slippage (nil = defaults).
+//
+// Returns:
+//   - One result per selected order, in ticket order.
+//   - The OpenedOrders error, or the errors of the failed orders joined.
+//
+// Example:
+//
+//	magic := int32(42)
+//	// Cut the losers of one strategy.
+//	_, err := account.CloseWhere(ctx, mt4.OrderFilter{Magic: &magic, Profit: mt4.Losing}, nil)
+func (a *MT4Account) CloseWhere(ctx context.Context, filter OrderFilter, opts *BulkOptions) ([]BulkResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	orders, err := a.selectOrders(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return a.closeOrders(ctx, orders, bulkOptions(opts))
+}
+
+// DeleteAllPending deletes every pending order of the account.
+//
+// Parameters:
+//   - ctx: Context for the OpenedOrders call and the trade calls.
+//   - opts: Parallelism and requote retries (nil = defaults).
+//
+// Returns:
+//   - One result per pending order, in ticket order.
+//   - The OpenedOrders error, or the errors of the failed orders joined.
+func (a *MT4Account) DeleteAllPending(ctx context.Context, opts *BulkOptions) ([]BulkResult, error) {
+	return a.CloseWhere(ctx, OrderFilter{Types: []pb.OpenedOrderType{
+		pb.OpenedOrderType_OO_OP_BUYLIMIT, pb.OpenedOrderType_OO_OP_SELLLIMIT,
+		pb.OpenedOrderType_OO_OP_BUYSTOP, pb.OpenedOrderType_OO_OP_SELLSTOP,
+	}}, opts)
+}
+
+// CloseNetted closes every position of symbol, pairing buys with sells through OrderCloseBy
+// first (largest with largest) so the hedged volume pays no second spread. What remains
+// (one side only, including OrderCloseBy remainders) is closed at market in parallel.
+// Pending orders are not touched.
+//
+// Parameters:
+//   - ctx: Context for the OpenedOrders calls and the trade calls.
+//   - symbol: Symbol whose positions are closed.
+//   - opts: Parallelism, requote retries and slippage (nil = defaults).
+//
+// Returns:
+//   - One result per OrderCloseBy pair (ClosedBy set) and per order closed at market.
+//   - The OpenedOrders error, or the errors of the failed operations joined.
+//
+// If an OrderCloseBy fails (e.g. the account does not allow it), pairing stops and the
+// remaining positions are closed at market.
+//
+// Example:
+//
+//	results, err := account.CloseNetted(ctx, "EURUSD", nil)
+//	for _, r := range results {
+//	    if r.ClosedBy != 0 { log.Printf("#%d closed by #%d at %.5f", r.Ticket, r.ClosedBy, r.CloseBy.GetClosePrice()) }
+//	}
+func (a *MT4Account) CloseNetted(ctx context.Context, symbol string, opts *BulkOptions) ([]BulkResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	o := bulkOptions(opts)
+	tradeCtx := a.bulkTradeContext(ctx, o)
+	positions := OrderFilter{Symbol: symbol, Types: []pb.OpenedOrderType{
+		pb.OpenedOrderType_OO_OP_BUY, pb.OpenedOrderType_OO_OP_SELL,
+	}}
+
+	var results []BulkResult
+	var errs []error
+	for {
+		orders, err := a.selectOrders(ctx, positions)
+		if err != nil {
+			return results, errors.Join(append(errs, err)...)
+		}
+		var buys, sells []*pb.OpenedOrderInfo
+		for _, ord := range orders {
+			if ord.GetOrderType() == pb.OpenedOrderType_OO_OP_BUY {
+				buys = append(buys, ord)
+			} else {
+				sells = append(sells, ord)
+			}
+		}
+		if len(buys) == 0 || len(sells) == 0 {
+			break
+		}
+		largest := func(s []*pb.OpenedOrderInfo) *pb.OpenedOrderInfo {
+			return slices.MaxFunc(s, func(x, y *pb.OpenedOrderInfo) int {
+				if x.GetLots() != y.GetLots() {
+					if x.GetLots() < y.GetLots() {
+						return -1
+					}
+					return 1
+				}
+				return int(y.GetTicket() - x.GetTicket()) // oldest first among equals
+			})
+		}
+		b, s := largest(buys), largest(sells)
+		r := bulkResult(b)
+		r.ClosedBy = s.GetTicket()
+		r.CloseBy, r.Err = a.OrderCloseBy(tradeCtx, b.GetTicket(), s.GetTicket())
+		results = append(results, r)
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("order #%d by #%d: %w", b.GetTicket(), s.GetTicket(), r.Err))
+			break
+		}
+	}
+
+	orders, err := a.selectOrders(ctx, positions)
+	if err != nil {
+		return results, errors.Join(append(errs, err)...)
+	}
+	rest, err := a.closeOrders(ctx, orders, o)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return append(results, rest...), errors.Join(errs...)
+}
+
+// bulkOptions returns opts with defaults applied.
+func bulkOptions(opts *BulkOptions) BulkOptions {
+	var o BulkOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultBulkConcurrency
+	}
+	if o.RequoteRetries == nil {
+		retries := int32(DefaultBulkRequoteRetries)
+		o.RequoteRetries = &retries
+	}
+	return o
+}
+
+// bulkTradeContext returns ctx with the effective trade retry policy extended by the
+// requote codes of a bulk operation and limited to RequoteRetries+1 attempts. Use it for
+// trade calls only.
+func (a *MT4Account) bulkTradeContext(ctx context.Context, o BulkOptions) context.Context {
+	retries := *o.RequoteRetries
+	if retries < 0 {
+		return ctx
+	}
+	p := a.retryPolicyFor(ctx, OperationTrade)
+	codes := slices.Clone(p.RetryableMqlErrorCodes)
+	for _, c := range bulkRetryCodes {
+		if !slices.Contains(codes, c) {
+			codes = append(codes, c)
+		}
+	}
+	p.RetryableMqlErrorCodes = codes
+	p.MaxAttempts = int(retries) + 1
+	return ContextWithRetryPolicy(ctx, p)
+}
+
+// selectOrders returns the opened orders passing filter, sorted by ticket.
+func (a *MT4Account) selectOrders(ctx context.Context, filter OrderFilter) ([]*pb.OpenedOrderInfo, error) {
+	data, err := a.OpenedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []*pb.OpenedOrderInfo
+	for _, o := range data.GetOrderInfos() {
+		if filter.match(o) {
+			out = append(out, o)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetTicket() < out[j].GetTicket() })
+	return out, nil
+}
+
+// closeOrders closes (positions) or deletes (pending orders) orders, o.Concurrency at a time.
+func (a *MT4Account) closeOrders(ctx context.Context, orders []*pb.OpenedOrderInfo, o BulkOptions) ([]BulkResult, error) {
+	tradeCtx := a.bulkTradeContext(ctx, o)
+	results := make([]BulkResult, len(orders))
+	sem := make(chan struct{}, o.Concurrency)
+	var wg sync.WaitGroup
+	for i, ord := range orders {
+		results[i] = bulkResult(ord)
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(r *BulkResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if isPendingOrderType(r.Type) {
+				r.Data, r.Err = a.OrderDelete(tradeCtx, r.Ticket)
+			} else {
+				r.Data, r.Err = a.OrderClose(tradeCtx, r.Ticket, nil, nil, o.Slippage)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("order #%d: %w", r.Ticket, r.Err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// bulkResult starts the result of an order.
+func bulkResult(o *pb.OpenedOrderInfo) BulkResult {
+	return BulkResult{Ticket: o.GetTicket(), Symbol: o.GetSymbol(), Type: o.GetOrderType(), Lots: o.GetLots()}
+}
@@ -0,0 +1,181 @@
+package mt4_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+// placeLimit places a buy limit on symbol below the market and returns its ticket.
+func placeLimit(t *testing.T, account *mt4.MT4Account, symbol string, price float64) int32 {
+	t.Helper()
+	data, err := account.OrderSend(testContext(t), symbol, pb.OrderSendOperationType_OC_OP_BUYLIMIT, 0.1, &price, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSend(%s buy limit): %v", symbol, err)
+	}
+	return data.GetTicket()
+}
+
+func TestCloseAll(t *testing.T) {
+	srv, account := newTestAccount(t)
+	first := buy(t, account, "EURUSD", 0.1)
+	send(t, account, "GBPUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.2)
+	limit := placeLimit(t, account, "EURUSD", 1.05)
+
+	results, err := account.CloseAll(testContext(t), &mt4.BulkOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatalf("CloseAll: %v", err)
+	}
+	if len(results) != 3 || results[0].Ticket != first || results[2].Ticket != limit {
+		t.Fatalf("results = %+v, want three in ticket order", results)
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Data == nil {
+			t.Errorf("#%d: data %v, err %v", r.Ticket, r.Data, r.Err)
+		}
+	}
+	if results[1].Symbol != "GBPUSD" || results[1].Type != pb.OpenedOrderType_OO_OP_SELL || results[1].Lots != 0.2 {
+		t.Errorf("result = %+v", results[1])
+	}
+	if got := len(srv.Orders()); got != 0 {
+		t.Errorf("%d orders left", got)
+	}
+}
+
+func TestCloseWhere(t *testing.T) {
+	srv, account := newTestAccount(t)
+	magic := int32(42)
+	tagged, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, &magic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := buy(t, account, "EURUSD", 0.1)
+	position := buy(t, account, "GBPUSD", 0.1)
+	placeLimit(t, account, "GBPUSD", 1.2)
+
+	results, err := account.CloseWhere(testContext(t), mt4.OrderFilter{Symbol: "EURUSD", Magic: &magic}, nil)
+	if err != nil || len(results) != 1 || results[0].Ticket != tagged.GetTicket() {
+		t.Errorf("CloseWhere(magic) = %+v, %v", results, err)
+	}
+	if srv.Order(other) == nil {
+		t.Error("CloseWhere closed an order of another magic")
+	}
+
+	results, err = account.DeleteAllPending(testContext(t), nil)
+	if err != nil || len(results) != 1 || results[0].Type != pb.OpenedOrderType_OO_OP_BUYLIMIT {
+		t.Errorf("DeleteAllPending = %+v, %v", results, err)
+	}
+	if srv.Order(position) == nil {
+		t.Error("DeleteAllPending closed a position")
+	}
+
+	// Nothing selected: no results, no error.
+	if results, err := account.DeleteAllPending(testContext(t), nil); err != nil || len(results) != 0 {
+		t.Errorf("DeleteAllPending without pending orders = %+v, %v", results, err)
+	}
+}
+
+func TestCloseNetted(t *testing.T) {
+	srv, account := newTestAccount(t)
+	long := buy(t, account, "EURUSD", 1)
+	shortA := send(t, account, "EURUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.4)
+	shortB := send(t, account, "EURUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.3)
+	gbp := buy(t, account, "GBPUSD", 0.1)
+	placeLimit(t, account, "EURUSD", 1.05)
+
+	results, err := account.CloseNetted(testContext(t), "EURUSD", nil)
+	if err != nil {
+		t.Fatalf("CloseNetted: %v", err)
+	}
+	if got := srv.Calls("OrderCloseBy"); got != 2 {
+		t.Errorf("OrderCloseBy calls = %d, want one per sell", got)
+	}
+	if len(results) < 3 || results[0].Ticket != long || results[0].ClosedBy != shortA || results[0].CloseBy == nil {
+		t.Fatalf("results = %+v, want the largest buy closed by the largest sell first", results)
+	}
+	if results[1].ClosedBy != shortB {
+		t.Errorf("second pair closed by #%d, want #%d", results[1].ClosedBy, shortB)
+	}
+	last := results[len(results)-1]
+	if last.ClosedBy != 0 || last.Data == nil || last.Err != nil {
+		t.Errorf("remainder = %+v, want a market close", last)
+	}
+
+	for _, o := range srv.Orders() {
+		if o.GetSymbol() == "EURUSD" && o.GetOrderType() == pb.OpenedOrderType_OO_OP_BUY {
+			t.Errorf("EURUSD position #%d left", o.GetTicket())
+		}
+	}
+	if srv.Order(gbp) == nil || len(srv.Orders()) != 2 {
+		t.Errorf("orders left = %v, want the GBPUSD position and the pending order", srv.Orders())
+	}
+}
+
+func TestBulkRequoteRetries(t *testing.T) {
+	const requote = pb.MqlErrorCode_ERR_REQUOTE
+	tests := []struct {
+		name        string
+		maxAttempts int    // the account's
+		retries     *int32 // nil = default
+		requotes    int
+		calls       int
+		fails       bool
+	}{
+		{"default retries", 1, nil, 2, 3, false},
+		{"default retries exhausted", 1, nil, 5, 4, true},
+		{"no retries", 5, ptr[int32](0), 1, 1, true},
+		{"retries exhausted", 1, ptr[int32](1), 5, 2, true},
+		{"retries replace a higher MaxAttempts", 5, ptr[int32](1), 5, 2, true},
+		{"retries replace a lower MaxAttempts", 2, ptr[int32](4), 4, 5, false},
+		{"account policy only", 5, ptr[int32](-1), 5, 1, true}, // requotes are not retryable for the account
+	}
+	for _, tt := range tests {
+		srv, account := newTestAccount(t, mt4.WithRetryPolicy(&mt4.RetryPolicy{
+			MaxAttempts: tt.maxAttempts, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond,
+		}))
+		ticket := buy(t, account, "EURUSD", 0.1)
+		srv.FailNextAPI("OrderCloseDelete", tt.requotes, "MQL_ERROR", requote)
+
+		results, err := account.CloseAll(testContext(t), &mt4.BulkOptions{RequoteRetries: tt.retries})
+		if got := srv.Calls("OrderCloseDelete"); got != tt.calls {
+			t.Errorf("%s: OrderClose calls = %d, want %d", tt.name, got, tt.calls)
+		}
+		if tt.fails != (err != nil) || len(results) != 1 {
+			t.Errorf("%s: CloseAll = %+v, %v", tt.name, results, err)
+			continue
+		}
+		if tt.fails && (!errors.Is(err, mt4.ErrRequote) || !errors.Is(results[0].Err, mt4.ErrRequote)) {
+			t.Errorf("%s: err = %v, want ErrRequote", tt.name, err)
+		}
+		if closed := srv.Order(ticket) == nil; closed == tt.fails {
+			t.Errorf("%s: order closed = %v", tt.name, closed)
+		}
+	}
+}
+
+func TestBulkErrors(t *testing.T) {
+	srv, account := newTestAccount(t)
+	first := buy(t, account, "EURUSD", 0.1)
+	second := buy(t, account, "EURUSD", 0.1)
+	srv.FailNextAPI("OrderCloseDelete", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_DISABLED)
+
+	results, err := account.CloseAll(testContext(t), &mt4.BulkOptions{Concurrency: 1})
+	if !errors.Is(err, mt4.ErrTradeDisabled) || len(results) != 2 {
+		t.Fatalf("CloseAll = %+v, %v", results, err)
+	}
+	if results[0].Ticket != first || results[0].Err == nil || results[1].Err != nil {
+		t.Errorf("results = %+v, want the first failed and the second closed", results)
+	}
+	if srv.Order(first) == nil || srv.Order(second) != nil {
+		t.Error("wrong order closed")
+	}
+
+	srv.FailNextAPI("OpenedOrders", 1, "INTERNAL", pb.MqlErrorCode_ERR_NO_ERROR)
+	if results, err := account.CloseAll(testContext(t), nil); err == nil || len(results) != 0 {
+		t.Errorf("CloseAll with a failing OpenedOrders = %+v, %v", results, err)
+	}
+}
@@ -0,0 +1,509 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+//=== 📂 Connection ===
+
+// ProxySettings describes the proxy the terminal uses to reach the MT4 server (see ConnectViaProxy).
+type ProxySettings struct {
+	// Type is the proxy protocol (pb.ProxyTypes_Https, pb.ProxyTypes_Socks4, pb.ProxyTypes_Socks5).
+	Type pb.ProxyTypes
+
+	// Host / Port of the proxy server.
+	Host string
+	Port int
+
+	// User / Password for proxy authentication (optional).
+	User     string
+	Password string
+}
+
+// ConnectViaProxy connects to the MT4 terminal through a SOCKS or HTTPS proxy.
+// Like ConnectByHostPort it updates the session upon success and remembers the
+// parameters (including the proxy) for automatic re-establishment.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//   - host, port: MT4 trade server address.
+//   - proxy: Proxy type, address and optional credentials.
+//   - baseChartSymbol: Default chart symbol (e.g., "EURUSD").
+//   - waitForTerminalIsAlive: Kept in the session for re-establishment.
+//   - timeoutSeconds: Timeout for connection readiness, in seconds.
+//
+// Returns:
+//   - Error if the connect RPC or the post-connect health-check fails.
+func (a *MT4Account) ConnectViaProxy(
+	ctx context.Context,
+	host string,
+	port int,
+	proxy ProxySettings,
+	baseChartSymbol string,
+	waitForTerminalIsAlive bool,
+	timeoutSeconds int,
+) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if proxy.Host == "" {
+		return errors.New("ConnectViaProxy: proxy host is required")
+	}
+
+	return a.connect(ctx, Session{
+		Host:                   host,
+		Port:                   port,
+		Proxy:                  proxy,
+		BaseChartSymbol:        baseChartSymbol,
+		WaitForTerminalIsAlive: waitForTerminalIsAlive,
+		ConnectTimeout:         timeoutSeconds,
+	}, "ConnectViaProxy")
+}
+
+// CheckConnect asks the server whether the terminal instance is alive and connected to the MT4 server.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//
+// Returns:
+//   - Pointer to CheckConnectData (instance id and TerminalHealthCheck flags).
+//   - Error if not connected or if the gRPC/API call fails.
+func (a *MT4Account) CheckConnect(ctx context.Context) (*pb.CheckConnectData, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read) // read-only call
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureConnectionClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.CheckConnectRequest{}
+
+	grpcCall := func(headers metadata.MD) (*pb.CheckConnectReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.CheckConnect(c, req)
+	}
+
+	errorSelector := func(reply *pb.CheckConnectReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+// Logout closes the terminal connection on the server (Connection.Disconnect) and releases
+// the terminal instance. The gRPC connection stays open, so the account can connect again;
+// the state becomes StateDisconnected. A terminal that is already gone counts as success
+// (nil data, nil error). Disconnect calls Logout for sessions opened by this account.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//
+// Returns:
+//   - Pointer to DisconnectData (instance id, lifetime), or nil if the instance was already gone.
+//   - Error if not connected or if the gRPC/API call fails.
+func (a *MT4Account) Logout(ctx context.Context) (*pb.DisconnectData, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read)
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureConnectionClient(); err != nil {
+		return nil, err
+	}
+
+	sessionID := a.sessionID()
+	req := &pb.DisconnectRequest{}
+
+	grpcCall := func(headers metadata.MD) (*pb.DisconnectReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.Disconnect(c, req)
+	}
+
+	// A missing terminal is what we want: do not retry or re-establish it.
+	errorSelector := func(reply *pb.DisconnectReply) *pb.Error {
+		if apiErr := reply.GetError(); apiErr != nil && !errors.Is(NewAPIError(apiErr), ErrTerminalNotFound) {
+			return apiErr
+		}
+		return nil
+	}
+
+	reply, err := ExecuteWithReconnect(a, withoutReestablish(ctx), grpcCall, errorSelector)
+	if err != nil {
+		return nil, err
+	}
+	a.endSession(sessionID)
+	return reply.GetData(), nil
+}
+
+// Reconnect asks the server to recreate the terminal instance with the same id
+// (or a new one, reported in ReconnectData.TerminalInstanceGuid, which becomes the session id).
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout (a connect may take up to the session ConnectTimeout).
+//   - force: Recreate the instance even if the current one is alive.
+//
+// Returns:
+//   - Pointer to ReconnectData (whether the terminal was recreated, old log files, ...).
+//   - Error if not connected or if the gRPC/API call fails.
+func (a *MT4Account) Reconnect(ctx context.Context, force bool) (*pb.ReconnectData, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := time.Duration(a.Session().ConnectTimeout) * time.Second
+		if timeout <= 0 {
+			timeout = 30 * time.Second
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureConnectionClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.ReconnectRequest{ForceReconnection: &force}
+
+	grpcCall := func(headers metadata.MD) (*pb.ReconnectReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.Reconnect(c, req)
+	}
+
+	errorSelector := func(reply *pb.ReconnectReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := ExecuteWithReconnect(a, withoutReestablish(ctx), grpcCall, errorSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adopt the (possibly new) instance id.
+	if guid := reply.GetData().GetTerminalInstanceGuid(); guid != "" {
+		if id, parseErr := uuid.Parse(guid); parseErr == nil {
+			a.sess.mu.Lock()
+			a.sess.session.Id = id
+			a.setStateLocked(StateConnected, nil)
+			a.sess.mu.Unlock()
+		}
+	}
+	return reply.GetData(), nil
+}
+
+// GetId returns the deterministic terminal instance id the server derives from the
+// account credentials (same user/password → same id). It can be called before connecting;
+// pass the result to WithSessionID to attach to that instance, or let ConnectStream use it.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//
+// Returns:
+//   - The instance id.
+//   - Error if the gRPC/API call fails or the id is not a UUID.
+func (a *MT4Account) GetId(ctx context.Context) (uuid.UUID, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Read)
+		defer cancel()
+	}
+
+	if err := a.ensureConnectionClient(); err != nil {
+		return uuid.Nil, err
+	}
+
+	req := &pb.GetIdRequest{
+		User:     strconv.FormatUint(a.User, 10),
+		Password: a.Password,
+	}
+
+	grpcCall := func(headers metadata.MD) (*pb.GetIdReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.GetId(c, req)
+	}
+
+	errorSelector := func(reply *pb.GetIdReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := ExecuteWithReconnect(a, withoutReestablish(ctx), grpcCall, errorSelector)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(reply.GetData().GetId())
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("GetId: %w", err)
+	}
+	return id, nil
+}
+
+// Screenshot captures the terminal window of the current instance.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//
+// Returns:
+//   - Pointer to ScreenshotData (ImageData, ContentType, display number).
+//   - Error if not connected or if the gRPC/API call fails.
+func (a *MT4Account) Screenshot(ctx context.Context) (*pb.ScreenshotData, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().History) // image payload
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureConnectionClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.ScreenshotRequest{}
+
+	grpcCall := func(headers metadata.MD) (*pb.ScreenshotReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.Screenshot(c, req)
+	}
+
+	errorSelector := func(reply *pb.ScreenshotReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := ExecuteWithReconnect(a, ctx, grpcCall, errorSelector)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+// GetBrokerServersByBrokerName lists the MT4 servers of brokers matching brokerName.
+// It can be called before connecting.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout.
+//   - brokerName: Broker (company) name or part of it, e.g. "FreshForex".
+//
+// Returns:
+//   - Pointer to GetBrokerServersByBrokerNameData (companies with their servers and Access lists).
+//   - Error if the gRPC/API call fails.
+func (a *MT4Account) GetBrokerServersByBrokerName(ctx context.Context, brokerName string) (*pb.GetBrokerServersByBrokerNameData, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().History) // directory lookup
+		defer cancel()
+	}
+
+	if err := a.ensureConnectionClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.GetBrokerServersByBrokerNameRequest{BrokerName: brokerName}
+
+	grpcCall := func(headers metadata.MD) (*pb.GetBrokerServersByBrokerNameReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.ConnectionClient.GetBrokerServersByBrokerName(c, req)
+	}
+
+	errorSelector := func(reply *pb.GetBrokerServersByBrokerNameReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := ExecuteWithReconnect(a, withoutReestablish(ctx), grpcCall, errorSelector)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+//=== 📂 Connection progress streams ===
+
+// ConnectStream is ConnectByHostPort as a stream of progress events (Connection.ConnectStream).
+// It is low-level: the session is not updated from the final event's ConnectData.
+//
+// The stream requires an "id" header; without a session, the id from GetId is used.
+// Opening the stream is retried on transport errors (OperationStream policy), but a stream
+// that breaks after the first event is not re-opened, since that would restart the login.
+//
+// Returns:
+//   - dataCh: progress events; the last one has IsFinal set.
+//   - errCh: the final event's ErrorData as *APIError, transport errors, or
+//     an error if the stream ends before the final event. Both channels are closed at the end.
+func (a *MT4Account) ConnectStream(
+	ctx context.Context,
+	host string,
+	port int,
+	baseChartSymbol string,
+	waitForTerminalIsAlive bool,
+	timeoutSeconds int,
+) (<-chan *pb.ConnectStreamEvent, <-chan error) {
+	req := a.connectRequest(Session{
+		Host:                   host,
+		Port:                   port,
+		BaseChartSymbol:        baseChartSymbol,
+		WaitForTerminalIsAlive: waitForTerminalIsAlive,
+		ConnectTimeout:         timeoutSeconds,
+	})
+	return a.connectEventStream(ctx, uuid.Nil, func(c context.Context) (connectEventReceiver, error) {
+		return a.ConnectionClient.ConnectStream(c, req)
+	})
+}
+
+// ConnectExStream is ConnectByServerName as a stream of progress events (Connection.ConnectExStream).
+// See ConnectStream for the channel semantics.
+func (a *MT4Account) ConnectExStream(
+	ctx context.Context,
+	serverName string,
+	baseChartSymbol string,
+	timeoutSeconds int,
+) (<-chan *pb.ConnectStreamEvent, <-chan error) {
+	req := a.connectExRequest(Session{
+		ServerName:      serverName,
+		BaseChartSymbol: baseChartSymbol,
+		ConnectTimeout:  timeoutSeconds,
+	})
+	return a.connectEventStream(ctx, uuid.Nil, func(c context.Context) (connectEventReceiver, error) {
+		return a.ConnectionClient.ConnectExStream(c, req)
+	})
+}
+
+// connectEventReceiver is implemented by the ConnectStream / ConnectExStream clients.
+type connectEventReceiver interface {
+	Recv() (*pb.ConnectStreamEvent, error)
+}
+
+// connectEventStream runs a connect progress stream opened by open (see ConnectStream).
+// id is sent in the "id" header; uuid.Nil resolves it with connectStreamID.
+func (a *MT4Account) connectEventStream(
+	ctx context.Context,
+	id uuid.UUID,
+	open func(context.Context) (connectEventReceiver, error),
+) (<-chan *pb.ConnectStreamEvent, <-chan error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	dataCh := make(chan *pb.ConnectStreamEvent)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(dataCh)
+		defer close(errCh)
+
+		if err := a.ensureConnectionClient(); err != nil {
+			errCh <- err
+			return
+		}
+
+		if id == uuid.Nil {
+			var err error
+			if id, err = a.connectStreamID(ctx); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		c := metadata.NewOutgoingContext(ctx, headersFor(id))
+
+		// Open with retries on transport errors.
+		policy := a.retryPolicyFor(ctx, OperationStream)
+		var stream connectEventReceiver
+		for attempt := 0; ; attempt++ {
+			s, err := open(c)
+			if err == nil {
+				stream = s
+				break
+			}
+			if !policy.retryableTransport(err) || attempt+1 >= policy.attempts() {
+				errCh <- err
+				return
+			}
+			a.logf("mt4: open connect stream: %v (attempt %d/%d)", err, attempt+1, policy.attempts())
+			if werr := waitWithCtx(ctx, policy.delay(attempt)); werr != nil {
+				errCh <- werr
+				return
+			}
+		}
+
+		for {
+			ev, err := stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					err = errors.New("connect stream ended before the final event")
+				}
+				errCh <- err
+				return
+			}
+
+			select {
+			case dataCh <- ev:
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+
+			if ev.GetIsFinal() {
+				if apiErr := ev.GetErrorData(); apiErr != nil {
+					errCh <- wrapAPIError(apiErr)
+				}
+				return
+			}
+		}
+	}()
+
+	return dataCh, errCh
+}
+
+// connectStreamID returns the id for the "id" header required by the connect streams:
+// the current session id, or a new one from GetId.
+func (a *MT4Account) connectStreamID(ctx context.Context) (uuid.UUID, error) {
+	if id := a.sessionID(); id != uuid.Nil {
+		return id, nil
+	}
+	id, err := a.GetId(ctx)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("connect stream: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,183 @@
+package mt4_test
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"testing"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+	"github.com/google/uuid"
+)
+
+func TestCheckConnect(t *testing.T) {
+	_, account := newTestAccount(t)
+	data, err := account.CheckConnect(testContext(t))
+	if err != nil {
+		t.Fatalf("CheckConnect: %v", err)
+	}
+	if !data.GetHealthCheck().GetIsAlive() || data.GetUniqueIdentifier() != account.Session().Id.String() {
+		t.Errorf("CheckConnect = %+v", data)
+	}
+}
+
+func TestLogoutEndsSession(t *testing.T) {
+	_, account := newTestAccount(t)
+	id := account.Session().Id
+
+	data, err := account.Logout(testContext(t))
+	if err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if data.GetUniqueIdentifier() != id.String() {
+		t.Errorf("Logout id = %q, want %s", data.GetUniqueIdentifier(), id)
+	}
+	if s := account.State(); s != mt4.StateDisconnected {
+		t.Errorf("state = %v, want disconnected", s)
+	}
+	if _, err := account.Quote(testContext(t), "EURUSD"); !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("Quote after Logout = %v, want ErrNotConnected", err)
+	}
+
+	// The remembered target still allows a reconnect.
+	if err := account.ConnectByHostPort(testContext(t), "mt4test", 443, "EURUSD", true, 30); err != nil {
+		t.Fatalf("ConnectByHostPort after Logout: %v", err)
+	}
+}
+
+func TestReconnectKeepsInstance(t *testing.T) {
+	_, account := newTestAccount(t)
+	id := account.Session().Id
+
+	data, err := account.Reconnect(testContext(t), true)
+	if err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	if !data.GetTerminalWasRecreated() || account.Session().Id != id {
+		t.Errorf("Reconnect = %+v, session %s (was %s)", data, account.Session().Id, id)
+	}
+}
+
+func TestGetIdIsDeterministic(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	newAccount := func(password string) *mt4.MT4Account {
+		a, err := mt4.NewMT4Account(100000, password, srv.AccountOptions()...)
+		if err != nil {
+			t.Fatalf("NewMT4Account: %v", err)
+		}
+		t.Cleanup(func() { _ = a.Disconnect() })
+		return a
+	}
+
+	a, err := newAccount("pw").GetId(testContext(t))
+	if err != nil {
+		t.Fatalf("GetId: %v", err)
+	}
+	b, _ := newAccount("pw").GetId(testContext(t))
+	c, _ := newAccount("other").GetId(testContext(t))
+	if a == uuid.Nil || a != b || a == c {
+		t.Errorf("ids = %s, %s, %s; want the same id for the same credentials only", a, b, c)
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	_, account := newTestAccount(t)
+	data, err := account.Screenshot(testContext(t))
+	if err != nil {
+		t.Fatalf("Screenshot: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data.GetImageData())); err != nil || data.GetContentType() != "image/png" {
+		t.Errorf("Screenshot = %s image: %v", data.GetContentType(), err)
+	}
+}
+
+func TestGetBrokerServersByBrokerName(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.AddBrokerServer("Example Markets Ltd", "ExampleMarkets-Demo", "demo.example.com:443")
+	srv.AddBrokerServer("Other Broker", "Other-Live")
+
+	data, err := account.GetBrokerServersByBrokerName(testContext(t), "example")
+	if err != nil {
+		t.Fatalf("GetBrokerServersByBrokerName: %v", err)
+	}
+	if len(data.GetResult()) != 1 || data.GetResult()[0].GetCompany() != "Example Markets Ltd" {
+		t.Errorf("result = %+v", data.GetResult())
+	}
+}
+
+func TestConnectViaProxy(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	account, err := mt4.NewMT4Account(100000, "", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	if err := account.ConnectViaProxy(testContext(t), "mt4test", 443, mt4.ProxySettings{}, "EURUSD", true, 30); err == nil {
+		t.Fatal("ConnectViaProxy accepted an empty proxy host")
+	}
+	proxy := mt4.ProxySettings{Type: pb.ProxyTypes_Socks5, Host: "proxy.local", Port: 1080}
+	if err := account.ConnectViaProxy(testContext(t), "mt4test", 443, proxy, "EURUSD", true, 30); err != nil {
+		t.Fatalf("ConnectViaProxy: %v", err)
+	}
+	if got := account.Session().Proxy; got != proxy {
+		t.Errorf("session proxy = %+v", got)
+	}
+	if got := srv.Calls("ConnectProxy"); got != 1 {
+		t.Errorf("ConnectProxy calls = %d, want 1", got)
+	}
+}
+
+func TestConnectStream(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	account, err := mt4.NewMT4Account(100000, "", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	dataCh, errCh := account.ConnectStream(testContext(t), "mt4test", 443, "EURUSD", true, 30)
+	var events []*pb.ConnectStreamEvent
+	for ev := range dataCh {
+		events = append(events, ev)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("ConnectStream: %v", err)
+	}
+	if len(events) < 2 || events[0].GetStep() != "Init" {
+		t.Fatalf("events = %v", events)
+	}
+	final := events[len(events)-1]
+	if !final.GetIsFinal() || final.GetConnectData().GetTerminalInstanceGuid() == "" {
+		t.Errorf("final event = %+v", final)
+	}
+	// Low-level: the session is not updated.
+	if account.Session().Id != uuid.Nil {
+		t.Errorf("ConnectStream set the session id")
+	}
+}
+
+func TestConnectStreamReportsLoginError(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	srv.SetCredentials(100000, "secret")
+	account, err := mt4.NewMT4Account(100000, "wrong", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	dataCh, errCh := account.ConnectStream(testContext(t), "mt4test", 443, "EURUSD", true, 30)
+	for range dataCh {
+	}
+	apiErr, ok := mt4.AsAPIError(<-errCh)
+	if !ok || apiErr.Code != "INVALID_ACCOUNT" {
+		t.Errorf("error = %v, want INVALID_ACCOUNT", apiErr)
+	}
+}
@@ -0,0 +1,97 @@
+package mt4
+
+import (
+	"context"
+	"fmt"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Currency conversion ===
+//
+// Profit and margin are computed in a symbol's own currencies (CurrencyProfit,
+// CurrencyMargin) and have to be brought into the account currency. ConversionRate looks
+// for a symbol quoting the pair among the terminal's symbols (SymbolParamsMany, cached):
+//
+//	FROM/TO  direct   rate = Bid
+//	TO/FROM  inverse  rate = 1 / Ask
+//
+// When several symbols match (e.g. "GBPUSD" and "GBPUSD.m"), the one with the suffix of
+// the traded symbol is preferred (see conversionRateFor).
+
+// ConversionRate returns the rate that converts an amount in currency from into currency to
+// (amount × rate) at the current quote.
+//
+// Parameters:
+//   - ctx: Context for the SymbolParamsMany / Quote calls.
+//   - from, to: Currency codes (e.g. "JPY", "USD").
+//
+// Returns:
+//   - The rate (1 when from == to).
+//   - The symbol it was taken from ("" when from == to).
+//   - ErrNoConversion when no symbol quotes the pair, or the error of the underlying calls.
+//
+// Example:
+//
+//	rate, symbol, err := account.ConversionRate(ctx, "GBP", "USD") // 1.27, "GBPUSD"
+func (a *MT4Account) ConversionRate(ctx context.Context, from, to string) (rate float64, symbol string, err error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return a.conversionRateFor(ctx, from, to, "")
+}
+
+// conversionRateFor implements ConversionRate, preferring symbols named like traded
+// (same suffix after the six currency letters).
+func (a *MT4Account) conversionRateFor(ctx context.Context, from, to, traded string) (float64, string, error) {
+	if from == "" || to == "" || from == to {
+		return 1, "", nil
+	}
+	if !a.isConnected() {
+		return 0, "", ErrNotConnected
+	}
+	specs, err := a.symbolSpecs.all(ctx, a, DefaultSymbolParamsTTL)
+	if err != nil {
+		return 0, "", err
+	}
+	var best *pb.SymbolParamsManyInfo
+	inverse := false
+	for _, p := range specs {
+		inv := false
+		switch {
+		case p.GetCurrencyBase() == from && p.GetCurrencyProfit() == to:
+		case p.GetCurrencyBase() == to && p.GetCurrencyProfit() == from:
+			inv = true
+		default:
+			continue
+		}
+		if best == nil || (symbolSuffix(p.GetSymbolName()) == symbolSuffix(traded) && symbolSuffix(best.GetSymbolName()) != symbolSuffix(traded)) {
+			best, inverse = p, inv
+		}
+	}
+	if best == nil {
+		return 0, "", fmt.Errorf("%s → %s: %w", from, to, ErrNoConversion)
+	}
+	q, err := a.Quote(ctx, best.GetSymbolName())
+	if err != nil {
+		return 0, "", err
+	}
+	if inverse {
+		if q.GetAsk() <= 0 {
+			return 0, "", fmt.Errorf("%s → %s: no ask price for %s", from, to, best.GetSymbolName())
+		}
+		return 1 / q.GetAsk(), best.GetSymbolName(), nil
+	}
+	if q.GetBid() <= 0 {
+		return 0, "", fmt.Errorf("%s → %s: no bid price for %s", from, to, best.GetSymbolName())
+	}
+	return q.GetBid(), best.GetSymbolName(), nil
+}
+
+// symbolSuffix returns what follows the six currency letters of a forex symbol ("EURUSD.m" → ".m").
+func symbolSuffix(symbol string) string {
+	if len(symbol) <= 6 {
+		return ""
+	}
+	return symbol[6:]
+}
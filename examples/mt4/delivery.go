@@ -0,0 +1,335 @@
+package mt4
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Stream delivery policies ===
+//
+// By default ExecuteStreamWithReconnect hands every message to an unbuffered channel, so a
+// slow consumer stalls the gRPC receive loop (and, through flow control, the server).
+// A DeliveryPolicy decouples the two:
+//
+//	DeliverBlock       buffered channel, the receive loop waits when it is full (default, Buffer 0 = unbuffered)
+//	DeliverDropOldest  buffered channel, the oldest undelivered message is discarded when it is full
+//	DeliverDropNewest  buffered channel, the incoming message is discarded when it is full
+//	DeliverConflate    undelivered messages with the same key are replaced by the newest one
+//
+// The policy is resolved per stream: ContextWithDeliveryPolicy → MT4Account.DeliveryPolicy → DeliverBlock.
+
+// DefaultDeliveryBuffer is the buffer of the dropping and conflating modes when DeliveryPolicy leaves it zero.
+const DefaultDeliveryBuffer = 1024
+
+// DeliveryMode selects what a stream does when its consumer falls behind.
+type DeliveryMode int
+
+const (
+	// DeliverBlock waits for the consumer (with Buffer messages of slack).
+	DeliverBlock DeliveryMode = iota
+	// DeliverDropOldest discards the oldest undelivered message to make room.
+	DeliverDropOldest
+	// DeliverDropNewest discards the incoming message when the buffer is full.
+	DeliverDropNewest
+	// DeliverConflate keeps only the latest undelivered message per key (see DeliveryPolicy.Key).
+	DeliverConflate
+)
+
+// String returns the mode name.
+func (m DeliveryMode) String() string {
+	switch m {
+	case DeliverBlock:
+		return "block"
+	case DeliverDropOldest:
+		return "drop-oldest"
+	case DeliverDropNewest:
+		return "drop-newest"
+	case DeliverConflate:
+		return "conflate"
+	}
+	return "unknown"
+}
+
+// DeliveryPolicy configures how a stream hands messages to its consumer.
+//
+// Example:
+//
+//	// Latest tick per symbol, never stall the stream.
+//	stats := &mt4.DeliveryStats{}
+//	ctx = mt4.ContextWithDeliveryPolicy(ctx, &mt4.DeliveryPolicy{Mode: mt4.DeliverConflate, Stats: stats})
+//	ticks, errs := account.OnSymbolTick(ctx, []string{"EURUSD", "GBPUSD"})
+//	...
+//	log.Printf("conflated %d ticks", stats.Conflated())
+type DeliveryPolicy struct {
+	// Mode selects the behavior when the consumer falls behind.
+	Mode DeliveryMode
+
+	// Buffer is the channel capacity (DeliverBlock: 0 = unbuffered; other modes:
+	// 0 = DefaultDeliveryBuffer). For DeliverConflate it bounds the undelivered keys;
+	// beyond it the oldest key is dropped.
+	Buffer int
+
+	// Key groups messages for DeliverConflate; messages with an empty key are never
+	// conflated (nil = DefaultConflateKey).
+	Key func(msg any) string
+
+	// Merge combines an undelivered message with a newer one of the same key
+	// (nil = DefaultConflateMerge).
+	Merge func(pending, next any) any
+
+	// Stats receives the counters of every stream using the policy (optional).
+	Stats *DeliveryStats
+}
+
+// DeliveryStats counts the fate of stream messages. Safe for concurrent use.
+type DeliveryStats struct {
+	received  atomic.Uint64
+	dropped   atomic.Uint64
+	conflated atomic.Uint64
+}
+
+// Received returns the number of messages received from the server.
+func (s *DeliveryStats) Received() uint64 { return s.received.Load() }
+
+// Dropped returns the number of messages discarded by DeliverDropOldest / DeliverDropNewest
+// (and by DeliverConflate beyond Buffer pending keys or when the stream ends).
+func (s *DeliveryStats) Dropped() uint64 { return s.dropped.Load() }
+
+// Conflated returns the number of messages merged into a newer one by DeliverConflate.
+func (s *DeliveryStats) Conflated() uint64 { return s.conflated.Load() }
+
+// DefaultConflateKey conflates ticks per symbol, profit updates per account and ticket
+// snapshots per account. Trade events (diffs) and unknown messages are never conflated.
+func DefaultConflateKey(msg any) string {
+	switch m := msg.(type) {
+	case *pb.OnSymbolTickData:
+		return "tick:" + m.GetSymbolTick().GetSymbol()
+	case *pb.OnOpenedOrdersProfitData:
+		return "profit"
+	case *pb.OnOpenedOrdersTicketsData:
+		return "tickets"
+	}
+	return ""
+}
+
+// DefaultConflateMerge keeps the newer message, except for profit updates: those are
+// merged per ticket, so the result holds the latest profit of every order seen in either.
+func DefaultConflateMerge(pending, next any) any {
+	older, ok1 := pending.(*pb.OnOpenedOrdersProfitData)
+	newer, ok2 := next.(*pb.OnOpenedOrdersProfitData)
+	if !ok1 || !ok2 {
+		return next
+	}
+	seen := make(map[int32]bool, len(newer.GetOpenedOrdersWithProfitUpdated()))
+	merged := &pb.OnOpenedOrdersProfitData{
+		Type:                   newer.GetType(),
+		AccountInfo:            newer.GetAccountInfo(),
+		TerminalInstanceGuidId: newer.GetTerminalInstanceGuidId(),
+	}
+	for _, o := range newer.GetOpenedOrdersWithProfitUpdated() {
+		seen[o.GetTicket()] = true
+	}
+	for _, o := range older.GetOpenedOrdersWithProfitUpdated() {
+		if !seen[o.GetTicket()] {
+			merged.OpenedOrdersWithProfitUpdated = append(merged.OpenedOrdersWithProfitUpdated, o)
+		}
+	}
+	merged.OpenedOrdersWithProfitUpdated = append(merged.OpenedOrdersWithProfitUpdated, newer.GetOpenedOrdersWithProfitUpdated()...)
+	return merged
+}
+
+type deliveryPolicyCtxKey struct{}
+
+// ContextWithDeliveryPolicy returns a context that sets the delivery policy of streams opened with it.
+func ContextWithDeliveryPolicy(ctx context.Context, p *DeliveryPolicy) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, deliveryPolicyCtxKey{}, p)
+}
+
+// DeliveryPolicyFromContext returns the policy set by ContextWithDeliveryPolicy, if any.
+func DeliveryPolicyFromContext(ctx context.Context) (*DeliveryPolicy, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(deliveryPolicyCtxKey{}).(*DeliveryPolicy)
+	return p, ok && p != nil
+}
+
+// deliveryPolicyFor resolves the effective policy for a stream (defaults applied).
+func (a *MT4Account) deliveryPolicyFor(ctx context.Context) DeliveryPolicy {
+	var p DeliveryPolicy
+	if cp, ok := DeliveryPolicyFromContext(ctx); ok {
+		p = *cp
+	} else if a != nil && a.DeliveryPolicy != nil {
+		p = *a.DeliveryPolicy
+	}
+	if p.Mode != DeliverBlock && p.Buffer <= 0 {
+		p.Buffer = DefaultDeliveryBuffer
+	}
+	if p.Buffer < 0 {
+		p.Buffer = 0
+	}
+	if p.Key == nil {
+		p.Key = DefaultConflateKey
+	}
+	if p.Merge == nil {
+		p.Merge = DefaultConflateMerge
+	}
+	if p.Stats == nil {
+		p.Stats = &DeliveryStats{}
+	}
+	return p
+}
+
+// deliverer hands stream messages to the consumer channel according to a DeliveryPolicy.
+// send is called from the stream goroutine only; close must be called once, after the last send.
+type deliverer[T any] struct {
+	policy DeliveryPolicy
+	ch     chan T
+
+	// DeliverConflate state: pending messages by key, in arrival order of their keys.
+	mu      sync.Mutex
+	order   []string
+	pending map[string]T
+	seq     uint64
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// newDeliverer creates the consumer channel and, for DeliverConflate, starts the forwarder.
+func newDeliverer[T any](ctx context.Context, policy DeliveryPolicy) *deliverer[T] {
+	d := &deliverer[T]{policy: policy}
+	if policy.Mode != DeliverConflate {
+		d.ch = make(chan T, policy.Buffer)
+		return d
+	}
+	d.ch = make(chan T)
+	d.pending = make(map[string]T)
+	d.wake = make(chan struct{}, 1)
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+	go d.forward(ctx)
+	return d
+}
+
+// send delivers msg; only DeliverBlock waits, and it fails with ctx.Err() when ctx is done.
+func (d *deliverer[T]) send(ctx context.Context, msg T) error {
+	stats := d.policy.Stats
+	stats.received.Add(1)
+	switch d.policy.Mode {
+	case DeliverDropNewest:
+		select {
+		case d.ch <- msg:
+		default:
+			stats.dropped.Add(1)
+		}
+	case DeliverDropOldest:
+		for {
+			select {
+			case d.ch <- msg:
+				return nil
+			default:
+			}
+			select {
+			case <-d.ch:
+				stats.dropped.Add(1)
+			default:
+			}
+		}
+	case DeliverConflate:
+		d.enqueue(msg)
+	default:
+		select {
+		case d.ch <- msg:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// enqueue adds msg to the conflation queue, merging it into a pending message of its key.
+func (d *deliverer[T]) enqueue(msg T) {
+	d.mu.Lock()
+	key := d.policy.Key(msg)
+	if key == "" {
+		// never conflated: a unique key keeps it in order
+		d.seq++
+		key = "\x00" + strconv.FormatUint(d.seq, 10)
+	}
+	if prev, ok := d.pending[key]; ok {
+		if merged, ok := d.policy.Merge(prev, msg).(T); ok {
+			msg = merged
+		}
+		d.pending[key] = msg
+		d.policy.Stats.conflated.Add(1)
+		d.mu.Unlock()
+		return
+	}
+	if len(d.order) >= d.policy.Buffer {
+		delete(d.pending, d.order[0])
+		d.order = d.order[1:]
+		d.policy.Stats.dropped.Add(1)
+	}
+	d.order = append(d.order, key)
+	d.pending[key] = msg
+	d.mu.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward delivers conflated messages in key order until close or ctx is done. A message
+// is taken off the queue before it is sent, so newer data of its key queues up behind it.
+func (d *deliverer[T]) forward(ctx context.Context) {
+	defer close(d.done)
+	for {
+		d.mu.Lock()
+		if len(d.order) == 0 {
+			d.mu.Unlock()
+			select {
+			case <-d.wake:
+				continue
+			case <-d.stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+		key := d.order[0]
+		msg := d.pending[key]
+		d.order = d.order[1:]
+		delete(d.pending, key)
+		d.mu.Unlock()
+
+		select {
+		case d.ch <- msg:
+		case <-d.stop:
+			d.policy.Stats.dropped.Add(1)
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// close closes the consumer channel; undelivered conflated messages are dropped.
+func (d *deliverer[T]) close() {
+	if d.policy.Mode == DeliverConflate {
+		close(d.stop)
+		<-d.done
+		d.mu.Lock()
+		d.policy.Stats.dropped.Add(uint64(len(d.order)))
+		d.mu.Unlock()
+	}
+	close(d.ch)
+}
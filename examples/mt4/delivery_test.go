@@ -0,0 +1,199 @@
+package mt4
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+// drain receives everything from ch until it is closed.
+func drain[T any](t *testing.T, ch <-chan T) []T {
+	t.Helper()
+	var out []T
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case v, ok := <-ch:
+			if !ok {
+				return out
+			}
+			out = append(out, v)
+		case <-timeout:
+			t.Fatalf("channel not closed, received %v", out)
+		}
+	}
+}
+
+func TestDeliverDropping(t *testing.T) {
+	tests := []struct {
+		mode    DeliveryMode
+		want    []int
+		dropped uint64
+	}{
+		{DeliverDropOldest, []int{4, 5}, 3},
+		{DeliverDropNewest, []int{1, 2}, 3},
+	}
+	for _, tt := range tests {
+		stats := &DeliveryStats{}
+		d := newDeliverer[int](context.Background(), DeliveryPolicy{Mode: tt.mode, Buffer: 2, Stats: stats})
+		for i := 1; i <= 5; i++ {
+			if err := d.send(context.Background(), i); err != nil {
+				t.Fatalf("%v: send: %v", tt.mode, err)
+			}
+		}
+		d.close()
+		if got := drain(t, d.ch); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: delivered %v, want %v", tt.mode, got, tt.want)
+		}
+		if stats.Received() != 5 || stats.Dropped() != tt.dropped {
+			t.Errorf("%v: received %d, dropped %d", tt.mode, stats.Received(), stats.Dropped())
+		}
+	}
+}
+
+func TestDeliverBlock(t *testing.T) {
+	d := newDeliverer[int](context.Background(), DeliveryPolicy{Mode: DeliverBlock, Buffer: 1, Stats: &DeliveryStats{}})
+	if err := d.send(context.Background(), 1); err != nil {
+		t.Fatalf("send into the buffer: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := d.send(ctx, 2); err != context.DeadlineExceeded {
+		t.Errorf("send on a full channel = %v, want the context error", err)
+	}
+	d.close()
+	if got := drain(t, d.ch); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("delivered %v", got)
+	}
+}
+
+func TestDeliverConflate(t *testing.T) {
+	stats := &DeliveryStats{}
+	key := func(msg any) string {
+		if s := msg.(string); s[0] != '!' {
+			return s[:1]
+		}
+		return "" // never conflated
+	}
+	d := newDeliverer[string](context.Background(), DeliveryPolicy{
+		Mode: DeliverConflate, Buffer: 3, Key: key, Merge: DefaultConflateMerge, Stats: stats,
+	})
+
+	// The forwarder takes the first message and blocks on the unbuffered channel;
+	// everything after it queues up.
+	_ = d.send(context.Background(), "a1")
+	for len(d.pendingKeys()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, msg := range []string{"a2", "b1", "a3", "!x", "b2"} {
+		_ = d.send(context.Background(), msg)
+	}
+	if got := d.pendingKeys(); len(got) != 3 {
+		t.Fatalf("pending keys = %v", got)
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, <-d.ch)
+	}
+	if want := []string{"a1", "a3", "b2", "!x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+	if stats.Received() != 6 || stats.Conflated() != 2 || stats.Dropped() != 0 {
+		t.Errorf("received %d, conflated %d, dropped %d", stats.Received(), stats.Conflated(), stats.Dropped())
+	}
+
+	// Beyond Buffer keys the oldest key is dropped; undelivered messages count as dropped on close.
+	_ = d.send(context.Background(), "c1")
+	for len(d.pendingKeys()) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, msg := range []string{"d1", "e1", "f1", "g1"} {
+		_ = d.send(context.Background(), msg)
+	}
+	d.close()
+	if got := drain(t, d.ch); len(got) != 0 {
+		t.Errorf("delivered after close: %v", got)
+	}
+	// c1 (held by the forwarder), d1 (evicted), e1, f1, g1 (pending on close)
+	if stats.Dropped() != 5 {
+		t.Errorf("dropped = %d, want 5", stats.Dropped())
+	}
+}
+
+// pendingKeys returns the queued conflation keys.
+func (d *deliverer[T]) pendingKeys() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.order...)
+}
+
+func TestDefaultConflateKey(t *testing.T) {
+	tests := []struct {
+		msg  any
+		want string
+	}{
+		{&pb.OnSymbolTickData{SymbolTick: &pb.OnSymbolMqlTickInfo{Symbol: "EURUSD"}}, "tick:EURUSD"},
+		{&pb.OnOpenedOrdersProfitData{}, "profit"},
+		{&pb.OnOpenedOrdersTicketsData{}, "tickets"},
+		{&pb.OnTradeData{}, ""},
+		{"other", ""},
+	}
+	for _, tt := range tests {
+		if got := DefaultConflateKey(tt.msg); got != tt.want {
+			t.Errorf("DefaultConflateKey(%T) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestDefaultConflateMerge(t *testing.T) {
+	profit := func(tickets ...int32) *pb.OnOpenedOrdersProfitData {
+		d := &pb.OnOpenedOrdersProfitData{}
+		for _, tk := range tickets {
+			d.OpenedOrdersWithProfitUpdated = append(d.OpenedOrdersWithProfitUpdated,
+				&pb.OnOpenedOrdersProfitOrderInfo{Ticket: tk, OrderProfit: float64(tk)})
+		}
+		return d
+	}
+	older, newer := profit(1, 2), profit(2, 3)
+	newer.OpenedOrdersWithProfitUpdated[0].OrderProfit = 20
+
+	merged := DefaultConflateMerge(older, newer).(*pb.OnOpenedOrdersProfitData)
+	got := map[int32]float64{}
+	for _, o := range merged.GetOpenedOrdersWithProfitUpdated() {
+		got[o.GetTicket()] = o.GetOrderProfit()
+	}
+	if want := map[int32]float64{1: 1, 2: 20, 3: 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merged profits = %v, want %v", got, want)
+	}
+
+	tick := &pb.OnSymbolTickData{}
+	if DefaultConflateMerge(&pb.OnSymbolTickData{}, tick) != tick {
+		t.Error("non-profit messages are not replaced by the newer one")
+	}
+}
+
+func TestDeliveryPolicyFor(t *testing.T) {
+	account := &MT4Account{DeliveryPolicy: &DeliveryPolicy{Mode: DeliverDropNewest, Buffer: 8}}
+
+	p := account.deliveryPolicyFor(context.Background())
+	if p.Mode != DeliverDropNewest || p.Buffer != 8 || p.Key == nil || p.Merge == nil || p.Stats == nil {
+		t.Errorf("account policy = %+v", p)
+	}
+
+	ctx := ContextWithDeliveryPolicy(context.Background(), &DeliveryPolicy{Mode: DeliverConflate})
+	if p := account.deliveryPolicyFor(ctx); p.Mode != DeliverConflate || p.Buffer != DefaultDeliveryBuffer {
+		t.Errorf("context policy = %+v", p)
+	}
+
+	if p := (&MT4Account{}).deliveryPolicyFor(context.Background()); p.Mode != DeliverBlock || p.Buffer != 0 {
+		t.Errorf("default policy = %+v", p)
+	}
+	if _, ok := DeliveryPolicyFromContext(ContextWithDeliveryPolicy(context.Background(), nil)); ok {
+		t.Error("nil policy in the context reported as set")
+	}
+}
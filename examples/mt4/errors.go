@@ -0,0 +1,271 @@
+package mt4
+
+import (
+	"errors"
+	"fmt"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+// ErrNotConnected is returned by MT4Account methods called before a successful connect.
+var ErrNotConnected = errors.New("not connected")
+
+// ErrAccountClosed is returned when connecting an account after Disconnect.
+// It satisfies errors.Is(err, ErrNotConnected).
+var ErrAccountClosed = fmt.Errorf("account closed: %w", ErrNotConnected)
+
+// AccountPool errors.
+var (
+	ErrPoolClosed     = errors.New("account pool closed")
+	ErrPoolFull       = errors.New("account pool full")
+	ErrDuplicateLogin = errors.New("login already in account pool")
+)
+
+// ErrStreamStalled ends a stream whose watchdog fired more often in a row than the
+// stream retry policy allows (see StallPolicy).
+var ErrStreamStalled = errors.New("stream stalled")
+
+// ErrNoBrokerServer is returned by ConnectByBroker when no candidate server accepted the login.
+var ErrNoBrokerServer = errors.New("no broker server accepted the login")
+
+// ErrNoConversion is returned by ConversionRate when no symbol quotes the currency pair.
+var ErrNoConversion = errors.New("no symbol converts between the currencies")
+
+// ErrRiskLimit is satisfied by the *RiskError of an order refused by a RiskGuard.
+var ErrRiskLimit = errors.New("risk limit exceeded")
+
+// ErrKillSwitch is satisfied by the *RiskError of an OrderSend refused while the RiskGuard
+// kill switch is tripped. It satisfies errors.Is(err, ErrRiskLimit).
+var ErrKillSwitch = fmt.Errorf("kill switch active: %w", ErrRiskLimit)
+
+// ErrUnknownGroup is returned by OrderGroups.Cancel for an id it does not supervise.
+var ErrUnknownGroup = errors.New("unknown order group")
+
+// Sentinel errors matched by *APIError via errors.Is.
+//
+// Example:
+//
+//	_, err := account.OrderSend(...)
+//	switch {
+//	case errors.Is(err, mt4.ErrRequote):
+//	    // refresh price and retry
+//	case errors.Is(err, mt4.ErrNotEnoughMoney):
+//	    // reduce volume
+//	}
+var (
+	ErrRequote          = errors.New("requote")
+	ErrOffQuotes        = errors.New("off quotes")
+	ErrNotEnoughMoney   = errors.New("not enough money")
+	ErrMarketClosed     = errors.New("market closed")
+	ErrTradeDisabled    = errors.New("trade disabled")
+	ErrInvalidStops     = errors.New("invalid stops")
+	ErrInvalidVolume    = errors.New("invalid trade volume")
+	ErrInvalidPrice     = errors.New("invalid price")
+	ErrInvalidTicket    = errors.New("invalid ticket")
+	ErrTradeContextBusy = errors.New("trade context busy")
+	ErrServerBusy       = errors.New("server busy")
+	ErrTooManyRequests  = errors.New("too many requests")
+	ErrNoConnection     = errors.New("no connection with trade server")
+	ErrTradeTimeout     = errors.New("trade timeout")
+	ErrOrderLocked      = errors.New("order locked")
+	ErrModifyDenied     = errors.New("trade modify denied")
+	ErrTooManyOrders    = errors.New("too many orders")
+	ErrHedgeProhibited  = errors.New("hedge prohibited")
+	ErrFIFOProhibited   = errors.New("prohibited by FIFO rules")
+	ErrExpirationDenied = errors.New("expiration denied")
+	ErrUnknownSymbol    = errors.New("unknown symbol")
+	ErrAccountDisabled  = errors.New("account disabled")
+	ErrTerminalNotFound = errors.New("terminal instance not found")
+)
+
+// mqlSentinels maps MqlErrorCode values to the sentinel they satisfy.
+var mqlSentinels = map[pb.MqlErrorCode]error{
+	pb.MqlErrorCode_ERR_REQUOTE:                         ErrRequote,
+	pb.MqlErrorCode_ERR_PRICE_CHANGED:                   ErrRequote,
+	pb.MqlErrorCode_ERR_OFF_QUOTES:                      ErrOffQuotes,
+	pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY:                ErrNotEnoughMoney,
+	pb.MqlErrorCode_ERR_MARKET_CLOSED:                   ErrMarketClosed,
+	pb.MqlErrorCode_ERR_TRADE_DISABLED:                  ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_TRADE_NOT_ALLOWED:               ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_TRADE_EXPERT_DISABLED_BY_SERVER: ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_LONGS_NOT_ALLOWED:               ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_SHORTS_NOT_ALLOWED:              ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_LONG_POSITIONS_ONLY_ALLOWED:     ErrTradeDisabled,
+	pb.MqlErrorCode_ERR_INVALID_STOPS:                   ErrInvalidStops,
+	pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME:            ErrInvalidVolume,
+	pb.MqlErrorCode_ERR_INVALID_PRICE:                   ErrInvalidPrice,
+	pb.MqlErrorCode_ERR_INVALID_PRICE_PARAM:             ErrInvalidPrice,
+	pb.MqlErrorCode_ERR_INVALID_TICKET:                  ErrInvalidTicket,
+	pb.MqlErrorCode_ERR_NO_ORDER_SELECTED:               ErrInvalidTicket,
+	pb.MqlErrorCode_ERR_TRADE_CONTEXT_BUSY:              ErrTradeContextBusy,
+	pb.MqlErrorCode_ERR_SERVER_BUSY:                     ErrServerBusy,
+	pb.MqlErrorCode_ERR_BROKER_BUSY:                     ErrServerBusy,
+	pb.MqlErrorCode_ERR_TOO_FREQUENT_REQUESTS:           ErrTooManyRequests,
+	pb.MqlErrorCode_ERR_TOO_MANY_REQUESTS:               ErrTooManyRequests,
+	pb.MqlErrorCode_ERR_NO_CONNECTION:                   ErrNoConnection,
+	pb.MqlErrorCode_ERR_TRADE_TIMEOUT:                   ErrTradeTimeout,
+	pb.MqlErrorCode_ERR_ORDER_LOCKED:                    ErrOrderLocked,
+	pb.MqlErrorCode_ERR_TRADE_MODIFY_DENIED:             ErrModifyDenied,
+	pb.MqlErrorCode_ERR_TRADE_TOO_MANY_ORDERS:           ErrTooManyOrders,
+	pb.MqlErrorCode_ERR_TRADE_HEDGE_PROHIBITED:          ErrHedgeProhibited,
+	pb.MqlErrorCode_ERR_TRADE_PROHIBITED_BY_FIFO:        ErrFIFOProhibited,
+	pb.MqlErrorCode_ERR_TRADE_EXPIRATION_DENIED:         ErrExpirationDenied,
+	pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL:                  ErrUnknownSymbol,
+	pb.MqlErrorCode_ERR_ACCOUNT_DISABLED:                ErrAccountDisabled,
+	pb.MqlErrorCode_ERR_INVALID_ACCOUNT:                 ErrAccountDisabled,
+}
+
+// codeSentinels maps pb.Error.ErrorCode strings to the sentinel they satisfy.
+var codeSentinels = map[string]error{
+	"TERMINAL_INSTANCE_NOT_FOUND":          ErrTerminalNotFound,
+	"TERMINAL_REGISTRY_TERMINAL_NOT_FOUND": ErrTerminalNotFound,
+}
+
+// APIError is an application-level error returned by the MT4 terminal API (pb.Error).
+// Every MT4Account method returns it (possibly wrapped) when the server replies with an error,
+// so callers can use errors.As to inspect it or errors.Is with the sentinels above.
+type APIError struct {
+	// Type is the error source (MRPC, terminal API, MQL execution, ...).
+	Type pb.ErrorType
+
+	// Code is the server error code (e.g. "TERMINAL_INSTANCE_NOT_FOUND").
+	Code string
+
+	// Message is the human-readable error message.
+	Message string
+
+	// MqlErrorCode is the MQL4 error (e.g. ERR_REQUOTE) for trade/MQL failures.
+	MqlErrorCode pb.MqlErrorCode
+
+	// MqlErrorIntCode is the raw MQL4 error number (GetLastError()).
+	MqlErrorIntCode int32
+
+	// MqlErrorDescription is the MQL4 error description.
+	MqlErrorDescription string
+
+	// CommandTypeName is the name of the terminal command that failed.
+	CommandTypeName string
+
+	// CommandId identifies the terminal command that failed.
+	CommandId int64
+
+	// StackTrace is the server-side stack trace (if provided).
+	StackTrace string
+
+	// Properties holds additional key/value error arguments.
+	Properties map[string]string
+
+	// Raw is the original protobuf error.
+	Raw *pb.Error
+}
+
+// NewAPIError converts a pb.Error into *APIError. Returns nil for nil input.
+func NewAPIError(apiErr *pb.Error) *APIError {
+	if apiErr == nil {
+		return nil
+	}
+	e := &APIError{
+		Type:                apiErr.GetType(),
+		Code:                apiErr.GetErrorCode(),
+		Message:             apiErr.GetErrorMessage(),
+		MqlErrorCode:        apiErr.GetMqlErrorCode(),
+		MqlErrorIntCode:     apiErr.GetMqlErrorIntCode(),
+		MqlErrorDescription: apiErr.GetMqlErrorDescription(),
+		CommandTypeName:     apiErr.GetCommandTypeName(),
+		CommandId:           apiErr.GetCommandId(),
+		StackTrace:          apiErr.GetStackTrace(),
+		Raw:                 apiErr,
+	}
+	if props := apiErr.GetProperties(); len(props) > 0 {
+		e.Properties = make(map[string]string, len(props))
+		for _, p := range props {
+			e.Properties[p.GetErrorArgKey()] = p.GetErrorArgValue()
+		}
+	}
+	return e
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("API error (code=%s): %s", e.Code, e.Message)
+	if e.MqlErrorCode != pb.MqlErrorCode_ERR_NO_ERROR || e.MqlErrorIntCode != 0 {
+		msg += fmt.Sprintf(" [mql=%s(%d)", e.MqlErrorCode, e.MqlErrorIntCode)
+		if e.MqlErrorDescription != "" {
+			msg += ": " + e.MqlErrorDescription
+		}
+		msg += "]"
+	}
+	return msg
+}
+
+// Is reports whether e matches target: either a sentinel from this package
+// or another *APIError with the same Code / MqlErrorCode (zero fields in target match anything).
+func (e *APIError) Is(target error) bool {
+	if t, ok := target.(*APIError); ok {
+		if t.Code != "" && t.Code != e.Code {
+			return false
+		}
+		if t.MqlErrorCode != pb.MqlErrorCode_ERR_NO_ERROR && t.MqlErrorCode != e.MqlErrorCode {
+			return false
+		}
+		return true
+	}
+	if s, ok := mqlSentinels[e.MqlErrorCode]; ok && s == target {
+		return true
+	}
+	if s, ok := codeSentinels[e.Code]; ok && s == target {
+		return true
+	}
+	return false
+}
+
+// AsAPIError returns the *APIError inside err, if any.
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsRequote reports whether err is a requote / price-changed rejection.
+func IsRequote(err error) bool { return errors.Is(err, ErrRequote) }
+
+// IsOffQuotes reports whether err is an off-quotes rejection.
+func IsOffQuotes(err error) bool { return errors.Is(err, ErrOffQuotes) }
+
+// IsNotEnoughMoney reports whether err is a not-enough-money rejection.
+func IsNotEnoughMoney(err error) bool { return errors.Is(err, ErrNotEnoughMoney) }
+
+// IsMarketClosed reports whether err is a market-closed rejection.
+func IsMarketClosed(err error) bool { return errors.Is(err, ErrMarketClosed) }
+
+// IsTradeDisabled reports whether trading is disabled/not allowed for the account or symbol.
+func IsTradeDisabled(err error) bool { return errors.Is(err, ErrTradeDisabled) }
+
+// IsInvalidStops reports whether err is an invalid-stops rejection.
+func IsInvalidStops(err error) bool { return errors.Is(err, ErrInvalidStops) }
+
+// IsInvalidVolume reports whether err is an invalid-volume rejection.
+func IsInvalidVolume(err error) bool { return errors.Is(err, ErrInvalidVolume) }
+
+// IsInvalidPrice reports whether err is an invalid-price rejection.
+func IsInvalidPrice(err error) bool { return errors.Is(err, ErrInvalidPrice) }
+
+// IsInvalidTicket reports whether err refers to a missing/invalid ticket.
+func IsInvalidTicket(err error) bool { return errors.Is(err, ErrInvalidTicket) }
+
+// IsTradeContextBusy reports whether the terminal trade context was busy.
+func IsTradeContextBusy(err error) bool { return errors.Is(err, ErrTradeContextBusy) }
+
+// IsServerBusy reports whether the trade server or broker was busy.
+func IsServerBusy(err error) bool { return errors.Is(err, ErrServerBusy) }
+
+// IsTooManyRequests reports whether the server throttled the request.
+func IsTooManyRequests(err error) bool { return errors.Is(err, ErrTooManyRequests) }
+
+// IsTerminalNotFound reports whether the terminal instance (session GUID) is gone.
+func IsTerminalNotFound(err error) bool { return errors.Is(err, ErrTerminalNotFound) }
+
+// IsNotConnected reports whether the account was not connected.
+func IsNotConnected(err error) bool { return errors.Is(err, ErrNotConnected) }
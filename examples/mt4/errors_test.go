@@ -0,0 +1,138 @@
+package mt4_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+func TestAPIErrorIsSentinels(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    *pb.Error
+		target error
+		want   bool
+	}{
+		{"requote", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_REQUOTE), mt4.ErrRequote, true},
+		{"price changed is a requote", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_PRICE_CHANGED), mt4.ErrRequote, true},
+		{"no money", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY), mt4.ErrNotEnoughMoney, true},
+		{"longs not allowed is trade disabled", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_LONGS_NOT_ALLOWED), mt4.ErrTradeDisabled, true},
+		{"trade timeout", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_TIMEOUT), mt4.ErrTradeTimeout, true},
+		{"terminal not found by code", mt4test.APIError("TERMINAL_INSTANCE_NOT_FOUND", pb.MqlErrorCode_ERR_NO_ERROR), mt4.ErrTerminalNotFound, true},
+		{"registry not found by code", mt4test.APIError("TERMINAL_REGISTRY_TERMINAL_NOT_FOUND", pb.MqlErrorCode_ERR_NO_ERROR), mt4.ErrTerminalNotFound, true},
+		{"requote is not no money", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_REQUOTE), mt4.ErrNotEnoughMoney, false},
+		{"unmapped code", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_COMMON_ERROR), mt4.ErrRequote, false},
+		{"foreign error", mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_REQUOTE), errors.New("requote"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", mt4.NewAPIError(tt.err))
+			if got := errors.Is(err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIErrorIsAPIErrorTemplate(t *testing.T) {
+	err := mt4.NewAPIError(mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_INVALID_STOPS))
+	tests := []struct {
+		name   string
+		target *mt4.APIError
+		want   bool
+	}{
+		{"empty template matches any", &mt4.APIError{}, true},
+		{"same code", &mt4.APIError{Code: "MQL_ERROR"}, true},
+		{"same mql", &mt4.APIError{MqlErrorCode: pb.MqlErrorCode_ERR_INVALID_STOPS}, true},
+		{"both match", &mt4.APIError{Code: "MQL_ERROR", MqlErrorCode: pb.MqlErrorCode_ERR_INVALID_STOPS}, true},
+		{"other code", &mt4.APIError{Code: "TERMINAL_INSTANCE_NOT_FOUND"}, false},
+		{"other mql", &mt4.APIError{MqlErrorCode: pb.MqlErrorCode_ERR_REQUOTE}, false},
+	}
+	for _, tt := range tests {
+		if got := errors.Is(err, tt.target); got != tt.want {
+			t.Errorf("%s: errors.Is = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewAPIError(t *testing.T) {
+	if mt4.NewAPIError(nil) != nil {
+		t.Error("NewAPIError(nil) != nil")
+	}
+
+	raw := mt4test.APIError("MQL_ERROR", pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)
+	raw.Properties = []*pb.ErrorProperty{{ErrorArgKey: "volume", ErrorArgValue: "0.001"}}
+	e := mt4.NewAPIError(raw)
+	if e.Code != "MQL_ERROR" || e.MqlErrorCode != pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME || e.MqlErrorIntCode != int32(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME) {
+		t.Errorf("fields not copied: %+v", e)
+	}
+	if e.Properties["volume"] != "0.001" {
+		t.Errorf("Properties = %v", e.Properties)
+	}
+	if e.Raw != raw {
+		t.Error("Raw is not the original error")
+	}
+	msg := e.Error()
+	if !strings.Contains(msg, "code=MQL_ERROR") || !strings.Contains(msg, "ERR_INVALID_TRADE_VOLUME") {
+		t.Errorf("Error() = %q", msg)
+	}
+	if msg := mt4.NewAPIError(&pb.Error{ErrorCode: "X", ErrorMessage: "boom"}).Error(); strings.Contains(msg, "mql=") {
+		t.Errorf("Error() without MQL code = %q", msg)
+	}
+}
+
+func TestErrorPredicates(t *testing.T) {
+	apiErr := func(mql pb.MqlErrorCode) error {
+		return fmt.Errorf("call: %w", mt4.NewAPIError(mt4test.APIError("MQL_ERROR", mql)))
+	}
+	tests := []struct {
+		name string
+		pred func(error) bool
+		err  error
+	}{
+		{"IsRequote", mt4.IsRequote, apiErr(pb.MqlErrorCode_ERR_REQUOTE)},
+		{"IsOffQuotes", mt4.IsOffQuotes, apiErr(pb.MqlErrorCode_ERR_OFF_QUOTES)},
+		{"IsNotEnoughMoney", mt4.IsNotEnoughMoney, apiErr(pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY)},
+		{"IsMarketClosed", mt4.IsMarketClosed, apiErr(pb.MqlErrorCode_ERR_MARKET_CLOSED)},
+		{"IsTradeDisabled", mt4.IsTradeDisabled, apiErr(pb.MqlErrorCode_ERR_TRADE_DISABLED)},
+		{"IsInvalidStops", mt4.IsInvalidStops, apiErr(pb.MqlErrorCode_ERR_INVALID_STOPS)},
+		{"IsInvalidVolume", mt4.IsInvalidVolume, apiErr(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)},
+		{"IsInvalidPrice", mt4.IsInvalidPrice, apiErr(pb.MqlErrorCode_ERR_INVALID_PRICE)},
+		{"IsInvalidTicket", mt4.IsInvalidTicket, apiErr(pb.MqlErrorCode_ERR_INVALID_TICKET)},
+		{"IsTradeContextBusy", mt4.IsTradeContextBusy, apiErr(pb.MqlErrorCode_ERR_TRADE_CONTEXT_BUSY)},
+		{"IsServerBusy", mt4.IsServerBusy, apiErr(pb.MqlErrorCode_ERR_BROKER_BUSY)},
+		{"IsTooManyRequests", mt4.IsTooManyRequests, apiErr(pb.MqlErrorCode_ERR_TOO_MANY_REQUESTS)},
+		{"IsNotConnected", mt4.IsNotConnected, mt4.ErrAccountClosed},
+	}
+	for _, tt := range tests {
+		if !tt.pred(tt.err) {
+			t.Errorf("%s(%v) = false", tt.name, tt.err)
+		}
+		if tt.pred(errors.New("other")) {
+			t.Errorf("%s(other) = true", tt.name)
+		}
+	}
+}
+
+func TestAPIErrorFromFakeServer(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNextAPI("OrderSend", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY)
+
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrNotEnoughMoney) {
+		t.Fatalf("OrderSend error = %v, want ErrNotEnoughMoney", err)
+	}
+	apiErr, ok := mt4.AsAPIError(err)
+	if !ok || apiErr.MqlErrorCode != pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY {
+		t.Errorf("AsAPIError = %+v, %v", apiErr, ok)
+	}
+	if _, ok := mt4.AsAPIError(errors.New("plain")); ok {
+		t.Error("AsAPIError matched a plain error")
+	}
+}
@@ -0,0 +1,75 @@
+package mt4_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fastRetries keeps the backoff of retried calls in the millisecond range.
+var fastRetries = &mt4.RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// errUnavailable is a retryable transport failure for fault injection.
+var errUnavailable = status.Error(codes.Unavailable, "mt4test: injected")
+
+// newTestAccount starts a fake server and returns an account connected to it.
+// Both are closed when the test ends; opts are applied after the fast retry policy.
+func newTestAccount(t *testing.T, opts ...mt4.Option) (*mt4test.Server, *mt4.MT4Account) {
+	t.Helper()
+	srv := mt4test.NewServer()
+	t.Cleanup(srv.Close)
+	account, err := srv.NewAccount(testContext(t), append([]mt4.Option{mt4.WithRetryPolicy(fastRetries)}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	t.Cleanup(func() { _ = account.Disconnect() })
+	return srv, account
+}
+
+// testContext returns a context canceled when the test ends or after 10 seconds.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// buy opens a market buy on the fake through account and returns its ticket.
+func buy(t *testing.T, account *mt4.MT4Account, symbol string, lots float64) int32 {
+	t.Helper()
+	return send(t, account, symbol, pb.OrderSendOperationType_OC_OP_BUY, lots)
+}
+
+// send places a market order on the fake through account and returns its ticket.
+func send(t *testing.T, account *mt4.MT4Account, symbol string, op pb.OrderSendOperationType, lots float64) int32 {
+	t.Helper()
+	data, err := account.OrderSend(testContext(t), symbol, op, lots, nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSend(%s %v %.2f): %v", symbol, op, lots, err)
+	}
+	return data.GetTicket()
+}
+
+// eventually polls cond every few milliseconds until it holds or two seconds have passed.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,536 @@
+package mt4
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//=== 📂 Idempotent Order Operations ===
+//
+// ExecuteWithReconnect retries on codes.Unavailable and TERMINAL_INSTANCE_NOT_FOUND,
+// but the failed attempt may already have reached the terminal. For trade calls that
+// means a retry can open (or close) a position twice. The *Idempotent variants below
+// reconcile against OpenedOrders / OrdersHistory before every retry and return the
+// already-executed result instead of re-sending.
+
+const (
+	// clientOrderIDPrefix marks the client order id inside the order comment.
+	clientOrderIDPrefix = "cid:"
+	// clientOrderIDLen is the number of hex characters in a generated client order id.
+	clientOrderIDLen = 12
+	// maxCommentLen is the MT4 limit for an order comment.
+	maxCommentLen = 31
+	// maxClientOrderIDLen is the longest client order id that fits the comment with its prefix.
+	maxClientOrderIDLen = maxCommentLen - len(clientOrderIDPrefix)
+	// reconcileHistoryWindow widens history lookups to tolerate server/local clock shifts.
+	reconcileHistoryWindow = 24 * time.Hour
+	// reconcileHistoryPageSize is the page size used when scanning history during reconcile.
+	reconcileHistoryPageSize int32 = 100
+	// priceEpsilon is the tolerance used when comparing prices returned by the terminal.
+	priceEpsilon = 1e-8
+)
+
+// NewClientOrderID returns a short random id suitable for OrderSendIdempotent.
+func NewClientOrderID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")[:clientOrderIDLen]
+}
+
+// ClientOrderIDFromComment extracts the client order id from an order comment.
+// Returns false if the comment carries no id.
+func ClientOrderIDFromComment(comment string) (string, bool) {
+	i := strings.Index(comment, clientOrderIDPrefix)
+	if i < 0 {
+		return "", false
+	}
+	rest := comment[i+len(clientOrderIDPrefix):]
+	if j := strings.IndexAny(rest, " [("); j >= 0 {
+		rest = rest[:j]
+	}
+	if rest == "" {
+		return "", false
+	}
+	return rest, true
+}
+
+// taggedComment builds the order comment "cid:<id> <comment>", truncated to the MT4 limit.
+// The tag comes first, so only the comment is cut as long as the id is at most
+// maxClientOrderIDLen characters (OrderSendIdempotent refuses longer ids).
+func taggedComment(clientOrderID string, comment *string) string {
+	c := clientOrderIDPrefix + clientOrderID
+	if comment != nil && *comment != "" {
+		c += " " + *comment
+	}
+	if len(c) > maxCommentLen {
+		c = c[:maxCommentLen]
+	}
+	return c
+}
+
+// OrderSendIdempotent places a new order tagged with a client order id and never double-fills on retry.
+//
+// Parameters:
+//   - ctx: Context used for request cancellation or timeout control.
+//   - clientOrderID: Caller-chosen unique id (see NewClientOrderID), at most 27 characters
+//     without spaces or brackets. Empty = generate one.
+//     If an order with this id is opened (or was closed within the last 24h), it is returned
+//     instead of sending a new one.
+//   - symbol, operationType, volume, price, slippage, stoploss, takeprofit, magicNumber, expiration:
+//     Same as OrderSend.
+//   - comment: Optional comment; it is appended after the "cid:<id>" tag and truncated to 31 chars.
+//
+// Returns:
+//   - Pointer to OrderSendData of the executed order (either from this call or found during reconcile).
+//   - Error if the operation fails.
+//
+// Before each retry the method looks for an order carrying the same tag in OpenedOrders and then in
+// OrdersHistory (the position may already have been closed by SL/TP). If one is found, its data is
+// returned and nothing is re-sent.
+func (a *MT4Account) OrderSendIdempotent(
+	ctx context.Context,
+	clientOrderID string,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price *float64,
+	slippage *int32,
+	stoploss *float64,
+	takeprofit *float64,
+	comment *string,
+	magicNumber *int32,
+	expiration *timestamppb.Timestamp,
+) (*pb.OrderSendData, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureTradeClient(); err != nil {
+		return nil, err
+	}
+
+	reused := clientOrderID != ""
+	if !reused {
+		clientOrderID = NewClientOrderID()
+	}
+	if strings.ContainsAny(clientOrderID, " [(") {
+		return nil, fmt.Errorf("invalid client order id %q: must not contain spaces or brackets", clientOrderID)
+	}
+	if len(clientOrderID) > maxClientOrderIDLen {
+		// A longer id would be cut from the comment, and the order would not be found before a retry.
+		return nil, fmt.Errorf("invalid client order id %q: longer than %d characters", clientOrderID, maxClientOrderIDLen)
+	}
+
+	// Pre-trade checks (see ValidationPolicy) run under the read deadline; the normalized values are sent.
+	checkCtx, cancelChecks := a.withReadTimeout(ctx)
+	defer cancelChecks()
+	if policy, ok := a.validationPolicyFor(checkCtx); ok {
+		chk, err := a.validateOrderSend(checkCtx, policy, symbol, operationType, volume, price, stoploss, takeprofit)
+		if err != nil {
+			return nil, err
+		}
+		volume, price, stoploss, takeprofit = chk.Volume, chk.Price, chk.StopLoss, chk.TakeProfit
+	}
+
+	// Account risk limits and kill switch (see NewRiskGuard).
+	if err := a.riskCheckSend(checkCtx, symbol, operationType, volume, price); err != nil {
+		return nil, err
+	}
+	cancelChecks()
+
+	// The trade deadline covers the order itself, not the checks before it.
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // trades usually tolerate a slightly longer timeout
+		defer cancel()
+	}
+
+	req := &pb.OrderSendRequest{
+		Symbol:        symbol,
+		OperationType: operationType,
+		Volume:        volume,
+		Price:         price,
+		Slippage:      slippage,
+		Stoploss:      stoploss,
+		Takeprofit:    takeprofit,
+		Comment:       proto.String(taggedComment(clientOrderID, comment)),
+		MagicNumber:   magicNumber,
+		Expiration:    expiration,
+	}
+
+	since := time.Now()
+	reconcile := func(c context.Context) (*pb.OrderSendReply, bool, error) {
+		data, err := a.findOrderByClientID(c, clientOrderID, since)
+		if err != nil || data == nil {
+			return nil, false, err
+		}
+		return &pb.OrderSendReply{Response: &pb.OrderSendReply_Data{Data: data}}, true, nil
+	}
+
+	// A caller-supplied id may belong to an order sent by an earlier process run.
+	if reused {
+		if reply, done, err := reconcile(ctx); err != nil {
+			return nil, err
+		} else if done {
+			return reply.GetData(), nil
+		}
+	}
+
+	grpcCall := func(headers metadata.MD) (*pb.OrderSendReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.TradeClient.OrderSend(c, req)
+	}
+
+	errorSelector := func(reply *pb.OrderSendReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, reconcile)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+// OrderCloseIdempotent closes or deletes an order like OrderClose, but never closes twice on retry.
+//
+// Before each retry the method checks whether the ticket is still among the opened orders.
+// If it is gone, the close is treated as executed and the history record is used to fill the result.
+// Note that a partial close in MT4 also removes the original ticket (the remainder gets a new one).
+func (a *MT4Account) OrderCloseIdempotent(
+	ctx context.Context,
+	ticket int32,
+	lots, price *float64,
+	slippage *int32,
+) (*pb.OrderCloseDeleteData, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // closing trades may take a bit longer
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureTradeClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.OrderCloseDeleteRequest{
+		OrderTicket:  ticket,
+		Lots:         lots,
+		ClosingPrice: price,
+		Slippage:     slippage,
+	}
+
+	since := time.Now()
+	reconcile := func(c context.Context) (*pb.OrderCloseDeleteReply, bool, error) {
+		open, err := a.findOpenedOrder(c, ticket)
+		if err != nil || open != nil {
+			return nil, false, err
+		}
+		data := &pb.OrderCloseDeleteData{Mode: pb.OrderCloseDeleteMode_OCD_MARKET_ORDER}
+		hist, err := a.findHistoryOrder(c, since, func(o *pb.HistoryOrderInfo) bool { return o.GetTicket() == ticket })
+		if err != nil {
+			return nil, false, err
+		}
+		if hist != nil {
+			if isPendingOrderType(hist.GetOrderType()) {
+				data.Mode = pb.OrderCloseDeleteMode_OCD_PENDING_ORDER
+			}
+			data.HistoryOrderComment = proto.String(hist.GetComment())
+		}
+		return &pb.OrderCloseDeleteReply{Response: &pb.OrderCloseDeleteReply_Data{Data: data}}, true, nil
+	}
+
+	grpcCall := func(headers metadata.MD) (*pb.OrderCloseDeleteReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.TradeClient.OrderCloseDelete(c, req)
+	}
+
+	errorSelector := func(reply *pb.OrderCloseDeleteReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, reconcile)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+// OrderCloseByIdempotent closes an order by an opposite one like OrderCloseBy, but never repeats on retry.
+//
+// Before each retry the method checks whether ticketToClose is still opened. If it is gone,
+// the close-by is treated as executed and ClosePrice/Profit/CloseTime are taken from history.
+func (a *MT4Account) OrderCloseByIdempotent(
+	ctx context.Context,
+	ticketToClose int32,
+	oppositeTicket int32,
+) (*pb.OrderCloseByData, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // close-by may take a bit longer
+		defer cancel()
+	}
+
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if err := a.ensureTradeClient(); err != nil {
+		return nil, err
+	}
+
+	req := &pb.OrderCloseByRequest{
+		TicketToClose:           ticketToClose,
+		OppositeTicketClosingBy: oppositeTicket,
+	}
+
+	since := time.Now()
+	reconcile := func(c context.Context) (*pb.OrderCloseByReply, bool, error) {
+		open, err := a.findOpenedOrder(c, ticketToClose)
+		if err != nil || open != nil {
+			return nil, false, err
+		}
+		data := &pb.OrderCloseByData{}
+		hist, err := a.findHistoryOrder(c, since, func(o *pb.HistoryOrderInfo) bool { return o.GetTicket() == ticketToClose })
+		if err != nil {
+			return nil, false, err
+		}
+		if hist != nil {
+			data.ClosePrice = hist.GetClosePrice()
+			data.Profit = hist.GetProfit()
+			data.CloseTime = hist.GetCloseTime()
+		}
+		return &pb.OrderCloseByReply{Response: &pb.OrderCloseByReply_Data{Data: data}}, true, nil
+	}
+
+	grpcCall := func(headers metadata.MD) (*pb.OrderCloseByReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.TradeClient.OrderCloseBy(c, req)
+	}
+
+	errorSelector := func(reply *pb.OrderCloseByReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, reconcile)
+	if err != nil {
+		return nil, err
+	}
+	return reply.GetData(), nil
+}
+
+// OrderModifyIdempotent modifies an order like OrderModify, but does not re-send an already applied change.
+//
+// Before each retry the method reads the order and compares its current price/SL/TP/expiration
+// with the requested values. If every requested field already matches, the modification is
+// treated as executed and true is returned.
+func (a *MT4Account) OrderModifyIdempotent(
+	ctx context.Context,
+	ticket int32,
+	price, stoploss, takeprofit *float64,
+	expiration *timestamppb.Timestamp,
+) (bool, error) {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if !a.isConnected() {
+		return false, ErrNotConnected
+	}
+	if err := a.ensureTradeClient(); err != nil {
+		return false, err
+	}
+
+	// Pre-trade checks (see ValidationPolicy) run under the read deadline; the normalized values are sent.
+	checkCtx, cancelChecks := a.withReadTimeout(ctx)
+	defer cancelChecks()
+	if policy, ok := a.validationPolicyFor(checkCtx); ok {
+		chk, err := a.validateOrderModify(checkCtx, policy, ticket, price, stoploss, takeprofit)
+		if err != nil {
+			return false, err
+		}
+		price, stoploss, takeprofit = chk.Price, chk.StopLoss, chk.TakeProfit
+	}
+
+	// Account risk limits (see NewRiskGuard).
+	if err := a.riskCheckModify(); err != nil {
+		return false, err
+	}
+	cancelChecks()
+
+	// The trade deadline covers the order itself, not the checks before it.
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeouts().Trade) // order modify can take slightly longer
+		defer cancel()
+	}
+
+	req := &pb.OrderModifyRequest{
+		OrderTicket:   ticket,
+		NewPrice:      price,
+		NewStopLoss:   stoploss,
+		NewTakeProfit: takeprofit,
+		NewExpiration: expiration,
+	}
+
+	reconcile := func(c context.Context) (*pb.OrderModifyReply, bool, error) {
+		open, err := a.findOpenedOrder(c, ticket)
+		if err != nil || open == nil {
+			return nil, false, err
+		}
+		if !orderMatchesModify(open, req) {
+			return nil, false, nil
+		}
+		data := &pb.OrderModifyData{OrderWasModified: true}
+		return &pb.OrderModifyReply{Response: &pb.OrderModifyReply_Data{Data: data}}, true, nil
+	}
+
+	grpcCall := func(headers metadata.MD) (*pb.OrderModifyReply, error) {
+		c := metadata.NewOutgoingContext(ctx, headers)
+		return a.TradeClient.OrderModify(c, req)
+	}
+
+	errorSelector := func(reply *pb.OrderModifyReply) *pb.Error {
+		return reply.GetError()
+	}
+
+	reply, err := executeWithReconnect(a, ctx, OperationTrade, grpcCall, errorSelector, reconcile)
+	if err != nil {
+		return false, err
+	}
+	if reply.GetData() == nil {
+		return false, fmt.Errorf("empty reply data")
+	}
+	return reply.GetData().GetOrderWasModified(), nil
+}
+
+// findOrderByClientID looks for an order tagged with clientOrderID,
+// first among opened orders, then in history. Returns nil if none exists.
+func (a *MT4Account) findOrderByClientID(ctx context.Context, clientOrderID string, since time.Time) (*pb.OrderSendData, error) {
+	matches := func(comment string) bool {
+		id, ok := ClientOrderIDFromComment(comment)
+		return ok && id == clientOrderID
+	}
+
+	opened, err := a.OpenedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opened.GetOrderInfos() {
+		if matches(o.GetComment()) {
+			return &pb.OrderSendData{
+				Ticket:   o.GetTicket(),
+				Volume:   o.GetLots(),
+				Price:    o.GetOpenPrice(),
+				OpenTime: o.GetOpenTime(),
+			}, nil
+		}
+	}
+
+	hist, err := a.findHistoryOrder(ctx, since, func(o *pb.HistoryOrderInfo) bool { return matches(o.GetComment()) })
+	if err != nil || hist == nil {
+		return nil, err
+	}
+	return &pb.OrderSendData{
+		Ticket:   hist.GetTicket(),
+		Volume:   hist.GetLots(),
+		Price:    hist.GetOpenPrice(),
+		OpenTime: hist.GetOpenTime(),
+	}, nil
+}
+
+// findOpenedOrder returns the opened order with the given ticket, or nil if it is not opened.
+func (a *MT4Account) findOpenedOrder(ctx context.Context, ticket int32) (*pb.OpenedOrderInfo, error) {
+	opened, err := a.OpenedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opened.GetOrderInfos() {
+		if o.GetTicket() == ticket {
+			return o, nil
+		}
+	}
+	return nil, nil
+}
+
+// findHistoryOrder scans history closed around/after since and returns the first match, or nil.
+func (a *MT4Account) findHistoryOrder(
+	ctx context.Context,
+	since time.Time,
+	match func(*pb.HistoryOrderInfo) bool,
+) (*pb.HistoryOrderInfo, error) {
+	from := since.Add(-reconcileHistoryWindow)
+	to := time.Now().Add(reconcileHistoryWindow)
+	pageSize := reconcileHistoryPageSize
+
+	for page := int32(1); ; page++ {
+		batch, err := a.OrdersHistory(ctx, pb.EnumOrderHistorySortType_HISTORY_SORT_BY_CLOSE_TIME_DESC, &from, &to, &page, &pageSize)
+		if err != nil {
+			return nil, err
+		}
+		orders := batch.GetOrdersInfo()
+		for _, o := range orders {
+			if match(o) {
+				return o, nil
+			}
+		}
+		if int32(len(orders)) < pageSize {
+			return nil, nil
+		}
+	}
+}
+
+// orderMatchesModify reports whether every field set in req already equals the order's state.
+func orderMatchesModify(o *pb.OpenedOrderInfo, req *pb.OrderModifyRequest) bool {
+	if req.NewPrice != nil && !priceEqual(o.GetOpenPrice(), req.GetNewPrice()) {
+		return false
+	}
+	if req.NewStopLoss != nil && !priceEqual(o.GetStopLoss(), req.GetNewStopLoss()) {
+		return false
+	}
+	if req.NewTakeProfit != nil && !priceEqual(o.GetTakeProfit(), req.GetNewTakeProfit()) {
+		return false
+	}
+	if req.NewExpiration != nil && o.GetExpirationTime().GetSeconds() != req.GetNewExpiration().GetSeconds() {
+		return false
+	}
+	return true
+}
+
+// priceEqual compares two prices with a small tolerance.
+func priceEqual(x, y float64) bool {
+	return math.Abs(x-y) < priceEpsilon
+}
+
+// isPendingOrderType reports whether t is a pending (limit/stop) order type.
+func isPendingOrderType(t pb.OpenedOrderType) bool {
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT, pb.OpenedOrderType_OO_OP_SELLLIMIT,
+		pb.OpenedOrderType_OO_OP_BUYSTOP, pb.OpenedOrderType_OO_OP_SELLSTOP:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package mt4_test
+
+import (
+	"strings"
+	"testing"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestClientOrderIDFromComment(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+		ok      bool
+	}{
+		{"cid:abc123", "abc123", true},
+		{"cid:abc123 scalper", "abc123", true},
+		{"cid:abc123[sl]", "abc123", true},
+		{"cid:abc123(partial)", "abc123", true},
+		{"note cid:abc123", "abc123", true},
+		{"cid:", "", false},
+		{"scalper", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := mt4.ClientOrderIDFromComment(tt.comment)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ClientOrderIDFromComment(%q) = %q, %v; want %q, %v", tt.comment, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewClientOrderIDIsUniqueAndParsable(t *testing.T) {
+	a, b := mt4.NewClientOrderID(), mt4.NewClientOrderID()
+	if a == b {
+		t.Fatalf("NewClientOrderID returned %q twice", a)
+	}
+	if got, ok := mt4.ClientOrderIDFromComment("cid:" + a + " tail"); !ok || got != a {
+		t.Errorf("ClientOrderIDFromComment did not round-trip %q: got %q, %v", a, got, ok)
+	}
+}
+
+func TestOrderSendIdempotentDroppedReplyDoesNotDoubleFill(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.DropNextReplies("OrderSend", 1)
+
+	data, err := account.OrderSendIdempotent(testContext(t), "", "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1,
+		nil, nil, nil, nil, ptr("bot"), nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSendIdempotent: %v", err)
+	}
+
+	orders := srv.Orders()
+	if len(orders) != 1 {
+		t.Fatalf("opened orders = %d, want 1", len(orders))
+	}
+	if got := srv.Calls("OrderSend"); got != 1 {
+		t.Errorf("OrderSend calls = %d, want 1 (the dropped one)", got)
+	}
+	if data.GetTicket() != orders[0].GetTicket() {
+		t.Errorf("ticket = %d, want the reconciled order %d", data.GetTicket(), orders[0].GetTicket())
+	}
+	if c := orders[0].GetComment(); !strings.HasPrefix(c, "cid:") || !strings.HasSuffix(c, " bot") {
+		t.Errorf("comment = %q, want the cid tag followed by the caller's comment", c)
+	}
+}
+
+func TestOrderSendIdempotentResendsWhenNothingExecuted(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNext("OrderSend", 2, errUnavailable)
+
+	if _, err := account.OrderSendIdempotent(testContext(t), "", "EURUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.2,
+		nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("OrderSendIdempotent: %v", err)
+	}
+	if got := len(srv.Orders()); got != 1 {
+		t.Errorf("opened orders = %d, want 1", got)
+	}
+	if got := srv.Calls("OrderSend"); got != 3 {
+		t.Errorf("OrderSend calls = %d, want 3", got)
+	}
+}
+
+func TestOrderSendIdempotentReusedIDFindsEarlierOrder(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := srv.AddOrder(&pb.OpenedOrderInfo{
+		Symbol:    "EURUSD",
+		OrderType: pb.OpenedOrderType_OO_OP_BUY,
+		Lots:      0.3,
+		OpenPrice: 1.1001,
+		Comment:   "cid:run42 grid",
+	})
+
+	data, err := account.OrderSendIdempotent(testContext(t), "run42", "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.3,
+		nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSendIdempotent: %v", err)
+	}
+	if data.GetTicket() != ticket || data.GetVolume() != 0.3 {
+		t.Errorf("got ticket %d volume %v, want the existing order %d", data.GetTicket(), data.GetVolume(), ticket)
+	}
+	if got := srv.Calls("OrderSend"); got != 0 {
+		t.Errorf("OrderSend calls = %d, want 0", got)
+	}
+}
+
+func TestOrderSendIdempotentReusedIDFindsClosedOrder(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.AddHistory(&pb.HistoryOrderInfo{
+		Ticket:     777,
+		Symbol:     "EURUSD",
+		OrderType:  pb.OpenedOrderType_OO_OP_BUY,
+		Lots:       0.1,
+		OpenPrice:  1.1,
+		ClosePrice: 1.2,
+		Comment:    "cid:run43[tp]",
+		CloseTime:  timestamppb.Now(),
+	})
+
+	data, err := account.OrderSendIdempotent(testContext(t), "run43", "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1,
+		nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSendIdempotent: %v", err)
+	}
+	if data.GetTicket() != 777 {
+		t.Errorf("ticket = %d, want 777 from history", data.GetTicket())
+	}
+	if got := len(srv.Orders()); got != 0 {
+		t.Errorf("opened orders = %d, want 0", got)
+	}
+}
+
+func TestOrderSendIdempotentRejectsInvalidID(t *testing.T) {
+	srv, account := newTestAccount(t)
+	_, err := account.OrderSendIdempotent(testContext(t), "bad id", "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1,
+		nil, nil, nil, nil, nil, nil, nil)
+	if err == nil {
+		t.Fatal("OrderSendIdempotent accepted a client order id with a space")
+	}
+
+	// "cid:" + a 36-character UUID does not fit the 31-character comment.
+	long := "123e4567-e89b-12d3-a456-426614174000"
+	_, err = account.OrderSendIdempotent(testContext(t), long, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1,
+		nil, nil, nil, nil, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "longer than 27") {
+		t.Fatalf("OrderSendIdempotent(%q) = %v, want a length error", long, err)
+	}
+	if got := srv.Calls("OrderSend"); got != 0 {
+		t.Errorf("OrderSend calls = %d, want 0", got)
+	}
+
+	// 27 characters still fit.
+	fits := strings.Repeat("a", 27)
+	data, err := account.OrderSendIdempotent(testContext(t), fits, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1,
+		nil, nil, nil, nil, ptr("bot"), nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSendIdempotent(27 characters): %v", err)
+	}
+	if id, ok := mt4.ClientOrderIDFromComment(srv.Order(data.GetTicket()).GetComment()); !ok || id != fits {
+		t.Errorf("comment %q carries id %q", srv.Order(data.GetTicket()).GetComment(), id)
+	}
+}
+
+func TestOrderCloseIdempotentDroppedReplyClosesOnce(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1)
+	srv.DropNextReplies("OrderCloseDelete", 1)
+
+	data, err := account.OrderCloseIdempotent(testContext(t), ticket, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderCloseIdempotent: %v", err)
+	}
+	if data.GetMode() != pb.OrderCloseDeleteMode_OCD_MARKET_ORDER {
+		t.Errorf("mode = %v, want OCD_MARKET_ORDER", data.GetMode())
+	}
+	if got := srv.Calls("OrderCloseDelete"); got != 1 {
+		t.Errorf("OrderCloseDelete calls = %d, want 1", got)
+	}
+	if got := len(srv.History()); got != 1 {
+		t.Errorf("history = %d orders, want 1", got)
+	}
+}
+
+func TestOrderCloseIdempotentDroppedPendingDelete(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := srv.AddOrder(&pb.OpenedOrderInfo{
+		Symbol:    "EURUSD",
+		OrderType: pb.OpenedOrderType_OO_OP_BUYLIMIT,
+		Lots:      0.1,
+		OpenPrice: 1.05,
+	})
+	srv.DropNextReplies("OrderCloseDelete", 1)
+
+	data, err := account.OrderCloseIdempotent(testContext(t), ticket, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderCloseIdempotent: %v", err)
+	}
+	if data.GetMode() != pb.OrderCloseDeleteMode_OCD_PENDING_ORDER {
+		t.Errorf("mode = %v, want OCD_PENDING_ORDER", data.GetMode())
+	}
+}
+
+func TestOrderCloseByIdempotentDroppedReply(t *testing.T) {
+	srv, account := newTestAccount(t)
+	long := buy(t, account, "EURUSD", 0.1)
+	short := send(t, account, "EURUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.1)
+	srv.DropNextReplies("OrderCloseBy", 1)
+
+	data, err := account.OrderCloseByIdempotent(testContext(t), long, short)
+	if err != nil {
+		t.Fatalf("OrderCloseByIdempotent: %v", err)
+	}
+	if data.GetClosePrice() == 0 {
+		t.Error("ClosePrice not filled from history")
+	}
+	if got := srv.Calls("OrderCloseBy"); got != 1 {
+		t.Errorf("OrderCloseBy calls = %d, want 1", got)
+	}
+	if got := len(srv.Orders()); got != 0 {
+		t.Errorf("opened orders = %d, want 0", got)
+	}
+}
+
+func TestOrderModifyIdempotentDroppedReply(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1)
+	srv.DropNextReplies("OrderModify", 1)
+
+	ok, err := account.OrderModifyIdempotent(testContext(t), ticket, nil, ptr(1.09), ptr(1.12), nil)
+	if err != nil {
+		t.Fatalf("OrderModifyIdempotent: %v", err)
+	}
+	if !ok {
+		t.Error("OrderModifyIdempotent = false, want true for the applied change")
+	}
+	if got := srv.Calls("OrderModify"); got != 1 {
+		t.Errorf("OrderModify calls = %d, want 1", got)
+	}
+	if o := srv.Order(ticket); o.GetStopLoss() != 1.09 || o.GetTakeProfit() != 1.12 {
+		t.Errorf("SL/TP = %v/%v, want 1.09/1.12", o.GetStopLoss(), o.GetTakeProfit())
+	}
+}
@@ -0,0 +1,320 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Margin estimation ===
+//
+// MarginEstimator answers "does this order fit?" before it is sent. The margin of a trade
+// follows the symbol's TradeCalcMode:
+//
+//	FOREX    lots × MarginInitial, or lots × TradeContractSize / AccountLeverage   (CurrencyMargin)
+//	FUTURES  lots × MarginInitial                                                  (CurrencyMargin)
+//	CFD      lots × TradeContractSize × price / AccountLeverage                    (CurrencyProfit)
+//
+// multiplied by MarginLong / MarginShort (pending orders: MarginLimit / MarginStop) when the
+// broker sets them, and converted into the account currency with ConversionRate.
+//
+// The projection adds the trade to the margin of the open positions (estimated the same
+// way from OpenedOrders) and to the equity (minus the spread paid on entry), and solves for
+// the price of the traded symbol at which the whole account reaches the stop-out level,
+// other symbols unchanged and margins held constant.
+//
+// ValidationPolicy.CheckMargin runs the estimate in the pre-trade path of OrderSend.
+
+// DefaultStopOutLevel is the stop-out margin level (percent) used when
+// MarginEstimatorConfig leaves it zero.
+const DefaultStopOutLevel = 50
+
+// MarginEstimatorConfig configures NewMarginEstimator.
+type MarginEstimatorConfig struct {
+	// StopOutLevel is the broker's stop-out margin level in percent (0 = DefaultStopOutLevel).
+	StopOutLevel float64
+}
+
+// MarginEstimator projects the margin impact of prospective trades. It is safe for concurrent use.
+type MarginEstimator struct {
+	account *MT4Account
+	cfg     MarginEstimatorConfig
+}
+
+// MarginEstimate is the result of MarginEstimator.Estimate. Amounts are in Currency.
+type MarginEstimate struct {
+	// Symbol, Lots and Price describe the trade (Price: the order price, or Ask / Bid).
+	Symbol string
+	Lots   float64
+	Price  float64
+
+	// Margin is the margin the trade requires.
+	Margin float64
+
+	// MarginCurrency is the currency of the margin formula; ConversionRate converts it
+	// into Currency (1 when they are the same).
+	MarginCurrency string
+	ConversionRate float64
+
+	// Currency and Leverage are the account's.
+	Currency string
+	Leverage int64
+
+	// Equity, UsedMargin and FreeMargin are the account before the trade (UsedMargin is
+	// estimated from the open positions).
+	Equity     float64
+	UsedMargin float64
+	FreeMargin float64
+
+	// EquityAfter, FreeMarginAfter and MarginLevelAfter (percent) project the account with
+	// the trade filled at Price.
+	EquityAfter      float64
+	FreeMarginAfter  float64
+	MarginLevelAfter float64
+
+	// StopOutLevel is the level the projection uses; StopOutPrice is the price of Symbol
+	// (Bid) at which the account reaches it (0 = not reachable, e.g. no net exposure).
+	StopOutLevel float64
+	StopOutPrice float64
+}
+
+// Fits reports whether the free margin covers the trade.
+func (e *MarginEstimate) Fits() bool {
+	return e.FreeMarginAfter >= 0
+}
+
+// NewMarginEstimator returns an estimator for account.
+//
+// Example:
+//
+//	est := mt4.NewMarginEstimator(account, mt4.MarginEstimatorConfig{StopOutLevel: 30})
+//	m, err := est.Estimate(ctx, "XAUUSD", pb.OrderSendOperationType_OC_OP_BUY, 2, nil)
+//	if err != nil { return err }
+//	log.Printf("margin %.2f, free after %.2f, level %.0f%%, stop-out at %.2f",
+//	    m.Margin, m.FreeMarginAfter, m.MarginLevelAfter, m.StopOutPrice)
+func NewMarginEstimator(account *MT4Account, cfg MarginEstimatorConfig) *MarginEstimator {
+	if cfg.StopOutLevel <= 0 {
+		cfg.StopOutLevel = DefaultStopOutLevel
+	}
+	return &MarginEstimator{account: account, cfg: cfg}
+}
+
+// Estimate computes the margin of a prospective order and the account after it.
+//
+// Parameters:
+//   - ctx: Context for the AccountSummary / OpenedOrders / SymbolParams / Quote calls.
+//   - symbol, operationType, lots: The order.
+//   - price: Order price (required for pending orders; nil = Ask for buys, Bid for sells).
+//
+// Returns:
+//   - The estimate; see MarginEstimate.Fits.
+//   - An error if the margin cannot be computed (e.g. ErrNoConversion for the margin
+//     currency), or the error of the underlying calls.
+func (e *MarginEstimator) Estimate(
+	ctx context.Context,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	lots float64,
+	price *float64,
+) (*MarginEstimate, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	a := e.account
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if lots <= 0 {
+		return nil, errors.New("margin estimate: lots must be positive")
+	}
+	t := pb.OpenedOrderType(operationType)
+	buy, pending := isBuyOrderType(t), isPendingOrderType(t)
+
+	summary, err := a.AccountSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	m := &marginCalc{account: a, summary: summary, quotes: make(map[string]*pb.QuoteData)}
+	q, err := m.quote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MarginEstimate{
+		Symbol:       symbol,
+		Lots:         lots,
+		Currency:     summary.GetAccountCurrency(),
+		Leverage:     summary.GetAccountLeverage(),
+		Equity:       summary.GetAccountEquity(),
+		StopOutLevel: e.cfg.StopOutLevel,
+	}
+	switch {
+	case price != nil && *price > 0:
+		res.Price = *price
+	case pending:
+		return nil, errors.New("margin estimate: price required for pending orders")
+	case buy:
+		res.Price = q.GetAsk()
+	default:
+		res.Price = q.GetBid()
+	}
+
+	params, err := a.symbolSpecs.get(ctx, a, symbol, DefaultSymbolParamsTTL)
+	if err != nil {
+		return nil, err
+	}
+	margin, ccy, rate, err := m.margin(ctx, params, t, lots, res.Price)
+	if err != nil {
+		return nil, fmt.Errorf("margin estimate: %w", err)
+	}
+	res.Margin, res.MarginCurrency, res.ConversionRate = margin, ccy, rate
+
+	// Open positions: their margin, and the exposure of Symbol for the stop-out price.
+	orders, err := a.OpenedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tv, err := a.tickValue(ctx, symbol, params, res.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("margin estimate: %w", err)
+	}
+	perUnit := tv.value / tv.size // account currency per lot and unit of price
+	exposure := lots * perUnit    // account currency per unit of price, net long > 0
+	if !buy {
+		exposure = -exposure
+	}
+	for _, o := range orders.GetOrderInfos() {
+		ot := o.GetOrderType()
+		if isPendingOrderType(ot) {
+			continue
+		}
+		p, err := a.symbolSpecs.get(ctx, a, o.GetSymbol(), DefaultSymbolParamsTTL)
+		if err != nil {
+			return nil, err
+		}
+		oq, err := m.quote(ctx, o.GetSymbol())
+		if err != nil {
+			return nil, err
+		}
+		om, _, _, err := m.margin(ctx, p, ot, o.GetLots(), closeSidePrice(oq, !isBuyOrderType(ot)))
+		if err != nil {
+			return nil, fmt.Errorf("margin estimate: order #%d: %w", o.GetTicket(), err)
+		}
+		res.UsedMargin += om
+		if o.GetSymbol() == symbol {
+			if isBuyOrderType(ot) {
+				exposure += o.GetLots() * perUnit
+			} else {
+				exposure -= o.GetLots() * perUnit
+			}
+		}
+	}
+	res.FreeMargin = res.Equity - res.UsedMargin
+
+	res.EquityAfter = res.Equity
+	if !pending {
+		res.EquityAfter -= (q.GetAsk() - q.GetBid()) / tv.size * tv.value * lots // spread paid on entry
+	}
+	used := res.UsedMargin + res.Margin
+	res.FreeMarginAfter = res.EquityAfter - used
+	if used > 0 {
+		res.MarginLevelAfter = res.EquityAfter / used * 100
+	}
+
+	// Equity(bid) = EquityAfter + (bid − Bid) × exposure; stop-out where it meets level × margin.
+	target := e.cfg.StopOutLevel / 100 * used
+	switch {
+	case used <= 0 || exposure == 0:
+	case res.EquityAfter <= target:
+		res.StopOutPrice = q.GetBid() // already at or below the level
+	default:
+		if p := q.GetBid() + (target-res.EquityAfter)/exposure; p > 0 {
+			res.StopOutPrice = NormalizePrice(params, p)
+		}
+	}
+	return res, nil
+}
+
+// marginCalc computes margins for one estimate, sharing the quotes it loads.
+type marginCalc struct {
+	account *MT4Account
+	summary *pb.AccountSummaryData
+	quotes  map[string]*pb.QuoteData
+}
+
+func (m *marginCalc) quote(ctx context.Context, symbol string) (*pb.QuoteData, error) {
+	if q, ok := m.quotes[symbol]; ok {
+		return q, nil
+	}
+	q, err := m.account.Quote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	m.quotes[symbol] = q
+	return q, nil
+}
+
+// margin returns the margin of lots of an order type at price, in the account currency,
+// with the currency of the formula and the rate that converted it.
+func (m *marginCalc) margin(ctx context.Context, p *pb.SymbolParamsManyInfo, t pb.OpenedOrderType, lots, price float64) (float64, string, float64, error) {
+	leverage := float64(m.summary.GetAccountLeverage())
+	if leverage <= 0 {
+		leverage = 1
+	}
+	ccy := p.GetCurrencyMargin()
+	if ccy == "" {
+		ccy = p.GetCurrencyBase()
+	}
+
+	var margin float64
+	switch p.GetTradeCalcMode() {
+	case pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FUTURES:
+		margin = lots * p.GetMarginInitial()
+	case pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_CFD:
+		margin = lots * p.GetTradeContractSize() * price / leverage
+		ccy = p.GetCurrencyProfit()
+	default:
+		if p.GetMarginInitial() > 0 {
+			margin = lots * p.GetMarginInitial()
+		} else {
+			margin = lots * p.GetTradeContractSize() / leverage
+		}
+	}
+	if k := marginRate(p, t); k > 0 {
+		margin *= k
+	}
+
+	rate, _, err := m.account.conversionRateFor(ctx, ccy, m.summary.GetAccountCurrency(), p.GetSymbolName())
+	if err != nil {
+		return 0, "", 0, err
+	}
+	return margin * rate, ccy, rate, nil
+}
+
+// marginRate returns the broker's margin coefficient for an order type (0 = none set).
+func marginRate(p *pb.SymbolParamsManyInfo, t pb.OpenedOrderType) float64 {
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT, pb.OpenedOrderType_OO_OP_SELLLIMIT:
+		if p.GetMarginLimit() > 0 {
+			return p.GetMarginLimit()
+		}
+	case pb.OpenedOrderType_OO_OP_BUYSTOP, pb.OpenedOrderType_OO_OP_SELLSTOP:
+		if p.GetMarginStop() > 0 {
+			return p.GetMarginStop()
+		}
+	}
+	if isBuyOrderType(t) {
+		return p.GetMarginLong()
+	}
+	return p.GetMarginShort()
+}
+
+// closeSidePrice returns Bid (sell side) or Ask (buy side) of q.
+func closeSidePrice(q *pb.QuoteData, ask bool) float64 {
+	if ask {
+		return q.GetAsk()
+	}
+	return q.GetBid()
+}
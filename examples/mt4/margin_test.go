@@ -0,0 +1,185 @@
+package mt4_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// near reports whether got is within 1e-6 of want.
+func near(got, want float64) bool {
+	return math.Abs(got-want) < 1e-6
+}
+
+func TestMarginEstimate(t *testing.T) {
+	_, account := newTestAccount(t) // USD, equity 10000, leverage 100; EURUSD 1.1/1.1001
+	est := mt4.NewMarginEstimator(account, mt4.MarginEstimatorConfig{})
+
+	m, err := est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 100000 EUR / 100 = 1000 EUR at the EURUSD bid.
+	if m.Price != 1.1001 || !near(m.Margin, 1100) || m.MarginCurrency != "EUR" || m.ConversionRate != 1.1 {
+		t.Errorf("price %v margin %v %s rate %v", m.Price, m.Margin, m.MarginCurrency, m.ConversionRate)
+	}
+	if m.Currency != "USD" || m.Leverage != 100 || m.Equity != 10000 || m.UsedMargin != 0 || m.FreeMargin != 10000 {
+		t.Errorf("account = %+v", m)
+	}
+	// The 10 point spread costs 10 USD on entry.
+	if !near(m.EquityAfter, 9990) || !near(m.FreeMarginAfter, 8890) || !near(m.MarginLevelAfter, 9990.0/1100*100) || !m.Fits() {
+		t.Errorf("after: equity %v free %v level %v", m.EquityAfter, m.FreeMarginAfter, m.MarginLevelAfter)
+	}
+	// 9990 + (bid − 1.1) × 100000 = 50% × 1100.
+	if m.StopOutLevel != mt4.DefaultStopOutLevel || m.StopOutPrice != 1.0056 {
+		t.Errorf("stop-out at %v (level %v)", m.StopOutPrice, m.StopOutLevel)
+	}
+
+	m, err = est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_SELL, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Price != 1.1 || m.StopOutPrice != 1.1944 {
+		t.Errorf("sell: price %v stop-out %v", m.Price, m.StopOutPrice)
+	}
+
+	m, err = est.Estimate(testContext(t), "USDJPY", pb.OrderSendOperationType_OC_OP_BUY, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Margin != 1000 || m.MarginCurrency != "USD" || m.ConversionRate != 1 {
+		t.Errorf("USDJPY margin %v %s rate %v", m.Margin, m.MarginCurrency, m.ConversionRate)
+	}
+
+	// 22000 margin: over the free margin and already below the stop-out level.
+	m, err = est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Fits() || m.StopOutPrice != 1.1 {
+		t.Errorf("20 lots: fits %v, free after %v, stop-out %v", m.Fits(), m.FreeMarginAfter, m.StopOutPrice)
+	}
+}
+
+func TestMarginEstimateCalcModes(t *testing.T) {
+	srv, account := newTestAccount(t)
+	gold := mt4test.ForexSymbol("XAUUSD", 2)
+	gold.TradeCalcMode = pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_CFD
+	gold.TradeContractSize = 100
+	gold.CurrencyMargin = "XAU"
+	gold.MarginShort = 2
+	gold.MarginLimit = 0.5
+	srv.AddSymbol(gold, 2000, 2000.5)
+	future := mt4test.ForexSymbol("FDAX", 1)
+	future.TradeCalcMode = pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FUTURES
+	future.CurrencyMargin, future.CurrencyProfit = "USD", "USD"
+	future.MarginInitial = 500
+	srv.AddSymbol(future, 18000, 18001)
+	est := mt4.NewMarginEstimator(account, mt4.MarginEstimatorConfig{StopOutLevel: 30})
+
+	tests := []struct {
+		name   string
+		symbol string
+		op     pb.OrderSendOperationType
+		lots   float64
+		price  *float64
+		margin float64
+	}{
+		{"CFD in the profit currency", "XAUUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil, 100 * 2000.5 / 100},
+		{"MarginShort", "XAUUSD", pb.OrderSendOperationType_OC_OP_SELL, 1, nil, 2 * 100 * 2000 / 100},
+		{"MarginLimit", "XAUUSD", pb.OrderSendOperationType_OC_OP_BUYLIMIT, 1, ptr(1900.0), 0.5 * 100 * 1900 / 100},
+		{"futures MarginInitial", "FDAX", pb.OrderSendOperationType_OC_OP_BUY, 2, nil, 1000},
+	}
+	for _, tt := range tests {
+		m, err := est.Estimate(testContext(t), tt.symbol, tt.op, tt.lots, tt.price)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !near(m.Margin, tt.margin) || m.StopOutLevel != 30 {
+			t.Errorf("%s: margin %v, want %v", tt.name, m.Margin, tt.margin)
+		}
+	}
+
+	// A pending order pays no spread.
+	m, err := est.Estimate(testContext(t), "XAUUSD", pb.OrderSendOperationType_OC_OP_BUYLIMIT, 1, ptr(1900.0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.EquityAfter != m.Equity || m.Price != 1900 {
+		t.Errorf("pending: equity after %v, price %v", m.EquityAfter, m.Price)
+	}
+}
+
+func TestMarginEstimateOpenPositions(t *testing.T) {
+	_, account := newTestAccount(t)
+	est := mt4.NewMarginEstimator(account, mt4.MarginEstimatorConfig{})
+	buy(t, account, "EURUSD", 1)
+	buy(t, account, "USDJPY", 2)
+
+	m, err := est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(m.UsedMargin, 1100+2000) || !near(m.FreeMargin, m.Equity-3100) {
+		t.Errorf("used %v free %v", m.UsedMargin, m.FreeMargin)
+	}
+	if !near(m.FreeMarginAfter, m.EquityAfter-4200) {
+		t.Errorf("free after %v, equity after %v", m.FreeMarginAfter, m.EquityAfter)
+	}
+	// Two lots long EURUSD: the stop-out moves twice as close as for one.
+	single := 1.1 - (m.EquityAfter-0.5*4200)/200000
+	if math.Abs(m.StopOutPrice-single) > 0.00001 {
+		t.Errorf("stop-out at %v, want about %v", m.StopOutPrice, single)
+	}
+}
+
+func TestMarginEstimateErrors(t *testing.T) {
+	srv, account := newTestAccount(t)
+	franc := mt4test.ForexSymbol("CHFSEK", 5)
+	srv.AddSymbol(franc, 11.5, 11.51)
+	est := mt4.NewMarginEstimator(account, mt4.MarginEstimatorConfig{})
+
+	if _, err := est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0, nil); err == nil {
+		t.Error("zero lots estimated")
+	}
+	if _, err := est.Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUYLIMIT, 1, nil); err == nil {
+		t.Error("pending order without a price estimated")
+	}
+	if _, err := est.Estimate(testContext(t), "CHFSEK", pb.OrderSendOperationType_OC_OP_BUY, 1, nil); !errors.Is(err, mt4.ErrNoConversion) {
+		t.Errorf("CHF margin without a CHF/USD symbol = %v, want ErrNoConversion", err)
+	}
+	if _, err := est.Estimate(testContext(t), "XXXYYY", pb.OrderSendOperationType_OC_OP_BUY, 1, nil); err == nil {
+		t.Error("unknown symbol estimated")
+	}
+
+	_, disconnected := newDisconnectedAccount(t)
+	_, err := mt4.NewMarginEstimator(disconnected, mt4.MarginEstimatorConfig{}).
+		Estimate(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil)
+	if !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("Estimate before connecting = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestOrderSendCheckMargin(t *testing.T) {
+	srv, account := newTestAccount(t, mt4.WithTradeValidation(&mt4.ValidationPolicy{CheckMargin: true}))
+
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 10, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrNotEnoughMoney) {
+		t.Fatalf("OrderSend beyond the free margin = %v, want ErrNotEnoughMoney", err)
+	}
+	if got := srv.Calls("OrderSend"); got != 0 {
+		t.Errorf("refused order reached the server (%d calls)", got)
+	}
+
+	// Pending orders hold no margin.
+	if _, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUYLIMIT, 10, ptr(1.09), nil, nil, nil, nil, nil, nil); err != nil {
+		t.Errorf("pending OrderSend: %v", err)
+	}
+	buy(t, account, "EURUSD", 1)
+}
@@ -0,0 +1,249 @@
+package mt4
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+//=== 📂 Account options ===
+
+// DefaultEndpoint is the production gRPC endpoint used when WithEndpoint is not given.
+const DefaultEndpoint = "mt4.mrpc.pro:443"
+
+// Option configures an MT4Account created by NewMT4Account.
+type Option func(*accountOptions)
+
+// accountOptions collects Option values before the connection is created.
+type accountOptions struct {
+	endpoint    string
+	id          uuid.UUID
+	tlsConfig   *tls.Config
+	insecure    bool
+	keepalive   *keepalive.ClientParameters
+	userAgent   string
+	maxMsgSize  int
+	dialOptions []grpc.DialOption
+	timeouts    Timeouts
+	retryPolicy *RetryPolicy
+	delivery    *DeliveryPolicy
+	tickStall   *StallPolicy
+	validation  *ValidationPolicy
+	logger      Logger
+
+	noReestablish bool
+	brokerCache   BrokerCache
+	conn          *grpc.ClientConn
+}
+
+// Logger receives diagnostic messages (retries, stream reconnects).
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// Timeouts are the per-call deadlines applied when the caller's context has none.
+// Zero fields fall back to DefaultTimeouts.
+type Timeouts struct {
+	// Read covers quick read-only calls (account summary, quotes, symbol params, ...).
+	Read time.Duration
+
+	// Trade covers OrderSend / OrderModify / OrderClose / OrderCloseBy / OrderDelete. Pre-trade
+	// validation and RiskGuard checks run under Read before it starts.
+	Trade time.Duration
+
+	// History covers OrdersHistory and QuoteHistory, which may return large pages.
+	History time.Duration
+
+	// HealthCheck bounds the AccountSummary probe run after Connect.
+	HealthCheck time.Duration
+}
+
+// DefaultTimeouts returns the per-call deadlines used when nothing else is configured.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:        3 * time.Second,
+		Trade:       5 * time.Second,
+		History:     8 * time.Second,
+		HealthCheck: 3 * time.Second,
+	}
+}
+
+// merge returns t with zero fields taken from d.
+func (t Timeouts) merge(d Timeouts) Timeouts {
+	if t.Read <= 0 {
+		t.Read = d.Read
+	}
+	if t.Trade <= 0 {
+		t.Trade = d.Trade
+	}
+	if t.History <= 0 {
+		t.History = d.History
+	}
+	if t.HealthCheck <= 0 {
+		t.HealthCheck = d.HealthCheck
+	}
+	return t
+}
+
+// WithEndpoint sets the gRPC endpoint (host:port or any gRPC target, e.g. "passthrough:///bufnet").
+// An empty endpoint keeps DefaultEndpoint.
+func WithEndpoint(endpoint string) Option {
+	return func(o *accountOptions) {
+		if endpoint != "" {
+			o.endpoint = endpoint
+		}
+	}
+}
+
+// WithSessionID presets the terminal instance id sent in the "id" header
+// (normally assigned by ConnectByHostPort / ConnectByServerName).
+func WithSessionID(id uuid.UUID) Option {
+	return func(o *accountOptions) { o.id = id }
+}
+
+// WithTLSConfig uses a custom TLS configuration (custom CA pool, client certificates for mTLS, ServerName, ...).
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *accountOptions) {
+		o.tlsConfig = cfg
+		o.insecure = false
+	}
+}
+
+// WithInsecure disables transport security (plaintext).
+// Use it only for local stand-ins such as mt4test or a port-forwarded gateway.
+func WithInsecure() Option {
+	return func(o *accountOptions) { o.insecure = true }
+}
+
+// WithKeepalive sets client keepalive pings.
+// The server may close connections that ping more often than it allows (GOAWAY "too_many_pings").
+func WithKeepalive(params keepalive.ClientParameters) Option {
+	return func(o *accountOptions) { o.keepalive = &params }
+}
+
+// WithUserAgent sets the user-agent prefix sent with every call.
+func WithUserAgent(userAgent string) Option {
+	return func(o *accountOptions) { o.userAgent = userAgent }
+}
+
+// WithMaxMessageSize raises the send/receive message limit in bytes (gRPC default: 4 MiB received),
+// e.g. for large OrdersHistory or QuoteHistory pages.
+func WithMaxMessageSize(bytes int) Option {
+	return func(o *accountOptions) { o.maxMsgSize = bytes }
+}
+
+// WithDialOptions appends raw gRPC dial options (interceptors, custom dialer, stats handler, ...).
+// They are applied after the options above, so they win on conflict.
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(o *accountOptions) { o.dialOptions = append(o.dialOptions, opts...) }
+}
+
+// WithDefaultTimeouts sets the per-call deadlines used when the caller's context has none.
+// Zero fields keep DefaultTimeouts.
+func WithDefaultTimeouts(t Timeouts) Option {
+	return func(o *accountOptions) { o.timeouts = t }
+}
+
+// WithRetryPolicy sets MT4Account.RetryPolicy.
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(o *accountOptions) { o.retryPolicy = p }
+}
+
+// WithDeliveryPolicy sets MT4Account.DeliveryPolicy.
+func WithDeliveryPolicy(p *DeliveryPolicy) Option {
+	return func(o *accountOptions) { o.delivery = p }
+}
+
+// WithTickStallPolicy sets MT4Account.TickStallPolicy.
+func WithTickStallPolicy(p *StallPolicy) Option {
+	return func(o *accountOptions) { o.tickStall = p }
+}
+
+// WithTradeValidation sets MT4Account.TradeValidation (pre-trade checks of OrderSend / OrderModify).
+func WithTradeValidation(p *ValidationPolicy) Option {
+	return func(o *accountOptions) { o.validation = p }
+}
+
+// WithLogger sets MT4Account.Logger.
+func WithLogger(l Logger) Option {
+	return func(o *accountOptions) { o.logger = l }
+}
+
+// WithAutoReestablish enables (default) or disables reconnecting with the remembered
+// Connect parameters when the terminal instance is lost (see MT4Account.DisableAutoReestablish).
+func WithAutoReestablish(enabled bool) Option {
+	return func(o *accountOptions) { o.noReestablish = !enabled }
+}
+
+// WithBrokerCache sets MT4Account.BrokerCache, e.g.
+// mt4.WithBrokerCache(mt4.NewFileBrokerCache(path)).
+func WithBrokerCache(c BrokerCache) Option {
+	return func(o *accountOptions) { o.brokerCache = c }
+}
+
+// WithClientConn makes the account use an existing gRPC connection instead of dialing its own,
+// so many logins can share one connection (the server routes calls by the "id" header).
+// WithEndpoint, TLS, keepalive and dial options are ignored, and Disconnect leaves conn open.
+// AccountPool uses it to multiplex logins.
+func WithClientConn(conn *grpc.ClientConn) Option {
+	return func(o *accountOptions) { o.conn = conn }
+}
+
+// grpcDialOptions builds the dial options for grpc.NewClient.
+func (o *accountOptions) grpcDialOptions() []grpc.DialOption {
+	var opts []grpc.DialOption
+
+	if o.insecure {
+		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		cfg := o.tlsConfig
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(cfg)))
+	}
+	if o.keepalive != nil {
+		opts = append(opts, grpc.WithKeepaliveParams(*o.keepalive))
+	}
+	if o.userAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(o.userAgent))
+	}
+	if o.maxMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(o.maxMsgSize),
+			grpc.MaxCallSendMsgSize(o.maxMsgSize),
+		))
+	}
+	return append(opts, o.dialOptions...)
+}
+
+// timeouts returns the effective per-call deadlines of the account.
+func (a *MT4Account) timeouts() Timeouts {
+	if a == nil {
+		return DefaultTimeouts()
+	}
+	return a.Timeouts.merge(DefaultTimeouts())
+}
+
+// withReadTimeout bounds ctx by the Read timeout unless it already has a deadline.
+func (a *MT4Account) withReadTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, a.timeouts().Read)
+}
+
+// logf writes to the account Logger, if any.
+func (a *MT4Account) logf(format string, v ...any) {
+	if a == nil || a.Logger == nil {
+		return
+	}
+	a.Logger.Printf(format, v...)
+}
@@ -0,0 +1,155 @@
+package mt4_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
+)
+
+// recordingLogger collects log lines for assertions.
+type recordingLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordingLogger) Printf(format string, v ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) contains(s string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range l.lines {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewMT4AccountOptions(t *testing.T) {
+	policy := &mt4.RetryPolicy{MaxAttempts: 2}
+	timeouts := mt4.Timeouts{Read: time.Second}
+	logger := &recordingLogger{}
+
+	account, err := mt4.NewMT4Account(1, "pw",
+		mt4.WithEndpoint("passthrough:///custom"),
+		mt4.WithInsecure(),
+		mt4.WithRetryPolicy(policy),
+		mt4.WithDefaultTimeouts(timeouts),
+		mt4.WithLogger(logger),
+		mt4.WithAutoReestablish(false),
+		nil, // ignored
+	)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	if account.GrpcServer != "passthrough:///custom" {
+		t.Errorf("GrpcServer = %q", account.GrpcServer)
+	}
+	if account.RetryPolicy != policy || account.Timeouts != timeouts || account.Logger != logger {
+		t.Errorf("policies not applied: %+v %+v %v", account.RetryPolicy, account.Timeouts, account.Logger)
+	}
+	if !account.DisableAutoReestablish {
+		t.Error("WithAutoReestablish(false) not applied")
+	}
+}
+
+func TestWithEndpointEmptyKeepsDefault(t *testing.T) {
+	account, err := mt4.NewMT4Account(1, "pw", mt4.WithEndpoint(""))
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+	if account.GrpcServer != mt4.DefaultEndpoint {
+		t.Errorf("GrpcServer = %q, want DefaultEndpoint", account.GrpcServer)
+	}
+}
+
+func TestWithDialOptionsInterceptor(t *testing.T) {
+	var calls atomic.Int32
+	count := grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		calls.Add(1)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+	_, account := newTestAccount(t, mt4.WithDialOptions(count), mt4.WithUserAgent("mt4-tests"))
+
+	before := calls.Load()
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if got := calls.Load() - before; got != 1 {
+		t.Errorf("interceptor saw %d calls, want 1", got)
+	}
+}
+
+func TestDefaultTimeoutsApplyWithoutCallerDeadline(t *testing.T) {
+	srv, account := newTestAccount(t, mt4.WithDefaultTimeouts(mt4.Timeouts{Read: 30 * time.Millisecond}))
+	srv.SetLatency("Quote", 200*time.Millisecond)
+
+	start := time.Now()
+	_, err := account.Quote(context.Background(), "EURUSD")
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Quote error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("Quote took %v, want about the 30ms read timeout", elapsed)
+	}
+
+	// A caller deadline wins over the default.
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Errorf("Quote with caller deadline: %v", err)
+	}
+}
+
+func TestLoggerReceivesRetries(t *testing.T) {
+	logger := &recordingLogger{}
+	srv, account := newTestAccount(t, mt4.WithLogger(logger))
+	srv.FailNext("Quote", 1, errUnavailable)
+
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if !logger.contains("read call") {
+		t.Errorf("logger lines = %q, want a retry message", logger.lines)
+	}
+}
+
+func TestWithClientConnSharesConnection(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	conn, err := srv.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	account, err := srv.NewAccount(testContext(t), mt4.WithClientConn(conn))
+	if err != nil {
+		t.Fatalf("NewAccount: %v", err)
+	}
+	if account.GrpcConn != conn || account.GrpcServer != conn.Target() {
+		t.Errorf("account does not use the shared connection (server %q)", account.GrpcServer)
+	}
+	if err := account.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if conn.GetState() == connectivity.Shutdown {
+		t.Error("Disconnect closed the shared connection")
+	}
+}
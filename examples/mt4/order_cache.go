@@ -0,0 +1,369 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Order cache ===
+//
+// OrderSelect and OrdersTotal call OpenedOrders on every use. An OrderCache keeps the
+// opened orders in memory instead: it bootstraps from OpenedOrders, applies every OnTrade
+// event (NewOrders, UpdatedOrders, RemovedOrders, NewHistoryOrders) and reconciles with
+// OpenedOrders periodically and after every reconnect, to repair events missed while the
+// stream was down.
+//
+// A snapshot and the stream race: an event may arrive while the snapshot RPC is in flight.
+// Tickets touched by such events keep their streamed state when the snapshot is installed.
+
+// DefaultOrderCacheReconcile is the reconciliation period used when OrderCacheConfig leaves it zero.
+const DefaultOrderCacheReconcile = 30 * time.Second
+
+// OrderCacheConfig configures NewOrderCache.
+type OrderCacheConfig struct {
+	// ReconcileInterval is the period of the OpenedOrders reconciliation
+	// (0 = DefaultOrderCacheReconcile, negative = only after reconnects and on Reconcile).
+	ReconcileInterval time.Duration
+
+	// Detached keeps MT4Account.OrderSelect / OrdersTotal on the network; by default the
+	// cache serves them while it runs.
+	Detached bool
+}
+
+// OrderFilter selects cached orders (zero value = all).
+type OrderFilter struct {
+	// Symbol matches exactly when non-empty.
+	Symbol string
+
+	// Magic matches the magic number when non-nil.
+	Magic *int32
+
+	// Types matches any of the listed order types when non-empty.
+	Types []pb.OpenedOrderType
+
+	// Profit matches the sign of Profit + Swap + Commission (AnyProfit = all).
+	Profit ProfitSign
+}
+
+// ProfitSign selects orders by the sign of their net profit.
+type ProfitSign int
+
+const (
+	AnyProfit ProfitSign = iota
+	Winning              // > 0
+	Losing               // < 0
+)
+
+// match reports whether o passes the filter.
+func (f OrderFilter) match(o *pb.OpenedOrderInfo) bool {
+	if f.Symbol != "" && o.GetSymbol() != f.Symbol {
+		return false
+	}
+	if f.Magic != nil && o.GetMagicNumber() != *f.Magic {
+		return false
+	}
+	switch net := o.GetProfit() + o.GetSwap() + o.GetCommision(); f.Profit {
+	case Winning:
+		if net <= 0 {
+			return false
+		}
+	case Losing:
+		if net >= 0 {
+			return false
+		}
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if o.GetOrderType() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderCache is a local, stream-fed copy of the opened orders of an account.
+// It is safe for concurrent use. Returned orders are shared: do not modify them.
+type OrderCache struct {
+	account *MT4Account
+	cfg     OrderCacheConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// reconcileMu serializes reconciliations.
+	reconcileMu sync.Mutex
+
+	mu       sync.RWMutex
+	orders   map[int32]*pb.OpenedOrderInfo
+	touched  map[int32]bool // tickets changed by events during a reconciliation (nil otherwise)
+	lastSync time.Time
+}
+
+// NewOrderCache bootstraps a cache from OpenedOrders and keeps it current from OnTrade
+// until ctx is done or Close is called. Unless cfg.Detached is set, the account's
+// OrderSelect and OrdersTotal are served from the cache while it runs (OrderSelect still
+// asks the server for tickets the cache does not know yet).
+//
+// Parameters:
+//   - ctx: Lifetime of the cache.
+//   - account: Connected account.
+//   - cfg: Reconciliation settings (zero value = defaults).
+//
+// Returns:
+//   - The running cache.
+//   - Error if the bootstrap OpenedOrders call fails.
+//
+// Example:
+//
+//	cache, err := mt4.NewOrderCache(ctx, account, mt4.OrderCacheConfig{})
+//	if err != nil { return err }
+//	defer cache.Close()
+//	buys := cache.Orders(mt4.OrderFilter{Symbol: "EURUSD", Types: []pb.OpenedOrderType{pb.OpenedOrderType_OO_OP_BUY}})
+func NewOrderCache(ctx context.Context, account *MT4Account, cfg OrderCacheConfig) (*OrderCache, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if account == nil {
+		return nil, errors.New("NewOrderCache: nil account")
+	}
+	if cfg.ReconcileInterval == 0 {
+		cfg.ReconcileInterval = DefaultOrderCacheReconcile
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	c := &OrderCache{
+		account: account,
+		cfg:     cfg,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		orders:  make(map[int32]*pb.OpenedOrderInfo),
+	}
+
+	// Subscribe before the snapshot so no event falls between the two.
+	trades, errs := account.OnTrade(runCtx)
+	changes := account.StateChanges()
+	if err := c.Reconcile(runCtx); err != nil {
+		cancel()
+		account.unsubscribeStateChanges(changes)
+		return nil, err
+	}
+
+	if !cfg.Detached {
+		account.orderCache.Store(c)
+	}
+	go c.run(runCtx, trades, errs, changes)
+	return c, nil
+}
+
+// run applies stream events and reconciles until ctx is done.
+func (c *OrderCache) run(ctx context.Context, trades <-chan *pb.OnTradeData, errs <-chan error, changes <-chan StateChange) {
+	defer close(c.done)
+	defer c.account.orderCache.CompareAndSwap(c, nil)
+	defer c.account.unsubscribeStateChanges(changes)
+
+	var tick <-chan time.Time
+	if c.cfg.ReconcileInterval > 0 {
+		t := time.NewTicker(c.cfg.ReconcileInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	reconcile := func(reason string) {
+		if err := c.Reconcile(ctx); err != nil && ctx.Err() == nil {
+			c.account.logf("mt4: order cache reconcile (%s): %v", reason, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-trades:
+			if !ok {
+				return
+			}
+			c.apply(ev.GetEventData())
+		case err, ok := <-errs:
+			if ok && err != nil && ctx.Err() == nil {
+				c.account.logf("mt4: order cache stream: %v", err)
+			}
+			return
+		case ch, ok := <-changes:
+			if !ok {
+				return
+			}
+			// Events may have been missed while the stream was down.
+			if ch.To == StateConnected && (ch.From == StateReconnecting || ch.Reestablished) {
+				reconcile("reconnect")
+			}
+		case <-tick:
+			reconcile("periodic")
+		}
+	}
+}
+
+// apply updates the cache from one OnTrade event.
+func (c *OrderCache) apply(ev *pb.OnTadeEventData) {
+	if ev == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	put := func(o *pb.OnTradeOrderInfo) {
+		if o == nil || o.GetIsHistory() {
+			return
+		}
+		c.orders[o.GetTicket()] = openedOrderFromTrade(o)
+		c.touchLocked(o.GetTicket())
+	}
+	drop := func(o *pb.OnTradeOrderInfo) {
+		if o == nil {
+			return
+		}
+		delete(c.orders, o.GetTicket())
+		c.touchLocked(o.GetTicket())
+	}
+	for _, o := range ev.GetRemovedOrders() {
+		drop(o)
+	}
+	for _, o := range ev.GetNewHistoryOrders() {
+		drop(o)
+	}
+	for _, o := range ev.GetNewOrders() {
+		put(o)
+	}
+	for _, u := range ev.GetUpdatedOrders() {
+		put(u.GetCurrent())
+	}
+}
+
+// touchLocked records ticket as changed during a running reconciliation. Caller holds c.mu.
+func (c *OrderCache) touchLocked(ticket int32) {
+	if c.touched != nil {
+		c.touched[ticket] = true
+	}
+}
+
+// Reconcile replaces the cache with a fresh OpenedOrders snapshot, keeping tickets that
+// stream events changed while the snapshot was taken.
+func (c *OrderCache) Reconcile(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.reconcileMu.Lock()
+	defer c.reconcileMu.Unlock()
+
+	c.mu.Lock()
+	c.touched = make(map[int32]bool)
+	c.mu.Unlock()
+
+	data, err := c.account.OpenedOrders(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	touched := c.touched
+	c.touched = nil
+	if err != nil {
+		return err
+	}
+
+	fresh := make(map[int32]*pb.OpenedOrderInfo, len(data.GetOrderInfos()))
+	for _, o := range data.GetOrderInfos() {
+		if !touched[o.GetTicket()] {
+			fresh[o.GetTicket()] = o
+		}
+	}
+	for ticket := range touched {
+		if o, ok := c.orders[ticket]; ok {
+			fresh[ticket] = o
+		}
+	}
+	c.orders = fresh
+	c.lastSync = time.Now()
+	return nil
+}
+
+// OrderSelect returns the cached order with ticket.
+func (c *OrderCache) OrderSelect(ticket int32) (*pb.OpenedOrderInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	o, ok := c.orders[ticket]
+	return o, ok
+}
+
+// OrdersTotal returns the number of cached opened orders (market and pending).
+func (c *OrderCache) OrdersTotal() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.orders)
+}
+
+// Orders returns the cached orders passing filter, sorted by ticket.
+func (c *OrderCache) Orders(filter OrderFilter) []*pb.OpenedOrderInfo {
+	c.mu.RLock()
+	out := make([]*pb.OpenedOrderInfo, 0, len(c.orders))
+	for _, o := range c.orders {
+		if filter.match(o) {
+			out = append(out, o)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].GetTicket() < out[j].GetTicket() })
+	return out
+}
+
+// LastReconcile returns when the cache was last synchronized with OpenedOrders.
+func (c *OrderCache) LastReconcile() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSync
+}
+
+// Done is closed when the cache stops (ctx done, Close, or the OnTrade stream ended).
+func (c *OrderCache) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close stops the cache and detaches it from the account.
+func (c *OrderCache) Close() {
+	c.cancel()
+	<-c.done
+}
+
+// running reports whether the cache is still fed by the stream.
+func (c *OrderCache) running() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// openedOrderFromTrade converts an OnTrade order into the OpenedOrders representation.
+func openedOrderFromTrade(o *pb.OnTradeOrderInfo) *pb.OpenedOrderInfo {
+	return &pb.OpenedOrderInfo{
+		Comment:        o.GetComment(),
+		Commision:      o.GetCommission(),
+		ExpirationTime: o.GetExpiration(),
+		Lots:           o.GetLots(),
+		MagicNumber:    o.GetMagicNumber(),
+		OpenPrice:      o.GetOpenPrice(),
+		Profit:         o.GetOrderProfit(),
+		StopLoss:       o.GetStopLoss(),
+		Swap:           o.GetSwap(),
+		Symbol:         o.GetSymbol(),
+		TakeProfit:     o.GetTakeProfit(),
+		Ticket:         o.GetTicket(),
+		PositionIndex:  o.GetIndex(),
+		OrderType:      pb.OpenedOrderType(o.GetType()),
+		OpenTime:       o.GetOpenTime(),
+		AccountLogin:   o.GetAccountLogin(),
+	}
+}
@@ -0,0 +1,233 @@
+package mt4_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/grpc"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+// newTestCache returns a running cache of account, closed when the test ends.
+func newTestCache(t *testing.T, account *mt4.MT4Account, cfg mt4.OrderCacheConfig) *mt4.OrderCache {
+	t.Helper()
+	cache, err := mt4.NewOrderCache(testContext(t), account, cfg)
+	if err != nil {
+		t.Fatalf("NewOrderCache: %v", err)
+	}
+	t.Cleanup(cache.Close)
+	return cache
+}
+
+func TestOrderCacheFollowsStream(t *testing.T) {
+	srv, account := newTestAccount(t)
+	existing := srv.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 0.1, OpenPrice: 1.1})
+	cache := newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1})
+
+	if _, ok := cache.OrderSelect(existing); !ok || cache.OrdersTotal() != 1 {
+		t.Fatalf("bootstrap: %d orders", cache.OrdersTotal())
+	}
+
+	ticket := buy(t, account, "EURUSD", 0.2)
+	eventually(t, "the new order in the cache", func() bool {
+		_, ok := cache.OrderSelect(ticket)
+		return ok
+	})
+
+	if _, err := account.OrderModify(testContext(t), ticket, nil, ptr(1.05), nil, nil); err != nil {
+		t.Fatalf("OrderModify: %v", err)
+	}
+	eventually(t, "the modified stop loss", func() bool {
+		o, _ := cache.OrderSelect(ticket)
+		return o.GetStopLoss() == 1.05
+	})
+
+	if _, err := account.OrderClose(testContext(t), existing, nil, nil, nil); err != nil {
+		t.Fatalf("OrderClose: %v", err)
+	}
+	eventually(t, "the closed order to leave the cache", func() bool {
+		_, ok := cache.OrderSelect(existing)
+		return !ok
+	})
+	if cache.OrdersTotal() != 1 {
+		t.Errorf("OrdersTotal = %d, want 1", cache.OrdersTotal())
+	}
+}
+
+func TestOrderCacheServesAccount(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1)
+	newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1})
+	calls := srv.Calls("OpenedOrders")
+
+	if o, err := account.OrderSelect(testContext(t), ticket); err != nil || o.GetTicket() != ticket {
+		t.Fatalf("OrderSelect = %v, %v", o, err)
+	}
+	if n, err := account.OrdersTotal(testContext(t)); err != nil || n != 1 {
+		t.Fatalf("OrdersTotal = %d, %v", n, err)
+	}
+	if got := srv.Calls("OpenedOrders") - calls; got != 0 {
+		t.Errorf("OpenedOrders called %d times with an attached cache", got)
+	}
+}
+
+func TestOrderCacheDetached(t *testing.T) {
+	srv, account := newTestAccount(t)
+	newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1, Detached: true})
+	calls := srv.Calls("OpenedOrders")
+
+	if _, err := account.OrdersTotal(testContext(t)); err != nil {
+		t.Fatalf("OrdersTotal: %v", err)
+	}
+	if got := srv.Calls("OpenedOrders") - calls; got != 1 {
+		t.Errorf("OpenedOrders calls = %d, want 1 with a detached cache", got)
+	}
+}
+
+func TestOrderCacheFilter(t *testing.T) {
+	srv, account := newTestAccount(t)
+	buyEUR := srv.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 0.1, OpenPrice: 1.1, MagicNumber: 7})
+	sellEUR := srv.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELL, Lots: 0.1, OpenPrice: 1.1})
+	limitEUR := srv.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUYLIMIT, Lots: 0.1, OpenPrice: 1.0, MagicNumber: 7})
+	cache := newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1})
+
+	tests := []struct {
+		name   string
+		filter mt4.OrderFilter
+		want   []int32
+	}{
+		{"all", mt4.OrderFilter{}, []int32{buyEUR, sellEUR, limitEUR}},
+		{"symbol", mt4.OrderFilter{Symbol: "GBPUSD"}, nil},
+		{"magic", mt4.OrderFilter{Magic: ptr[int32](7)}, []int32{buyEUR, limitEUR}},
+		{"types", mt4.OrderFilter{Types: []pb.OpenedOrderType{pb.OpenedOrderType_OO_OP_SELL, pb.OpenedOrderType_OO_OP_BUYLIMIT}}, []int32{sellEUR, limitEUR}},
+		{"magic and type", mt4.OrderFilter{Magic: ptr[int32](7), Types: []pb.OpenedOrderType{pb.OpenedOrderType_OO_OP_BUY}}, []int32{buyEUR}},
+	}
+	for _, tt := range tests {
+		got := cache.Orders(tt.filter)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d orders, want %v", tt.name, len(got), tt.want)
+			continue
+		}
+		for i, o := range got {
+			if o.GetTicket() != tt.want[i] {
+				t.Errorf("%s: order %d = %d, want %v", tt.name, i, o.GetTicket(), tt.want)
+			}
+		}
+	}
+
+	// Profit signs follow the fake's live repricing, so only check they partition the orders.
+	winning, losing := cache.Orders(mt4.OrderFilter{Profit: mt4.Winning}), cache.Orders(mt4.OrderFilter{Profit: mt4.Losing})
+	for _, o := range winning {
+		if o.GetProfit()+o.GetSwap()+o.GetCommision() <= 0 {
+			t.Errorf("Winning returned %d with profit %v", o.GetTicket(), o.GetProfit())
+		}
+	}
+	for _, o := range losing {
+		if o.GetProfit()+o.GetSwap()+o.GetCommision() >= 0 {
+			t.Errorf("Losing returned %d with profit %v", o.GetTicket(), o.GetProfit())
+		}
+	}
+}
+
+// TestOrderCacheSnapshotRace holds an OpenedOrders reply on the client while the stream
+// reports changes, so the snapshot installed by Reconcile is older than the cache.
+func TestOrderCacheSnapshotRace(t *testing.T) {
+	var hold atomic.Bool
+	snapped, release := make(chan struct{}), make(chan struct{})
+	interceptor := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if strings.HasSuffix(method, "/OpenedOrders") && hold.CompareAndSwap(true, false) {
+			close(snapped)
+			<-release
+		}
+		return err
+	}
+	srv, account := newTestAccount(t, mt4.WithDialOptions(grpc.WithChainUnaryInterceptor(interceptor)))
+	closed := buy(t, account, "EURUSD", 0.1)
+	cache := newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1})
+
+	hold.Store(true)
+	done := make(chan error, 1)
+	go func() { done <- cache.Reconcile(testContext(t)) }()
+	<-snapped
+
+	// The snapshot still lists closed and misses opened.
+	if _, err := account.OrderClose(testContext(t), closed, nil, nil, nil); err != nil {
+		t.Fatalf("OrderClose: %v", err)
+	}
+	opened := srv.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELL, Lots: 0.1, OpenPrice: 1.1})
+	eventually(t, "the stream events", func() bool {
+		_, known := cache.OrderSelect(opened)
+		_, stale := cache.OrderSelect(closed)
+		return known && !stale
+	})
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if _, ok := cache.OrderSelect(closed); ok {
+		t.Error("stale snapshot resurrected a closed order")
+	}
+	if _, ok := cache.OrderSelect(opened); !ok {
+		t.Error("stale snapshot dropped an order opened during the reconciliation")
+	}
+
+	// The next reconciliation installs the server state as is.
+	if err := cache.Reconcile(testContext(t)); err != nil || cache.OrdersTotal() != 1 {
+		t.Errorf("Reconcile = %v, %d orders", err, cache.OrdersTotal())
+	}
+}
+
+func TestOrderCacheReconcilesAfterReestablish(t *testing.T) {
+	srv, account := newTestAccount(t)
+	cache := newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: -1})
+	synced := cache.LastReconcile()
+
+	srv.DropTerminals()
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	eventually(t, "a reconciliation after the re-establishment", func() bool {
+		return cache.LastReconcile().After(synced)
+	})
+}
+
+func TestOrderCachePeriodicReconcile(t *testing.T) {
+	srv, account := newTestAccount(t)
+	cache := newTestCache(t, account, mt4.OrderCacheConfig{ReconcileInterval: 20 * time.Millisecond})
+	calls := srv.Calls("OpenedOrders")
+	eventually(t, "periodic OpenedOrders calls", func() bool {
+		return srv.Calls("OpenedOrders")-calls >= 2
+	})
+
+	cache.Close()
+	select {
+	case <-cache.Done():
+	default:
+		t.Fatal("Done not closed after Close")
+	}
+	calls = srv.Calls("OpenedOrders")
+	if _, err := account.OrdersTotal(testContext(t)); err != nil {
+		t.Fatalf("OrdersTotal: %v", err)
+	}
+	if got := srv.Calls("OpenedOrders") - calls; got != 1 {
+		t.Errorf("OrdersTotal after Close made %d OpenedOrders calls, want 1", got)
+	}
+}
+
+func TestNewOrderCacheBootstrapError(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNextAPI("OpenedOrders", 1, "INTERNAL", pb.MqlErrorCode_ERR_NO_ERROR)
+	if _, err := mt4.NewOrderCache(testContext(t), account, mt4.OrderCacheConfig{}); err == nil {
+		t.Fatal("NewOrderCache ignored a failed bootstrap")
+	}
+	if _, err := mt4.NewOrderCache(testContext(t), nil, mt4.OrderCacheConfig{}); err == nil {
+		t.Error("NewOrderCache accepted a nil account")
+	}
+}
@@ -0,0 +1,1102 @@
+package mt4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//=== 📂 Order groups ===
+//
+// MT4 has no linked orders. OrderGroups links them client-side:
+//
+//	OCO      two pending orders; when one fills, is deleted or expires, the other is deleted
+//	bracket  an entry (market or pending) carrying the server-side SL / TP, plus staged take
+//	         profits closed with OrderClose(lots) when the market reaches them
+//	if-done  a chain of orders, each sent when the previous one has filled
+//
+// The supervisor follows OnTrade and reconciles the groups an event touches with OpenedOrders
+// (tickets that are gone: OrdersHistory); it also reconciles periodically and after reconnects.
+// A partial close gives the rest of a position a new ticket ("from #N"); the leg follows it.
+//
+// Orders are sent with OrderSendIdempotent and the client order id of every leg is written to
+// the GroupStore before the order is sent, so a restarted process resumes supervising the
+// open groups without sending an order twice.
+
+// DefaultGroupReconcile is the reconciliation period used when OrderGroupsConfig leaves it zero.
+const DefaultGroupReconcile = 30 * time.Second
+
+// GroupKind is the type of an OrderGroup.
+type GroupKind string
+
+const (
+	GroupOCO     GroupKind = "oco"
+	GroupBracket GroupKind = "bracket"
+	GroupIfDone  GroupKind = "if-done"
+)
+
+// GroupStatus is the lifecycle state of an OrderGroup.
+type GroupStatus string
+
+const (
+	GroupActive    GroupStatus = "active"    // supervised
+	GroupDone      GroupStatus = "done"      // completed as designed
+	GroupCancelled GroupStatus = "cancelled" // a leg was deleted / expired, or Cancel was called
+	GroupFailed    GroupStatus = "failed"    // a leg was rejected, or both OCO legs filled (see Err)
+)
+
+// LegStatus is the state of one order of a group.
+type LegStatus string
+
+const (
+	LegNew     LegStatus = "new"     // not sent yet
+	LegPending LegStatus = "pending" // pending order waiting
+	LegOpen    LegStatus = "open"    // position open
+	LegClosed  LegStatus = "closed"  // position closed (filled, then closed)
+	LegDeleted LegStatus = "deleted" // pending order deleted or expired without filling
+	LegFailed  LegStatus = "failed"  // OrderSend rejected
+)
+
+// filled reports whether the leg's order became a position.
+func (s LegStatus) filled() bool {
+	return s == LegOpen || s == LegClosed
+}
+
+// OrderSpec describes an order of a group. Zero fields are left to the server
+// (Price 0 = market price).
+type OrderSpec struct {
+	Symbol     string
+	Type       pb.OrderSendOperationType
+	Lots       float64
+	Price      float64
+	StopLoss   float64
+	TakeProfit float64
+	Slippage   int32
+	Magic      int32
+	Comment    string // after the "cid:<id>" tag, truncated to the MT4 limit
+	Expiration time.Time
+}
+
+// pending reports whether s is a limit or stop order.
+func (s OrderSpec) pending() bool {
+	return isPendingOrderType(pb.OpenedOrderType(s.Type))
+}
+
+// TakeProfitTarget is a staged take profit of a bracket: Lots are closed when the market
+// (Bid for buys, Ask for sells) reaches Price.
+type TakeProfitTarget struct {
+	Price float64
+	Lots  float64
+}
+
+// GroupLeg is one order of a group.
+type GroupLeg struct {
+	Spec     OrderSpec
+	ClientID string // client order id of the order (see OrderSendIdempotent)
+	Ticket   int32  // current ticket (0 = not sent; changes after partial closes)
+	Lots     float64
+	Status   LegStatus
+	Err      string // rejection of OrderSend
+}
+
+// OrderGroup is a supervised group of orders. The values handed out by OrderGroups are
+// snapshots.
+type OrderGroup struct {
+	ID     string
+	Kind   GroupKind
+	Status GroupStatus
+	Legs   []GroupLeg
+
+	// Targets are the staged take profits of a bracket, nearest first; Hit counts the
+	// targets taken.
+	Targets []TakeProfitTarget `json:",omitempty"`
+	Hit     int                `json:",omitempty"`
+
+	Err     string `json:",omitempty"`
+	Created time.Time
+	Updated time.Time
+}
+
+func (g *OrderGroup) clone() *OrderGroup {
+	c := *g
+	c.Legs = append([]GroupLeg(nil), g.Legs...)
+	c.Targets = append([]TakeProfitTarget(nil), g.Targets...)
+	return &c
+}
+
+// GroupEventKind classifies a GroupEvent.
+type GroupEventKind string
+
+const (
+	GroupLegPlaced  GroupEventKind = "leg placed"
+	GroupLegFilled  GroupEventKind = "leg filled"
+	GroupLegClosed  GroupEventKind = "leg closed"
+	GroupLegDeleted GroupEventKind = "leg deleted"
+	GroupLegFailed  GroupEventKind = "leg failed"
+	GroupTargetHit  GroupEventKind = "target hit"
+	GroupFinished   GroupEventKind = "finished" // see Group.Status
+)
+
+// GroupEvent reports a change of a group.
+type GroupEvent struct {
+	Kind  GroupEventKind
+	Group *OrderGroup // snapshot after the change
+
+	// Leg is the index of the leg in Group.Legs (-1 for GroupFinished); for GroupTargetHit,
+	// Target is the index of the target.
+	Leg    int
+	Target int
+	Ticket int32
+
+	Err  error
+	Time time.Time
+}
+
+//=== 📂 Group store ===
+
+// GroupStore persists the active groups of an OrderGroups. Implementations must be safe
+// for concurrent use.
+type GroupStore interface {
+	// Load returns the stored groups.
+	Load() ([]*OrderGroup, error)
+
+	// Save stores (or replaces) g.
+	Save(g *OrderGroup) error
+
+	// Delete removes the group with id (no error if it is not stored).
+	Delete(id string) error
+}
+
+// FileGroupStore is a GroupStore persisted as JSON in a local file.
+type FileGroupStore struct {
+	path string
+
+	mu     sync.Mutex
+	loaded bool
+	groups map[string]*OrderGroup
+}
+
+// NewFileGroupStore returns a store at path (created on first Save).
+func NewFileGroupStore(path string) *FileGroupStore {
+	return &FileGroupStore{path: path}
+}
+
+// Load implements GroupStore. A missing file is an empty store.
+func (s *FileGroupStore) Load() ([]*OrderGroup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+	out := make([]*OrderGroup, 0, len(s.groups))
+	for _, g := range s.groups {
+		out = append(out, g.clone())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out, nil
+}
+
+// Save implements GroupStore. The file is replaced atomically.
+func (s *FileGroupStore) Save(g *OrderGroup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	s.groups[g.ID] = g.clone()
+	return s.writeLocked()
+}
+
+// Delete implements GroupStore.
+func (s *FileGroupStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+	if _, ok := s.groups[id]; !ok {
+		return nil
+	}
+	delete(s.groups, id)
+	return s.writeLocked()
+}
+
+// loadLocked reads the file once. Caller holds s.mu.
+func (s *FileGroupStore) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+	groups := make(map[string]*OrderGroup)
+	data, err := os.ReadFile(s.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		// A corrupt file must not silently drop supervised orders; "null" is an empty store.
+		if err := json.Unmarshal(data, &groups); err != nil {
+			return fmt.Errorf("group store %s: %w", s.path, err)
+		}
+	}
+	if groups == nil {
+		groups = make(map[string]*OrderGroup)
+	}
+	s.groups, s.loaded = groups, true
+	return nil
+}
+
+// writeLocked replaces the file. Caller holds s.mu.
+func (s *FileGroupStore) writeLocked() error {
+	data, err := json.MarshalIndent(s.groups, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".groups-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+//=== 📂 Supervisor ===
+
+// OrderGroupsConfig configures NewOrderGroups.
+type OrderGroupsConfig struct {
+	// Store persists the active groups (nil = memory only, no resume after a restart).
+	Store GroupStore
+
+	// ReconcileInterval is the period of the OpenedOrders reconciliation
+	// (0 = DefaultGroupReconcile, negative = only on events and after reconnects).
+	ReconcileInterval time.Duration
+
+	// OnEvent is called after every change of a group, outside the supervisor's lock.
+	OnEvent func(GroupEvent)
+}
+
+// OrderGroups supervises OCO, bracket and if-done groups. It is safe for concurrent use.
+type OrderGroups struct {
+	account *MT4Account
+	cfg     OrderGroupsConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	ticks  *TickSubscription
+
+	// mu serializes all group changes, including the trade calls they make.
+	mu      sync.Mutex
+	groups  map[string]*OrderGroup
+	retryAt map[string]time.Time // bracket target closes that failed
+	events  []GroupEvent         // emitted by unlock
+}
+
+// NewOrderGroups starts a supervisor for account. The active groups of cfg.Store are
+// reconciled with the account and supervised again.
+//
+// Parameters:
+//   - ctx: Lifetime of the supervisor.
+//   - account: Connected account.
+//   - cfg: Store, reconciliation period and event callback (zero value = in-memory defaults).
+//
+// Returns:
+//   - The running supervisor.
+//   - ErrNotConnected, the error of cfg.Store.Load, or of the first reconciliation.
+//
+// Example:
+//
+//	groups, err := mt4.NewOrderGroups(ctx, account, mt4.OrderGroupsConfig{
+//	    Store:   mt4.NewFileGroupStore("groups.json"),
+//	    OnEvent: func(e mt4.GroupEvent) { log.Printf("group %s: %s #%d %v", e.Group.ID, e.Kind, e.Ticket, e.Err) },
+//	})
+//	if err != nil { return err }
+//	defer groups.Close()
+func NewOrderGroups(ctx context.Context, account *MT4Account, cfg OrderGroupsConfig) (*OrderGroups, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if account == nil {
+		return nil, errors.New("NewOrderGroups: nil account")
+	}
+	if !account.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if cfg.ReconcileInterval == 0 {
+		cfg.ReconcileInterval = DefaultGroupReconcile
+	}
+
+	m := &OrderGroups{
+		account: account,
+		cfg:     cfg,
+		done:    make(chan struct{}),
+		groups:  make(map[string]*OrderGroup),
+		retryAt: make(map[string]time.Time),
+	}
+	if cfg.Store != nil {
+		stored, err := cfg.Store.Load()
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range stored {
+			if g.Status == GroupActive {
+				m.groups[g.ID] = g
+			}
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+
+	// Subscribe before reconciling so no event falls between the two.
+	trades, errs := account.OnTradeEvents(runCtx)
+	changes := account.StateChanges()
+	m.ticks = account.TickHub().Subscribe()
+	m.lock()
+	err := m.reconcileLocked(runCtx, nil)
+	m.unlock()
+	if err != nil {
+		cancel()
+		account.unsubscribeStateChanges(changes)
+		m.ticks.Close()
+		return nil, err
+	}
+	go m.run(runCtx, trades, errs, changes)
+	return m, nil
+}
+
+// PlaceOCO sends two pending orders; when one fills, is deleted or expires, the other is
+// deleted.
+//
+// Parameters:
+//   - ctx: Context for the trade calls.
+//   - first, second: The pending orders.
+//
+// Returns:
+//   - A snapshot of the group.
+//   - The OrderSend error. If the second order is rejected, the first is deleted again and the
+//     group fails; after an error that leaves the outcome unknown (ErrTradeTimeout, a lost
+//     connection) the group stays active and the order is sent again at the next reconciliation.
+//
+// Example:
+//
+//	// Breakout either way.
+//	g, err := groups.PlaceOCO(ctx,
+//	    mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYSTOP, Lots: 0.1, Price: 1.1050, StopLoss: 1.1020},
+//	    mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_SELLSTOP, Lots: 0.1, Price: 1.0950, StopLoss: 1.0980})
+func (m *OrderGroups) PlaceOCO(ctx context.Context, first, second OrderSpec) (*OrderGroup, error) {
+	if !first.pending() || !second.pending() {
+		return nil, errors.New("PlaceOCO: both orders must be pending orders")
+	}
+	return m.place(ctx, &OrderGroup{Kind: GroupOCO, Legs: []GroupLeg{{Spec: first}, {Spec: second}}})
+}
+
+// PlaceBracket sends entry (market or pending) with its StopLoss and TakeProfit, and closes
+// the Lots of each target when the market reaches it. What the targets leave open is closed
+// by the server-side SL / TP.
+//
+// Parameters:
+//   - ctx: Context for the trade calls.
+//   - entry: The entry order.
+//   - targets: Staged take profits (any order; their Lots must not exceed entry.Lots).
+//
+// Returns:
+//   - A snapshot of the group.
+//   - A validation error, or the OrderSend error.
+//
+// Example:
+//
+//	// 0.3 lots: a third off at +20 and +40 pips, the rest runs to the TP at +80.
+//	g, err := groups.PlaceBracket(ctx,
+//	    mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUY, Lots: 0.3, StopLoss: 1.0950, TakeProfit: 1.1080},
+//	    []mt4.TakeProfitTarget{{Price: 1.1020, Lots: 0.1}, {Price: 1.1040, Lots: 0.1}})
+func (m *OrderGroups) PlaceBracket(ctx context.Context, entry OrderSpec, targets []TakeProfitTarget) (*OrderGroup, error) {
+	buy := isBuyOrderType(pb.OpenedOrderType(entry.Type))
+	var sum float64
+	for _, t := range targets {
+		if t.Price <= 0 || t.Lots <= 0 {
+			return nil, fmt.Errorf("PlaceBracket: invalid target %v @ %v", t.Lots, t.Price)
+		}
+		sum += t.Lots
+	}
+	if sum > entry.Lots+1e-9 {
+		return nil, fmt.Errorf("PlaceBracket: targets close %s lots of %s", formatFloat(sum), formatFloat(entry.Lots))
+	}
+	targets = append([]TakeProfitTarget(nil), targets...)
+	sort.SliceStable(targets, func(i, j int) bool {
+		return better(!buy, targets[i].Price, targets[j].Price) // nearest first
+	})
+	return m.place(ctx, &OrderGroup{Kind: GroupBracket, Legs: []GroupLeg{{Spec: entry}}, Targets: targets})
+}
+
+// PlaceIfDone sends the first order; every following order is sent when the previous one
+// has filled. If a pending order of the chain is deleted or expires, the chain is cancelled.
+//
+// Parameters:
+//   - ctx: Context for the trade calls.
+//   - chain: Two or more orders.
+//
+// Returns:
+//   - A snapshot of the group.
+//   - The OrderSend error of the first order. Later rejections end the group as GroupFailed
+//     (see OnEvent / Group).
+//
+// Example:
+//
+//	// Buy the pullback; once filled, add on a breakout.
+//	g, err := groups.PlaceIfDone(ctx,
+//	    mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYLIMIT, Lots: 0.1, Price: 1.0980},
+//	    mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYSTOP, Lots: 0.1, Price: 1.1050})
+func (m *OrderGroups) PlaceIfDone(ctx context.Context, chain ...OrderSpec) (*OrderGroup, error) {
+	if len(chain) < 2 {
+		return nil, errors.New("PlaceIfDone: a chain needs at least two orders")
+	}
+	g := &OrderGroup{Kind: GroupIfDone}
+	for _, s := range chain {
+		g.Legs = append(g.Legs, GroupLeg{Spec: s})
+	}
+	return m.place(ctx, g)
+}
+
+// Cancel stops supervising a group and deletes its pending orders. Open positions stay
+// open (with their server-side SL / TP); orders of an if-done chain not sent yet are dropped.
+//
+// Returns:
+//   - ErrUnknownGroup if id is not an active group, or the OrderDelete errors joined.
+func (m *OrderGroups) Cancel(ctx context.Context, id string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.lock()
+	defer m.unlock()
+	g, ok := m.groups[id]
+	if !ok || g.Status != GroupActive {
+		return ErrUnknownGroup
+	}
+	if err := m.deletePending(ctx, g); err != nil {
+		return err
+	}
+	m.finish(g, GroupCancelled, nil)
+	return nil
+}
+
+// Group returns a snapshot of the group with id. Finished groups stay available for the
+// lifetime of the supervisor.
+func (m *OrderGroups) Group(id string) (*OrderGroup, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g, ok := m.groups[id]
+	if !ok {
+		return nil, false
+	}
+	return g.clone(), true
+}
+
+// Groups returns snapshots of the active groups, oldest first.
+func (m *OrderGroups) Groups() []*OrderGroup {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.activeLocked(true)
+}
+
+// Done is closed when the supervisor stops (ctx done, Close, or the OnTrade stream ended).
+func (m *OrderGroups) Done() <-chan struct{} {
+	return m.done
+}
+
+// Close stops the supervisor. The orders and the stored groups stay as they are; a new
+// supervisor with the same store resumes them. Do not call it from OnEvent.
+func (m *OrderGroups) Close() {
+	m.cancel()
+	<-m.done
+}
+
+// running reports whether the supervisor still runs.
+func (m *OrderGroups) running() bool {
+	select {
+	case <-m.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// lock and unlock guard the groups; unlock delivers the events collected meanwhile.
+func (m *OrderGroups) lock() {
+	m.mu.Lock()
+}
+
+func (m *OrderGroups) unlock() {
+	events := m.events
+	m.events = nil
+	m.mu.Unlock()
+	if m.cfg.OnEvent != nil {
+		for _, e := range events {
+			m.cfg.OnEvent(e)
+		}
+	}
+}
+
+// place registers g, sends its first orders and returns a snapshot.
+func (m *OrderGroups) place(ctx context.Context, g *OrderGroup) (*OrderGroup, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !m.running() {
+		return nil, errors.New("order groups: supervisor stopped")
+	}
+	if !m.account.isConnected() {
+		return nil, ErrNotConnected
+	}
+	now := time.Now()
+	g.ID, g.Status, g.Created, g.Updated = NewClientOrderID(), GroupActive, now, now
+	for i := range g.Legs {
+		g.Legs[i].ClientID, g.Legs[i].Status = NewClientOrderID(), LegNew
+	}
+
+	m.lock()
+	defer m.unlock()
+	if err := m.save(g); err != nil {
+		return nil, err
+	}
+	m.groups[g.ID] = g
+
+	// The first orders go out now (OCO: both); advance sends what follows a filled if-done order.
+	n := 1
+	if g.Kind == GroupOCO {
+		n = 2
+	}
+	for i := 0; i < n; i++ {
+		if err := m.sendLeg(ctx, g, i); err != nil {
+			if g.Legs[i].Status == LegFailed {
+				m.finish(g, GroupFailed, errors.Join(err, m.deletePending(ctx, g)))
+			} else {
+				m.save(g) // outcome unknown: reconciliation sends the leg again
+			}
+			return g.clone(), err
+		}
+	}
+	m.advance(ctx, g)
+	m.save(g)
+	m.syncTicks()
+	return g.clone(), nil
+}
+
+// run reconciles on trade events, ticks (bracket targets), reconnects and periodically.
+func (m *OrderGroups) run(ctx context.Context, trades <-chan TradeEvent, errs <-chan error, changes <-chan StateChange) {
+	defer close(m.done)
+	defer m.account.unsubscribeStateChanges(changes)
+	defer m.ticks.Close()
+
+	var tick <-chan time.Time
+	if m.cfg.ReconcileInterval > 0 {
+		t := time.NewTicker(m.cfg.ReconcileInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	reconcile := func(reason string, only map[string]bool) {
+		m.lock()
+		err := m.reconcileLocked(ctx, only)
+		m.unlock()
+		if err != nil && ctx.Err() == nil {
+			m.account.logf("mt4: order groups reconcile (%s): %v", reason, err)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-trades:
+			if !ok {
+				return
+			}
+			m.mu.Lock()
+			only := m.groupsOf(ev.Ticket)
+			m.mu.Unlock()
+			if len(only) > 0 {
+				reconcile("event", only)
+			}
+		case err, ok := <-errs:
+			if ok && err != nil && ctx.Err() == nil {
+				m.account.logf("mt4: order groups stream: %v", err)
+			}
+			return
+		case ch, ok := <-changes:
+			if !ok {
+				return
+			}
+			if ch.To == StateConnected && (ch.From == StateReconnecting || ch.Reestablished) {
+				reconcile("reconnect", nil)
+			}
+		case t, ok := <-m.ticks.C:
+			if !ok {
+				return
+			}
+			m.lock()
+			m.onTick(ctx, t)
+			m.unlock()
+		case <-tick:
+			reconcile("periodic", nil)
+		}
+	}
+}
+
+// groupsOf returns the ids of the active groups with a leg on ticket. Caller holds m.mu.
+func (m *OrderGroups) groupsOf(ticket int32) map[string]bool {
+	out := make(map[string]bool)
+	for _, g := range m.groups {
+		if g.Status != GroupActive {
+			continue
+		}
+		for _, l := range g.Legs {
+			if l.Ticket == ticket {
+				out[g.ID] = true
+			}
+		}
+	}
+	return out
+}
+
+// activeLocked returns the active groups, oldest first (cloned if snapshot is set).
+func (m *OrderGroups) activeLocked(snapshot bool) []*OrderGroup {
+	var out []*OrderGroup
+	for _, g := range m.groups {
+		if g.Status == GroupActive {
+			if snapshot {
+				g = g.clone()
+			}
+			out = append(out, g)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.Before(out[j].Created) })
+	return out
+}
+
+// reconcileLocked refreshes the legs of the active groups (only those in only, nil = all)
+// from OpenedOrders and moves the groups on. Caller holds the lock.
+func (m *OrderGroups) reconcileLocked(ctx context.Context, only map[string]bool) error {
+	defer m.syncTicks()
+	var groups []*OrderGroup
+	for _, g := range m.activeLocked(false) {
+		if only == nil || only[g.ID] {
+			groups = append(groups, g)
+		}
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	data, err := m.account.OpenedOrders(ctx)
+	if err != nil {
+		return err
+	}
+	opened := make(map[int32]*pb.OpenedOrderInfo)
+	from := make(map[int32]*pb.OpenedOrderInfo) // remainders of partial closes by original ticket
+	for _, o := range data.GetOrderInfos() {
+		opened[o.GetTicket()] = o
+		if sm := partialCloseComment.FindStringSubmatch(o.GetComment()); sm != nil {
+			if t, err := strconv.ParseInt(sm[1], 10, 32); err == nil {
+				from[int32(t)] = o
+			}
+		}
+	}
+
+	var errs []error
+	for _, g := range groups {
+		before, _ := json.Marshal(g)
+		for i := range g.Legs {
+			if err := m.refreshLeg(ctx, g, i, opened, from); err != nil {
+				errs = append(errs, fmt.Errorf("group %s: %w", g.ID, err))
+			}
+		}
+		m.advance(ctx, g)
+		if after, _ := json.Marshal(g); string(after) != string(before) && g.Status == GroupActive {
+			g.Updated = time.Now()
+			m.save(g)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// refreshLeg updates leg i of g from the opened orders or the history.
+func (m *OrderGroups) refreshLeg(ctx context.Context, g *OrderGroup, i int, opened, from map[int32]*pb.OpenedOrderInfo) error {
+	leg := &g.Legs[i]
+	if leg.Status != LegPending && leg.Status != LegOpen {
+		return nil
+	}
+	prev := leg.Status
+	for seen := 0; seen < 100; seen++ {
+		if o, ok := opened[leg.Ticket]; ok {
+			if isPendingOrderType(o.GetOrderType()) {
+				leg.Status = LegPending
+			} else {
+				leg.Status = LegOpen
+			}
+			leg.Lots = o.GetLots()
+			m.legChanged(g, i, prev)
+			m.targetsHit(g)
+			return nil
+		}
+		rest, ok := from[leg.Ticket]
+		if !ok {
+			break
+		}
+		leg.Ticket = rest.GetTicket() // partially closed; follow the rest
+	}
+
+	h, err := m.account.findHistoryOrder(ctx, time.Now(), func(h *pb.HistoryOrderInfo) bool {
+		return h.GetTicket() == leg.Ticket
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case h != nil && isPendingOrderType(h.GetOrderType()):
+		leg.Status = LegDeleted
+	case h != nil, prev == LegOpen:
+		leg.Status = LegClosed
+	default:
+		leg.Status = LegDeleted
+	}
+	m.legChanged(g, i, prev)
+	return nil
+}
+
+// legChanged reports the transition of leg i from prev.
+func (m *OrderGroups) legChanged(g *OrderGroup, i int, prev LegStatus) {
+	cur := g.Legs[i].Status
+	if cur == prev {
+		return
+	}
+	if cur.filled() && !prev.filled() {
+		m.emit(g, GroupLegFilled, i, -1, nil)
+	}
+	switch cur {
+	case LegClosed:
+		m.emit(g, GroupLegClosed, i, -1, nil)
+	case LegDeleted:
+		m.emit(g, GroupLegDeleted, i, -1, nil)
+	}
+}
+
+// targetsHit counts the bracket targets the closed volume covers (targets also taken
+// before a restart, when the position shrank but Hit was not stored yet).
+func (m *OrderGroups) targetsHit(g *OrderGroup) {
+	if g.Kind != GroupBracket || g.Legs[0].Status != LegOpen {
+		return
+	}
+	closed := g.Legs[0].Spec.Lots - g.Legs[0].Lots
+	var sum float64
+	for n := range g.Targets {
+		sum += g.Targets[n].Lots
+		if sum > closed+1e-9 {
+			return
+		}
+		if n >= g.Hit {
+			g.Hit = n + 1
+			m.emit(g, GroupTargetHit, 0, n, nil)
+		}
+	}
+}
+
+// advance acts on the state of g's legs.
+func (m *OrderGroups) advance(ctx context.Context, g *OrderGroup) {
+	if g.Status != GroupActive {
+		return
+	}
+	switch g.Kind {
+	case GroupOCO:
+		filled, ended := 0, false
+		for _, l := range g.Legs {
+			switch {
+			case l.Status.filled():
+				filled++
+			case l.Status == LegDeleted || l.Status == LegFailed:
+				ended = true
+			}
+		}
+		if filled == 0 && !ended {
+			for i := range g.Legs {
+				if g.Legs[i].Status != LegNew {
+					continue
+				}
+				if err := m.sendLeg(ctx, g, i); err != nil {
+					if g.Legs[i].Status != LegFailed {
+						return // sent again on the next reconciliation
+					}
+					ended = true
+				}
+			}
+			if !ended {
+				return
+			}
+		}
+		if err := m.deletePending(ctx, g); err != nil {
+			m.account.logf("mt4: order group %s: %v", g.ID, err)
+			return // retried on the next reconciliation
+		}
+		switch filled {
+		case 0:
+			for _, l := range g.Legs {
+				if l.Status == LegFailed {
+					m.finish(g, GroupFailed, errors.New(l.Err))
+					return
+				}
+			}
+			m.finish(g, GroupCancelled, nil)
+		case 1:
+			m.finish(g, GroupDone, nil)
+		default:
+			m.finish(g, GroupFailed, errors.New("both OCO orders filled"))
+		}
+
+	case GroupBracket:
+		if g.Legs[0].Status == LegNew {
+			m.sendLeg(ctx, g, 0) // resumed after a restart
+		}
+		switch g.Legs[0].Status {
+		case LegClosed:
+			m.finish(g, GroupDone, nil)
+		case LegDeleted:
+			m.finish(g, GroupCancelled, nil)
+		case LegFailed:
+			m.finish(g, GroupFailed, errors.New(g.Legs[0].Err))
+		}
+
+	case GroupIfDone:
+		for i := range g.Legs {
+			leg := &g.Legs[i]
+			if leg.Status == LegNew {
+				if err := m.sendLeg(ctx, g, i); err != nil {
+					if leg.Status == LegFailed {
+						m.finish(g, GroupFailed, err)
+					}
+					return
+				}
+			}
+			switch leg.Status {
+			case LegPending:
+				return
+			case LegDeleted:
+				m.finish(g, GroupCancelled, nil)
+				return
+			}
+		}
+		m.finish(g, GroupDone, nil)
+	}
+}
+
+// sendLeg sends leg i of g. Definite rejections mark the leg failed; other errors (the
+// connection, a trade timeout) leave it new, to be sent again (with the same client order
+// id, which finds the order if it was executed after all) later.
+func (m *OrderGroups) sendLeg(ctx context.Context, g *OrderGroup, i int) error {
+	leg := &g.Legs[i]
+	s := leg.Spec
+	opt := func(v float64) *float64 {
+		if v == 0 {
+			return nil
+		}
+		return &v
+	}
+	var slippage, magic *int32
+	if s.Slippage != 0 {
+		slippage = &s.Slippage
+	}
+	if s.Magic != 0 {
+		magic = &s.Magic
+	}
+	var comment *string
+	if s.Comment != "" {
+		comment = &s.Comment
+	}
+	var expiration *timestamppb.Timestamp
+	if !s.Expiration.IsZero() {
+		expiration = timestamppb.New(s.Expiration)
+	}
+
+	data, err := m.account.OrderSendIdempotent(ctx, leg.ClientID, s.Symbol, s.Type, s.Lots,
+		opt(s.Price), slippage, opt(s.StopLoss), opt(s.TakeProfit), comment, magic, expiration)
+	if err != nil {
+		if definiteRejection(err) {
+			leg.Status, leg.Err = LegFailed, err.Error()
+			m.emit(g, GroupLegFailed, i, -1, err)
+		} else if ctx.Err() == nil {
+			m.account.logf("mt4: order group %s: leg %d: %v", g.ID, i, err)
+		}
+		return err
+	}
+	leg.Ticket, leg.Lots = data.GetTicket(), data.GetVolume()
+	if leg.Lots == 0 {
+		leg.Lots = s.Lots
+	}
+	leg.Status = LegOpen
+	if s.pending() {
+		leg.Status = LegPending
+	}
+	m.emit(g, GroupLegPlaced, i, -1, nil)
+	if leg.Status == LegOpen {
+		m.emit(g, GroupLegFilled, i, -1, nil)
+	}
+	return nil
+}
+
+// definiteRejection reports whether err refuses an order for good (as opposed to a lost
+// connection or a trade timeout, after which the order may exist, or a busy server; the
+// order is sent again).
+func definiteRejection(err error) bool {
+	var riskErr *RiskError
+	var valErr *ValidationError
+	if errors.As(err, &riskErr) || errors.As(err, &valErr) {
+		return true
+	}
+	if _, ok := AsAPIError(err); !ok {
+		return false
+	}
+	for _, transient := range transientSendErrors {
+		if errors.Is(err, transient) {
+			return false
+		}
+	}
+	return true
+}
+
+// transientSendErrors are the API errors after which an order group sends a leg again.
+var transientSendErrors = []error{
+	ErrTradeTimeout, ErrNoConnection, ErrServerBusy, ErrTradeContextBusy, ErrTooManyRequests, ErrTerminalNotFound,
+}
+
+// deletePending deletes the pending legs of g.
+func (m *OrderGroups) deletePending(ctx context.Context, g *OrderGroup) error {
+	var errs []error
+	for i := range g.Legs {
+		leg := &g.Legs[i]
+		if leg.Status != LegPending {
+			continue
+		}
+		if _, err := m.account.OrderDelete(ctx, leg.Ticket); err != nil {
+			errs = append(errs, fmt.Errorf("order #%d: %w", leg.Ticket, err))
+			continue
+		}
+		leg.Status = LegDeleted
+		m.emit(g, GroupLegDeleted, i, -1, nil)
+	}
+	return errors.Join(errs...)
+}
+
+// onTick closes the bracket targets the tick reached.
+func (m *OrderGroups) onTick(ctx context.Context, t *pb.OnSymbolMqlTickInfo) {
+	reached := make(map[string]bool)
+	for _, g := range m.activeLocked(false) {
+		leg := &g.Legs[0]
+		if g.Kind != GroupBracket || leg.Status != LegOpen || g.Hit >= len(g.Targets) ||
+			leg.Spec.Symbol != t.GetSymbol() || time.Now().Before(m.retryAt[g.ID]) {
+			continue
+		}
+		target := g.Targets[g.Hit]
+		buy := isBuyOrderType(pb.OpenedOrderType(leg.Spec.Type))
+		if (buy && t.GetBid() < target.Price) || (!buy && t.GetAsk() > target.Price) {
+			continue
+		}
+		var lots *float64 // nil = the whole position
+		if target.Lots < leg.Lots-1e-9 {
+			lots = &target.Lots
+		}
+		var slippage *int32
+		if leg.Spec.Slippage != 0 {
+			slippage = &leg.Spec.Slippage
+		}
+		if _, err := m.account.OrderCloseIdempotent(ctx, leg.Ticket, lots, nil, slippage); err != nil {
+			m.retryAt[g.ID] = time.Now().Add(time.Second)
+			if ctx.Err() == nil {
+				m.account.logf("mt4: order group %s: target %d: %v", g.ID, g.Hit, err)
+			}
+			continue
+		}
+		delete(m.retryAt, g.ID)
+		g.Hit++
+		m.emit(g, GroupTargetHit, 0, g.Hit-1, nil)
+		m.save(g)
+		reached[g.ID] = true
+	}
+	if len(reached) > 0 {
+		if err := m.reconcileLocked(ctx, reached); err != nil && ctx.Err() == nil {
+			m.account.logf("mt4: order groups reconcile (target): %v", err)
+		}
+	}
+}
+
+// syncTicks follows the symbols of the brackets with targets left. Caller holds the lock.
+func (m *OrderGroups) syncTicks() {
+	want := make(map[string]bool)
+	for _, g := range m.activeLocked(false) {
+		if g.Kind == GroupBracket && g.Hit < len(g.Targets) && g.Legs[0].Status != LegNew {
+			want[g.Legs[0].Spec.Symbol] = true
+		}
+	}
+	have := make(map[string]bool)
+	for _, s := range m.ticks.Symbols() {
+		have[s] = true
+		if !want[s] {
+			m.ticks.Unsubscribe(s)
+		}
+	}
+	for s := range want {
+		if !have[s] {
+			m.ticks.Subscribe(s)
+		}
+	}
+}
+
+// finish ends g and removes it from the store.
+func (m *OrderGroups) finish(g *OrderGroup, status GroupStatus, err error) {
+	g.Status, g.Updated = status, time.Now()
+	if err != nil {
+		g.Err = err.Error()
+	}
+	delete(m.retryAt, g.ID)
+	if m.cfg.Store != nil {
+		if err := m.cfg.Store.Delete(g.ID); err != nil {
+			m.account.logf("mt4: order group %s: store: %v", g.ID, err)
+		}
+	}
+	m.emit(g, GroupFinished, -1, -1, err)
+}
+
+// save stores g (no-op without a store). Errors are logged and returned.
+func (m *OrderGroups) save(g *OrderGroup) error {
+	if m.cfg.Store == nil || g.Status != GroupActive {
+		return nil
+	}
+	if err := m.cfg.Store.Save(g); err != nil {
+		m.account.logf("mt4: order group %s: store: %v", g.ID, err)
+		return err
+	}
+	return nil
+}
+
+// emit queues an event for unlock.
+func (m *OrderGroups) emit(g *OrderGroup, kind GroupEventKind, leg, target int, err error) {
+	e := GroupEvent{Kind: kind, Group: g.clone(), Leg: leg, Target: target, Err: err, Time: time.Now()}
+	if leg >= 0 {
+		e.Ticket = g.Legs[leg].Ticket
+	}
+	m.events = append(m.events, e)
+}
@@ -0,0 +1,352 @@
+package mt4_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// newTestGroups starts an order group supervisor on account, closed when the test ends.
+func newTestGroups(t *testing.T, account *mt4.MT4Account, cfg mt4.OrderGroupsConfig) *mt4.OrderGroups {
+	t.Helper()
+	groups, err := mt4.NewOrderGroups(testContext(t), account, cfg)
+	if err != nil {
+		t.Fatalf("NewOrderGroups: %v", err)
+	}
+	t.Cleanup(groups.Close)
+	return groups
+}
+
+// groupStatus returns the status of group id (empty if unknown).
+func groupStatus(groups *mt4.OrderGroups, id string) mt4.GroupStatus {
+	g, ok := groups.Group(id)
+	if !ok {
+		return ""
+	}
+	return g.Status
+}
+
+// breakoutBuy and breakoutSell are an OCO pair around EURUSD 1.1/1.1001.
+var (
+	breakoutBuy  = mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYSTOP, Lots: 0.1, Price: 1.105}
+	breakoutSell = mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_SELLSTOP, Lots: 0.1, Price: 1.095}
+)
+
+// failSecondOrderSend makes the second of the next two OrderSend calls reply with mql.
+func failSecondOrderSend(srv *mt4test.Server, mql pb.MqlErrorCode) {
+	srv.InjectFault("OrderSend", mt4test.Fault{Latency: time.Millisecond, Times: 1})
+	srv.FailNextAPI("OrderSend", 1, "MQL_ERROR", mql)
+}
+
+func TestOrderGroupsOCO(t *testing.T) {
+	srv, account := newTestAccount(t)
+	var mu sync.Mutex
+	var kinds []mt4.GroupEventKind
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{OnEvent: func(e mt4.GroupEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		kinds = append(kinds, e.Kind)
+	}})
+
+	g, err := groups.PlaceOCO(testContext(t), breakoutBuy, breakoutSell)
+	if err != nil {
+		t.Fatalf("PlaceOCO: %v", err)
+	}
+	if g.Status != mt4.GroupActive || g.Legs[0].Status != mt4.LegPending || g.Legs[1].Status != mt4.LegPending {
+		t.Fatalf("group = %+v", g)
+	}
+	if len(groups.Groups()) != 1 || len(srv.Orders()) != 2 {
+		t.Fatalf("%d groups, %d orders", len(groups.Groups()), len(srv.Orders()))
+	}
+
+	srv.PushTick("EURUSD", 1.105, 1.1051) // the buy stop fills
+	eventually(t, "the OCO group to finish", func() bool { return groupStatus(groups, g.ID) == mt4.GroupDone })
+
+	done, _ := groups.Group(g.ID)
+	if done.Legs[0].Status != mt4.LegOpen || done.Legs[1].Status != mt4.LegDeleted {
+		t.Errorf("legs = %+v", done.Legs)
+	}
+	if srv.Order(g.Legs[1].Ticket) != nil || srv.Order(g.Legs[0].Ticket) == nil {
+		t.Error("wrong order deleted")
+	}
+	if len(groups.Groups()) != 0 {
+		t.Error("finished group still active")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []mt4.GroupEventKind{mt4.GroupLegPlaced, mt4.GroupLegPlaced, mt4.GroupLegFilled, mt4.GroupLegDeleted, mt4.GroupFinished}
+	if len(kinds) != len(want) {
+		t.Fatalf("events = %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Errorf("events = %v, want %v", kinds, want)
+			break
+		}
+	}
+}
+
+func TestOrderGroupsBracket(t *testing.T) {
+	srv, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{})
+
+	g, err := groups.PlaceBracket(testContext(t),
+		mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUY, Lots: 0.3, StopLoss: 1.095, TakeProfit: 1.108},
+		[]mt4.TakeProfitTarget{{Price: 1.104, Lots: 0.1}, {Price: 1.102, Lots: 0.1}})
+	if err != nil {
+		t.Fatalf("PlaceBracket: %v", err)
+	}
+	if g.Legs[0].Status != mt4.LegOpen || g.Targets[0].Price != 1.102 {
+		t.Fatalf("group = %+v, want an open entry and the nearest target first", g)
+	}
+
+	// The tick subscription starts asynchronously: push until the target is taken.
+	for hit, bid := range []float64{1.102, 1.104} {
+		eventually(t, "the target close", func() bool {
+			srv.PushTick("EURUSD", bid, bid+0.0001)
+			cur, _ := groups.Group(g.ID)
+			return cur.Hit == hit+1 && near(cur.Legs[0].Lots, 0.2-0.1*float64(hit))
+		})
+	}
+	if got := srv.Calls("OrderCloseDelete"); got != 2 {
+		t.Errorf("OrderClose calls = %d, want one per target", got)
+	}
+
+	srv.PushTick("EURUSD", 1.108, 1.1081) // the server-side TP closes the rest
+	eventually(t, "the bracket to finish", func() bool { return groupStatus(groups, g.ID) == mt4.GroupDone })
+	if len(srv.Orders()) != 0 {
+		t.Errorf("orders left: %v", srv.Orders())
+	}
+}
+
+func TestOrderGroupsIfDone(t *testing.T) {
+	srv, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{})
+
+	g, err := groups.PlaceIfDone(testContext(t),
+		mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYLIMIT, Lots: 0.1, Price: 1.098},
+		mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUYSTOP, Lots: 0.1, Price: 1.105})
+	if err != nil {
+		t.Fatalf("PlaceIfDone: %v", err)
+	}
+	if g.Legs[0].Status != mt4.LegPending || g.Legs[1].Status != mt4.LegNew || srv.Calls("OrderSend") != 1 {
+		t.Fatalf("legs = %+v, want only the first order sent", g.Legs)
+	}
+
+	srv.PushTick("EURUSD", 1.0979, 1.098) // the limit fills, the stop goes out
+	eventually(t, "the second order", func() bool {
+		cur, _ := groups.Group(g.ID)
+		return cur.Legs[1].Status == mt4.LegPending
+	})
+
+	srv.PushTick("EURUSD", 1.105, 1.1051)
+	eventually(t, "the chain to finish", func() bool { return groupStatus(groups, g.ID) == mt4.GroupDone })
+	if got := len(srv.Orders()); got != 2 {
+		t.Errorf("%d positions, want 2", got)
+	}
+}
+
+func TestOrderGroupsCancel(t *testing.T) {
+	srv, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{})
+	g, err := groups.PlaceOCO(testContext(t), breakoutBuy, breakoutSell)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := groups.Cancel(testContext(t), g.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if groupStatus(groups, g.ID) != mt4.GroupCancelled || len(srv.Orders()) != 0 {
+		t.Errorf("status %s, %d orders left", groupStatus(groups, g.ID), len(srv.Orders()))
+	}
+	if err := groups.Cancel(testContext(t), g.ID); !errors.Is(err, mt4.ErrUnknownGroup) {
+		t.Errorf("second Cancel = %v, want ErrUnknownGroup", err)
+	}
+	if err := groups.Cancel(testContext(t), "nope"); !errors.Is(err, mt4.ErrUnknownGroup) {
+		t.Errorf("Cancel(unknown) = %v, want ErrUnknownGroup", err)
+	}
+}
+
+func TestOrderGroupsInvalid(t *testing.T) {
+	_, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{})
+	market := mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUY, Lots: 0.1}
+
+	if _, err := groups.PlaceOCO(testContext(t), market, breakoutSell); err == nil {
+		t.Error("OCO with a market order placed")
+	}
+	if _, err := groups.PlaceBracket(testContext(t), market, []mt4.TakeProfitTarget{{Price: 1.102, Lots: 0.2}}); err == nil {
+		t.Error("bracket targets beyond the entry lots placed")
+	}
+	if _, err := groups.PlaceIfDone(testContext(t), market); err == nil {
+		t.Error("if-done chain of one order placed")
+	}
+
+	_, disconnected := newDisconnectedAccount(t)
+	if _, err := mt4.NewOrderGroups(testContext(t), disconnected, mt4.OrderGroupsConfig{}); !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("NewOrderGroups before connecting = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestOrderGroupsRejection(t *testing.T) {
+	srv, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{})
+	failSecondOrderSend(srv, pb.MqlErrorCode_ERR_TRADE_DISABLED)
+
+	g, err := groups.PlaceOCO(testContext(t), breakoutBuy, breakoutSell)
+	if !errors.Is(err, mt4.ErrTradeDisabled) {
+		t.Fatalf("PlaceOCO = %v, want ErrTradeDisabled", err)
+	}
+	if g.Status != mt4.GroupFailed || g.Legs[0].Status != mt4.LegDeleted || g.Legs[1].Status != mt4.LegFailed || g.Err == "" {
+		t.Errorf("group = %+v, want failed with the first order deleted", g)
+	}
+	if len(srv.Orders()) != 0 {
+		t.Errorf("orders left: %v", srv.Orders())
+	}
+	if len(groups.Groups()) != 0 {
+		t.Error("failed group still active")
+	}
+}
+
+func TestOrderGroupsUnknownOutcome(t *testing.T) {
+	srv, account := newTestAccount(t)
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{ReconcileInterval: 20 * time.Millisecond})
+	failSecondOrderSend(srv, pb.MqlErrorCode_ERR_TRADE_TIMEOUT)
+
+	g, err := groups.PlaceOCO(testContext(t), breakoutBuy, breakoutSell)
+	if !errors.Is(err, mt4.ErrTradeTimeout) {
+		t.Fatalf("PlaceOCO = %v, want ErrTradeTimeout", err)
+	}
+	if g.Status != mt4.GroupActive || g.Legs[0].Status != mt4.LegPending || g.Legs[1].Status != mt4.LegNew || g.Legs[1].ClientID == "" {
+		t.Fatalf("group = %+v, want active with the second order still new", g)
+	}
+	if srv.Order(g.Legs[0].Ticket) == nil {
+		t.Fatal("first order deleted although the second may exist")
+	}
+
+	// The next reconciliation sends the order again.
+	eventually(t, "the second order", func() bool {
+		cur, _ := groups.Group(g.ID)
+		return cur.Legs[1].Status == mt4.LegPending
+	})
+	if got := srv.Calls("OrderSend"); got != 3 {
+		t.Errorf("OrderSend calls = %d, want 3", got)
+	}
+	if got := len(srv.Orders()); got != 2 {
+		t.Errorf("%d orders, want 2", got)
+	}
+}
+
+func TestOrderGroupsResume(t *testing.T) {
+	srv, account := newTestAccount(t)
+	path := filepath.Join(t.TempDir(), "groups.json")
+	store := mt4.NewFileGroupStore(path)
+	first, err := mt4.NewOrderGroups(testContext(t), account, mt4.OrderGroupsConfig{Store: store, ReconcileInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failSecondOrderSend(srv, pb.MqlErrorCode_ERR_TRADE_TIMEOUT)
+	g, err := first.PlaceOCO(testContext(t), breakoutBuy, breakoutSell)
+	if !errors.Is(err, mt4.ErrTradeTimeout) {
+		t.Fatalf("PlaceOCO = %v, want ErrTradeTimeout", err)
+	}
+	first.Close()
+
+	stored, err := store.Load()
+	if err != nil || len(stored) != 1 || stored[0].ID != g.ID || stored[0].Legs[1].ClientID != g.Legs[1].ClientID {
+		t.Fatalf("stored = %+v, %v", stored, err)
+	}
+
+	// The order was executed after all; the resumed supervisor finds it by its client order id.
+	ticket := srv.AddOrder(&pb.OpenedOrderInfo{
+		Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELLSTOP, Lots: 0.1, OpenPrice: 1.095,
+		Comment: "cid:" + g.Legs[1].ClientID,
+	})
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{Store: mt4.NewFileGroupStore(path), ReconcileInterval: -1})
+	cur, ok := groups.Group(g.ID)
+	if !ok || cur.Status != mt4.GroupActive || cur.Legs[1].Status != mt4.LegPending || cur.Legs[1].Ticket != ticket {
+		t.Fatalf("resumed group = %+v", cur)
+	}
+	if got := srv.Calls("OrderSend"); got != 2 {
+		t.Errorf("OrderSend calls = %d, want 2 (no duplicate)", got)
+	}
+}
+
+func TestOrderGroupsBracketRejected(t *testing.T) {
+	srv, account := newTestAccount(t)
+	path := filepath.Join(t.TempDir(), "groups.json")
+	entry := mt4.OrderSpec{Symbol: "EURUSD", Type: pb.OrderSendOperationType_OC_OP_BUY, Lots: 0.1, StopLoss: 1.095}
+
+	// Rejected right away.
+	groups := newTestGroups(t, account, mt4.OrderGroupsConfig{Store: mt4.NewFileGroupStore(path), ReconcileInterval: -1})
+	srv.FailNextAPI("OrderSend", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_DISABLED)
+	g, err := groups.PlaceBracket(testContext(t), entry, nil)
+	if !errors.Is(err, mt4.ErrTradeDisabled) || g.Status != mt4.GroupFailed || g.Err == "" {
+		t.Errorf("PlaceBracket = %+v, %v, want failed", g, err)
+	}
+
+	// Rejected when sent again after a restart: the same status.
+	srv.FailNextAPI("OrderSend", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_TIMEOUT)
+	g, err = groups.PlaceBracket(testContext(t), entry, nil)
+	if !errors.Is(err, mt4.ErrTradeTimeout) || g.Status != mt4.GroupActive {
+		t.Fatalf("PlaceBracket = %+v, %v, want active", g, err)
+	}
+	groups.Close()
+	srv.FailNextAPI("OrderSend", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_DISABLED)
+	resumed := newTestGroups(t, account, mt4.OrderGroupsConfig{Store: mt4.NewFileGroupStore(path), ReconcileInterval: -1})
+	cur, ok := resumed.Group(g.ID)
+	if !ok || cur.Status != mt4.GroupFailed || cur.Legs[0].Status != mt4.LegFailed || cur.Err == "" {
+		t.Errorf("resumed bracket = %+v, want failed", cur)
+	}
+	if stored, err := mt4.NewFileGroupStore(path).Load(); err != nil || len(stored) != 0 {
+		t.Errorf("stored = %+v, %v, want none", stored, err)
+	}
+}
+
+func TestFileGroupStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "groups.json")
+	if err := os.WriteFile(path, []byte("null"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A "null" file is an empty store that can be written to.
+	store := mt4.NewFileGroupStore(path)
+	if groups, err := store.Load(); err != nil || len(groups) != 0 {
+		t.Fatalf("Load(null) = %v, %v", groups, err)
+	}
+	g := &mt4.OrderGroup{ID: "g1", Kind: mt4.GroupOCO, Status: mt4.GroupActive, Created: time.Now()}
+	if err := store.Save(g); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if groups, err := mt4.NewFileGroupStore(path).Load(); err != nil || len(groups) != 1 || groups[0].ID != "g1" {
+		t.Errorf("Load after Save = %v, %v", groups, err)
+	}
+	if err := store.Delete("g1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("g1"); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+
+	// A corrupt file is an error, not an empty store.
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mt4.NewFileGroupStore(corrupt).Load(); err == nil {
+		t.Error("corrupt store loaded")
+	}
+	if err := mt4.NewFileGroupStore(corrupt).Save(g); err == nil {
+		t.Error("Save replaced a corrupt store")
+	}
+}
@@ -0,0 +1,367 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+//=== 📂 Account pool ===
+//
+// Every MT4Account normally dials its own gRPC connection. The server routes each call by
+// the "id" header, so many logins can share a few connections instead: AccountPool dials
+// PoolConfig.Connections connections once and spreads its accounts over them (least
+// loaded first). Connects and automatic re-establishments of all pooled accounts share
+// one concurrency limit, so a server restart does not trigger hundreds of logins at once.
+
+// PoolConfig sizes an AccountPool. Zero fields use the defaults in parentheses.
+type PoolConfig struct {
+	// Connections is the number of shared gRPC connections (4).
+	Connections int
+
+	// MaxAccounts caps the number of logins; Add fails with ErrPoolFull beyond it (0 = unlimited).
+	MaxAccounts int
+
+	// MaxConcurrentConnects bounds simultaneous connects and re-establishments across the pool (8).
+	MaxConcurrentConnects int
+
+	// Parallelism bounds the concurrency of ForEach and Close (16).
+	Parallelism int
+}
+
+// withDefaults returns c with zero fields set to their defaults.
+func (c PoolConfig) withDefaults() PoolConfig {
+	if c.Connections <= 0 {
+		c.Connections = 4
+	}
+	if c.MaxConcurrentConnects <= 0 {
+		c.MaxConcurrentConnects = 8
+	}
+	if c.Parallelism <= 0 {
+		c.Parallelism = 16
+	}
+	return c
+}
+
+// AccountPool multiplexes many MT4 logins over a small set of shared gRPC connections.
+// It is safe for concurrent use.
+type AccountPool struct {
+	cfg   PoolConfig
+	opts  []Option
+	conns []*grpc.ClientConn
+
+	// connectSlots is the pool-wide connect limit (see MT4Account.connectSlots).
+	connectSlots chan struct{}
+
+	mu      sync.RWMutex
+	closed  bool
+	members map[uint64]*poolMember
+	load    []int // accounts per connection
+}
+
+// poolMember is one login of the pool. account is nil while Add is still connecting.
+type poolMember struct {
+	account *MT4Account
+	conn    int
+}
+
+// PoolHealth is an aggregate view of an AccountPool (see AccountPool.Health).
+type PoolHealth struct {
+	// Accounts is the number of logins in the pool.
+	Accounts int
+
+	// ByState counts the logins per session state.
+	ByState map[SessionState]int
+
+	// Down lists the logins that are not StateConnected, in ascending order.
+	Down []uint64
+
+	// Connections is the state of each shared gRPC connection.
+	Connections []connectivity.State
+}
+
+// Healthy reports whether every login is connected and no shared connection has failed.
+func (h PoolHealth) Healthy() bool {
+	for _, s := range h.Connections {
+		if s == connectivity.TransientFailure || s == connectivity.Shutdown {
+			return false
+		}
+	}
+	return len(h.Down) == 0
+}
+
+// NewAccountPool dials the shared connections.
+//
+// Parameters:
+//   - cfg: Pool sizing (zero value = defaults).
+//   - opts: Options for the connections (WithEndpoint, WithTLSConfig, WithKeepalive, WithDialOptions, ...)
+//     and for every account (WithRetryPolicy, WithDefaultTimeouts, WithLogger, ...).
+//
+// Returns:
+//   - The pool, without accounts yet (see Add).
+//   - Error if a gRPC client cannot be created (e.g. invalid target).
+//
+// Example:
+//
+//	pool, err := mt4.NewAccountPool(mt4.PoolConfig{Connections: 8}, mt4.WithLogger(log.Default()))
+//	...
+//	acc, err := pool.Add(ctx, login, password, mt4.Session{ServerName: "MetaQuotes-Demo", BaseChartSymbol: "EURUSD", ConnectTimeout: 30})
+func NewAccountPool(cfg PoolConfig, opts ...Option) (*AccountPool, error) {
+	cfg = cfg.withDefaults()
+
+	o := accountOptions{endpoint: DefaultEndpoint}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+
+	p := &AccountPool{
+		cfg:          cfg,
+		opts:         opts,
+		connectSlots: make(chan struct{}, cfg.MaxConcurrentConnects),
+		members:      make(map[uint64]*poolMember),
+		load:         make([]int, cfg.Connections),
+	}
+	for i := 0; i < cfg.Connections; i++ {
+		conn, err := grpc.NewClient(o.endpoint, o.grpcDialOptions()...)
+		if err != nil {
+			p.closeConns()
+			return nil, err
+		}
+		p.conns = append(p.conns, conn)
+	}
+	return p, nil
+}
+
+// Add creates an account for login on the least loaded shared connection and connects it
+// to target (ServerName, Proxy or Host/Port, as for ConnectWithProgress). The connect waits
+// for a slot of the pool's MaxConcurrentConnects limit.
+//
+// Returns:
+//   - The connected account; it keeps re-establishing its session on its own.
+//   - ErrPoolClosed, ErrPoolFull, ErrDuplicateLogin, or the connect error (the login is then not added).
+func (p *AccountPool) Add(ctx context.Context, login uint64, password string, target Session) (*MT4Account, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if target.Host == "" && target.ServerName == "" {
+		return nil, errors.New("AccountPool.Add: target needs ServerName or Host")
+	}
+
+	// Reserve the login and a connection.
+	p.mu.Lock()
+	switch {
+	case p.closed:
+		p.mu.Unlock()
+		return nil, ErrPoolClosed
+	case p.members[login] != nil:
+		p.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d", ErrDuplicateLogin, login)
+	case p.cfg.MaxAccounts > 0 && len(p.members) >= p.cfg.MaxAccounts:
+		p.mu.Unlock()
+		return nil, ErrPoolFull
+	}
+	m := &poolMember{conn: p.leastLoadedLocked()}
+	p.members[login] = m
+	p.load[m.conn]++
+	conn := p.conns[m.conn]
+	p.mu.Unlock()
+
+	account, err := NewMT4Account(login, password, append(append([]Option(nil), p.opts...), WithClientConn(conn))...)
+	if err == nil {
+		account.connectSlots = p.connectSlots
+		if err = account.connect(ctx, target, "AccountPool.Add"); err != nil {
+			_ = account.Disconnect()
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil && p.closed {
+		_ = account.Disconnect()
+		err = ErrPoolClosed
+	}
+	if err != nil {
+		delete(p.members, login)
+		p.load[m.conn]--
+		return nil, err
+	}
+	m.account = account
+	return account, nil
+}
+
+// leastLoadedLocked returns the connection with the fewest accounts. Caller holds p.mu.
+func (p *AccountPool) leastLoadedLocked() int {
+	best := 0
+	for i, n := range p.load {
+		if n < p.load[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// Get returns the account of login (false while it is still being added or if unknown).
+func (p *AccountPool) Get(login uint64) (*MT4Account, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	m := p.members[login]
+	if m == nil || m.account == nil {
+		return nil, false
+	}
+	return m.account, true
+}
+
+// Logins returns the logins of all added accounts in ascending order.
+func (p *AccountPool) Logins() []uint64 {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	logins := make([]uint64, 0, len(p.members))
+	for login, m := range p.members {
+		if m.account != nil {
+			logins = append(logins, login)
+		}
+	}
+	sort.Slice(logins, func(i, j int) bool { return logins[i] < logins[j] })
+	return logins
+}
+
+// Reconnect connects login again with its last session parameters, within the pool's
+// connect limit, e.g. after a Logout or a failed re-establishment.
+func (p *AccountPool) Reconnect(ctx context.Context, login uint64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	account, ok := p.Get(login)
+	if !ok {
+		return fmt.Errorf("AccountPool.Reconnect: unknown login %d", login)
+	}
+	target := account.lastTarget()
+	if target.Host == "" && target.ServerName == "" {
+		return fmt.Errorf("AccountPool.Reconnect: login %d has no session parameters", login)
+	}
+	return account.connect(ctx, target, "AccountPool.Reconnect")
+}
+
+// ForEach calls fn for every account, at most PoolConfig.Parallelism at a time, and
+// returns the joined errors (each prefixed with its login). Accounts not yet started
+// when ctx is done are skipped with ctx.Err().
+func (p *AccountPool) ForEach(ctx context.Context, fn func(ctx context.Context, account *MT4Account) error) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var accounts []*MT4Account
+	for _, login := range p.Logins() {
+		if a, ok := p.Get(login); ok {
+			accounts = append(accounts, a)
+		}
+	}
+	return p.parallel(ctx, accounts, fn)
+}
+
+// parallel runs fn over accounts with the pool's Parallelism.
+func (p *AccountPool) parallel(ctx context.Context, accounts []*MT4Account, fn func(context.Context, *MT4Account) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+		sem  = make(chan struct{}, p.cfg.Parallelism)
+	)
+	fail := func(a *MT4Account, err error) {
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("login %d: %w", a.User, err))
+		mu.Unlock()
+	}
+	for _, a := range accounts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(a, ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func(a *MT4Account) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, a); err != nil {
+				fail(a, err)
+			}
+		}(a)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Health returns the aggregate state of the pool.
+func (p *AccountPool) Health() PoolHealth {
+	h := PoolHealth{ByState: make(map[SessionState]int)}
+	for _, login := range p.Logins() {
+		a, ok := p.Get(login)
+		if !ok {
+			continue
+		}
+		st := a.State()
+		h.Accounts++
+		h.ByState[st]++
+		if st != StateConnected {
+			h.Down = append(h.Down, login)
+		}
+	}
+	for _, c := range p.conns {
+		h.Connections = append(h.Connections, c.GetState())
+	}
+	return h
+}
+
+// Remove logs login out, closes its account and frees its slot.
+func (p *AccountPool) Remove(login uint64) error {
+	p.mu.Lock()
+	m := p.members[login]
+	if m == nil || m.account == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("AccountPool.Remove: unknown login %d", login)
+	}
+	delete(p.members, login)
+	p.load[m.conn]--
+	p.mu.Unlock()
+	return m.account.Disconnect()
+}
+
+// Close logs out and closes every account, then closes the shared connections.
+// Accounts still being added fail with ErrPoolClosed. Safe to call more than once.
+func (p *AccountPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	var accounts []*MT4Account
+	for login, m := range p.members {
+		if m.account != nil {
+			accounts = append(accounts, m.account)
+			delete(p.members, login)
+		}
+	}
+	p.mu.Unlock()
+
+	err := p.parallel(context.Background(), accounts, func(_ context.Context, a *MT4Account) error {
+		return a.Disconnect()
+	})
+	return errors.Join(err, p.closeConns())
+}
+
+// closeConns closes the shared connections.
+func (p *AccountPool) closeConns() error {
+	var errs []error
+	for _, c := range p.conns {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
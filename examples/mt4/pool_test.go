@@ -0,0 +1,186 @@
+package mt4_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// poolTarget is the fake's host/port session for AccountPool.Add.
+var poolTarget = mt4.Session{Host: "mt4test", Port: 443, BaseChartSymbol: "EURUSD", ConnectTimeout: 30}
+
+// newTestPool starts a fake server and returns a pool wired to it. Both are closed when the test ends.
+func newTestPool(t *testing.T, cfg mt4.PoolConfig) (*mt4test.Server, *mt4.AccountPool) {
+	t.Helper()
+	srv := mt4test.NewServer()
+	t.Cleanup(srv.Close) // after the pool's Close
+	pool, err := mt4.NewAccountPool(cfg, append(srv.AccountOptions(), mt4.WithRetryPolicy(fastRetries))...)
+	if err != nil {
+		t.Fatalf("NewAccountPool: %v", err)
+	}
+	t.Cleanup(func() { _ = pool.Close() })
+	return srv, pool
+}
+
+func TestAccountPoolAdd(t *testing.T) {
+	_, pool := newTestPool(t, mt4.PoolConfig{Connections: 2, MaxAccounts: 3})
+
+	for _, login := range []uint64{300, 100, 200} {
+		if _, err := pool.Add(testContext(t), login, "", poolTarget); err != nil {
+			t.Fatalf("Add(%d): %v", login, err)
+		}
+	}
+	if got := pool.Logins(); len(got) != 3 || got[0] != 100 || got[1] != 200 || got[2] != 300 {
+		t.Errorf("Logins = %v", got)
+	}
+	a, ok := pool.Get(200)
+	if !ok || a.User != 200 || a.State() != mt4.StateConnected {
+		t.Fatalf("Get(200) = %v, %v", a, ok)
+	}
+	if _, err := a.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Errorf("Quote over a shared connection: %v", err)
+	}
+
+	if _, err := pool.Add(testContext(t), 100, "", poolTarget); !errors.Is(err, mt4.ErrDuplicateLogin) {
+		t.Errorf("duplicate Add = %v, want ErrDuplicateLogin", err)
+	}
+	if _, err := pool.Add(testContext(t), 400, "", poolTarget); !errors.Is(err, mt4.ErrPoolFull) {
+		t.Errorf("Add beyond MaxAccounts = %v, want ErrPoolFull", err)
+	}
+	if _, err := pool.Add(testContext(t), 400, "", mt4.Session{}); err == nil {
+		t.Error("Add accepted a session without a target")
+	}
+}
+
+func TestAccountPoolAddConnectFailure(t *testing.T) {
+	srv, pool := newTestPool(t, mt4.PoolConfig{})
+	srv.SetCredentials(100, "secret")
+
+	if _, err := pool.Add(testContext(t), 100, "wrong", poolTarget); err == nil {
+		t.Fatal("Add with a wrong password succeeded")
+	}
+	if _, ok := pool.Get(100); ok || len(pool.Logins()) != 0 {
+		t.Errorf("failed login kept in the pool: %v", pool.Logins())
+	}
+	if _, err := pool.Add(testContext(t), 100, "secret", poolTarget); err != nil {
+		t.Errorf("Add after a failed attempt: %v", err)
+	}
+}
+
+func TestAccountPoolForEach(t *testing.T) {
+	_, pool := newTestPool(t, mt4.PoolConfig{Parallelism: 2})
+	for login := uint64(1); login <= 5; login++ {
+		if _, err := pool.Add(testContext(t), login, "", poolTarget); err != nil {
+			t.Fatalf("Add(%d): %v", login, err)
+		}
+	}
+
+	var running, peak, calls atomic.Int32
+	err := pool.ForEach(testContext(t), func(ctx context.Context, a *mt4.MT4Account) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		calls.Add(1)
+		if _, err := a.Quote(ctx, "EURUSD"); err != nil {
+			return err
+		}
+		if a.User == 3 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if calls.Load() != 5 {
+		t.Errorf("fn called %d times, want 5", calls.Load())
+	}
+	if peak.Load() > 2 {
+		t.Errorf("%d calls ran at once, want at most Parallelism 2", peak.Load())
+	}
+	if err == nil || !strings.Contains(err.Error(), "login 3: boom") || strings.Contains(err.Error(), "login 1") {
+		t.Errorf("ForEach = %v, want only the error of login 3", err)
+	}
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	cancel()
+	if err := pool.ForEach(ctx, func(context.Context, *mt4.MT4Account) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("ForEach with a done context = %v, want context.Canceled", err)
+	}
+}
+
+func TestAccountPoolHealth(t *testing.T) {
+	_, pool := newTestPool(t, mt4.PoolConfig{Connections: 2})
+	for _, login := range []uint64{1, 2} {
+		if _, err := pool.Add(testContext(t), login, "", poolTarget); err != nil {
+			t.Fatalf("Add(%d): %v", login, err)
+		}
+	}
+	if h := pool.Health(); !h.Healthy() || h.Accounts != 2 || h.ByState[mt4.StateConnected] != 2 || len(h.Connections) != 2 {
+		t.Fatalf("Health = %+v", h)
+	}
+
+	a, _ := pool.Get(2)
+	if _, err := a.Logout(testContext(t)); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	h := pool.Health()
+	if h.Healthy() || len(h.Down) != 1 || h.Down[0] != 2 || h.ByState[mt4.StateDisconnected] != 1 {
+		t.Errorf("Health after Logout = %+v", h)
+	}
+
+	if err := pool.Reconnect(testContext(t), 2); err != nil {
+		t.Fatalf("Reconnect: %v", err)
+	}
+	if h := pool.Health(); !h.Healthy() {
+		t.Errorf("Health after Reconnect = %+v", h)
+	}
+	if err := pool.Reconnect(testContext(t), 9); err == nil {
+		t.Error("Reconnect of an unknown login succeeded")
+	}
+}
+
+func TestAccountPoolRemoveAndClose(t *testing.T) {
+	_, pool := newTestPool(t, mt4.PoolConfig{MaxAccounts: 2})
+	a1, err := pool.Add(testContext(t), 1, "", poolTarget)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	a2, err := pool.Add(testContext(t), 2, "", poolTarget)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	if err := pool.Remove(1); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if a1.State() != mt4.StateClosed {
+		t.Errorf("removed account state = %v", a1.State())
+	}
+	if err := pool.Remove(1); err == nil {
+		t.Error("second Remove succeeded")
+	}
+	// The freed slot is usable again.
+	if _, err := pool.Add(testContext(t), 3, "", poolTarget); err != nil {
+		t.Fatalf("Add after Remove: %v", err)
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if a2.State() != mt4.StateClosed {
+		t.Errorf("account state after Close = %v", a2.State())
+	}
+	if len(pool.Logins()) != 0 {
+		t.Errorf("Logins after Close = %v", pool.Logins())
+	}
+	if _, err := pool.Add(testContext(t), 4, "", poolTarget); !errors.Is(err, mt4.ErrPoolClosed) {
+		t.Errorf("Add after Close = %v, want ErrPoolClosed", err)
+	}
+	if err := pool.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Position sizing ===
+//
+// PositionSizer turns "risk 1 % of equity with the stop at X" into a lot size:
+//
+//	risk money    AccountEquity × RiskPercent / 100, or RiskMoney (account currency)
+//	loss per lot  |entry − stop| / TradeTickSize × tick value (+ CommissionPerLot)
+//	lots          risk money / loss per lot, rounded down to VolumeStep, capped at VolumeMax
+//
+// The tick value is the value of one tick for one lot in the account currency:
+//
+//	profit currency = account currency   TradeTickValue (TickValueWithSize)
+//	otherwise                            TradeTickSize × TradeContractSize converted with ConversionRate
+//	no conversion symbol                 TradeTickValue as computed by the terminal
+//
+// Lots are never rounded up, so the loss at the stop stays within the requested risk.
+
+// PositionSizerConfig configures NewPositionSizer.
+type PositionSizerConfig struct {
+	// CommissionPerLot is the round-turn commission per lot in the account currency. It is
+	// added to the loss per lot, so the risk includes it (0 = none).
+	CommissionPerLot float64
+}
+
+// PositionSizer computes lot sizes from a risk budget. It is safe for concurrent use.
+type PositionSizer struct {
+	account *MT4Account
+	cfg     PositionSizerConfig
+}
+
+// SizeRequest describes the trade to size. Exactly one of RiskPercent and RiskMoney is set.
+type SizeRequest struct {
+	// Symbol is the traded symbol.
+	Symbol string
+
+	// Entry is the planned entry price (0 = current market: Ask when StopLoss is below Bid,
+	// Bid when it is above Ask).
+	Entry float64
+
+	// StopLoss is the stop price; the distance to Entry is the risked move.
+	StopLoss float64
+
+	// RiskPercent is the risk in percent of AccountEquity (e.g. 1 = 1 %).
+	RiskPercent float64
+
+	// RiskMoney is the risk in the account currency.
+	RiskMoney float64
+}
+
+// PositionSize is the result of PositionSizer.Size.
+type PositionSize struct {
+	// Lots is the volume to send: rounded down to VolumeStep, at most VolumeMax.
+	Lots float64
+
+	// RawLots is the exact volume for the risk, before rounding and capping.
+	RawLots float64
+
+	// Risk is the targeted risk and ActualRisk the loss at the stop with Lots
+	// (both in Currency, commission included).
+	Risk       float64
+	ActualRisk float64
+
+	// Currency is the account currency.
+	Currency string
+
+	// Entry is the entry price used (Quote when SizeRequest.Entry was 0).
+	Entry float64
+
+	// StopPoints is the entry–stop distance in points.
+	StopPoints float64
+
+	// TickValue is the value of one tick for one lot in Currency; TickSize is the tick in price units.
+	TickValue float64
+	TickSize  float64
+
+	// ConversionRate converts the profit currency into Currency (1 when they are the same);
+	// ConversionSymbol is the symbol it came from ("" when not converted).
+	ConversionRate   float64
+	ConversionSymbol string
+
+	// Capped reports that RawLots exceeded VolumeMax.
+	Capped bool
+}
+
+// NewPositionSizer returns a sizer for account.
+//
+// Example:
+//
+//	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{CommissionPerLot: 7})
+//	size, err := sizer.Size(ctx, mt4.SizeRequest{Symbol: "EURJPY", StopLoss: 161.20, RiskPercent: 1})
+//	if err != nil { return err }
+//	log.Printf("%.2f lots risk %.2f %s", size.Lots, size.ActualRisk, size.Currency)
+func NewPositionSizer(account *MT4Account, cfg PositionSizerConfig) *PositionSizer {
+	return &PositionSizer{account: account, cfg: cfg}
+}
+
+// Size returns the lot size that loses the requested risk when the stop is hit.
+//
+// Parameters:
+//   - ctx: Context for the AccountSummary / SymbolParams / TickValueWithSize / Quote calls.
+//   - req: Symbol, entry, stop and risk (see SizeRequest).
+//
+// Returns:
+//   - The size with the figures it was computed from.
+//   - An error for an invalid request, an error wrapping ErrInvalidVolume when the risk does
+//     not pay for VolumeMin (the size is returned with Lots = 0), or the error of the underlying calls.
+func (s *PositionSizer) Size(ctx context.Context, req SizeRequest) (*PositionSize, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	a := s.account
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	switch {
+	case req.Symbol == "":
+		return nil, errors.New("position size: no symbol")
+	case req.StopLoss <= 0:
+		return nil, errors.New("position size: no stop loss")
+	case (req.RiskPercent > 0) == (req.RiskMoney > 0):
+		return nil, errors.New("position size: set exactly one of RiskPercent and RiskMoney")
+	}
+
+	summary, err := a.AccountSummary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params, err := a.symbolSpecs.get(ctx, a, req.Symbol, DefaultSymbolParamsTTL)
+	if err != nil {
+		return nil, err
+	}
+	res := &PositionSize{Currency: summary.GetAccountCurrency(), Entry: req.Entry, Risk: req.RiskMoney}
+	if req.RiskPercent > 0 {
+		if summary.GetAccountEquity() <= 0 {
+			return nil, fmt.Errorf("position size: account equity is %s", formatFloat(summary.GetAccountEquity()))
+		}
+		res.Risk = summary.GetAccountEquity() * req.RiskPercent / 100
+	}
+
+	if res.Entry <= 0 {
+		q, err := a.Quote(ctx, req.Symbol)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case req.StopLoss < q.GetBid():
+			res.Entry = q.GetAsk()
+		case req.StopLoss > q.GetAsk():
+			res.Entry = q.GetBid()
+		default:
+			return nil, fmt.Errorf("position size: stop loss %s is inside the spread", formatFloat(req.StopLoss))
+		}
+	}
+	dist := math.Abs(res.Entry - req.StopLoss)
+	if dist <= 0 {
+		return nil, errors.New("position size: stop loss equals entry")
+	}
+
+	tv, err := a.tickValue(ctx, req.Symbol, params, res.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("position size: %w", err)
+	}
+	res.TickValue, res.TickSize = tv.value, tv.size
+	res.ConversionRate, res.ConversionSymbol = tv.rate, tv.symbol
+
+	point := params.GetPoint()
+	if point <= 0 {
+		point = res.TickSize
+	}
+	res.StopPoints = roundDecimals(dist/point, 1)
+	lossPerLot := dist/res.TickSize*res.TickValue + s.cfg.CommissionPerLot
+	res.RawLots = res.Risk / lossPerLot
+
+	lots := NormalizeVolume(params, res.RawLots)
+	if hi := params.GetVolumeMax(); hi > 0 && lots > hi {
+		lots, res.Capped = NormalizeVolume(params, hi), true
+	}
+	if lo := params.GetVolumeMin(); lots <= 0 || (lo > 0 && lots < lo-1e-9) {
+		return res, fmt.Errorf("position size: %s lots for a risk of %s %s is below VolumeMin %s: %w",
+			formatFloat(roundDecimals(res.RawLots, 4)), formatFloat(roundDecimals(res.Risk, 2)), res.Currency,
+			formatFloat(params.GetVolumeMin()), ErrInvalidVolume)
+	}
+	res.Lots = lots
+	res.ActualRisk = roundDecimals(lots*lossPerLot, 2)
+	return res, nil
+}
+
+// tickValuation is the value of one tick for one lot in a target currency.
+type tickValuation struct {
+	value  float64 // per tick and lot, target currency
+	size   float64 // tick size in price units
+	rate   float64 // profit currency → target currency
+	symbol string  // conversion symbol ("" = not converted)
+}
+
+// tickValue values a tick of symbol in currency (see the table at the top of the file).
+func (a *MT4Account) tickValue(ctx context.Context, symbol string, params *pb.SymbolParamsManyInfo, currency string) (tickValuation, error) {
+	tv, err := a.TickValueWithSize(ctx, []string{symbol})
+	if err != nil {
+		return tickValuation{}, err
+	}
+	if len(tv.GetInfos()) == 0 {
+		return tickValuation{}, fmt.Errorf("no tick value for %s", symbol)
+	}
+	info := tv.GetInfos()[0]
+	res := tickValuation{value: info.GetTradeTickValue(), size: info.GetTradeTickSize(), rate: 1}
+	if res.size <= 0 {
+		res.size = priceTick(params)
+	}
+	if res.size <= 0 {
+		return tickValuation{}, fmt.Errorf("no tick size for %s", symbol)
+	}
+
+	if profit := params.GetCurrencyProfit(); profit != "" && currency != "" && profit != currency {
+		contract := info.GetTradeContractSize()
+		if contract <= 0 {
+			contract = params.GetTradeContractSize()
+		}
+		rate, conv, err := a.conversionRateFor(ctx, profit, currency, symbol)
+		switch {
+		case err == nil && contract > 0:
+			res.value = res.size * contract * rate
+			res.rate, res.symbol = rate, conv
+		case err != nil && !errors.Is(err, ErrNoConversion):
+			return tickValuation{}, err
+		}
+	}
+	if res.value <= 0 {
+		return tickValuation{}, fmt.Errorf("no tick value for %s", symbol)
+	}
+	return res, nil
+}
@@ -0,0 +1,137 @@
+package mt4_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+func TestPositionSize(t *testing.T) {
+	_, account := newTestAccount(t) // USD account, equity 10000; EURUSD 1.1/1.1001
+	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{})
+
+	tests := []struct {
+		name       string
+		req        mt4.SizeRequest
+		lots       float64
+		entry      float64
+		actualRisk float64
+	}{
+		{"risk money", mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskMoney: 100}, 0.2, 1.1, 100},
+		{"risk percent of equity", mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskPercent: 1}, 0.2, 1.1, 100},
+		{"short", mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.104, RiskMoney: 100}, 0.25, 1.1, 100},
+		{"market buy enters at the ask", mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.09, RiskMoney: 100}, 0.09, 1.1001, 90.9},
+		{"market sell enters at the bid", mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.105, RiskMoney: 100}, 0.2, 1.1, 100},
+		{"rounded down to the step", mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.097, RiskMoney: 100}, 0.33, 1.1, 99},
+	}
+	for _, tt := range tests {
+		res, err := sizer.Size(testContext(t), tt.req)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if res.Lots != tt.lots || res.Entry != tt.entry || res.ActualRisk != tt.actualRisk {
+			t.Errorf("%s: lots %v entry %v actual risk %v, want %v %v %v",
+				tt.name, res.Lots, res.Entry, res.ActualRisk, tt.lots, tt.entry, tt.actualRisk)
+		}
+		if res.Currency != "USD" || res.ConversionSymbol != "" || res.Capped {
+			t.Errorf("%s: %+v", tt.name, res)
+		}
+	}
+
+	res, err := sizer.Size(testContext(t), mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskMoney: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StopPoints != 500 || res.TickValue != 1 || res.TickSize != 0.00001 || res.Risk != 100 {
+		t.Errorf("breakdown = %+v", res)
+	}
+}
+
+func TestPositionSizeCommission(t *testing.T) {
+	_, account := newTestAccount(t)
+	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{CommissionPerLot: 7})
+
+	// 500 per lot at the stop plus 7 commission: 100 / 507 = 0.197 lots.
+	res, err := sizer.Size(testContext(t), mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskMoney: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lots != 0.19 || res.ActualRisk != 96.33 {
+		t.Errorf("lots %v actual risk %v, want 0.19 and 96.33", res.Lots, res.ActualRisk)
+	}
+}
+
+func TestPositionSizeConversion(t *testing.T) {
+	_, account := newTestAccount(t) // USDJPY 150/150.012: JPY profit, USD account
+	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{})
+
+	res, err := sizer.Size(testContext(t), mt4.SizeRequest{Symbol: "USDJPY", Entry: 150, StopLoss: 149, RiskMoney: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rate := 1 / 150.012
+	if res.ConversionSymbol != "USDJPY" || math.Abs(res.ConversionRate-rate) > 1e-12 {
+		t.Errorf("conversion = %v via %q, want %v via USDJPY", res.ConversionRate, res.ConversionSymbol, rate)
+	}
+	if want := 0.001 * 100000 * rate; math.Abs(res.TickValue-want) > 1e-9 {
+		t.Errorf("TickValue = %v, want %v USD", res.TickValue, want)
+	}
+	// 1000 ticks × 0.6666 USD = 666.6 per lot.
+	if res.Lots != 0.15 {
+		t.Errorf("Lots = %v, want 0.15", res.Lots)
+	}
+}
+
+func TestPositionSizeLimits(t *testing.T) {
+	_, account := newTestAccount(t)
+	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{})
+
+	res, err := sizer.Size(testContext(t), mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskMoney: 1})
+	if !errors.Is(err, mt4.ErrInvalidVolume) {
+		t.Errorf("risk below VolumeMin = %v, want ErrInvalidVolume", err)
+	}
+	if res == nil || res.Lots != 0 || math.Abs(res.RawLots-0.002) > 1e-9 {
+		t.Errorf("result below VolumeMin = %+v", res)
+	}
+
+	res, err = sizer.Size(testContext(t), mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.095, RiskMoney: 1e6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lots != 100 || !res.Capped || math.Abs(res.RawLots-2000) > 1e-6 {
+		t.Errorf("lots %v raw %v capped %v, want VolumeMax", res.Lots, res.RawLots, res.Capped)
+	}
+}
+
+func TestPositionSizeInvalidRequest(t *testing.T) {
+	_, account := newTestAccount(t)
+	sizer := mt4.NewPositionSizer(account, mt4.PositionSizerConfig{})
+
+	tests := []struct {
+		name string
+		req  mt4.SizeRequest
+	}{
+		{"no symbol", mt4.SizeRequest{StopLoss: 1.09, RiskMoney: 100}},
+		{"no stop loss", mt4.SizeRequest{Symbol: "EURUSD", RiskMoney: 100}},
+		{"no risk", mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.09}},
+		{"both risks", mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.09, RiskMoney: 100, RiskPercent: 1}},
+		{"stop loss inside the spread", mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.10005, RiskMoney: 100}},
+		{"stop loss at entry", mt4.SizeRequest{Symbol: "EURUSD", Entry: 1.1, StopLoss: 1.1, RiskMoney: 100}},
+		{"unknown symbol", mt4.SizeRequest{Symbol: "XXXYYY", Entry: 1.1, StopLoss: 1.09, RiskMoney: 100}},
+	}
+	for _, tt := range tests {
+		if res, err := sizer.Size(testContext(t), tt.req); err == nil {
+			t.Errorf("%s: sized %+v", tt.name, res)
+		}
+	}
+
+	_, disconnected := newDisconnectedAccount(t)
+	_, err := mt4.NewPositionSizer(disconnected, mt4.PositionSizerConfig{}).
+		Size(testContext(t), mt4.SizeRequest{Symbol: "EURUSD", StopLoss: 1.09, RiskMoney: 100})
+	if !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("Size before connecting = %v, want ErrNotConnected", err)
+	}
+}
@@ -0,0 +1,122 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/grpc/metadata"
+)
+
+//=== 📂 Connect with progress ===
+
+// ConnectProgressFunc receives the progress events of ConnectWithProgress in order
+// (Step, Message, Level, ElapsedMs; the last one has IsFinal set).
+// It runs on the goroutine that called ConnectWithProgress and should return quickly.
+type ConnectProgressFunc func(ev *pb.ConnectStreamEvent)
+
+// ConnectWithProgress connects like ConnectByServerName (target.ServerName set) or
+// ConnectByHostPort (target.Host / target.Port set), but through ConnectExStream /
+// ConnectStream, so every connect step is reported to progress while the login runs.
+// The session is finalized from the final event's ConnectData and health-checked,
+// exactly as for the blocking Connect* methods.
+//
+// Only Host, Port, ServerName, BaseChartSymbol, WaitForTerminalIsAlive and ConnectTimeout
+// of target are used. Proxy connections have no progress stream (use ConnectViaProxy).
+// Automatic re-establishment later reconnects with the blocking RPCs.
+//
+// Parameters:
+//   - ctx: Context for cancellation or timeout of the whole connect.
+//   - target: Connection parameters.
+//   - progress: Optional callback for each event (nil = only track ConnectProgress).
+//
+// Returns:
+//   - The final event's ErrorData as *APIError, a transport error, or a health-check error.
+//
+// Example:
+//
+//	err := account.ConnectWithProgress(ctx, mt4.Session{
+//	    ServerName: "MetaQuotes-Demo", BaseChartSymbol: "EURUSD", ConnectTimeout: 30,
+//	}, func(ev *pb.ConnectStreamEvent) {
+//	    log.Printf("[%5dms] %s: %s", ev.GetElapsedMs(), ev.GetStep(), ev.GetMessage())
+//	})
+func (a *MT4Account) ConnectWithProgress(ctx context.Context, target Session, progress ConnectProgressFunc) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if target.Proxy.Host != "" {
+		return errors.New("ConnectWithProgress: proxy connections have no progress stream, use ConnectViaProxy")
+	}
+
+	return a.connectWith(ctx, target, "ConnectWithProgress", func(ctx context.Context, params Session, _ metadata.MD) (Session, error) {
+		return a.openSessionStream(ctx, params, progress)
+	})
+}
+
+// ConnectProgress returns the latest event of the running (or last) ConnectWithProgress,
+// e.g. to show on a dashboard where a login is stuck. nil if none. Do not modify it.
+func (a *MT4Account) ConnectProgress() *pb.ConnectStreamEvent {
+	if a == nil {
+		return nil
+	}
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.progress
+}
+
+// setConnectProgress records the latest ConnectWithProgress event.
+func (a *MT4Account) setConnectProgress(ev *pb.ConnectStreamEvent) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	a.sess.progress = ev
+}
+
+// openSessionStream is the sessionOpener of ConnectWithProgress: it runs ConnectExStream
+// (params.ServerName set) or ConnectStream and builds the session from the final event.
+func (a *MT4Account) openSessionStream(ctx context.Context, params Session, progress ConnectProgressFunc) (Session, error) {
+	if err := a.ensureConnectionClient(); err != nil {
+		return Session{}, err
+	}
+	id, err := a.connectStreamID(ctx)
+	if err != nil {
+		return Session{}, err
+	}
+
+	var open func(context.Context) (connectEventReceiver, error)
+	if params.ServerName != "" {
+		req := a.connectExRequest(params)
+		open = func(c context.Context) (connectEventReceiver, error) {
+			return a.ConnectionClient.ConnectExStream(c, req)
+		}
+	} else {
+		req := a.connectRequest(params)
+		open = func(c context.Context) (connectEventReceiver, error) {
+			return a.ConnectionClient.ConnectStream(c, req)
+		}
+	}
+
+	a.setConnectProgress(nil)
+	events, errs := a.connectEventStream(ctx, id, open)
+
+	var final *pb.ConnectStreamEvent
+	for ev := range events {
+		a.setConnectProgress(ev)
+		if progress != nil {
+			progress(ev)
+		}
+		if ev.GetIsFinal() {
+			final = ev
+		}
+	}
+	if err := <-errs; err != nil {
+		return Session{}, err
+	}
+
+	// The terminal runs under the id we sent unless the server reports another one.
+	guid := final.GetConnectData().GetTerminalInstanceGuid()
+	if guid == "" {
+		guid = id.String()
+	}
+	return a.newSession(params, guid), nil
+}
@@ -0,0 +1,102 @@
+package mt4_test
+
+import (
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// newDisconnectedAccount returns an account wired to a fresh fake but not connected yet.
+func newDisconnectedAccount(t *testing.T) (*mt4test.Server, *mt4.MT4Account) {
+	t.Helper()
+	srv := mt4test.NewServer()
+	t.Cleanup(srv.Close)
+	account, err := mt4.NewMT4Account(100000, "", append(srv.AccountOptions(), mt4.WithRetryPolicy(fastRetries))...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	t.Cleanup(func() { _ = account.Disconnect() })
+	return srv, account
+}
+
+func TestConnectWithProgressByHost(t *testing.T) {
+	_, account := newDisconnectedAccount(t)
+
+	var steps []string
+	err := account.ConnectWithProgress(testContext(t), mt4.Session{Host: "mt4test", Port: 443, BaseChartSymbol: "EURUSD", ConnectTimeout: 30},
+		func(ev *pb.ConnectStreamEvent) { steps = append(steps, ev.GetStep()) })
+	if err != nil {
+		t.Fatalf("ConnectWithProgress: %v", err)
+	}
+	if len(steps) < 2 || steps[0] != "Init" || steps[len(steps)-1] != "Complete" {
+		t.Errorf("steps = %v", steps)
+	}
+	if s := account.State(); s != mt4.StateConnected {
+		t.Errorf("state = %v", s)
+	}
+	if ev := account.ConnectProgress(); !ev.GetIsFinal() {
+		t.Errorf("ConnectProgress = %+v, want the final event", ev)
+	}
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Errorf("Quote on the new session: %v", err)
+	}
+}
+
+func TestConnectWithProgressByServerName(t *testing.T) {
+	srv, account := newDisconnectedAccount(t)
+	srv.AddBrokerServer("Example Markets", "Example-Demo")
+
+	err := account.ConnectWithProgress(testContext(t), mt4.Session{ServerName: "Unknown-Live", BaseChartSymbol: "EURUSD"}, nil)
+	if apiErr, ok := mt4.AsAPIError(err); !ok || apiErr.Code != "INVALID_SERVER" {
+		t.Fatalf("unknown server: %v, want INVALID_SERVER", err)
+	}
+	if s := account.State(); s != mt4.StateDisconnected {
+		t.Errorf("state after failure = %v", s)
+	}
+
+	if err := account.ConnectWithProgress(testContext(t), mt4.Session{ServerName: "Example-Demo", BaseChartSymbol: "EURUSD"}, nil); err != nil {
+		t.Fatalf("ConnectWithProgress: %v", err)
+	}
+	if got := account.Session().ServerName; got != "Example-Demo" {
+		t.Errorf("session server = %q", got)
+	}
+	if got := srv.Calls("ConnectExStream"); got != 2 {
+		t.Errorf("ConnectExStream calls = %d, want 2", got)
+	}
+}
+
+func TestConnectProgressWhileRunning(t *testing.T) {
+	srv, account := newDisconnectedAccount(t)
+	srv.SetConnectStepDelay(30 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- account.ConnectWithProgress(testContext(t), mt4.Session{Host: "mt4test", Port: 443, BaseChartSymbol: "EURUSD"}, nil)
+	}()
+
+	eventually(t, "an intermediate progress event", func() bool {
+		ev := account.ConnectProgress()
+		return ev != nil && !ev.GetIsFinal()
+	})
+	if s := account.State(); s != mt4.StateConnecting {
+		t.Errorf("state while connecting = %v", s)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("ConnectWithProgress: %v", err)
+	}
+}
+
+func TestConnectWithProgressRejectsProxy(t *testing.T) {
+	srv, account := newDisconnectedAccount(t)
+	err := account.ConnectWithProgress(testContext(t), mt4.Session{Host: "mt4test", Proxy: mt4.ProxySettings{Host: "proxy.local"}}, nil)
+	if err == nil {
+		t.Fatal("ConnectWithProgress accepted a proxy target")
+	}
+	if got := srv.Calls("ConnectStream"); got != 0 {
+		t.Errorf("ConnectStream calls = %d, want 0", got)
+	}
+}
@@ -0,0 +1,168 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//=== 📂 Session re-establishment ===
+//
+// TERMINAL_INSTANCE_NOT_FOUND means the terminal behind the session id is gone
+// (restarted, evicted, moved to another node); retrying with the same id can never
+// succeed. The account therefore remembers how it connected (Session) and, on that
+// error, calls Connect / ConnectEx again to obtain a new TerminalInstanceGuid, then
+// resumes the pending unary call or re-opens the stream with the new id.
+//
+// Concurrent calls that lose the same instance trigger a single reconnect: the first
+// one re-establishes, the others see the new id and simply retry.
+
+// errReestablishUnavailable: the account cannot re-establish (disabled, never connected
+// via ConnectByHostPort / ConnectByServerName, or called from the health-check).
+var errReestablishUnavailable = errors.New("session re-establishment unavailable")
+
+type noReestablishCtxKey struct{}
+
+// withoutReestablish marks ctx so calls made with it never re-establish the session
+// (used by the post-connect health-check, which runs under connectMu).
+func withoutReestablish(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noReestablishCtxKey{}, true)
+}
+
+// reestablishDisabled reports whether ctx was marked by withoutReestablish.
+func reestablishDisabled(ctx context.Context) bool {
+	v, _ := ctx.Value(noReestablishCtxKey{}).(bool)
+	return v
+}
+
+// reestablishCall is an in-flight re-establishment shared by every caller that lost the same instance.
+type reestablishCall struct {
+	staleID uuid.UUID
+	done    chan struct{}
+	err     error
+}
+
+// reestablish replaces a lost terminal instance and waits for the result (or ctx).
+// staleID is the session id the failed call used; if the session has already been
+// replaced since (by a concurrent call or an explicit Connect), it returns nil at once.
+//
+// The reconnect itself runs detached from ctx, bounded by the remembered ConnectTimeout,
+// so a short per-call deadline does not abort it for everybody else.
+func (a *MT4Account) reestablish(ctx context.Context, staleID uuid.UUID, cause error) error {
+	if a.DisableAutoReestablish || reestablishDisabled(ctx) {
+		return errReestablishUnavailable
+	}
+
+	a.sess.mu.Lock()
+	params := a.sess.session
+	switch {
+	case a.sess.state == StateClosed:
+		a.sess.mu.Unlock()
+		return ErrAccountClosed
+	case params.Id != staleID:
+		a.sess.mu.Unlock()
+		return nil // already replaced
+	case params.Host == "" && params.ServerName == "":
+		a.sess.mu.Unlock()
+		return errReestablishUnavailable
+	}
+	call := a.sess.reestablishing
+	if call == nil || call.staleID != staleID {
+		call = &reestablishCall{staleID: staleID, done: make(chan struct{})}
+		a.sess.reestablishing = call
+		go a.runReestablish(call, params, cause)
+	}
+	a.sess.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runReestablish performs call: Connect / ConnectEx without the stale id, health-check,
+// then publishes a StateChange with Reestablished=true.
+func (a *MT4Account) runReestablish(call *reestablishCall, params Session, cause error) {
+	defer func() {
+		a.sess.mu.Lock()
+		if a.sess.reestablishing == call {
+			a.sess.reestablishing = nil
+		}
+		a.sess.mu.Unlock()
+		close(call.done)
+	}()
+
+	a.sess.connectMu.Lock()
+	defer a.sess.connectMu.Unlock()
+
+	// An explicit Connect may have won the race for connectMu.
+	if a.sessionID() != call.staleID {
+		return
+	}
+
+	timeout := time.Duration(params.ConnectTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+a.timeouts().HealthCheck)
+	defer cancel()
+
+	a.markReconnecting(cause)
+	a.logf("mt4: terminal instance %s lost (%v), re-establishing session", call.staleID, cause)
+
+	release, err := a.acquireConnectSlot(ctx)
+	if err != nil {
+		call.err = fmt.Errorf("re-establish session: %w", err)
+		return
+	}
+	defer release()
+
+	// Do not send the stale id: ask for a fresh terminal instance.
+	sess, err := a.openSession(ctx, params, nil)
+	if err != nil {
+		call.err = fmt.Errorf("re-establish session: %w", err)
+		return
+	}
+	a.storeSession(sess)
+
+	if err := a.healthCheck(ctx, "re-establish"); err != nil {
+		call.err = err
+		return
+	}
+
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	if from := a.sess.state; from != StateClosed {
+		a.sess.state = StateConnected
+		a.publishLocked(StateChange{
+			From:          from,
+			To:            StateConnected,
+			Err:           cause,
+			Time:          time.Now(),
+			Reestablished: true,
+			PreviousID:    call.staleID,
+			SessionID:     sess.Id,
+		})
+	}
+}
+
+// tryReestablish runs reestablish after a terminal-not-found error and reports
+// whether the failed call can be retried right away with the new session.
+func (a *MT4Account) tryReestablish(ctx context.Context, staleID uuid.UUID, cause error) bool {
+	if !IsTerminalNotFound(cause) {
+		return false
+	}
+	err := a.reestablish(ctx, staleID, cause)
+	if err == nil {
+		return true
+	}
+	if !errors.Is(err, errReestablishUnavailable) {
+		a.logf("mt4: %v", err)
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package mt4_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+func TestLostTerminalIsReestablished(t *testing.T) {
+	srv, account := newTestAccount(t)
+	oldID := account.Session().Id
+	changes := account.StateChanges()
+	srv.DropTerminals()
+
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote after DropTerminals: %v", err)
+	}
+	newID := account.Session().Id
+	if newID == oldID {
+		t.Fatal("session id unchanged after re-establishment")
+	}
+
+	var re mt4.StateChange
+	for re.To != mt4.StateConnected {
+		re = nextChange(t, changes)
+	}
+	if !re.Reestablished || re.PreviousID != oldID || re.SessionID != newID || !errors.Is(re.Err, mt4.ErrTerminalNotFound) {
+		t.Errorf("change = %+v, want a re-establishment from %s to %s", re, oldID, newID)
+	}
+	if s := account.State(); s != mt4.StateConnected {
+		t.Errorf("state = %v", s)
+	}
+}
+
+func TestConcurrentCallsReestablishOnce(t *testing.T) {
+	srv, account := newTestAccount(t)
+	connects := srv.Calls("Connect")
+	srv.DropTerminals()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Quote: %v", err)
+	}
+	if got := srv.Calls("Connect") - connects; got != 1 {
+		t.Errorf("Connect calls = %d, want a single re-establishment", got)
+	}
+}
+
+func TestReestablishDisabled(t *testing.T) {
+	srv, account := newTestAccount(t,
+		mt4.WithAutoReestablish(false),
+		mt4.WithRetryPolicy(&mt4.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+	oldID := account.Session().Id
+	srv.DropTerminals()
+
+	_, err := account.Quote(testContext(t), "EURUSD")
+	if !errors.Is(err, mt4.ErrTerminalNotFound) {
+		t.Fatalf("Quote = %v, want ErrTerminalNotFound", err)
+	}
+	if account.Session().Id != oldID {
+		t.Error("session replaced with re-establishment disabled")
+	}
+	if s := account.State(); s != mt4.StateReconnecting {
+		t.Errorf("state = %v, want reconnecting", s)
+	}
+}
+
+func TestStreamResumesOnNewTerminal(t *testing.T) {
+	srv, account := newTestAccount(t)
+	oldID := account.Session().Id
+	dataCh, errCh := account.OnSymbolTick(testContext(t), []string{"EURUSD"})
+
+	receive := func(bid float64) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			srv.PushTick("EURUSD", bid, bid+0.0001)
+			select {
+			case d := <-dataCh:
+				if d.GetSymbolTick().GetBid() == bid {
+					return
+				}
+			case err := <-errCh:
+				t.Fatalf("stream error: %v", err)
+			case <-deadline:
+				t.Fatalf("no tick at %v", bid)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	receive(1.2)
+	srv.DropTerminals()
+	receive(1.3)
+	if account.Session().Id == oldID {
+		t.Error("stream resumed without a new session")
+	}
+}
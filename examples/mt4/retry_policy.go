@@ -0,0 +1,277 @@
+package mt4
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OperationKind classifies calls so a RetryPolicy can treat them differently.
+type OperationKind int
+
+const (
+	// OperationRead covers read-only unary calls (account info, quotes, history, ...).
+	OperationRead OperationKind = iota
+	// OperationTrade covers OrderSend / OrderModify / OrderClose / OrderCloseBy.
+	OperationTrade
+	// OperationStream covers opening and re-opening server streams.
+	OperationStream
+)
+
+// String returns a human-readable operation kind.
+func (k OperationKind) String() string {
+	switch k {
+	case OperationRead:
+		return "read"
+	case OperationTrade:
+		return "trade"
+	case OperationStream:
+		return "stream"
+	}
+	return "unknown"
+}
+
+// JitterStrategy selects how random jitter is applied to the backoff delay.
+type JitterStrategy int
+
+const (
+	// JitterUnset inherits the strategy from the parent policy (JitterSymmetric at the top level).
+	JitterUnset JitterStrategy = iota
+	// JitterSymmetric adds a random offset in [-JitterRange, +JitterRange].
+	JitterSymmetric
+	// JitterNone uses the exponential delay as is.
+	JitterNone
+	// JitterFull picks a random delay in [0, delay].
+	JitterFull
+	// JitterEqual picks a random delay in [delay/2, delay].
+	JitterEqual
+)
+
+// RetryPolicy controls how ExecuteWithReconnect and ExecuteStreamWithReconnect retry.
+//
+// A policy is layered: zero-valued fields inherit from the level below
+// (DefaultRetryPolicy → MT4Account.RetryPolicy → its Reads/Trades/Streams override →
+// policy from ContextWithRetryPolicy → its Reads/Trades/Streams override).
+//
+// Examples:
+//
+//	// No retries on trades, aggressive retries on reads.
+//	account.RetryPolicy = &mt4.RetryPolicy{
+//	    Trades: &mt4.RetryPolicy{MaxAttempts: 1},
+//	    Reads:  &mt4.RetryPolicy{MaxAttempts: 30, MaxDelay: 10 * time.Second},
+//	}
+//
+//	// One-off override for a single call.
+//	ctx = mt4.ContextWithRetryPolicy(ctx, &mt4.RetryPolicy{MaxAttempts: 3})
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one (1 = no retries).
+	MaxAttempts int
+
+	// BaseDelay is the initial backoff; it doubles on every attempt.
+	BaseDelay time.Duration
+
+	// MaxDelay caps the exponential backoff (before jitter).
+	MaxDelay time.Duration
+
+	// Jitter selects the jitter strategy.
+	Jitter JitterStrategy
+
+	// JitterRange is the +/- range used by JitterSymmetric.
+	JitterRange time.Duration
+
+	// RetryableCodes are transport (gRPC status) codes that trigger a retry.
+	RetryableCodes []codes.Code
+
+	// RetryableAPIErrorCodes are pb.Error.ErrorCode values that trigger a retry
+	// (e.g. "TERMINAL_INSTANCE_NOT_FOUND").
+	RetryableAPIErrorCodes []string
+
+	// RetryableMqlErrorCodes are pb.Error.MqlErrorCode values that trigger a retry
+	// (e.g. ERR_REQUOTE, ERR_TRADE_CONTEXT_BUSY). These are definite rejections,
+	// so no reconcile step is needed before retrying.
+	RetryableMqlErrorCodes []pb.MqlErrorCode
+
+	// Per-operation overrides (optional).
+	Reads   *RetryPolicy
+	Trades  *RetryPolicy
+	Streams *RetryPolicy
+}
+
+// DefaultRetryPolicy returns the policy used when nothing else is configured.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    maxRetries,
+		BaseDelay:      backoffBase,
+		MaxDelay:       backoffMax,
+		Jitter:         JitterSymmetric,
+		JitterRange:    jitterRange,
+		RetryableCodes: []codes.Code{codes.Unavailable},
+		RetryableAPIErrorCodes: []string{
+			"TERMINAL_INSTANCE_NOT_FOUND",
+			"TERMINAL_REGISTRY_TERMINAL_NOT_FOUND",
+		},
+	}
+}
+
+type retryPolicyCtxKey struct{}
+
+// ContextWithRetryPolicy returns a context that overrides the account retry policy for calls made with it.
+func ContextWithRetryPolicy(ctx context.Context, p *RetryPolicy) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, retryPolicyCtxKey{}, p)
+}
+
+// RetryPolicyFromContext returns the policy set by ContextWithRetryPolicy, if any.
+func RetryPolicyFromContext(ctx context.Context) (*RetryPolicy, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(retryPolicyCtxKey{}).(*RetryPolicy)
+	return p, ok && p != nil
+}
+
+// retryPolicyFor resolves the effective (flattened) policy for a call.
+func (a *MT4Account) retryPolicyFor(ctx context.Context, kind OperationKind) *RetryPolicy {
+	p := DefaultRetryPolicy()
+	if a != nil && a.RetryPolicy != nil {
+		p = p.merge(a.RetryPolicy).merge(a.RetryPolicy.override(kind))
+	}
+	if cp, ok := RetryPolicyFromContext(ctx); ok {
+		p = p.merge(cp).merge(cp.override(kind))
+	}
+	return p
+}
+
+// override returns the per-operation override for kind (may be nil).
+func (p *RetryPolicy) override(kind OperationKind) *RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	switch kind {
+	case OperationRead:
+		return p.Reads
+	case OperationTrade:
+		return p.Trades
+	case OperationStream:
+		return p.Streams
+	}
+	return nil
+}
+
+// merge returns a copy of p with every non-zero field of o applied on top.
+// Per-operation overrides are not carried over; the result is a flat policy.
+func (p *RetryPolicy) merge(o *RetryPolicy) *RetryPolicy {
+	r := *p
+	r.Reads, r.Trades, r.Streams = nil, nil, nil
+	if o == nil {
+		return &r
+	}
+	if o.MaxAttempts > 0 {
+		r.MaxAttempts = o.MaxAttempts
+	}
+	if o.BaseDelay > 0 {
+		r.BaseDelay = o.BaseDelay
+	}
+	if o.MaxDelay > 0 {
+		r.MaxDelay = o.MaxDelay
+	}
+	if o.Jitter != JitterUnset {
+		r.Jitter = o.Jitter
+	}
+	if o.JitterRange > 0 {
+		r.JitterRange = o.JitterRange
+	}
+	if o.RetryableCodes != nil {
+		r.RetryableCodes = o.RetryableCodes
+	}
+	if o.RetryableAPIErrorCodes != nil {
+		r.RetryableAPIErrorCodes = o.RetryableAPIErrorCodes
+	}
+	if o.RetryableMqlErrorCodes != nil {
+		r.RetryableMqlErrorCodes = o.RetryableMqlErrorCodes
+	}
+	return &r
+}
+
+// attempts returns the total number of attempts allowed (at least 1).
+func (p *RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns exponential backoff with jitter for the given attempt, capped by MaxDelay.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	// exponential: base << attempt (guard against shift overflow)
+	d := p.MaxDelay
+	if attempt < 32 {
+		if e := p.BaseDelay << attempt; e > 0 && e < p.MaxDelay {
+			d = e
+		}
+	}
+
+	switch p.Jitter {
+	case JitterNone:
+		return d
+	case JitterFull:
+		if d <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	case JitterEqual:
+		if d <= 0 {
+			return 0
+		}
+		half := d / 2
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	default: // JitterSymmetric
+		if p.JitterRange <= 0 {
+			return d
+		}
+		// jitter in [-JitterRange, +JitterRange]
+		j := time.Duration(rand.Int63n(int64(p.JitterRange*2))) - p.JitterRange
+		if d+j < 0 {
+			return 0
+		}
+		return d + j
+	}
+}
+
+// retryableTransport reports whether a transport error should be retried.
+func (p *RetryPolicy) retryableTransport(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, c := range p.RetryableCodes {
+		if s.Code() == c {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableAPI reports whether an API error should be retried.
+// ambiguous is true when the failed call may still have been executed
+// (matched by RetryableAPIErrorCodes) and false for definite MQL rejections.
+func (p *RetryPolicy) retryableAPI(apiErr *pb.Error) (retry, ambiguous bool) {
+	for _, c := range p.RetryableAPIErrorCodes {
+		if apiErr.GetErrorCode() == c {
+			return true, true
+		}
+	}
+	for _, c := range p.RetryableMqlErrorCodes {
+		if apiErr.GetMqlErrorCode() == c {
+			return true, false
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,207 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryPolicyMerge(t *testing.T) {
+	base := DefaultRetryPolicy()
+	tests := []struct {
+		name string
+		over *RetryPolicy
+		want func(*RetryPolicy)
+	}{
+		{"nil keeps everything", nil, func(*RetryPolicy) {}},
+		{"zero keeps everything", &RetryPolicy{}, func(*RetryPolicy) {}},
+		{"attempts", &RetryPolicy{MaxAttempts: 3}, func(p *RetryPolicy) { p.MaxAttempts = 3 }},
+		{"delays", &RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, func(p *RetryPolicy) {
+			p.BaseDelay, p.MaxDelay = time.Second, time.Minute
+		}},
+		{"jitter", &RetryPolicy{Jitter: JitterFull, JitterRange: time.Second}, func(p *RetryPolicy) {
+			p.Jitter, p.JitterRange = JitterFull, time.Second
+		}},
+		{"empty code list replaces", &RetryPolicy{RetryableCodes: []codes.Code{}}, func(p *RetryPolicy) {
+			p.RetryableCodes = []codes.Code{}
+		}},
+		{"mql codes", &RetryPolicy{RetryableMqlErrorCodes: []pb.MqlErrorCode{pb.MqlErrorCode_ERR_REQUOTE}}, func(p *RetryPolicy) {
+			p.RetryableMqlErrorCodes = []pb.MqlErrorCode{pb.MqlErrorCode_ERR_REQUOTE}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := *base
+			tt.want(&want)
+			if got := base.merge(tt.over); !reflect.DeepEqual(*got, want) {
+				t.Errorf("merge = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyMergeDropsOverrides(t *testing.T) {
+	p := &RetryPolicy{Trades: &RetryPolicy{MaxAttempts: 1}}
+	got := DefaultRetryPolicy().merge(p)
+	if got.Reads != nil || got.Trades != nil || got.Streams != nil {
+		t.Errorf("merge kept per-operation overrides: %+v", got)
+	}
+}
+
+func TestRetryPolicyForLayers(t *testing.T) {
+	a := &MT4Account{RetryPolicy: &RetryPolicy{
+		MaxAttempts: 5,
+		BaseDelay:   time.Second,
+		Trades:      &RetryPolicy{MaxAttempts: 1},
+	}}
+	ctx := ContextWithRetryPolicy(context.Background(), &RetryPolicy{
+		MaxDelay: time.Minute,
+		Reads:    &RetryPolicy{MaxAttempts: 7},
+	})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		kind      OperationKind
+		attempts  int
+		baseDelay time.Duration
+		maxDelay  time.Duration
+	}{
+		{"account read", context.Background(), OperationRead, 5, time.Second, backoffMax},
+		{"account trade override", context.Background(), OperationTrade, 1, time.Second, backoffMax},
+		{"context read override", ctx, OperationRead, 7, time.Second, time.Minute},
+		{"context keeps account trade override", ctx, OperationTrade, 1, time.Second, time.Minute},
+		{"context stream", ctx, OperationStream, 5, time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := a.retryPolicyFor(tt.ctx, tt.kind)
+			if p.MaxAttempts != tt.attempts || p.BaseDelay != tt.baseDelay || p.MaxDelay != tt.maxDelay {
+				t.Errorf("got attempts=%d base=%v max=%v, want %d %v %v",
+					p.MaxAttempts, p.BaseDelay, p.MaxDelay, tt.attempts, tt.baseDelay, tt.maxDelay)
+			}
+		})
+	}
+
+	if p := (*MT4Account)(nil).retryPolicyFor(context.Background(), OperationRead); !reflect.DeepEqual(p, DefaultRetryPolicy()) {
+		t.Errorf("nil account policy = %+v, want defaults", p)
+	}
+}
+
+func TestRetryPolicyAttempts(t *testing.T) {
+	for _, n := range []int{-1, 0, 1} {
+		if got := (&RetryPolicy{MaxAttempts: n}).attempts(); got != 1 {
+			t.Errorf("attempts(MaxAttempts=%d) = %d, want 1", n, got)
+		}
+	}
+	if got := (&RetryPolicy{MaxAttempts: 4}).attempts(); got != 4 {
+		t.Errorf("attempts(4) = %d", got)
+	}
+}
+
+func TestRetryPolicyDelayExponential(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: JitterNone}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{3, 800 * time.Millisecond},
+		{4, time.Second},  // capped
+		{31, time.Second}, // shift overflows int64
+		{100, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyDelayJitterBounds(t *testing.T) {
+	const d = 400 * time.Millisecond // delay(2) before jitter
+	tests := []struct {
+		name     string
+		p        RetryPolicy
+		min, max time.Duration
+	}{
+		{"symmetric", RetryPolicy{Jitter: JitterSymmetric, JitterRange: 50 * time.Millisecond}, d - 50*time.Millisecond, d + 50*time.Millisecond},
+		{"symmetric without range", RetryPolicy{Jitter: JitterSymmetric}, d, d},
+		{"full", RetryPolicy{Jitter: JitterFull}, 0, d},
+		{"equal", RetryPolicy{Jitter: JitterEqual}, d / 2, d},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.p
+			p.BaseDelay, p.MaxDelay = 100*time.Millisecond, time.Second
+			for i := 0; i < 200; i++ {
+				if got := p.delay(2); got < tt.min || got > tt.max {
+					t.Fatalf("delay(2) = %v, want within [%v, %v]", got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+
+	// Symmetric jitter never goes negative.
+	p := &RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Second, JitterRange: time.Second}
+	for i := 0; i < 200; i++ {
+		if got := p.delay(0); got < 0 {
+			t.Fatalf("delay(0) = %v, want >= 0", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	p := DefaultRetryPolicy().merge(&RetryPolicy{
+		RetryableMqlErrorCodes: []pb.MqlErrorCode{pb.MqlErrorCode_ERR_REQUOTE},
+	})
+
+	if !p.retryableTransport(status.Error(codes.Unavailable, "down")) {
+		t.Error("Unavailable not retryable")
+	}
+	if p.retryableTransport(status.Error(codes.InvalidArgument, "bad")) {
+		t.Error("InvalidArgument retryable")
+	}
+	if p.retryableTransport(errors.New("plain")) {
+		t.Error("non-status error retryable")
+	}
+
+	tests := []struct {
+		name             string
+		err              *pb.Error
+		retry, ambiguous bool
+	}{
+		{"terminal not found", &pb.Error{ErrorCode: "TERMINAL_INSTANCE_NOT_FOUND"}, true, true},
+		{"registry not found", &pb.Error{ErrorCode: "TERMINAL_REGISTRY_TERMINAL_NOT_FOUND"}, true, true},
+		{"requote", &pb.Error{ErrorCode: "MQL_ERROR", MqlErrorCode: pb.MqlErrorCode_ERR_REQUOTE}, true, false},
+		{"no money", &pb.Error{ErrorCode: "MQL_ERROR", MqlErrorCode: pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY}, false, false},
+	}
+	for _, tt := range tests {
+		retry, ambiguous := p.retryableAPI(tt.err)
+		if retry != tt.retry || ambiguous != tt.ambiguous {
+			t.Errorf("%s: retryableAPI = %v, %v; want %v, %v", tt.name, retry, ambiguous, tt.retry, tt.ambiguous)
+		}
+	}
+}
+
+func TestOperationKindString(t *testing.T) {
+	for kind, want := range map[OperationKind]string{
+		OperationRead:    "read",
+		OperationTrade:   "trade",
+		OperationStream:  "stream",
+		OperationKind(9): "unknown",
+	} {
+		if got := kind.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", kind, got, want)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Risk limits and kill switch ===
+//
+// A RiskGuard enforces account-level limits client-side, in front of OrderSend and
+// OrderModify (and their idempotent variants), while it is attached:
+//
+//	MaxOpenPositions    opened orders after the new one (pending orders count as if filled)
+//	MaxLotsPerSymbol    buy + sell lots of the symbol after the new order
+//	MaxNetExposure      |net| amount per currency after the new order; orders that reduce it pass
+//	MaxDailyLoss        −(today's realized + floating profit), in the account currency
+//	MaxOrdersPerMinute  OrderSend + OrderModify requests sent in the last minute
+//	TradingHours        allow list of weekly windows; requests outside them are refused
+//
+// A refused request is a *RiskError satisfying errors.Is(err, ErrRiskLimit). The daily loss
+// is watched continuously: realized profit comes from today's OrdersHistory (refreshed when
+// orders move to history, on reconnects and at midnight), floating profit from the
+// AccountInfo of OnOpenedOrdersProfit (and AccountSummary on each refresh). Reaching MaxDailyLoss trips the kill switch: OrderSend
+// is refused with ErrKillSwitch until Reset, and with FlattenOnTrip every position is closed
+// and every pending order deleted. OrderModify, OrderClose and OrderDelete stay available so
+// positions can still be protected and closed. Each trip is reported to RiskLimits.OnTrip.
+//
+// TripOnBreach also trips the kill switch on every refused request, Trip trips it by hand.
+// If the profit feed fails for good the switch trips as well (RiskMonitor, never flattening):
+// without it the daily loss is unknown.
+
+// RiskLimitKind names the limit behind a *RiskError or a RiskTrip.
+type RiskLimitKind string
+
+const (
+	RiskOpenPositions RiskLimitKind = "open positions"
+	RiskSymbolLots    RiskLimitKind = "lots per symbol"
+	RiskNetExposure   RiskLimitKind = "net exposure"
+	RiskDailyLoss     RiskLimitKind = "daily loss"
+	RiskOrderRate     RiskLimitKind = "order rate"
+	RiskTradingHours  RiskLimitKind = "trading hours"
+	RiskManual        RiskLimitKind = "manual"  // RiskGuard.Trip
+	RiskMonitor       RiskLimitKind = "monitor" // the daily loss feed failed
+)
+
+// TradingWindow is a daily time window, optionally limited to some weekdays.
+type TradingWindow struct {
+	// Days are the weekdays the window opens on (empty = every day).
+	Days []time.Weekday
+
+	// From and To are offsets from midnight; From > To wraps past midnight into the next day.
+	From, To time.Duration
+}
+
+// Contains reports whether t (in its own location) falls within the window.
+func (w TradingWindow) Contains(t time.Time) bool {
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := func(d time.Weekday) bool { return len(w.Days) == 0 || slices.Contains(w.Days, d) }
+	if w.From <= w.To {
+		return day(t.Weekday()) && tod >= w.From && tod < w.To
+	}
+	if tod >= w.From {
+		return day(t.Weekday())
+	}
+	return tod < w.To && day((t.Weekday()+6)%7) // opened the day before
+}
+
+// RiskLimits configures a RiskGuard; zero limits are off.
+type RiskLimits struct {
+	MaxOpenPositions   int
+	MaxLotsPerSymbol   float64
+	MaxNetExposure     map[string]float64 // currency → largest |net| amount in that currency
+	MaxDailyLoss       float64            // account currency
+	MaxOrdersPerMinute int
+
+	// TradingHours is the allow list of request times (empty = always).
+	TradingHours []TradingWindow
+
+	// Location is the time zone of TradingHours and of the trading day (nil = UTC).
+	Location *time.Location
+
+	// TripOnBreach trips the kill switch whenever a request is refused, not only on MaxDailyLoss.
+	TripOnBreach bool
+
+	// FlattenOnTrip closes all positions and deletes all pending orders (CloseAll) when the switch trips.
+	FlattenOnTrip bool
+
+	// ProfitIntervalMs is the OnOpenedOrdersProfit interval used for MaxDailyLoss (0 = 1000).
+	ProfitIntervalMs int32
+
+	// OnTrip is called (from a guard goroutine, after flattening) each time the switch trips.
+	OnTrip func(RiskTrip)
+}
+
+// RiskTrip describes a tripped kill switch.
+type RiskTrip struct {
+	Kind   RiskLimitKind
+	Reason string
+	Time   time.Time
+
+	// Flattened reports that FlattenOnTrip ran; FlattenErr joins the orders it could not close.
+	Flattened  bool
+	FlattenErr error
+}
+
+// RiskError is a request refused by a RiskGuard. It satisfies errors.Is(err, ErrRiskLimit),
+// and errors.Is(err, ErrKillSwitch) when Trip is set.
+type RiskError struct {
+	Kind   RiskLimitKind
+	Symbol string // empty for account-wide limits
+	Reason string
+
+	// Trip is the active kill switch that refused the request (nil = a limit refused it).
+	Trip *RiskTrip
+}
+
+func (e *RiskError) Error() string {
+	if e.Trip != nil {
+		return fmt.Sprintf("kill switch active since %s (%s: %s)", e.Trip.Time.Format(time.RFC3339), e.Trip.Kind, e.Trip.Reason)
+	}
+	if e.Symbol != "" {
+		return fmt.Sprintf("risk limit %s: %s %s", e.Kind, e.Symbol, e.Reason)
+	}
+	return fmt.Sprintf("risk limit %s: %s", e.Kind, e.Reason)
+}
+
+func (e *RiskError) Unwrap() error {
+	if e.Trip != nil {
+		return ErrKillSwitch
+	}
+	return ErrRiskLimit
+}
+
+// RiskGuard enforces RiskLimits on the order calls of an account. It is safe for concurrent use.
+type RiskGuard struct {
+	account *MT4Account
+	limits  RiskLimits
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	reset  chan struct{}
+	wg     sync.WaitGroup // OnTrip / flatten goroutines
+
+	mu       sync.Mutex
+	stopped  bool
+	tripped  bool
+	trip     RiskTrip
+	tripSeq  int
+	sent     []time.Time // requests of the last minute
+	day      time.Time   // start of the trading day of realized
+	realized float64
+	floating float64
+	currency string
+}
+
+// NewRiskGuard attaches a guard enforcing limits to the account's OrderSend / OrderModify
+// until ctx is done or Close is called. With MaxDailyLoss it loads today's realized profit
+// and follows OnTrade / OnOpenedOrdersProfit.
+//
+// Parameters:
+//   - ctx: Lifetime of the guard.
+//   - account: Connected account.
+//   - limits: The limits (zero fields are off) and the kill switch behaviour.
+//
+// Returns:
+//   - The running guard.
+//   - ErrNotConnected, or the error of the bootstrap AccountSummary / OrdersHistory calls.
+//
+// Example:
+//
+//	guard, err := mt4.NewRiskGuard(ctx, account, mt4.RiskLimits{
+//	    MaxOpenPositions:   5,
+//	    MaxDailyLoss:       500,
+//	    MaxOrdersPerMinute: 10,
+//	    TradingHours:       []mt4.TradingWindow{{From: 7 * time.Hour, To: 20 * time.Hour}},
+//	    FlattenOnTrip:      true,
+//	    OnTrip:             func(t mt4.RiskTrip) { alert("kill switch: %s: %s", t.Kind, t.Reason) },
+//	})
+//	if err != nil { return err }
+//	defer guard.Close()
+//	_, err = account.OrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil, nil, nil, nil, nil, nil, nil)
+//	if errors.Is(err, mt4.ErrRiskLimit) { ... }
+func NewRiskGuard(ctx context.Context, account *MT4Account, limits RiskLimits) (*RiskGuard, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if account == nil {
+		return nil, errors.New("NewRiskGuard: nil account")
+	}
+	if !account.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if limits.Location == nil {
+		limits.Location = time.UTC
+	}
+	if limits.ProfitIntervalMs <= 0 {
+		limits.ProfitIntervalMs = 1000
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	g := &RiskGuard{
+		account: account,
+		limits:  limits,
+		ctx:     runCtx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		reset:   make(chan struct{}, 1),
+	}
+	if limits.MaxDailyLoss > 0 {
+		if err := g.refreshDaily(runCtx); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	account.riskGuard.Store(g)
+	go g.run(runCtx)
+	return g, nil
+}
+
+// run follows the daily loss until ctx is done. A failed feed trips the kill switch and is
+// re-opened after Reset.
+func (g *RiskGuard) run(ctx context.Context) {
+	defer close(g.done)
+	defer func() {
+		g.mu.Lock()
+		g.stopped = true
+		g.mu.Unlock()
+		g.wg.Wait()
+	}()
+	defer g.account.riskGuard.CompareAndSwap(g, nil)
+
+	if g.limits.MaxDailyLoss <= 0 {
+		<-ctx.Done()
+		return
+	}
+	for {
+		err := g.monitor(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		g.account.logf("mt4: risk guard: %v", err)
+		g.tripWith(RiskMonitor, fmt.Sprintf("daily loss feed: %v", err), false)
+		select {
+		case <-ctx.Done():
+			return
+		case <-g.reset:
+		}
+	}
+}
+
+// monitor applies the profit and trade streams until one of them fails.
+func (g *RiskGuard) monitor(ctx context.Context) error {
+	a := g.account
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	profits, profitErrs := a.OnOpenedOrdersProfit(ctx, g.limits.ProfitIntervalMs)
+	trades, tradeErrs := a.OnTrade(ctx)
+	changes := a.StateChanges()
+	defer a.unsubscribeStateChanges(changes)
+
+	refresh := func(reason string) {
+		if err := g.refreshDaily(ctx); err != nil && ctx.Err() == nil {
+			a.logf("mt4: risk guard: daily profit (%s): %v", reason, err)
+		}
+	}
+	streamErr := func(err error, ok bool, name string) error {
+		if !ok || err == nil {
+			return errors.New(name + " stream ended")
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case data, ok := <-profits:
+			if !ok {
+				profits = nil // the error follows on profitErrs
+				continue
+			}
+			if g.newDay() {
+				refresh("new day")
+			}
+			if info := data.GetAccountInfo(); info != nil {
+				g.mu.Lock()
+				g.floating = info.GetProfit()
+				g.mu.Unlock()
+			}
+			g.checkDailyLoss()
+		case err, ok := <-profitErrs:
+			return streamErr(err, ok, "profit")
+		case data, ok := <-trades:
+			if !ok {
+				trades = nil
+				continue
+			}
+			if len(data.GetEventData().GetNewHistoryOrders()) > 0 {
+				refresh("history")
+				g.checkDailyLoss()
+			}
+		case err, ok := <-tradeErrs:
+			return streamErr(err, ok, "trade")
+		case ch, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			// Orders may have closed while the streams were down.
+			if ch.To == StateConnected && (ch.From == StateReconnecting || ch.Reestablished) {
+				refresh("reconnect")
+			}
+		}
+	}
+}
+
+// refreshDaily sums profit, swap and commission of the positions closed today, then reloads
+// the floating profit so a position that just closed is not counted twice.
+func (g *RiskGuard) refreshDaily(ctx context.Context) error {
+	from := g.startOfDay(time.Now())
+	history, err := g.account.OrdersHistory(ctx, pb.EnumOrderHistorySortType_HISTORY_SORT_BY_CLOSE_TIME_ASC, &from, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	var realized float64
+	for _, o := range history.GetOrdersInfo() {
+		if t := o.GetOrderType(); t != pb.OpenedOrderType_OO_OP_BUY && t != pb.OpenedOrderType_OO_OP_SELL {
+			continue // deleted pending orders, balance operations
+		}
+		realized += o.GetProfit() + o.GetSwap() + o.GetCommision()
+	}
+	summary, err := g.account.AccountSummary(ctx)
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.realized, g.day = realized, from
+	g.floating = summary.GetAccountEquity() - summary.GetAccountBalance() - summary.GetAccountCredit()
+	g.currency = summary.GetAccountCurrency()
+	g.mu.Unlock()
+	return nil
+}
+
+// startOfDay returns midnight of t's trading day in Location.
+func (g *RiskGuard) startOfDay(t time.Time) time.Time {
+	t = t.In(g.limits.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// newDay reports whether the trading day changed since the last realized refresh.
+func (g *RiskGuard) newDay() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return !g.day.Equal(g.startOfDay(time.Now()))
+}
+
+// checkDailyLoss trips the kill switch when the daily loss reached MaxDailyLoss.
+func (g *RiskGuard) checkDailyLoss() {
+	if g.limits.MaxDailyLoss <= 0 {
+		return
+	}
+	g.mu.Lock()
+	loss, currency := -(g.realized + g.floating), g.currency
+	g.mu.Unlock()
+	if loss >= g.limits.MaxDailyLoss {
+		g.tripWith(RiskDailyLoss, fmt.Sprintf("daily loss %.2f %s reached the limit of %.2f",
+			loss, currency, g.limits.MaxDailyLoss), true)
+	}
+}
+
+// Trip trips the kill switch by hand (RiskManual); it is a no-op while the switch is tripped.
+func (g *RiskGuard) Trip(reason string) {
+	g.tripWith(RiskManual, reason, true)
+}
+
+// tripWith trips the kill switch unless it is tripped already, then flattens (when allowed
+// and configured) and reports the trip to OnTrip from a goroutine.
+func (g *RiskGuard) tripWith(kind RiskLimitKind, reason string, flatten bool) {
+	g.mu.Lock()
+	if g.tripped {
+		g.mu.Unlock()
+		return
+	}
+	g.tripped = true
+	g.tripSeq++
+	g.trip = RiskTrip{Kind: kind, Reason: reason, Time: time.Now()}
+	trip, seq := g.trip, g.tripSeq
+	flatten = flatten && g.limits.FlattenOnTrip
+	async := !g.stopped && (flatten || g.limits.OnTrip != nil)
+	if async {
+		g.wg.Add(1)
+	}
+	g.mu.Unlock()
+
+	g.account.logf("mt4: kill switch tripped (%s): %s", kind, reason)
+	if !async {
+		return
+	}
+	go func() {
+		defer g.wg.Done()
+		if flatten {
+			_, err := g.account.CloseAll(g.ctx, nil)
+			trip.Flattened, trip.FlattenErr = true, err
+			if trip.FlattenErr != nil {
+				g.account.logf("mt4: kill switch flatten: %v", trip.FlattenErr)
+			}
+			g.mu.Lock()
+			if g.tripSeq == seq {
+				g.trip = trip
+			}
+			g.mu.Unlock()
+		}
+		if g.limits.OnTrip != nil {
+			g.limits.OnTrip(trip)
+		}
+	}()
+}
+
+// Reset re-arms the kill switch (and re-opens a failed daily loss feed). If the daily loss is
+// still over the limit, the switch trips again on the next profit update.
+func (g *RiskGuard) Reset() {
+	g.mu.Lock()
+	g.tripped = false
+	g.trip = RiskTrip{}
+	g.mu.Unlock()
+	select {
+	case g.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Tripped returns the active trip, if the kill switch is tripped.
+func (g *RiskGuard) Tripped() (RiskTrip, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.trip, g.tripped
+}
+
+// DailyPnL returns today's realized and current floating profit in the account currency
+// (both 0 without MaxDailyLoss).
+func (g *RiskGuard) DailyPnL() (realized, floating float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.realized, g.floating
+}
+
+// Done is closed when the guard stops.
+func (g *RiskGuard) Done() <-chan struct{} {
+	return g.done
+}
+
+// Close detaches the guard from the account and waits for a running flatten / OnTrip.
+// Safe to call more than once; do not call it from OnTrip.
+func (g *RiskGuard) Close() {
+	g.cancel()
+	<-g.done
+}
+
+// running reports whether the guard still enforces its limits.
+func (g *RiskGuard) running() bool {
+	select {
+	case <-g.done:
+		return false
+	default:
+		return true
+	}
+}
+
+//=== 📂 Checks ===
+
+// riskCheckSend applies the attached RiskGuard, if any, to an OrderSend.
+func (a *MT4Account) riskCheckSend(
+	ctx context.Context,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price *float64,
+) error {
+	if g := a.riskGuard.Load(); g != nil && g.running() {
+		return g.checkOrderSend(ctx, symbol, operationType, volume, price)
+	}
+	return nil
+}
+
+// riskCheckModify applies the attached RiskGuard, if any, to an OrderModify.
+func (a *MT4Account) riskCheckModify() error {
+	if g := a.riskGuard.Load(); g != nil && g.running() {
+		return g.checkOrderModify()
+	}
+	return nil
+}
+
+// checkOrderSend applies every limit to a new order and counts it for MaxOrdersPerMinute.
+func (g *RiskGuard) checkOrderSend(
+	ctx context.Context,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price *float64,
+) error {
+	g.checkDailyLoss()
+	if err := g.killSwitch(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := g.tradingHours(now); err != nil {
+		return g.breach(err)
+	}
+	if err := g.orderRate(now, false); err != nil {
+		return g.breach(err)
+	}
+	if err := g.positions(ctx, symbol, operationType, volume, price); err != nil {
+		var re *RiskError
+		if errors.As(err, &re) {
+			return g.breach(re)
+		}
+		return err
+	}
+	if err := g.orderRate(now, true); err != nil {
+		return g.breach(err)
+	}
+	return nil
+}
+
+// checkOrderModify applies the trading hours and the order rate to a modification.
+func (g *RiskGuard) checkOrderModify() error {
+	now := time.Now()
+	if err := g.tradingHours(now); err != nil {
+		return g.breach(err)
+	}
+	if err := g.orderRate(now, true); err != nil {
+		return g.breach(err)
+	}
+	return nil
+}
+
+// breach trips the kill switch for a refused request when TripOnBreach is set.
+func (g *RiskGuard) breach(err *RiskError) error {
+	if g.limits.TripOnBreach {
+		reason := err.Reason
+		if err.Symbol != "" {
+			reason = err.Symbol + " " + reason
+		}
+		g.tripWith(err.Kind, reason, true)
+	}
+	return err
+}
+
+// killSwitch returns the refusal of the tripped kill switch.
+func (g *RiskGuard) killSwitch() *RiskError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.tripped {
+		return nil
+	}
+	trip := g.trip
+	return &RiskError{Kind: trip.Kind, Reason: trip.Reason, Trip: &trip}
+}
+
+// tradingHours refuses requests outside the TradingHours windows.
+func (g *RiskGuard) tradingHours(now time.Time) *RiskError {
+	if len(g.limits.TradingHours) == 0 {
+		return nil
+	}
+	t := now.In(g.limits.Location)
+	for _, w := range g.limits.TradingHours {
+		if w.Contains(t) {
+			return nil
+		}
+	}
+	return &RiskError{Kind: RiskTradingHours, Reason: "outside trading hours at " + t.Format("Mon 15:04 MST")}
+}
+
+// orderRate refuses a request over MaxOrdersPerMinute; record counts it when it passes.
+func (g *RiskGuard) orderRate(now time.Time, record bool) *RiskError {
+	limit := g.limits.MaxOrdersPerMinute
+	if limit <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cut := 0
+	for cut < len(g.sent) && now.Sub(g.sent[cut]) >= time.Minute {
+		cut++
+	}
+	g.sent = g.sent[cut:]
+	if len(g.sent) >= limit {
+		return &RiskError{Kind: RiskOrderRate, Reason: fmt.Sprintf("%d requests in the last minute, limit %d", len(g.sent), limit)}
+	}
+	if record {
+		g.sent = append(g.sent, now)
+	}
+	return nil
+}
+
+// positions applies MaxOpenPositions, MaxLotsPerSymbol and MaxNetExposure to the opened
+// orders plus the new one. The error is a *RiskError or the error of a lookup.
+func (g *RiskGuard) positions(
+	ctx context.Context,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price *float64,
+) error {
+	l := g.limits
+	if l.MaxOpenPositions <= 0 && l.MaxLotsPerSymbol <= 0 && len(l.MaxNetExposure) == 0 {
+		return nil
+	}
+	orders, err := g.openedOrders(ctx)
+	if err != nil {
+		return err
+	}
+
+	if l.MaxOpenPositions > 0 && len(orders)+1 > l.MaxOpenPositions {
+		return &RiskError{Kind: RiskOpenPositions,
+			Reason: fmt.Sprintf("%d opened orders, limit %d", len(orders), l.MaxOpenPositions)}
+	}
+	if l.MaxLotsPerSymbol > 0 {
+		var lots float64
+		for _, o := range orders {
+			if o.GetSymbol() == symbol {
+				lots += o.GetLots()
+			}
+		}
+		if lots+volume > l.MaxLotsPerSymbol+1e-9 {
+			return &RiskError{Kind: RiskSymbolLots, Symbol: symbol,
+				Reason: fmt.Sprintf("%s + %s lots exceeds %s", formatFloat(lots), formatFloat(volume), formatFloat(l.MaxLotsPerSymbol))}
+		}
+	}
+	if len(l.MaxNetExposure) > 0 {
+		return g.netExposure(ctx, orders, symbol, operationType, volume, price)
+	}
+	return nil
+}
+
+// netExposure refuses an order that takes a currency's |net| amount over its limit.
+func (g *RiskGuard) netExposure(
+	ctx context.Context,
+	orders []*pb.OpenedOrderInfo,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price *float64,
+) error {
+	a := g.account
+	quotes := make(map[string]*pb.QuoteData)
+	quote := func(s string) (*pb.QuoteData, error) {
+		if q, ok := quotes[s]; ok {
+			return q, nil
+		}
+		q, err := a.Quote(ctx, s)
+		if err != nil {
+			return nil, err
+		}
+		quotes[s] = q
+		return q, nil
+	}
+	// add books lots of s: FOREX as +base / −quote, other modes as the value in the profit currency.
+	add := func(net map[string]float64, s string, buy bool, lots, px float64) error {
+		p, err := a.symbolSpecs.get(ctx, a, s, DefaultSymbolParamsTTL)
+		if err != nil {
+			return err
+		}
+		units := lots * p.GetTradeContractSize()
+		if !buy {
+			units = -units
+		}
+		if p.GetTradeCalcMode() == pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FOREX {
+			net[p.GetCurrencyBase()] += units
+			net[p.GetCurrencyProfit()] -= units * px
+		} else {
+			net[p.GetCurrencyProfit()] += units * px
+		}
+		return nil
+	}
+
+	before := make(map[string]float64)
+	for _, o := range orders {
+		q, err := quote(o.GetSymbol())
+		if err != nil {
+			return err
+		}
+		if err := add(before, o.GetSymbol(), isBuyOrderType(o.GetOrderType()), o.GetLots(), q.GetBid()); err != nil {
+			return err
+		}
+	}
+	after := make(map[string]float64, len(before))
+	for ccy, v := range before {
+		after[ccy] = v
+	}
+	buy := isBuyOrderType(pb.OpenedOrderType(operationType))
+	px := deref(price)
+	if px <= 0 {
+		q, err := quote(symbol)
+		if err != nil {
+			return err
+		}
+		px = closeSidePrice(q, buy)
+	}
+	if err := add(after, symbol, buy, volume, px); err != nil {
+		return err
+	}
+
+	currencies := make([]string, 0, len(g.limits.MaxNetExposure))
+	for ccy := range g.limits.MaxNetExposure {
+		currencies = append(currencies, ccy)
+	}
+	sort.Strings(currencies)
+	for _, ccy := range currencies {
+		limit, b, n := g.limits.MaxNetExposure[ccy], math.Abs(before[ccy]), math.Abs(after[ccy])
+		if limit > 0 && n > limit && n > b {
+			return &RiskError{Kind: RiskNetExposure, Symbol: symbol,
+				Reason: fmt.Sprintf("takes net %s exposure to %.2f, limit %.2f", ccy, after[ccy], limit)}
+		}
+	}
+	return nil
+}
+
+// openedOrders returns the opened orders from the attached OrderCache, or OpenedOrders.
+func (g *RiskGuard) openedOrders(ctx context.Context) ([]*pb.OpenedOrderInfo, error) {
+	if c := g.account.orderCache.Load(); c != nil && c.running() {
+		return c.Orders(OrderFilter{}), nil
+	}
+	data, err := g.account.OpenedOrders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return data.GetOrderInfos(), nil
+}
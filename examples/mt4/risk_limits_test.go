@@ -0,0 +1,268 @@
+package mt4_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+func TestTradingWindowContains(t *testing.T) {
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	tests := []struct {
+		name string
+		w    mt4.TradingWindow
+		at   string
+		want bool
+	}{
+		{"inside", mt4.TradingWindow{From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-10T12:00:00Z", true},
+		{"at From", mt4.TradingWindow{From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-10T07:00:00Z", true},
+		{"at To", mt4.TradingWindow{From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-10T20:00:00Z", false},
+		{"before", mt4.TradingWindow{From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-10T06:59:59Z", false},
+		{"weekday", mt4.TradingWindow{Days: weekdays, From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-13T12:00:00Z", true},
+		{"weekend", mt4.TradingWindow{Days: weekdays, From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-14T12:00:00Z", false},
+		{"wraps: evening", mt4.TradingWindow{From: 22 * time.Hour, To: 2 * time.Hour}, "2026-03-10T23:00:00Z", true},
+		{"wraps: after midnight", mt4.TradingWindow{From: 22 * time.Hour, To: 2 * time.Hour}, "2026-03-11T01:30:00Z", true},
+		{"wraps: outside", mt4.TradingWindow{From: 22 * time.Hour, To: 2 * time.Hour}, "2026-03-11T03:00:00Z", false},
+		// Friday 22:00 – 02:00 opens on Friday and runs into Saturday, not into Monday.
+		{"wraps: day before", mt4.TradingWindow{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}, "2026-03-14T01:00:00Z", true},
+		{"wraps: wrong day", mt4.TradingWindow{Days: []time.Weekday{time.Friday}, From: 22 * time.Hour, To: 2 * time.Hour}, "2026-03-13T01:00:00Z", false},
+		{"own location", mt4.TradingWindow{From: 7 * time.Hour, To: 20 * time.Hour}, "2026-03-10T06:00:00+02:00", false},
+	}
+	for _, tt := range tests {
+		at, err := time.Parse(time.RFC3339, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.w.Contains(at); got != tt.want {
+			t.Errorf("%s: Contains(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestRiskError(t *testing.T) {
+	limit := &mt4.RiskError{Kind: mt4.RiskSymbolLots, Symbol: "EURUSD", Reason: "2 + 1 lots exceeds 2"}
+	if !errors.Is(limit, mt4.ErrRiskLimit) || errors.Is(limit, mt4.ErrKillSwitch) {
+		t.Errorf("limit error %v does not match ErrRiskLimit only", limit)
+	}
+	if got, want := limit.Error(), "risk limit lots per symbol: EURUSD 2 + 1 lots exceeds 2"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	trip := &mt4.RiskError{Kind: mt4.RiskManual, Trip: &mt4.RiskTrip{Kind: mt4.RiskManual, Reason: "news", Time: time.Now()}}
+	if !errors.Is(trip, mt4.ErrKillSwitch) {
+		t.Errorf("kill switch error %v does not match ErrKillSwitch", trip)
+	}
+}
+
+// newTestGuard attaches a guard with limits to account, closed when the test ends.
+func newTestGuard(t *testing.T, account *mt4.MT4Account, limits mt4.RiskLimits) *mt4.RiskGuard {
+	t.Helper()
+	g, err := mt4.NewRiskGuard(testContext(t), account, limits)
+	if err != nil {
+		t.Fatalf("NewRiskGuard: %v", err)
+	}
+	t.Cleanup(g.Close)
+	return g
+}
+
+// riskKind returns the kind of a *RiskError, or "" for any other error.
+func riskKind(err error) mt4.RiskLimitKind {
+	var re *mt4.RiskError
+	if errors.As(err, &re) {
+		return re.Kind
+	}
+	return ""
+}
+
+func TestRiskGuardPositionLimits(t *testing.T) {
+	srv, account := newTestAccount(t)
+	newTestGuard(t, account, mt4.RiskLimits{
+		MaxOpenPositions: 3,
+		MaxLotsPerSymbol: 2,
+		MaxNetExposure:   map[string]float64{"EUR": 150000},
+	})
+	sell := func(symbol string, lots float64) error {
+		_, err := account.OrderSend(testContext(t), symbol, pb.OrderSendOperationType_OC_OP_SELL, lots, nil, nil, nil, nil, nil, nil, nil)
+		return err
+	}
+
+	buy(t, account, "EURUSD", 1)
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 1, nil, nil, nil, nil, nil, nil, nil)
+	if riskKind(err) != mt4.RiskNetExposure {
+		t.Errorf("second EUR lot = %v, want a net exposure refusal", err)
+	}
+	// Selling reduces the net EUR exposure; the lots still add up per symbol.
+	if err := sell("EURUSD", 1); err != nil {
+		t.Errorf("sell reducing the exposure: %v", err)
+	}
+	if err := sell("EURUSD", 0.5); riskKind(err) != mt4.RiskSymbolLots {
+		t.Errorf("2.5 EURUSD lots = %v, want a lots per symbol refusal", err)
+	}
+	buy(t, account, "USDJPY", 1)
+	if err := sell("GBPUSD", 0.1); riskKind(err) != mt4.RiskOpenPositions || !errors.Is(err, mt4.ErrRiskLimit) {
+		t.Errorf("fourth position = %v, want an open positions refusal", err)
+	}
+	if got := srv.Calls("OrderSend"); got != 3 {
+		t.Errorf("OrderSend calls = %d, refused orders reached the server", got)
+	}
+}
+
+func TestRiskGuardOrderRateAndHours(t *testing.T) {
+	_, account := newTestAccount(t)
+	g := newTestGuard(t, account, mt4.RiskLimits{MaxOrdersPerMinute: 2})
+
+	ticket := buy(t, account, "EURUSD", 0.1)
+	if _, err := account.OrderModify(testContext(t), ticket, nil, ptr(1.05), nil, nil); err != nil {
+		t.Fatalf("OrderModify: %v", err)
+	}
+	_, err := account.OrderModify(testContext(t), ticket, nil, ptr(1.06), nil, nil)
+	if riskKind(err) != mt4.RiskOrderRate {
+		t.Errorf("third request in a minute = %v, want an order rate refusal", err)
+	}
+	// Closing is never refused.
+	if _, err := account.OrderClose(testContext(t), ticket, nil, nil, nil); err != nil {
+		t.Errorf("OrderClose: %v", err)
+	}
+	g.Close()
+
+	tomorrow := time.Now().UTC().Add(24 * time.Hour).Weekday()
+	newTestGuard(t, account, mt4.RiskLimits{
+		TradingHours: []mt4.TradingWindow{{Days: []time.Weekday{tomorrow}, From: 0, To: 24 * time.Hour}},
+		TripOnBreach: true,
+	})
+	_, err = account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if riskKind(err) != mt4.RiskTradingHours {
+		t.Errorf("OrderSend outside the window = %v, want a trading hours refusal", err)
+	}
+	// TripOnBreach: the refusal tripped the kill switch.
+	_, err = account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrKillSwitch) {
+		t.Errorf("OrderSend after the breach = %v, want ErrKillSwitch", err)
+	}
+}
+
+func TestRiskGuardKillSwitch(t *testing.T) {
+	srv, account := newTestAccount(t)
+	trips := make(chan mt4.RiskTrip, 4)
+	g := newTestGuard(t, account, mt4.RiskLimits{OnTrip: func(tr mt4.RiskTrip) { trips <- tr }})
+	ticket := buy(t, account, "EURUSD", 0.1)
+
+	g.Trip("news")
+	g.Trip("ignored while tripped")
+	if tr, ok := g.Tripped(); !ok || tr.Kind != mt4.RiskManual || tr.Reason != "news" {
+		t.Errorf("Tripped() = %+v, %v", tr, ok)
+	}
+	select {
+	case tr := <-trips:
+		if tr.Reason != "news" || tr.Flattened {
+			t.Errorf("OnTrip(%+v)", tr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnTrip not called")
+	}
+
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrKillSwitch) {
+		t.Errorf("OrderSend with the switch tripped = %v, want ErrKillSwitch", err)
+	}
+	// Positions can still be protected.
+	if _, err := account.OrderModify(testContext(t), ticket, nil, ptr(1.05), nil, nil); err != nil {
+		t.Errorf("OrderModify with the switch tripped: %v", err)
+	}
+	if srv.Order(ticket) == nil {
+		t.Error("manual trip without FlattenOnTrip closed the position")
+	}
+
+	g.Reset()
+	buy(t, account, "EURUSD", 0.1)
+
+	// A closed guard no longer applies.
+	g.Trip("again")
+	g.Close()
+	g.Close()
+	buy(t, account, "EURUSD", 0.1)
+}
+
+func TestRiskGuardDailyLoss(t *testing.T) {
+	srv, account := newTestAccount(t)
+	now := timestamppb.Now()
+	srv.AddHistory(
+		&pb.HistoryOrderInfo{Ticket: 900, Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 1,
+			Profit: -300, Swap: -10, Commision: -5, OpenTime: now, CloseTime: now},
+		&pb.HistoryOrderInfo{Ticket: 901, Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUYLIMIT, Lots: 1,
+			Profit: -1000, OpenTime: now, CloseTime: now}, // deleted pending order: not counted
+		&pb.HistoryOrderInfo{Ticket: 902, Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELL, Lots: 1,
+			Profit: -1000, OpenTime: timestamppb.New(now.AsTime().Add(-72 * time.Hour)),
+			CloseTime: timestamppb.New(now.AsTime().Add(-48 * time.Hour))}, // an earlier day
+	)
+	trips := make(chan mt4.RiskTrip, 4)
+	g := newTestGuard(t, account, mt4.RiskLimits{
+		MaxDailyLoss:     1000,
+		FlattenOnTrip:    true,
+		ProfitIntervalMs: 20,
+		OnTrip:           func(tr mt4.RiskTrip) { trips <- tr },
+	})
+	if realized, floating := g.DailyPnL(); realized != -315 || floating != 0 {
+		t.Errorf("DailyPnL = %v, %v, want -315, 0", realized, floating)
+	}
+
+	buy(t, account, "EURUSD", 1)
+	srv.PushTick("EURUSD", 1.093, 1.0931) // −710 floating: −1025 for the day
+
+	var trip mt4.RiskTrip
+	select {
+	case trip = <-trips:
+	case <-time.After(2 * time.Second):
+		t.Fatal("daily loss did not trip the kill switch")
+	}
+	if trip.Kind != mt4.RiskDailyLoss || !trip.Flattened || trip.FlattenErr != nil {
+		t.Errorf("trip = %+v", trip)
+	}
+	if orders := srv.Orders(); len(orders) != 0 {
+		t.Errorf("%d orders left after flattening", len(orders))
+	}
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrKillSwitch) {
+		t.Errorf("OrderSend after the trip = %v, want ErrKillSwitch", err)
+	}
+}
+
+func TestRiskGuardMonitorFailure(t *testing.T) {
+	srv, account := newTestAccount(t)
+	srv.FailNext("OnOpenedOrdersProfit", 1, status.Error(codes.PermissionDenied, "mt4test: denied"))
+	g := newTestGuard(t, account, mt4.RiskLimits{MaxDailyLoss: 1000})
+
+	eventually(t, "a monitor trip", func() bool {
+		tr, ok := g.Tripped()
+		return ok && tr.Kind == mt4.RiskMonitor
+	})
+	// Reset re-opens the feed; the switch stays off while it runs.
+	g.Reset()
+	time.Sleep(50 * time.Millisecond)
+	if tr, ok := g.Tripped(); ok {
+		t.Errorf("tripped again after Reset: %+v", tr)
+	}
+	buy(t, account, "EURUSD", 0.1)
+}
+
+func TestNewRiskGuardErrors(t *testing.T) {
+	_, disconnected := newDisconnectedAccount(t)
+	if _, err := mt4.NewRiskGuard(testContext(t), disconnected, mt4.RiskLimits{}); !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("NewRiskGuard before connecting = %v, want ErrNotConnected", err)
+	}
+	if _, err := mt4.NewRiskGuard(testContext(t), nil, mt4.RiskLimits{}); err == nil {
+		t.Error("NewRiskGuard accepted a nil account")
+	}
+
+	srv, account := newTestAccount(t)
+	srv.FailNext("OrdersHistory", 1, status.Error(codes.PermissionDenied, "mt4test: denied"))
+	if _, err := mt4.NewRiskGuard(testContext(t), account, mt4.RiskLimits{MaxDailyLoss: 100}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("NewRiskGuard with a failing history = %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package mt4
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/google/uuid"
+)
+
+//=== 📂 Session state ===
+//
+// The terminal session (instance id, host, server name, ...) changes on Connect,
+// Disconnect and automatic re-establishment (reestablish.go), while stream goroutines keep
+// reading it to build request headers. It therefore lives behind a lock and is only
+// exposed as an immutable snapshot (Session) plus an explicit state machine:
+//
+//	Disconnected ──Connect──▶ Connecting ──ok──▶ Connected ◀──recovered── Reconnecting
+//	      ▲                        │                 │  └──transport / terminal lost──▶┘
+//	      └──────────failed────────┘                 │
+//	 any state ──Disconnect──▶ Closed (final)  ◀─────┘
+
+// SessionState is the lifecycle state of an MT4Account.
+type SessionState int32
+
+const (
+	// StateDisconnected: no terminal session (initial state, or after a failed connect).
+	StateDisconnected SessionState = iota
+	// StateConnecting: ConnectByHostPort / ConnectByServerName in progress.
+	StateConnecting
+	// StateConnected: terminal session established and healthy.
+	StateConnected
+	// StateReconnecting: calls are failing with transport / terminal-not-found errors and are being retried.
+	StateReconnecting
+	// StateClosed: Disconnect was called; the account cannot be used anymore.
+	StateClosed
+)
+
+// String returns a human-readable state name.
+func (s SessionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// StateChange is delivered on StateChanges channels.
+type StateChange struct {
+	From SessionState
+	To   SessionState
+	Err  error // cause of the transition (nil for successful connects and Disconnect)
+	Time time.Time
+
+	// Reestablished is true when a lost terminal instance was replaced automatically;
+	// PreviousID is the lost instance and SessionID the new one.
+	Reestablished bool
+	PreviousID    uuid.UUID
+	SessionID     uuid.UUID
+}
+
+// Session is an immutable snapshot of the terminal session.
+type Session struct {
+	// Id is the terminal instance id sent in the "id" header (uuid.Nil = none).
+	Id uuid.UUID
+
+	// Host / Port are set by ConnectByHostPort.
+	Host string
+	Port int
+
+	// ServerName is set by ConnectByServerName.
+	ServerName string
+
+	// Proxy is set by ConnectViaProxy (zero = direct connection).
+	Proxy ProxySettings
+
+	// BaseChartSymbol is the default chart symbol (e.g., "EURUSD").
+	BaseChartSymbol string
+
+	// WaitForTerminalIsAlive is the flag passed to ConnectByHostPort.
+	WaitForTerminalIsAlive bool
+
+	// ConnectTimeout is the timeout for connection readiness, in seconds.
+	ConnectTimeout int
+
+	// ConnectedAt is when the session was established (zero if never).
+	ConnectedAt time.Time
+}
+
+// stateChangesBuffer is the capacity of each StateChanges channel.
+// When a subscriber falls behind, its oldest undelivered change is dropped.
+const stateChangesBuffer = 16
+
+// sessionHolder guards the mutable session of an MT4Account.
+// The zero value is a disconnected account without a session.
+type sessionHolder struct {
+	mu      sync.RWMutex
+	state   SessionState
+	session Session
+	subs    []chan StateChange
+	stalls  []chan StreamStall // StreamStalls subscribers
+
+	// connectMu serializes ConnectByHostPort / ConnectByServerName and re-establishment.
+	connectMu sync.Mutex
+
+	// reestablishing is the in-flight automatic reconnect, if any (guarded by mu).
+	reestablishing *reestablishCall
+
+	// target is the last successfully connected session, kept across Logout (guarded by mu).
+	target Session
+
+	// progress is the latest ConnectWithProgress event (guarded by mu).
+	progress *pb.ConnectStreamEvent
+}
+
+// State returns the current lifecycle state.
+func (a *MT4Account) State() SessionState {
+	if a == nil {
+		return StateClosed
+	}
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.state
+}
+
+// Session returns a snapshot of the current terminal session.
+func (a *MT4Account) Session() Session {
+	if a == nil {
+		return Session{}
+	}
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.session
+}
+
+// StateChanges returns a channel receiving every subsequent state transition.
+// Each call creates an independent subscription; the channel is closed after the
+// transition to StateClosed (immediately, if the account is already closed).
+// A subscriber that does not keep up loses its oldest undelivered changes.
+//
+// Example:
+//
+//	go func() {
+//	    for ch := range account.StateChanges() {
+//	        log.Printf("mt4: %s → %s (%v)", ch.From, ch.To, ch.Err)
+//	    }
+//	}()
+func (a *MT4Account) StateChanges() <-chan StateChange {
+	ch := make(chan StateChange, stateChangesBuffer)
+	if a == nil {
+		close(ch)
+		return ch
+	}
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	if a.sess.state == StateClosed {
+		close(ch)
+		return ch
+	}
+	a.sess.subs = append(a.sess.subs, ch)
+	return ch
+}
+
+// unsubscribeStateChanges removes a StateChanges subscription and closes its channel.
+func (a *MT4Account) unsubscribeStateChanges(ch <-chan StateChange) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	for i, sub := range a.sess.subs {
+		if sub == ch {
+			a.sess.subs = append(a.sess.subs[:i], a.sess.subs[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// setStateLocked moves to state to and notifies subscribers. Caller holds a.sess.mu.
+// Nothing leaves StateClosed.
+func (a *MT4Account) setStateLocked(to SessionState, cause error) {
+	from := a.sess.state
+	if from == to || from == StateClosed {
+		return
+	}
+	a.sess.state = to
+	a.publishLocked(StateChange{From: from, To: to, Err: cause, Time: time.Now()})
+}
+
+// publishLocked delivers change to every subscriber and closes them on StateClosed.
+// Caller holds a.sess.mu and has already updated a.sess.state.
+func (a *MT4Account) publishLocked(change StateChange) {
+	for _, ch := range a.sess.subs {
+		for {
+			select {
+			case ch <- change:
+			default:
+				// Full: drop the oldest change and try again.
+				select {
+				case <-ch:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+	if change.To == StateClosed {
+		for _, ch := range a.sess.subs {
+			close(ch)
+		}
+		for _, ch := range a.sess.stalls {
+			close(ch)
+		}
+		a.sess.subs, a.sess.stalls = nil, nil
+	}
+	a.logf("mt4: session %s → %s", change.From, change.To)
+}
+
+// setState moves to state to (see setStateLocked).
+func (a *MT4Account) setState(to SessionState, cause error) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	a.setStateLocked(to, cause)
+}
+
+// transition moves from → to only if the account is currently in state from.
+func (a *MT4Account) transition(from, to SessionState, cause error) bool {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	if a.sess.state != from {
+		return false
+	}
+	a.setStateLocked(to, cause)
+	return true
+}
+
+// beginConnect enters StateConnecting and returns the state to restore if the connect RPC fails.
+func (a *MT4Account) beginConnect() (SessionState, error) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	prev := a.sess.state
+	if prev == StateClosed {
+		return prev, ErrAccountClosed
+	}
+	a.setStateLocked(StateConnecting, nil)
+	return prev, nil
+}
+
+// abortConnect restores the state saved by beginConnect after a failed connect RPC
+// (the previous session, if any, is left untouched).
+func (a *MT4Account) abortConnect(prev SessionState, cause error) {
+	if prev == StateConnecting {
+		prev = StateDisconnected
+	}
+	a.setState(prev, cause)
+}
+
+// storeSession replaces the session snapshot.
+func (a *MT4Account) storeSession(s Session) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	a.sess.session = s
+	a.sess.target = s
+}
+
+// lastTarget returns the parameters of the last session opened by a connect,
+// even after Logout dropped the session.
+func (a *MT4Account) lastTarget() Session {
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.target
+}
+
+// acquireConnectSlot waits for a slot of the AccountPool connect limit and returns its
+// release function (a no-op for accounts outside a pool).
+func (a *MT4Account) acquireConnectSlot(ctx context.Context) (func(), error) {
+	if a.connectSlots == nil {
+		return func() {}, nil
+	}
+	select {
+	case a.connectSlots <- struct{}{}:
+		return func() { <-a.connectSlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// failConnect drops the session after a failed post-connect health-check.
+func (a *MT4Account) failConnect(cause error) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	a.sess.session = Session{}
+	a.setStateLocked(StateDisconnected, cause)
+}
+
+// endSession drops the session after a server-side logout, unless it was replaced meanwhile.
+func (a *MT4Account) endSession(id uuid.UUID) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	if a.sess.session.Id != id {
+		return
+	}
+	a.sess.session = Session{}
+	a.setStateLocked(StateDisconnected, nil)
+}
+
+// sessionID returns the current terminal instance id.
+func (a *MT4Account) sessionID() uuid.UUID {
+	a.sess.mu.RLock()
+	defer a.sess.mu.RUnlock()
+	return a.sess.session.Id
+}
+
+// markReconnecting records that calls are failing because the transport or the terminal went away.
+func (a *MT4Account) markReconnecting(cause error) {
+	a.transition(StateConnected, StateReconnecting, cause)
+}
+
+// markConnected records that a call succeeded again after StateReconnecting.
+func (a *MT4Account) markConnected() {
+	if a.State() == StateReconnecting {
+		a.transition(StateReconnecting, StateConnected, nil)
+	}
+}
@@ -0,0 +1,183 @@
+package mt4_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// nextChange receives one StateChange or fails after a second.
+func nextChange(t *testing.T, ch <-chan mt4.StateChange) mt4.StateChange {
+	t.Helper()
+	select {
+	case c, ok := <-ch:
+		if !ok {
+			t.Fatal("StateChanges closed")
+		}
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("no state change")
+	}
+	return mt4.StateChange{}
+}
+
+// expectClosed fails unless ch is drained and closed within a second.
+func expectClosed(t *testing.T, ch <-chan mt4.StateChange) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("StateChanges not closed")
+		}
+	}
+}
+
+func TestSessionStateString(t *testing.T) {
+	for state, want := range map[mt4.SessionState]string{
+		mt4.StateDisconnected: "disconnected",
+		mt4.StateConnecting:   "connecting",
+		mt4.StateConnected:    "connected",
+		mt4.StateReconnecting: "reconnecting",
+		mt4.StateClosed:       "closed",
+		mt4.SessionState(42):  "unknown",
+	} {
+		if got := state.String(); got != want {
+			t.Errorf("%d.String() = %q, want %q", state, got, want)
+		}
+	}
+}
+
+func TestConnectTransitions(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	account, err := mt4.NewMT4Account(100000, "", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	if s := account.State(); s != mt4.StateDisconnected {
+		t.Fatalf("initial state = %v", s)
+	}
+	changes := account.StateChanges()
+	if err := account.ConnectByHostPort(testContext(t), "mt4test", 443, "EURUSD", true, 30); err != nil {
+		t.Fatalf("ConnectByHostPort: %v", err)
+	}
+
+	for _, want := range []mt4.SessionState{mt4.StateConnecting, mt4.StateConnected} {
+		if c := nextChange(t, changes); c.To != want || c.Err != nil {
+			t.Fatalf("change = %v → %v (%v), want → %v", c.From, c.To, c.Err, want)
+		}
+	}
+	sess := account.Session()
+	if sess.Host != "mt4test" || sess.BaseChartSymbol != "EURUSD" || sess.ConnectedAt.IsZero() || sess.Id.String() == "" {
+		t.Errorf("session = %+v", sess)
+	}
+}
+
+func TestFailedConnectReturnsToDisconnected(t *testing.T) {
+	srv := mt4test.NewServer()
+	defer srv.Close()
+	srv.SetCredentials(100000, "secret")
+	account, err := mt4.NewMT4Account(100000, "wrong", srv.AccountOptions()...)
+	if err != nil {
+		t.Fatalf("NewMT4Account: %v", err)
+	}
+	defer account.Disconnect()
+
+	changes := account.StateChanges()
+	if err := account.ConnectByHostPort(testContext(t), "mt4test", 443, "EURUSD", true, 30); err == nil {
+		t.Fatal("ConnectByHostPort accepted wrong credentials")
+	}
+	nextChange(t, changes) // → connecting
+	if c := nextChange(t, changes); c.To != mt4.StateDisconnected || c.Err == nil {
+		t.Errorf("change = %v → %v (%v), want → disconnected with a cause", c.From, c.To, c.Err)
+	}
+}
+
+func TestTransientFailuresReportReconnecting(t *testing.T) {
+	srv, account := newTestAccount(t)
+	changes := account.StateChanges()
+	srv.FailNext("Quote", 2, errUnavailable)
+
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	if c := nextChange(t, changes); c.From != mt4.StateConnected || c.To != mt4.StateReconnecting || c.Err == nil {
+		t.Errorf("first change = %v → %v (%v)", c.From, c.To, c.Err)
+	}
+	if c := nextChange(t, changes); c.To != mt4.StateConnected {
+		t.Errorf("second change = %v → %v", c.From, c.To)
+	}
+	if s := account.State(); s != mt4.StateConnected {
+		t.Errorf("state = %v", s)
+	}
+}
+
+func TestSlowSubscriberLosesOldestChanges(t *testing.T) {
+	srv, account := newTestAccount(t)
+	changes := account.StateChanges()
+
+	// Each recovered failure is two transitions: 20 in total, the buffer holds 16.
+	for i := 0; i < 10; i++ {
+		srv.FailNext("Quote", 1, errUnavailable)
+		if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+			t.Fatalf("Quote: %v", err)
+		}
+	}
+	if n := len(changes); n != 16 {
+		t.Fatalf("buffered changes = %d, want 16", n)
+	}
+	var last mt4.StateChange
+	for len(changes) > 0 {
+		last = <-changes
+	}
+	if last.To != mt4.StateConnected {
+		t.Errorf("newest change = → %v, want the final → connected", last.To)
+	}
+}
+
+func TestDisconnectClosesAccount(t *testing.T) {
+	_, account := newTestAccount(t)
+	first, second := account.StateChanges(), account.StateChanges()
+
+	if err := account.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	// Logout ends the server session first (→ disconnected), then the account closes.
+	var last mt4.StateChange
+	for c := range first {
+		last = c
+	}
+	if last.To != mt4.StateClosed {
+		t.Errorf("last change = → %v, want → closed", last.To)
+	}
+	expectClosed(t, second)
+	expectClosed(t, account.StateChanges())
+
+	if s := account.State(); s != mt4.StateClosed {
+		t.Errorf("state = %v", s)
+	}
+	if err := account.ConnectByHostPort(testContext(t), "mt4test", 443, "EURUSD", true, 30); !errors.Is(err, mt4.ErrAccountClosed) {
+		t.Errorf("connect after Disconnect = %v, want ErrAccountClosed", err)
+	}
+	if err := account.Disconnect(); err != nil {
+		t.Errorf("second Disconnect: %v", err)
+	}
+}
+
+func TestNilAccountState(t *testing.T) {
+	var account *mt4.MT4Account
+	if s := account.State(); s != mt4.StateClosed {
+		t.Errorf("nil State() = %v", s)
+	}
+	expectClosed(t, account.StateChanges())
+}
@@ -0,0 +1,240 @@
+package mt4
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//=== 📂 Stream stall watchdog ===
+//
+// A half-open TCP connection can leave a stream silent for minutes: no EOF, no Unavailable,
+// just nothing. A StallPolicy puts a watchdog on a stream: when no message arrives for
+// Timeout (while Active says data is expected), the stream is cancelled and re-opened like
+// after a transport error. Each stall is reported to OnStall, the Logger and the
+// StreamStalls channels; it leaves the account's session state alone. When retries are
+// exhausted the stream ends with an error wrapping ErrStreamStalled.
+//
+// Defaults:
+//
+//	OnOpenedOrdersProfit / OnOpenedOrdersTickets  3 × intervalMs
+//	OnSymbolTick                                  MT4Account.TickStallPolicy (nil = none)
+//	other streams                                 none
+//
+// ContextWithStallPolicy overrides them for one stream (Timeout < 0 disables the watchdog).
+
+// StallPolicy configures the inactivity watchdog of a stream.
+type StallPolicy struct {
+	// Timeout is the longest accepted silence (<= 0 = no watchdog).
+	Timeout time.Duration
+
+	// Active reports whether data is expected at t, e.g. ForexMarketOpen for tick streams
+	// (nil = always). While it is false the silence is not counted.
+	Active func(t time.Time) bool
+
+	// OnStall is called (from the stream goroutine) before a stalled stream is re-opened.
+	OnStall func(StreamStall)
+}
+
+// StreamStall describes one detected stall.
+type StreamStall struct {
+	// Stream is the request type of the stalled stream (e.g. "OnSymbolTickRequest").
+	Stream string
+
+	// Silence is how long the stream received nothing.
+	Silence time.Duration
+
+	// Attempt is the reconnect attempt the re-open counts as (1-based).
+	Attempt int
+
+	// Time is when the stall was detected.
+	Time time.Time
+}
+
+// ForexMarketOpen reports whether the FX market is open at t: from Sunday 22:00 to
+// Friday 22:00 UTC. Use it as StallPolicy.Active for tick streams.
+func ForexMarketOpen(t time.Time) bool {
+	t = t.UTC()
+	switch t.Weekday() {
+	case time.Saturday:
+		return false
+	case time.Sunday:
+		return t.Hour() >= 22
+	case time.Friday:
+		return t.Hour() < 22
+	}
+	return true
+}
+
+// StreamStalls returns a channel receiving every subsequent stall of the account's streams,
+// including those the streams recover from. Each call creates an independent subscription;
+// the channel is closed with the account (immediately, if it is already closed). A
+// subscriber that does not keep up loses its oldest undelivered stalls.
+//
+// Example:
+//
+//	go func() {
+//	    for s := range account.StreamStalls() {
+//	        log.Printf("mt4: %s silent for %v (stall %d)", s.Stream, s.Silence, s.Attempt)
+//	    }
+//	}()
+func (a *MT4Account) StreamStalls() <-chan StreamStall {
+	ch := make(chan StreamStall, stateChangesBuffer)
+	if a == nil {
+		close(ch)
+		return ch
+	}
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	if a.sess.state == StateClosed {
+		close(ch)
+		return ch
+	}
+	a.sess.stalls = append(a.sess.stalls, ch)
+	return ch
+}
+
+// publishStall delivers stall to every StreamStalls subscriber.
+func (a *MT4Account) publishStall(stall StreamStall) {
+	a.sess.mu.Lock()
+	defer a.sess.mu.Unlock()
+	for _, ch := range a.sess.stalls {
+		for {
+			select {
+			case ch <- stall:
+			default:
+				// Full: drop the oldest stall and try again.
+				select {
+				case <-ch:
+				default:
+				}
+				continue
+			}
+			break
+		}
+	}
+}
+
+// streamName returns the type name of a stream request (without the pointer).
+func streamName(request any) string {
+	t := reflect.TypeOf(request)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+type stallPolicyCtxKey struct{}
+
+// ContextWithStallPolicy returns a context that sets the stall watchdog of streams opened with it.
+func ContextWithStallPolicy(ctx context.Context, p *StallPolicy) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, stallPolicyCtxKey{}, p)
+}
+
+// StallPolicyFromContext returns the policy set by ContextWithStallPolicy, if any.
+func StallPolicyFromContext(ctx context.Context) (*StallPolicy, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(stallPolicyCtxKey{}).(*StallPolicy)
+	return p, ok && p != nil
+}
+
+// withDefaultStallPolicy sets p as the stall policy of ctx unless the caller set one.
+func withDefaultStallPolicy(ctx context.Context, p *StallPolicy) context.Context {
+	if _, ok := StallPolicyFromContext(ctx); ok || p == nil {
+		return ctx
+	}
+	return ContextWithStallPolicy(ctx, p)
+}
+
+// intervalStallPolicy is the default watchdog of interval-driven streams: 3 × intervalMs.
+func intervalStallPolicy(intervalMs int32) *StallPolicy {
+	if intervalMs <= 0 {
+		return nil
+	}
+	return &StallPolicy{Timeout: 3 * time.Duration(intervalMs) * time.Millisecond}
+}
+
+// stallWatchdog cancels one stream attempt after Timeout of (active) silence.
+type stallWatchdog struct {
+	policy StallPolicy
+	cancel context.CancelFunc
+
+	last    atomic.Int64 // unix nanos of the last message (or of the last inactive check)
+	stalled atomic.Bool
+
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+// startStallWatchdog starts a watchdog for one stream attempt; it returns nil when p has no timeout.
+func startStallWatchdog(p *StallPolicy, cancel context.CancelFunc) *stallWatchdog {
+	if p == nil || p.Timeout <= 0 {
+		return nil
+	}
+	w := &stallWatchdog{policy: *p, cancel: cancel}
+	w.last.Store(time.Now().UnixNano())
+	w.mu.Lock()
+	w.timer = time.AfterFunc(p.Timeout, w.check)
+	w.mu.Unlock()
+	return w
+}
+
+// kick records stream activity.
+func (w *stallWatchdog) kick() {
+	if w != nil {
+		w.last.Store(time.Now().UnixNano())
+	}
+}
+
+// check fires the watchdog or re-arms it for the rest of the window.
+func (w *stallWatchdog) check() {
+	now := time.Now()
+	silence := now.Sub(time.Unix(0, w.last.Load()))
+	next := w.policy.Timeout - silence
+	if next <= 0 {
+		if w.policy.Active == nil || w.policy.Active(now) {
+			w.stalled.Store(true)
+			w.cancel()
+			return
+		}
+		// Nothing expected now: start a fresh window.
+		w.last.Store(now.UnixNano())
+		next = w.policy.Timeout
+	}
+	w.mu.Lock()
+	if w.timer != nil {
+		w.timer.Reset(next)
+	}
+	w.mu.Unlock()
+}
+
+// silence returns the time since the last activity.
+func (w *stallWatchdog) silence() time.Duration {
+	return time.Since(time.Unix(0, w.last.Load()))
+}
+
+// fired reports whether the watchdog cancelled the stream.
+func (w *stallWatchdog) fired() bool {
+	return w != nil && w.stalled.Load()
+}
+
+// stop disarms the watchdog.
+func (w *stallWatchdog) stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.timer.Stop()
+	w.timer = nil
+	w.mu.Unlock()
+}
@@ -0,0 +1,197 @@
+package mt4_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+func TestForexMarketOpen(t *testing.T) {
+	tests := []struct {
+		at   string
+		want bool
+	}{
+		{"2026-03-06T21:59:00Z", true},       // Friday
+		{"2026-03-06T22:00:00Z", false},      // Friday close
+		{"2026-03-07T12:00:00Z", false},      // Saturday
+		{"2026-03-08T21:59:00Z", false},      // Sunday
+		{"2026-03-08T22:00:00Z", true},       // Sunday open
+		{"2026-03-10T03:00:00Z", true},       // Tuesday
+		{"2026-03-09T00:30:00+03:00", false}, // Monday locally, Sunday 21:30 UTC
+	}
+	for _, tt := range tests {
+		at, err := time.Parse(time.RFC3339, tt.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := mt4.ForexMarketOpen(at); got != tt.want {
+			t.Errorf("ForexMarketOpen(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestStalledStreamIsReopened(t *testing.T) {
+	srv, account := newTestAccount(t, mt4.WithRetryPolicy(&mt4.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	changes := account.StateChanges()
+
+	var (
+		mu     sync.Mutex
+		stalls []mt4.StreamStall
+	)
+	ctx := mt4.ContextWithStallPolicy(testContext(t), &mt4.StallPolicy{
+		Timeout: 50 * time.Millisecond,
+		OnStall: func(s mt4.StreamStall) {
+			mu.Lock()
+			stalls = append(stalls, s)
+			mu.Unlock()
+		},
+	})
+	dataCh, errCh := account.OnSymbolTick(ctx, []string{"EURUSD"})
+
+	// No ticks: every window stalls, and the third stall in a row ends the stream.
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, mt4.ErrStreamStalled) {
+			t.Fatalf("stream error = %v, want ErrStreamStalled", err)
+		}
+	case d := <-dataCh:
+		t.Fatalf("unexpected tick %v", d)
+	case <-time.After(2 * time.Second):
+		t.Fatal("stalled stream never gave up")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(stalls) != 2 || stalls[0].Attempt != 1 || stalls[1].Attempt != 2 || stalls[0].Silence < 50*time.Millisecond {
+		t.Errorf("stalls = %+v", stalls)
+	}
+	if got := srv.Calls("OnSymbolTick"); got != 3 {
+		t.Errorf("OnSymbolTick streams = %d, want 3", got)
+	}
+
+	// A stall is local to its stream: the session is untouched.
+	if s := account.State(); s != mt4.StateConnected {
+		t.Errorf("state = %v, want connected", s)
+	}
+	select {
+	case ch := <-changes:
+		t.Errorf("state change %+v on a stall", ch)
+	default:
+	}
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Errorf("Quote after the stalls: %v", err)
+	}
+}
+
+func TestStreamStallsChannel(t *testing.T) {
+	_, account := newTestAccount(t, mt4.WithRetryPolicy(&mt4.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	stallCh := account.StreamStalls()
+
+	ctx := mt4.ContextWithStallPolicy(testContext(t), &mt4.StallPolicy{Timeout: 50 * time.Millisecond})
+	_, errCh := account.OnSymbolTick(ctx, []string{"EURUSD"})
+
+	// The first stall is recovered from: it appears on StreamStalls, not on errCh.
+	select {
+	case s := <-stallCh:
+		if s.Stream != "OnSymbolTickRequest" || s.Attempt != 1 || s.Silence < 50*time.Millisecond || s.Time.IsZero() {
+			t.Errorf("stall = %+v", s)
+		}
+	case err := <-errCh:
+		t.Fatalf("stream ended before the first stall was published: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no stall published")
+	}
+
+	if err := <-errCh; !errors.Is(err, mt4.ErrStreamStalled) {
+		t.Fatalf("stream error = %v, want ErrStreamStalled", err)
+	}
+	for _, want := range []int{2, 3} {
+		select {
+		case s := <-stallCh:
+			if s.Attempt != want {
+				t.Errorf("stall %+v, want attempt %d", s, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("stall %d not published", want)
+		}
+	}
+
+	// The channel closes with the account.
+	if err := account.Disconnect(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-stallCh:
+		if ok {
+			t.Error("stall after Disconnect")
+		}
+	case <-time.After(time.Second):
+		t.Error("StreamStalls channel not closed by Disconnect")
+	}
+	if _, ok := <-account.StreamStalls(); ok {
+		t.Error("StreamStalls of a closed account is open")
+	}
+}
+
+func TestStallCounterResetsOnData(t *testing.T) {
+	srv, account := newTestAccount(t, mt4.WithRetryPolicy(&mt4.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	var stalled sync.WaitGroup
+	stalled.Add(1)
+	var once sync.Once
+	ctx := mt4.ContextWithStallPolicy(testContext(t), &mt4.StallPolicy{
+		Timeout: 100 * time.Millisecond,
+		OnStall: func(mt4.StreamStall) { once.Do(stalled.Done) },
+	})
+	dataCh, errCh := account.OnSymbolTick(ctx, []string{"EURUSD"})
+	stalled.Wait()
+
+	// A tick after the first stall resets the count: the stream keeps going past MaxAttempts.
+	receive := func(bid float64) {
+		t.Helper()
+		deadline := time.After(2 * time.Second)
+		for {
+			srv.PushTick("EURUSD", bid, bid+0.0001)
+			select {
+			case d := <-dataCh:
+				if d.GetSymbolTick().GetBid() == bid {
+					return
+				}
+			case err := <-errCh:
+				t.Fatalf("stream ended: %v", err)
+			case <-deadline:
+				t.Fatalf("no tick at %v", bid)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	receive(1.2)
+	time.Sleep(130 * time.Millisecond) // one more stall; the next one would end the stream
+	receive(1.3)
+	if s := account.State(); s != mt4.StateConnected {
+		t.Errorf("state = %v", s)
+	}
+}
+
+func TestStallWatchdogInactive(t *testing.T) {
+	srv, account := newTestAccount(t)
+	var stalls atomic.Int32
+	ctx := mt4.ContextWithStallPolicy(testContext(t), &mt4.StallPolicy{
+		Timeout: 20 * time.Millisecond,
+		Active:  func(time.Time) bool { return false },
+		OnStall: func(mt4.StreamStall) { stalls.Add(1) },
+	})
+	_, errCh := account.OnSymbolTick(ctx, []string{"EURUSD"})
+
+	select {
+	case err := <-errCh:
+		t.Fatalf("stream ended: %v", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+	if got := srv.Calls("OnSymbolTick"); got != 1 || stalls.Load() != 0 {
+		t.Errorf("streams = %d, stalls = %d while inactive", got, stalls.Load())
+	}
+}
@@ -0,0 +1,594 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Stop manager ===
+//
+// MT4 trailing stops run inside the desktop terminal only; API sessions have none. A
+// StopManager moves stop losses client-side: it follows the ticks of the managed symbols
+// (TickHub) and the opened orders (OrderCache), and calls OrderModify when a StopRule gives a
+// better stop than the current one:
+//
+//	break-even     at BreakEvenAt points of profit: open price + LockIn points
+//	trailing       TrailDistance points behind the market, once TrailStart points in profit
+//	step trailing  the same, moving in whole TrailStep increments
+//	ATR trailing   ATR.Multiplier × ATR(Period) of the Timeframe bars behind the market
+//
+// Stops only ever move in the position's favour. A stop closer to the market than
+// TradeStopsLevel is pulled back to the level, and nothing is sent while the market is within
+// TradeFreezeLevel of the current SL or TP. Modifications are rate-limited per ticket
+// (MinModifyInterval) and per account (MaxModifiesPerMinute).
+//
+// Rules apply per ticket (SetTicketRule) or per magic number (SetMagicRule); a ticket rule
+// wins. Only market positions are managed.
+
+// DefaultStopModifyInterval is the per-ticket modification interval used when
+// StopManagerConfig leaves MinModifyInterval zero.
+const DefaultStopModifyInterval = time.Second
+
+// StopRule describes how the stop loss of a position moves. Distances are in points;
+// zero fields are off.
+type StopRule struct {
+	// BreakEvenAt moves the stop to the open price (plus LockIn points of profit) once the
+	// position is BreakEvenAt points in profit.
+	BreakEvenAt float64
+	LockIn      float64
+
+	// TrailDistance trails the stop this many points behind the market (Bid for buys, Ask for sells).
+	TrailDistance float64
+
+	// TrailStart delays trailing until the position is this many points in profit.
+	TrailStart float64
+
+	// TrailStep moves a trailing stop only in whole steps of this many points.
+	TrailStep float64
+
+	// ATR trails by a multiple of the Average True Range instead of TrailDistance.
+	ATR *ATRTrail
+}
+
+// ATRTrail configures ATR trailing.
+type ATRTrail struct {
+	// Timeframe of the bars the ATR is computed on.
+	Timeframe pb.ENUM_QUOTE_HISTORY_TIMEFRAME
+
+	// Period is the number of bars averaged (0 = 14).
+	Period int
+
+	// Multiplier scales the ATR into the trailing distance (0 = 1).
+	Multiplier float64
+}
+
+// StopReason names the rule behind a StopMove.
+type StopReason string
+
+const (
+	StopBreakEven   StopReason = "break-even"
+	StopTrailing    StopReason = "trailing"
+	StopATRTrailing StopReason = "atr trailing"
+)
+
+// StopMove reports one OrderModify of a StopManager.
+type StopMove struct {
+	Ticket int32
+	Symbol string
+	Reason StopReason
+
+	// From and To are the old (0 = none) and the new stop loss; Price is the market price
+	// (Bid for buys, Ask for sells) that triggered the move.
+	From, To float64
+	Price    float64
+	Time     time.Time
+
+	// Err is the OrderModify error (nil = moved).
+	Err error
+}
+
+// StopManagerConfig configures NewStopManager.
+type StopManagerConfig struct {
+	// MinModifyInterval is the shortest time between two modifications of one ticket
+	// (0 = DefaultStopModifyInterval).
+	MinModifyInterval time.Duration
+
+	// MaxModifiesPerMinute caps the modifications of all tickets (0 = no cap).
+	MaxModifiesPerMinute int
+
+	// OnMove is called (from the manager goroutine) after every modification attempt.
+	OnMove func(StopMove)
+}
+
+// StopManager moves stop losses by rule. It is safe for concurrent use.
+type StopManager struct {
+	account *MT4Account
+	cfg     StopManagerConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	wake   chan struct{}
+
+	mu    sync.Mutex
+	byTkt map[int32]StopRule
+	byMag map[int32]StopRule
+
+	// Owned by the run goroutine.
+	stops map[int32]*stopState
+	atr   map[atrKey]atrEntry
+	sent  []time.Time // modifications of the last minute
+}
+
+// stopState is what the manager remembers of a ticket.
+type stopState struct {
+	sl       float64 // last stop loss sent (the cache may lag behind)
+	modified time.Time
+}
+
+type atrKey struct {
+	symbol    string
+	timeframe pb.ENUM_QUOTE_HISTORY_TIMEFRAME
+	period    int
+}
+
+type atrEntry struct {
+	value float64
+	err   error
+	at    time.Time
+}
+
+// NewStopManager starts a manager for account. It uses the account's OrderCache when one is
+// attached, or runs a detached one, and subscribes the symbols of managed positions on the
+// account's TickHub. A position is evaluated on the ticks of its symbol; symbols not followed
+// yet are picked up within a second.
+//
+// Parameters:
+//   - ctx: Lifetime of the manager.
+//   - account: Connected account.
+//   - cfg: Rate limits and the OnMove callback (zero value = defaults).
+//
+// Returns:
+//   - The running manager (without rules: add them with SetTicketRule / SetMagicRule).
+//   - ErrNotConnected, or the error of the OrderCache bootstrap.
+//
+// Example:
+//
+//	sm, err := mt4.NewStopManager(ctx, account, mt4.StopManagerConfig{
+//	    OnMove: func(m mt4.StopMove) { log.Printf("#%d %s: SL %.5f → %.5f (%v)", m.Ticket, m.Reason, m.From, m.To, m.Err) },
+//	})
+//	if err != nil { return err }
+//	defer sm.Close()
+//	sm.SetMagicRule(42, mt4.StopRule{BreakEvenAt: 150, LockIn: 10, TrailDistance: 200, TrailStart: 300})
+func NewStopManager(ctx context.Context, account *MT4Account, cfg StopManagerConfig) (*StopManager, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if account == nil {
+		return nil, errors.New("NewStopManager: nil account")
+	}
+	if !account.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if cfg.MinModifyInterval <= 0 {
+		cfg.MinModifyInterval = DefaultStopModifyInterval
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	cache := account.orderCache.Load()
+	if cache == nil || !cache.running() {
+		var err error
+		cache, err = NewOrderCache(runCtx, account, OrderCacheConfig{Detached: true})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	m := &StopManager{
+		account: account,
+		cfg:     cfg,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+		byTkt:   make(map[int32]StopRule),
+		byMag:   make(map[int32]StopRule),
+		stops:   make(map[int32]*stopState),
+		atr:     make(map[atrKey]atrEntry),
+	}
+	go m.run(runCtx, cache)
+	return m, nil
+}
+
+// SetTicketRule manages the position ticket with r (replacing its magic number rule).
+func (m *StopManager) SetTicketRule(ticket int32, r StopRule) {
+	m.mu.Lock()
+	m.byTkt[ticket] = r
+	m.mu.Unlock()
+	m.notify()
+}
+
+// SetMagicRule manages every position with the magic number with r.
+func (m *StopManager) SetMagicRule(magic int32, r StopRule) {
+	m.mu.Lock()
+	m.byMag[magic] = r
+	m.mu.Unlock()
+	m.notify()
+}
+
+// ClearTicketRule stops managing ticket by its own rule (a magic number rule may still apply).
+func (m *StopManager) ClearTicketRule(ticket int32) {
+	m.mu.Lock()
+	delete(m.byTkt, ticket)
+	m.mu.Unlock()
+	m.notify()
+}
+
+// ClearMagicRule stops managing the positions of the magic number.
+func (m *StopManager) ClearMagicRule(magic int32) {
+	m.mu.Lock()
+	delete(m.byMag, magic)
+	m.mu.Unlock()
+	m.notify()
+}
+
+// Done is closed when the manager stops.
+func (m *StopManager) Done() <-chan struct{} {
+	return m.done
+}
+
+// Close stops the manager and waits for a running modification. Safe to call more than
+// once; do not call it from OnMove.
+func (m *StopManager) Close() {
+	m.cancel()
+	<-m.done
+}
+
+// notify wakes run to re-read the rules.
+func (m *StopManager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ruleFor returns the rule managing o, if any.
+func (m *StopManager) ruleFor(o *pb.OpenedOrderInfo) (StopRule, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r, ok := m.byTkt[o.GetTicket()]; ok {
+		return r, true
+	}
+	r, ok := m.byMag[o.GetMagicNumber()]
+	return r, ok
+}
+
+// managed returns the managed market positions of cache by symbol.
+func (m *StopManager) managed(cache *OrderCache) map[string][]*pb.OpenedOrderInfo {
+	out := make(map[string][]*pb.OpenedOrderInfo)
+	for _, o := range cache.Orders(OrderFilter{Types: []pb.OpenedOrderType{
+		pb.OpenedOrderType_OO_OP_BUY, pb.OpenedOrderType_OO_OP_SELL,
+	}}) {
+		if _, ok := m.ruleFor(o); ok {
+			out[o.GetSymbol()] = append(out[o.GetSymbol()], o)
+		}
+	}
+	return out
+}
+
+// run follows the ticks of the managed symbols until ctx is done or the cache stops.
+func (m *StopManager) run(ctx context.Context, cache *OrderCache) {
+	defer close(m.done)
+	sub := m.account.TickHub().Subscribe()
+	defer sub.Close()
+
+	resync := func() {
+		managed := m.managed(cache)
+		have := make(map[string]bool)
+		for _, s := range sub.Symbols() {
+			have[s] = true
+			if _, ok := managed[s]; !ok {
+				sub.Unsubscribe(s)
+			}
+		}
+		for s := range managed {
+			if !have[s] {
+				// The tick that made the position eligible may predate the subscription.
+				sub.Subscribe(s)
+				if t := m.quoteTick(ctx, s); t != nil {
+					m.onTick(ctx, t, managed[s])
+				}
+			}
+		}
+		for ticket := range m.stops {
+			if _, ok := cache.OrderSelect(ticket); !ok {
+				delete(m.stops, ticket)
+			}
+		}
+	}
+	resync()
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-cache.Done():
+			if ctx.Err() == nil {
+				m.account.logf("mt4: stop manager: order cache stopped")
+			}
+			return
+		case tick, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			m.onTick(ctx, tick, m.managed(cache)[tick.GetSymbol()])
+		case <-m.wake:
+			resync()
+		case <-t.C:
+			resync()
+		}
+	}
+}
+
+// quoteTick returns the current quote of symbol as a tick (nil on error).
+func (m *StopManager) quoteTick(ctx context.Context, symbol string) *pb.OnSymbolMqlTickInfo {
+	q, err := m.account.Quote(ctx, symbol)
+	if err != nil {
+		if ctx.Err() == nil {
+			m.account.logf("mt4: stop manager: %s: %v", symbol, err)
+		}
+		return nil
+	}
+	return &pb.OnSymbolMqlTickInfo{Symbol: symbol, Bid: q.GetBid(), Ask: q.GetAsk(), Time: q.GetDateTime()}
+}
+
+// onTick moves the stops of orders (positions of the tick's symbol) where their rules say so.
+func (m *StopManager) onTick(ctx context.Context, tick *pb.OnSymbolMqlTickInfo, orders []*pb.OpenedOrderInfo) {
+	if len(orders) == 0 {
+		return
+	}
+	a := m.account
+	params, err := a.symbolSpecs.get(ctx, a, tick.GetSymbol(), DefaultSymbolParamsTTL)
+	if err != nil {
+		a.logf("mt4: stop manager: %s: %v", tick.GetSymbol(), err)
+		return
+	}
+	for _, o := range orders {
+		r, ok := m.ruleFor(o)
+		if !ok || ctx.Err() != nil {
+			continue
+		}
+		st := m.stops[o.GetTicket()]
+		if st == nil {
+			st = &stopState{}
+			m.stops[o.GetTicket()] = st
+		}
+		cur := o.GetStopLoss()
+		if st.sl != 0 && (cur == 0 || better(isBuyOrderType(o.GetOrderType()), st.sl, cur)) {
+			cur = st.sl // our last move is not in the cache yet
+		}
+		to, reason, price, ok := m.target(ctx, params, tick, o, r, cur)
+		if !ok || !m.allow(st, time.Now()) {
+			continue
+		}
+		m.modify(ctx, o, st, cur, to, price, reason)
+	}
+}
+
+// target returns the stop loss r gives o at tick, if it improves cur and may be sent.
+func (m *StopManager) target(
+	ctx context.Context,
+	params *pb.SymbolParamsManyInfo,
+	tick *pb.OnSymbolMqlTickInfo,
+	o *pb.OpenedOrderInfo,
+	r StopRule,
+	cur float64,
+) (to float64, reason StopReason, price float64, ok bool) {
+	buy := isBuyOrderType(o.GetOrderType())
+	pt := symbolPoint(params)
+	dir := 1.0
+	price = tick.GetBid()
+	if !buy {
+		dir, price = -1, tick.GetAsk()
+	}
+	open := o.GetOpenPrice()
+	profit := (price - open) * dir / pt // points
+	improves := func(sl float64) bool {
+		return cur == 0 || (sl-cur)*dir >= priceTick(params)-pt*1e-3
+	}
+
+	// Break-even.
+	if r.BreakEvenAt > 0 && profit >= r.BreakEvenAt {
+		if be := open + r.LockIn*pt*dir; improves(be) {
+			to, reason, ok = be, StopBreakEven, true
+		}
+	}
+
+	// Trailing.
+	dist, trailReason := r.TrailDistance*pt, StopTrailing
+	if r.ATR != nil {
+		atr, err := m.atrFor(ctx, o.GetSymbol(), r.ATR)
+		if err != nil {
+			dist = 0 // logged by atrFor; break-even still applies
+		} else {
+			mult := r.ATR.Multiplier
+			if mult <= 0 {
+				mult = 1
+			}
+			dist, trailReason = atr*mult, StopATRTrailing
+		}
+	}
+	if dist > 0 && profit >= r.TrailStart {
+		trail := price - dist*dir
+		if step := r.TrailStep * pt; step > 0 && cur != 0 {
+			trail = cur + math.Floor((trail-cur)*dir/step+1e-9)*step*dir
+		}
+		if improves(trail) && (!ok || better(buy, trail, to)) {
+			to, reason, ok = trail, trailReason, true
+		}
+	}
+	if !ok {
+		return 0, "", price, false
+	}
+
+	// Broker distances: pull back to TradeStopsLevel, skip inside TradeFreezeLevel.
+	if lvl := float64(params.GetTradeStopsLevel()) * pt; (price-to)*dir < lvl {
+		to = price - lvl*dir
+	}
+	to = NormalizePrice(params, to)
+	if !improves(to) {
+		return 0, "", price, false
+	}
+	if freeze := float64(params.GetTradeFreezeLevel()) * pt; freeze > 0 {
+		if sl := o.GetStopLoss(); sl != 0 && math.Abs(price-sl) <= freeze {
+			return 0, "", price, false
+		}
+		if tp := o.GetTakeProfit(); tp != 0 && math.Abs(tp-price) <= freeze {
+			return 0, "", price, false
+		}
+	}
+	return to, reason, price, true
+}
+
+// allow applies MinModifyInterval and MaxModifiesPerMinute.
+func (m *StopManager) allow(st *stopState, now time.Time) bool {
+	if now.Sub(st.modified) < m.cfg.MinModifyInterval {
+		return false
+	}
+	if limit := m.cfg.MaxModifiesPerMinute; limit > 0 {
+		cut := 0
+		for cut < len(m.sent) && now.Sub(m.sent[cut]) >= time.Minute {
+			cut++
+		}
+		m.sent = m.sent[cut:]
+		if len(m.sent) >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// modify sends the new stop loss (keeping the take profit) and reports it.
+func (m *StopManager) modify(ctx context.Context, o *pb.OpenedOrderInfo, st *stopState, from, to, price float64, reason StopReason) {
+	now := time.Now()
+	st.modified = now
+	if m.cfg.MaxModifiesPerMinute > 0 {
+		m.sent = append(m.sent, now)
+	}
+	var tp *float64
+	if v := o.GetTakeProfit(); v != 0 {
+		tp = &v
+	}
+	_, err := m.account.OrderModify(ctx, o.GetTicket(), nil, &to, tp, nil)
+	if err == nil {
+		st.sl = to
+	} else if ctx.Err() == nil {
+		m.account.logf("mt4: stop manager: #%d %s to %s: %v", o.GetTicket(), reason, formatFloat(to), err)
+	}
+	if m.cfg.OnMove != nil && ctx.Err() == nil {
+		m.cfg.OnMove(StopMove{
+			Ticket: o.GetTicket(), Symbol: o.GetSymbol(), Reason: reason,
+			From: from, To: to, Price: price, Time: now, Err: err,
+		})
+	}
+}
+
+// atrFor returns the cached ATR of t for symbol, refreshed once per bar (errors: per minute).
+func (m *StopManager) atrFor(ctx context.Context, symbol string, t *ATRTrail) (float64, error) {
+	period := t.Period
+	if period <= 0 {
+		period = 14
+	}
+	key := atrKey{symbol, t.Timeframe, period}
+	e, ok := m.atr[key]
+	ttl := TimeframeDuration(t.Timeframe)
+	if e.err != nil {
+		ttl = time.Minute
+	}
+	if ok && time.Since(e.at) < ttl {
+		return e.value, e.err
+	}
+	v, err := m.account.ATR(ctx, symbol, t.Timeframe, period)
+	if err != nil && ctx.Err() == nil {
+		m.account.logf("mt4: stop manager: ATR %s: %v", symbol, err)
+	}
+	m.atr[key] = atrEntry{value: v, err: err, at: time.Now()}
+	return v, err
+}
+
+// better reports whether stop a is better (closer to profit) than b for the position side.
+func better(buy bool, a, b float64) bool {
+	if buy {
+		return a > b
+	}
+	return a < b
+}
+
+// ATR returns the Average True Range of the last period closed bars of symbol: the simple
+// average of max(high, previous close) − min(low, previous close), in price units.
+//
+// Parameters:
+//   - ctx: Context for the QuoteHistory call.
+//   - symbol, timeframe: The bars.
+//   - period: Number of bars averaged.
+//
+// Returns:
+//   - The ATR.
+//   - An error if fewer than period + 1 bars are available, or the QuoteHistory error.
+func (a *MT4Account) ATR(ctx context.Context, symbol string, timeframe pb.ENUM_QUOTE_HISTORY_TIMEFRAME, period int) (float64, error) {
+	if period <= 0 {
+		return 0, errors.New("ATR: period must be positive")
+	}
+	bar := TimeframeDuration(timeframe)
+	to := time.Now()
+	from := to.Add(-time.Duration(3*period+10) * bar) // room for weekends and gaps
+	data, err := a.QuoteHistory(ctx, symbol, timeframe, from, to)
+	if err != nil {
+		return 0, err
+	}
+	bars := data.GetHistoricalQuotes()
+	// The last bar may still be forming.
+	if n := len(bars); n > 0 && bars[n-1].GetTime().AsTime().Add(bar).After(to) {
+		bars = bars[:n-1]
+	}
+	if len(bars) < period+1 {
+		return 0, fmt.Errorf("ATR: %d bars of %s, need %d", len(bars), symbol, period+1)
+	}
+	bars = bars[len(bars)-period-1:]
+	var sum float64
+	for i := 1; i < len(bars); i++ {
+		prev := bars[i-1].GetClose()
+		sum += math.Max(bars[i].GetHigh(), prev) - math.Min(bars[i].GetLow(), prev)
+	}
+	return sum / float64(period), nil
+}
+
+// TimeframeDuration returns the bar length of a QuoteHistory timeframe (MN1 ≈ 30 days).
+func TimeframeDuration(tf pb.ENUM_QUOTE_HISTORY_TIMEFRAME) time.Duration {
+	switch tf {
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_M5:
+		return 5 * time.Minute
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_M15:
+		return 15 * time.Minute
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_M30:
+		return 30 * time.Minute
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_H1:
+		return time.Hour
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_H4:
+		return 4 * time.Hour
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_D1:
+		return 24 * time.Hour
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_W1:
+		return 7 * 24 * time.Hour
+	case pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_MN1:
+		return 30 * 24 * time.Hour
+	default:
+		return time.Minute
+	}
+}
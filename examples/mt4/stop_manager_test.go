@@ -0,0 +1,323 @@
+package mt4_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+func TestATR(t *testing.T) {
+	srv, account := newTestAccount(t)
+	h1 := pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_H1
+	last := time.Now().Truncate(time.Hour).Add(-time.Hour) // the last closed H1 bar
+
+	// bars returns closed H1 bars ending at last from {high, low, close} triples.
+	bars := func(hlc ...[3]float64) []*pb.HistoryQuote {
+		var out []*pb.HistoryQuote
+		for i, b := range hlc {
+			at := last.Add(-time.Duration(len(hlc)-1-i) * time.Hour)
+			out = append(out, &pb.HistoryQuote{Time: timestamppb.New(at), Open: b[2], High: b[0], Low: b[1], Close: b[2]})
+		}
+		return out
+	}
+	forming := &pb.HistoryQuote{Time: timestamppb.New(last.Add(time.Hour)), High: 2, Low: 1, Close: 1.5}
+
+	tests := []struct {
+		name    string
+		bars    []*pb.HistoryQuote
+		period  int
+		want    float64
+		wantErr bool
+	}{
+		{"constant range", bars([3]float64{1.101, 1.100, 1.1005}, [3]float64{1.101, 1.100, 1.1005}, [3]float64{1.101, 1.100, 1.1005}), 2, 0.001, false},
+		{"gap up uses the previous close", bars([3]float64{1.100, 1.099, 1.099}, [3]float64{1.105, 1.104, 1.1045}), 1, 0.006, false},
+		{"gap down uses the previous close", bars([3]float64{1.100, 1.099, 1.100}, [3]float64{1.096, 1.095, 1.095}), 1, 0.005, false},
+		{"last period bars only", bars([3]float64{2, 1, 1.5}, [3]float64{1.101, 1.100, 1.1005}, [3]float64{1.102, 1.100, 1.101}, [3]float64{1.102, 1.101, 1.1015}), 2, 0.0015, false},
+		{"forming bar ignored", append(bars([3]float64{1.101, 1.100, 1.1005}, [3]float64{1.101, 1.100, 1.1005}), forming), 1, 0.001, false},
+		{"too few bars", bars([3]float64{1.101, 1.100, 1.1005}, [3]float64{1.101, 1.100, 1.1005}), 2, 0, true},
+		{"no period", bars([3]float64{1.101, 1.100, 1.1005}), 0, 0, true},
+	}
+	for i, tt := range tests {
+		symbol := fmt.Sprintf("SYM%03d", i)
+		srv.AddSymbol(mt4test.ForexSymbol(symbol, 5), 1.1, 1.1001)
+		srv.AddBars(symbol, tt.bars...)
+		got, err := account.ATR(testContext(t), symbol, h1, tt.period)
+		if (err != nil) != tt.wantErr || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: ATR = %v, %v, want %v (error %v)", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+	if _, err := account.ATR(testContext(t), "XXXYYY", h1, 14); err == nil {
+		t.Error("ATR of an unknown symbol")
+	}
+}
+
+func TestTimeframeDuration(t *testing.T) {
+	tests := []struct {
+		tf   pb.ENUM_QUOTE_HISTORY_TIMEFRAME
+		want time.Duration
+	}{
+		{pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_M1, time.Minute},
+		{pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_M15, 15 * time.Minute},
+		{pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_H4, 4 * time.Hour},
+		{pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_D1, 24 * time.Hour},
+		{pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_W1, 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := mt4.TimeframeDuration(tt.tf); got != tt.want {
+			t.Errorf("TimeframeDuration(%v) = %v, want %v", tt.tf, got, tt.want)
+		}
+	}
+}
+
+// newTestStopManager starts a manager reporting its moves on the returned channel,
+// closed when the test ends.
+func newTestStopManager(t *testing.T, account *mt4.MT4Account, cfg mt4.StopManagerConfig) (*mt4.StopManager, <-chan mt4.StopMove) {
+	t.Helper()
+	moves := make(chan mt4.StopMove, 64)
+	if cfg.MinModifyInterval == 0 {
+		cfg.MinModifyInterval = time.Millisecond
+	}
+	cfg.OnMove = func(m mt4.StopMove) { moves <- m }
+	m, err := mt4.NewStopManager(testContext(t), account, cfg)
+	if err != nil {
+		t.Fatalf("NewStopManager: %v", err)
+	}
+	t.Cleanup(m.Close)
+	return m, moves
+}
+
+// moveAt pushes symbol at bid (one point spread) until the manager reports a move.
+func moveAt(t *testing.T, srv *mt4test.Server, moves <-chan mt4.StopMove, symbol string, bid float64) mt4.StopMove {
+	t.Helper()
+	deadline := time.After(3 * time.Second)
+	for {
+		srv.PushTick(symbol, bid, bid+0.0001)
+		select {
+		case m := <-moves:
+			return m
+		case <-deadline:
+			t.Fatalf("no stop move at %s %v", symbol, bid)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+// noMoveAt pushes symbol at bid for a while and fails on any move.
+func noMoveAt(t *testing.T, srv *mt4test.Server, moves <-chan mt4.StopMove, symbol string, bid float64) {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		srv.PushTick(symbol, bid, bid+0.0001)
+		select {
+		case m := <-moves:
+			t.Fatalf("unexpected move at %v: %+v", bid, m)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
+
+func TestStopManagerBreakEven(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1) // open 1.1001
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	sm.SetTicketRule(ticket, mt4.StopRule{BreakEvenAt: 100, LockIn: 10})
+
+	noMoveAt(t, srv, moves, "EURUSD", 1.1010) // 90 points
+	m := moveAt(t, srv, moves, "EURUSD", 1.1012)
+	if m.Ticket != ticket || m.Reason != mt4.StopBreakEven || m.From != 0 || m.To != 1.1002 || m.Price != 1.1012 || m.Err != nil {
+		t.Errorf("move = %+v", m)
+	}
+	eventually(t, "the stop on the server", func() bool { return srv.Order(ticket).GetStopLoss() == 1.1002 })
+	noMoveAt(t, srv, moves, "EURUSD", 1.1050) // break-even only once
+}
+
+func TestStopManagerTrailing(t *testing.T) {
+	srv, account := newTestAccount(t)
+	long := buy(t, account, "EURUSD", 0.1)                                         // open 1.1001
+	short := send(t, account, "GBPUSD", pb.OrderSendOperationType_OC_OP_SELL, 0.1) // open 1.27
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	sm.SetTicketRule(long, mt4.StopRule{TrailDistance: 50, TrailStart: 100})
+	sm.SetTicketRule(short, mt4.StopRule{TrailDistance: 50})
+
+	noMoveAt(t, srv, moves, "EURUSD", 1.1006) // 50 points: before TrailStart
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1101); m.To != 1.1096 || m.Reason != mt4.StopTrailing {
+		t.Errorf("first trail = %+v", m)
+	}
+	noMoveAt(t, srv, moves, "EURUSD", 1.1099) // never backwards (1.1094)
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1120); m.From != 1.1096 || m.To != 1.1115 {
+		t.Errorf("second trail = %+v", m)
+	}
+
+	// A sell trails above the ask.
+	if m := moveAt(t, srv, moves, "GBPUSD", 1.2600); m.Ticket != short || m.To != 1.2606 || m.Price != 1.2601 {
+		t.Errorf("sell trail = %+v", m)
+	}
+	eventually(t, "the stops on the server", func() bool {
+		return srv.Order(long).GetStopLoss() == 1.1115 && srv.Order(short).GetStopLoss() == 1.2606
+	})
+}
+
+func TestStopManagerTrailStep(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1)
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	sm.SetTicketRule(ticket, mt4.StopRule{TrailDistance: 50, TrailStep: 20})
+
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1100); m.To != 1.1095 {
+		t.Errorf("first trail = %+v", m)
+	}
+	noMoveAt(t, srv, moves, "EURUSD", 1.1101) // 10 points: less than a step
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1103); m.To != 1.1097 {
+		t.Errorf("step = %+v, want one whole step", m)
+	}
+}
+
+func TestStopManagerATRTrailing(t *testing.T) {
+	srv, account := newTestAccount(t)
+	last := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	for i := 0; i < 4; i++ { // ATR(3) = 0.001
+		at := last.Add(-time.Duration(3-i) * time.Hour)
+		srv.AddBars("EURUSD", &pb.HistoryQuote{Time: timestamppb.New(at), Open: 1.1, High: 1.1005, Low: 1.0995, Close: 1.1})
+	}
+	ticket := buy(t, account, "EURUSD", 0.1)
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	sm.SetTicketRule(ticket, mt4.StopRule{ATR: &mt4.ATRTrail{
+		Timeframe: pb.ENUM_QUOTE_HISTORY_TIMEFRAME_QH_PERIOD_H1, Period: 3, Multiplier: 2,
+	}})
+
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1050); m.Reason != mt4.StopATRTrailing || m.To != 1.1030 {
+		t.Errorf("ATR trail = %+v, want 2 × 0.001 behind the bid", m)
+	}
+}
+
+func TestStopManagerBrokerLevels(t *testing.T) {
+	srv, account := newTestAccount(t)
+	eurusd := mt4test.ForexSymbol("EURUSD", 5)
+	eurusd.TradeStopsLevel = 30
+	srv.AddSymbol(eurusd, 1.1, 1.1001)
+	frozen := mt4test.ForexSymbol("GBPUSD", 5)
+	frozen.TradeFreezeLevel = 40
+	srv.AddSymbol(frozen, 1.27, 1.2701)
+
+	ticket := buy(t, account, "EURUSD", 0.1)
+	frozenTicket := buy(t, account, "GBPUSD", 0.1) // open 1.2701
+	if _, err := account.OrderModify(testContext(t), frozenTicket, nil, nil, ptr(1.2750), nil); err != nil {
+		t.Fatal(err)
+	}
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	sm.SetTicketRule(ticket, mt4.StopRule{TrailDistance: 10})
+	sm.SetTicketRule(frozenTicket, mt4.StopRule{TrailDistance: 10})
+
+	// 10 points is inside the 30 point stops level: pulled back to the level.
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1050); m.To != 1.1047 {
+		t.Errorf("move = %+v, want the stop at the stops level", m)
+	}
+	// The take profit at 1.2750 is within 40 points of the bid: frozen.
+	noMoveAt(t, srv, moves, "GBPUSD", 1.2747)
+	if m := moveAt(t, srv, moves, "GBPUSD", 1.2740); m.Ticket != frozenTicket || m.To != 1.2739 {
+		t.Errorf("move outside the freeze level = %+v", m)
+	}
+	if tp := srv.Order(frozenTicket).GetTakeProfit(); tp != 1.2750 {
+		t.Errorf("take profit = %v, want it kept", tp)
+	}
+}
+
+func TestStopManagerRules(t *testing.T) {
+	srv, account := newTestAccount(t)
+	magic := int32(7)
+	data, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, &magic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket := data.GetTicket()
+	unmanaged := buy(t, account, "EURUSD", 0.1)
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+
+	sm.SetMagicRule(magic, mt4.StopRule{TrailDistance: 100})
+	sm.SetTicketRule(ticket, mt4.StopRule{TrailDistance: 50}) // wins over the magic rule
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1100); m.Ticket != ticket || m.To != 1.1095 {
+		t.Errorf("ticket rule move = %+v", m)
+	}
+
+	sm.ClearTicketRule(ticket)
+	noMoveAt(t, srv, moves, "EURUSD", 1.1104) // the magic rule trails 100 points: 1.1094 is worse
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1120); m.To != 1.1110 {
+		t.Errorf("magic rule move = %+v", m)
+	}
+	sm.ClearMagicRule(magic)
+	noMoveAt(t, srv, moves, "EURUSD", 1.1300)
+	if sl := srv.Order(unmanaged).GetStopLoss(); sl != 0 {
+		t.Errorf("unmanaged order moved to %v", sl)
+	}
+}
+
+func TestStopManagerRateLimits(t *testing.T) {
+	srv, account := newTestAccount(t)
+	a, b := buy(t, account, "EURUSD", 0.1), buy(t, account, "EURUSD", 0.1)
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{MaxModifiesPerMinute: 1})
+	sm.SetTicketRule(a, mt4.StopRule{TrailDistance: 50})
+	sm.SetTicketRule(b, mt4.StopRule{TrailDistance: 50})
+
+	first := moveAt(t, srv, moves, "EURUSD", 1.1100)
+	noMoveAt(t, srv, moves, "EURUSD", 1.1200) // the minute's budget is spent
+	idle := a
+	if first.Ticket == a {
+		idle = b
+	}
+	if sl := srv.Order(idle).GetStopLoss(); sl != 0 {
+		t.Errorf("#%d moved to %v over MaxModifiesPerMinute", idle, sl)
+	}
+
+	other, otherMoves := newTestStopManager(t, account, mt4.StopManagerConfig{MinModifyInterval: time.Hour})
+	sm.Close()
+	c := buy(t, account, "USDJPY", 0.1) // open 150.012
+	other.SetTicketRule(c, mt4.StopRule{TrailDistance: 50})
+	moveAt(t, srv, otherMoves, "USDJPY", 151)
+	noMoveAt(t, srv, otherMoves, "USDJPY", 152) // one move per ticket and hour
+}
+
+func TestStopManagerModifyError(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticket := buy(t, account, "EURUSD", 0.1)
+	sm, moves := newTestStopManager(t, account, mt4.StopManagerConfig{})
+	srv.FailNextAPI("OrderModify", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_TRADE_DISABLED)
+	sm.SetTicketRule(ticket, mt4.StopRule{TrailDistance: 50})
+
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1100); !errors.Is(m.Err, mt4.ErrTradeDisabled) {
+		t.Errorf("failed move = %+v", m)
+	}
+	// The failed stop is not remembered: the next tick tries again.
+	if m := moveAt(t, srv, moves, "EURUSD", 1.1100); m.Err != nil || m.From != 0 || m.To != 1.1095 {
+		t.Errorf("retried move = %+v", m)
+	}
+}
+
+func TestNewStopManagerErrors(t *testing.T) {
+	if _, err := mt4.NewStopManager(testContext(t), nil, mt4.StopManagerConfig{}); err == nil {
+		t.Error("NewStopManager accepted a nil account")
+	}
+	_, disconnected := newDisconnectedAccount(t)
+	if _, err := mt4.NewStopManager(testContext(t), disconnected, mt4.StopManagerConfig{}); !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("NewStopManager before connecting = %v, want ErrNotConnected", err)
+	}
+
+	_, account := newTestAccount(t)
+	sm, err := mt4.NewStopManager(testContext(t), account, mt4.StopManagerConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Close()
+	sm.Close()
+	select {
+	case <-sm.Done():
+	default:
+		t.Error("Done open after Close")
+	}
+}
@@ -0,0 +1,254 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Handler subscriptions ===
+//
+// The streaming methods return (dataCh, errCh) pairs that every caller has to select over.
+// Subscribe runs the streams a Handler needs and calls its callbacks instead, serially from
+// one goroutine per Subscription:
+//
+//	OnTick        ticks of Handler.Symbols (via the account's TickHub, no extra upstream stream)
+//	OnTrade       raw OnTrade messages
+//	OnTradeEvent  the same messages decoded by DecodeTradeEvents
+//	OnProfit      OnOpenedOrdersProfit updates
+//	OnReconnect   the session is connected again after a reconnect / re-establishment
+//	OnError       a stream ended with an error; the Subscription stops
+//
+// MergeHandlers composes several handlers into one Subscription.
+
+// Tick is a symbol tick as delivered by OnSymbolTick.
+type Tick = pb.OnSymbolMqlTickInfo
+
+// Handler holds the callbacks of a Subscription; nil callbacks are not subscribed.
+type Handler struct {
+	// Symbols are the symbols delivered to OnTick.
+	Symbols []string
+
+	// ProfitIntervalMs is the OnOpenedOrdersProfit interval (0 = 1000).
+	ProfitIntervalMs int32
+
+	OnTick       func(*Tick)
+	OnTrade      func(*pb.OnTradeData)
+	OnTradeEvent func(TradeEvent)
+	OnProfit     func(*pb.OnOpenedOrdersProfitData)
+	OnReconnect  func(StateChange)
+	OnError      func(error)
+}
+
+// MergeHandlers combines handlers: every callback calls the callbacks of all handlers in
+// order, Symbols are united and the shortest ProfitIntervalMs wins.
+func MergeHandlers(handlers ...Handler) Handler {
+	var m Handler
+	seen := make(map[string]bool)
+	for _, h := range handlers {
+		for _, symbol := range h.Symbols {
+			if !seen[symbol] {
+				seen[symbol] = true
+				m.Symbols = append(m.Symbols, symbol)
+			}
+		}
+		if h.ProfitIntervalMs > 0 && (m.ProfitIntervalMs == 0 || h.ProfitIntervalMs < m.ProfitIntervalMs) {
+			m.ProfitIntervalMs = h.ProfitIntervalMs
+		}
+		m.OnTick = chain(m.OnTick, h.OnTick)
+		m.OnTrade = chain(m.OnTrade, h.OnTrade)
+		m.OnTradeEvent = chain(m.OnTradeEvent, h.OnTradeEvent)
+		m.OnProfit = chain(m.OnProfit, h.OnProfit)
+		m.OnReconnect = chain(m.OnReconnect, h.OnReconnect)
+		m.OnError = chain(m.OnError, h.OnError)
+	}
+	return m
+}
+
+// chain returns a callback calling first, then next (either may be nil).
+func chain[T any](first, next func(T)) func(T) {
+	switch {
+	case first == nil:
+		return next
+	case next == nil:
+		return first
+	}
+	return func(v T) {
+		first(v)
+		next(v)
+	}
+}
+
+// Subscription is a running Subscribe. Its callbacks are never called concurrently.
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// Subscribe starts the streams needed by h and dispatches their data to its callbacks
+// until ctx is done, Close is called or a stream ends with an error (reported to OnError
+// and by Err).
+//
+// Parameters:
+//   - ctx: Lifetime of the subscription.
+//   - h: Callbacks (see Handler); combine several with MergeHandlers.
+//
+// Returns:
+//   - The running subscription.
+//   - ErrNotConnected, or an error if h has no callbacks or OnTick without Symbols.
+//
+// Example:
+//
+//	sub, err := account.Subscribe(ctx, mt4.Handler{
+//	    Symbols:      []string{"EURUSD"},
+//	    OnTick:       func(t *mt4.Tick) { log.Printf("%s %.5f", t.GetSymbol(), t.GetBid()) },
+//	    OnTradeEvent: func(e mt4.TradeEvent) { log.Printf("%v #%d", e.Kind, e.Ticket) },
+//	    OnError:      func(err error) { log.Printf("subscription: %v", err) },
+//	})
+//	if err != nil { return err }
+//	defer sub.Close()
+func (a *MT4Account) Subscribe(ctx context.Context, h Handler) (*Subscription, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	if h.OnTick == nil && h.OnTrade == nil && h.OnTradeEvent == nil && h.OnProfit == nil && h.OnReconnect == nil {
+		return nil, errors.New("Subscribe: handler has no callbacks")
+	}
+	if h.OnTick != nil && len(h.Symbols) == 0 {
+		return nil, errors.New("Subscribe: OnTick needs Symbols")
+	}
+	if h.ProfitIntervalMs <= 0 {
+		h.ProfitIntervalMs = 1000
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	s := &Subscription{cancel: cancel, done: make(chan struct{})}
+	go s.run(runCtx, a, h)
+	return s, nil
+}
+
+// run opens the streams and dispatches until ctx is done or a stream fails.
+func (s *Subscription) run(ctx context.Context, a *MT4Account, h Handler) {
+	defer close(s.done)
+	defer s.cancel()
+
+	var (
+		ticks      <-chan *Tick
+		trades     <-chan *pb.OnTradeData
+		tradeErrs  <-chan error
+		profits    <-chan *pb.OnOpenedOrdersProfitData
+		profitErrs <-chan error
+		changes    <-chan StateChange
+	)
+	if h.OnTick != nil {
+		sub := a.TickHub().Subscribe(h.Symbols...)
+		defer sub.Close()
+		ticks = sub.C
+	}
+	if h.OnTrade != nil || h.OnTradeEvent != nil {
+		trades, tradeErrs = a.OnTrade(ctx)
+	}
+	if h.OnProfit != nil {
+		profits, profitErrs = a.OnOpenedOrdersProfit(ctx, h.ProfitIntervalMs)
+	}
+	if h.OnReconnect != nil {
+		changes = a.StateChanges()
+		defer a.unsubscribeStateChanges(changes)
+	}
+
+	fail := func(err error) {
+		if ctx.Err() != nil {
+			return // closed by the caller
+		}
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		if h.OnError != nil {
+			h.OnError(err)
+		}
+	}
+	streamErr := func(err error, ok bool, name string) error {
+		if !ok || err == nil {
+			return errors.New(name + " stream ended")
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t, ok := <-ticks:
+			if !ok {
+				if a.State() == StateClosed {
+					fail(ErrAccountClosed)
+				} else {
+					fail(errors.New("tick hub stopped"))
+				}
+				return
+			}
+			h.OnTick(t)
+		case data, ok := <-trades:
+			if !ok {
+				trades = nil // the error follows on tradeErrs
+				continue
+			}
+			if h.OnTrade != nil {
+				h.OnTrade(data)
+			}
+			if h.OnTradeEvent != nil {
+				for _, e := range DecodeTradeEvents(data) {
+					h.OnTradeEvent(e)
+				}
+			}
+		case err, ok := <-tradeErrs:
+			fail(streamErr(err, ok, "trade"))
+			return
+		case data, ok := <-profits:
+			if !ok {
+				profits = nil
+				continue
+			}
+			h.OnProfit(data)
+		case err, ok := <-profitErrs:
+			fail(streamErr(err, ok, "profit"))
+			return
+		case ch, ok := <-changes:
+			if !ok {
+				changes = nil
+				continue
+			}
+			if ch.To == StateConnected && (ch.From == StateReconnecting || ch.Reestablished) {
+				h.OnReconnect(ch)
+			}
+		}
+	}
+}
+
+// Err returns the error that stopped the subscription (nil while running or when it was
+// stopped by Close or its ctx).
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Done is closed when the subscription stops.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close stops the subscription's streams and waits for the running callback to return.
+// Safe to call more than once; do not call it from a callback (use the ctx instead).
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
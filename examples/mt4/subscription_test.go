@@ -0,0 +1,141 @@
+package mt4_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+func TestMergeHandlers(t *testing.T) {
+	var calls []string
+	record := func(name string) func(*mt4.Tick) {
+		return func(*mt4.Tick) { calls = append(calls, name) }
+	}
+	m := mt4.MergeHandlers(
+		mt4.Handler{Symbols: []string{"EURUSD", "GBPUSD"}, ProfitIntervalMs: 500, OnTick: record("a")},
+		mt4.Handler{OnError: func(error) { calls = append(calls, "err") }},
+		mt4.Handler{Symbols: []string{"GBPUSD", "USDJPY"}, ProfitIntervalMs: 200, OnTick: record("c")},
+		mt4.Handler{ProfitIntervalMs: 1000},
+	)
+
+	if want := []string{"EURUSD", "GBPUSD", "USDJPY"}; !reflect.DeepEqual(m.Symbols, want) {
+		t.Errorf("Symbols = %v, want %v", m.Symbols, want)
+	}
+	if m.ProfitIntervalMs != 200 {
+		t.Errorf("ProfitIntervalMs = %d, want the shortest", m.ProfitIntervalMs)
+	}
+	if m.OnTrade != nil || m.OnProfit != nil {
+		t.Error("callbacks set by no handler are not nil")
+	}
+	m.OnTick(&mt4.Tick{})
+	m.OnError(nil)
+	if want := []string{"a", "c", "err"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	_, account := newTestAccount(t)
+	if _, err := account.Subscribe(testContext(t), mt4.Handler{OnError: func(error) {}}); err == nil {
+		t.Error("Subscribe accepted a handler without stream callbacks")
+	}
+	if _, err := account.Subscribe(testContext(t), mt4.Handler{OnTick: func(*mt4.Tick) {}}); err == nil {
+		t.Error("Subscribe accepted OnTick without Symbols")
+	}
+
+	_, disconnected := newDisconnectedAccount(t)
+	if _, err := disconnected.Subscribe(testContext(t), mt4.Handler{OnTrade: func(*pb.OnTradeData) {}}); !errors.Is(err, mt4.ErrNotConnected) {
+		t.Errorf("Subscribe before connecting = %v, want ErrNotConnected", err)
+	}
+}
+
+func TestSubscribeDispatches(t *testing.T) {
+	srv, account := newTestAccount(t)
+	ticks := make(chan *mt4.Tick, 64)
+	events := make(chan mt4.TradeEvent, 64)
+	reconnects := make(chan mt4.StateChange, 4)
+	sub, err := account.Subscribe(testContext(t), mt4.Handler{
+		Symbols:      []string{"EURUSD"},
+		OnTick:       func(t *mt4.Tick) { ticks <- t },
+		OnTradeEvent: func(e mt4.TradeEvent) { events <- e },
+		OnReconnect:  func(ch mt4.StateChange) { reconnects <- ch },
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	eventually(t, "a tick callback", func() bool {
+		srv.PushTick("EURUSD", 1.2, 1.2001)
+		select {
+		case tick := <-ticks:
+			return tick.GetBid() == 1.2
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	})
+
+	// The trade stream may subscribe after the first order; keep trading until one is seen.
+	eventually(t, "a trade event callback", func() bool {
+		ticket := buy(t, account, "EURUSD", 0.1)
+		select {
+		case e := <-events:
+			return e.Kind == mt4.EventOrderOpened && e.Ticket == ticket
+		case <-time.After(20 * time.Millisecond):
+			return false
+		}
+	})
+
+	srv.DropTerminals()
+	if _, err := account.Quote(testContext(t), "EURUSD"); err != nil {
+		t.Fatalf("Quote: %v", err)
+	}
+	select {
+	case ch := <-reconnects:
+		if !ch.Reestablished || ch.To != mt4.StateConnected {
+			t.Errorf("OnReconnect(%+v)", ch)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no OnReconnect after a re-establishment")
+	}
+
+	sub.Close()
+	if err := sub.Err(); err != nil {
+		t.Errorf("Err after Close = %v", err)
+	}
+	sub.Close() // idempotent
+}
+
+func TestSubscribeStreamError(t *testing.T) {
+	srv, account := newTestAccount(t)
+	permanent := status.Error(codes.PermissionDenied, "mt4test: denied")
+	srv.FailNext("OnTrade", 1, permanent)
+
+	errs := make(chan error, 1)
+	sub, err := account.Subscribe(testContext(t), mt4.Handler{
+		OnTrade: func(*pb.OnTradeData) {},
+		OnError: func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	select {
+	case <-sub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscription still running after a stream error")
+	}
+	if status.Code(sub.Err()) != codes.PermissionDenied {
+		t.Errorf("Err = %v", sub.Err())
+	}
+	if got := <-errs; status.Code(got) != codes.PermissionDenied {
+		t.Errorf("OnError(%v)", got)
+	}
+}
@@ -0,0 +1,460 @@
+package mt4
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/protobuf/proto"
+)
+
+//=== 📂 Tick hub ===
+//
+// OnSymbolTick opens one stream per caller with a fixed symbol list. A TickHub keeps a
+// single upstream OnSymbolTick stream for the union of its subscribers' symbols and fans
+// the ticks out. When the union changes, the upstream stream is re-issued: the old stream
+// is cancelled once the new one delivers, and ticks seen on both are delivered once (a tick
+// is dropped unless it is newer than the last one delivered for its symbol, or as old but
+// with another Bid / Ask).
+//
+// Delivery never blocks the hub: a subscriber whose buffer is full loses the tick (see
+// TickSubscription.Dropped).
+
+// DefaultTickBuffer is the per-subscriber buffer used when TickHubConfig leaves it zero.
+const DefaultTickBuffer = 256
+
+// TickHubConfig configures NewTickHub.
+type TickHubConfig struct {
+	// Buffer is the channel capacity of each subscription (0 = DefaultTickBuffer).
+	Buffer int
+}
+
+// TickHub fans out one upstream tick stream to many subscribers. It is safe for concurrent use.
+type TickHub struct {
+	account *MT4Account
+	cfg     TickHubConfig
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// changed wakes run after the symbol union changed.
+	changed chan struct{}
+
+	mu      sync.Mutex
+	stopped bool
+	subs    map[*TickSubscription]struct{}
+	refs    map[string]int                     // symbol → number of subscribers
+	last    map[string]*pb.OnSymbolMqlTickInfo // latest tick per symbol
+}
+
+// TickSubscription receives the ticks of its symbols from a TickHub.
+type TickSubscription struct {
+	// C delivers the ticks; it is closed by Close and when the hub stops.
+	C <-chan *pb.OnSymbolMqlTickInfo
+
+	hub     *TickHub
+	ch      chan *pb.OnSymbolMqlTickInfo
+	symbols map[string]bool // guarded by hub.mu
+	closed  bool            // guarded by hub.mu
+	dropped atomic.Uint64
+}
+
+// upstreamEnd reports the end of an upstream stream to run.
+type upstreamEnd struct {
+	gen int
+	err error
+}
+
+// NewTickHub starts a hub for account. The upstream stream is opened as soon as a
+// subscription names a symbol, and the hub runs until ctx is done, Close is called or
+// the account is closed.
+//
+// Parameters:
+//   - ctx: Lifetime of the hub.
+//   - account: Connected account.
+//   - cfg: Subscriber buffering (zero value = defaults).
+//
+// Example:
+//
+//	hub := mt4.NewTickHub(ctx, account, mt4.TickHubConfig{})
+//	defer hub.Close()
+//	sub := hub.Subscribe("EURUSD", "GBPUSD")
+//	defer sub.Close()
+//	for tick := range sub.C { ... }
+func NewTickHub(ctx context.Context, account *MT4Account, cfg TickHubConfig) *TickHub {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = DefaultTickBuffer
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	h := &TickHub{
+		account: account,
+		cfg:     cfg,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		changed: make(chan struct{}, 1),
+		subs:    make(map[*TickSubscription]struct{}),
+		refs:    make(map[string]int),
+		last:    make(map[string]*pb.OnSymbolMqlTickInfo),
+	}
+	go h.run(runCtx)
+	return h
+}
+
+// TickHub returns the account's shared hub, starting it on first use. It runs until the
+// account is closed; strategies of one account should subscribe here instead of calling
+// OnSymbolTick each.
+func (a *MT4Account) TickHub() *TickHub {
+	for {
+		if h := a.tickHub.Load(); h != nil && h.running() {
+			return h
+		}
+		cur := a.tickHub.Load()
+		h := NewTickHub(context.Background(), a, TickHubConfig{})
+		if a.tickHub.CompareAndSwap(cur, h) {
+			return h
+		}
+		h.Close()
+	}
+}
+
+// run keeps the upstream stream in line with the symbol union until ctx is done.
+func (h *TickHub) run(ctx context.Context) {
+	defer close(h.done)
+	defer h.stop()
+
+	if h.account == nil || h.account.State() == StateClosed {
+		return
+	}
+	changes := h.account.StateChanges()
+	defer h.account.unsubscribeStateChanges(changes)
+
+	var (
+		gen      int
+		current  []string           // symbols of the running upstream
+		upCancel context.CancelFunc // cancels the running upstream
+		ended    = make(chan upstreamEnd, 1)
+		retry    <-chan struct{}
+		failures int
+	)
+	defer func() {
+		if upCancel != nil {
+			upCancel()
+		}
+	}()
+
+	reissue := func() {
+		want := h.Symbols()
+		if upCancel != nil && slices.Equal(want, current) {
+			return
+		}
+		prev := upCancel
+		upCancel, current = nil, nil
+		if len(want) == 0 {
+			if prev != nil {
+				prev()
+			}
+			return
+		}
+		gen++
+		upCtx, cancel := context.WithCancel(ctx)
+		upCancel, current = cancel, want
+		go h.pump(upCtx, gen, want, prev, ended)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.changed:
+			retry = nil
+			reissue()
+		case e := <-ended:
+			if e.gen != gen || upCancel == nil {
+				continue // a replaced stream
+			}
+			upCancel()
+			upCancel, current = nil, nil
+			if h.account.State() == StateClosed {
+				return
+			}
+			if e.err != nil && !errors.Is(e.err, context.Canceled) {
+				h.account.logf("mt4: tick hub upstream: %v", e.err)
+			}
+			wait := make(chan struct{})
+			delay := h.account.retryPolicyFor(ctx, OperationStream).delay(failures)
+			failures++
+			go func() {
+				if waitWithCtx(ctx, delay) == nil {
+					close(wait)
+				}
+			}()
+			retry = wait
+		case <-retry:
+			retry = nil
+			reissue()
+		case ch, ok := <-changes:
+			if !ok || ch.To == StateClosed {
+				return
+			}
+			if ch.To == StateConnected {
+				failures = 0
+			}
+		}
+	}
+}
+
+// pump forwards one upstream stream into the hub and reports its end. The replaced
+// stream (prev) is cancelled once this one delivers its first tick, or when it ends.
+func (h *TickHub) pump(ctx context.Context, gen int, symbols []string, prev context.CancelFunc, ended chan<- upstreamEnd) {
+	if prev == nil {
+		prev = func() {}
+	}
+	defer prev()
+
+	data, errs := h.account.OnSymbolTick(ctx, symbols)
+	for d := range data {
+		h.dispatch(d.GetSymbolTick())
+		prev()
+	}
+	err := <-errs
+	select {
+	case ended <- upstreamEnd{gen: gen, err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// dispatch delivers tick to the subscribers of its symbol, skipping repeated and older
+// ticks (both streams deliver them while the upstream is re-issued).
+func (h *TickHub) dispatch(tick *pb.OnSymbolMqlTickInfo) {
+	if tick == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	symbol := tick.GetSymbol()
+	if h.stopped || h.refs[symbol] == 0 {
+		return
+	}
+	if staleTick(h.last[symbol], tick) {
+		return
+	}
+	h.last[symbol] = tick
+	for s := range h.subs {
+		if !s.symbols[symbol] {
+			continue
+		}
+		select {
+		case s.ch <- tick:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// staleTick reports whether tick was already delivered or is older than prev, the last
+// tick delivered for its symbol. Ticks without a time are compared as a whole.
+func staleTick(prev, tick *pb.OnSymbolMqlTickInfo) bool {
+	if prev == nil {
+		return false
+	}
+	at, last := tickMillis(tick), tickMillis(prev)
+	if at == 0 || last == 0 {
+		return proto.Equal(prev, tick)
+	}
+	return at < last || (at == last && tick.GetBid() == prev.GetBid() && tick.GetAsk() == prev.GetAsk())
+}
+
+// tickMillis returns the time of tick in Unix milliseconds (0 = none).
+func tickMillis(tick *pb.OnSymbolMqlTickInfo) int64 {
+	if ms := tick.GetTimeMsc(); ms != 0 {
+		return ms
+	}
+	if t := tick.GetTime(); t != nil {
+		return t.AsTime().UnixMilli()
+	}
+	return 0
+}
+
+// Subscribe registers a subscription for symbols (more can be added later with
+// TickSubscription.Subscribe). On a stopped hub the returned subscription is already closed.
+func (h *TickHub) Subscribe(symbols ...string) *TickSubscription {
+	ch := make(chan *pb.OnSymbolMqlTickInfo, h.cfg.Buffer)
+	s := &TickSubscription{C: ch, hub: h, ch: ch, symbols: make(map[string]bool)}
+
+	h.mu.Lock()
+	if h.stopped {
+		s.closed = true
+		close(ch)
+		h.mu.Unlock()
+		return s
+	}
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	s.Subscribe(symbols...)
+	return s
+}
+
+// Symbols returns the union of all subscribed symbols, sorted.
+func (h *TickHub) Symbols() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]string, 0, len(h.refs))
+	for symbol := range h.refs {
+		out = append(out, symbol)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Last returns the latest tick of symbol seen by the hub (nil if none yet).
+func (h *TickHub) Last(symbol string) *pb.OnSymbolMqlTickInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last[symbol]
+}
+
+// Done is closed when the hub stops.
+func (h *TickHub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Close stops the upstream stream and closes every subscription.
+func (h *TickHub) Close() {
+	h.cancel()
+	<-h.done
+}
+
+// running reports whether the hub has not stopped.
+func (h *TickHub) running() bool {
+	select {
+	case <-h.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop closes all subscriptions; later subscriptions are born closed.
+func (h *TickHub) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	for s := range h.subs {
+		s.closed = true
+		close(s.ch)
+	}
+	h.subs = nil
+	h.refs = make(map[string]int)
+}
+
+// notify wakes run to re-issue the upstream stream.
+func (h *TickHub) notify() {
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe adds symbols to the subscription. The upstream stream is re-issued if a
+// symbol is new to the hub.
+func (s *TickSubscription) Subscribe(symbols ...string) {
+	h := s.hub
+	h.mu.Lock()
+	if s.closed {
+		h.mu.Unlock()
+		return
+	}
+	grew := false
+	for _, symbol := range symbols {
+		if symbol == "" || s.symbols[symbol] {
+			continue
+		}
+		s.symbols[symbol] = true
+		if h.refs[symbol]++; h.refs[symbol] == 1 {
+			grew = true
+		}
+	}
+	h.mu.Unlock()
+	if grew {
+		h.notify()
+	}
+}
+
+// Unsubscribe removes symbols from the subscription. The upstream stream is re-issued if
+// no other subscription needs a removed symbol.
+func (s *TickSubscription) Unsubscribe(symbols ...string) {
+	h := s.hub
+	h.mu.Lock()
+	if s.closed {
+		h.mu.Unlock()
+		return
+	}
+	shrunk := false
+	for _, symbol := range symbols {
+		if s.symbols[symbol] {
+			delete(s.symbols, symbol)
+			shrunk = h.releaseLocked(symbol) || shrunk
+		}
+	}
+	h.mu.Unlock()
+	if shrunk {
+		h.notify()
+	}
+}
+
+// Symbols returns the symbols of the subscription, sorted.
+func (s *TickSubscription) Symbols() []string {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	out := make([]string, 0, len(s.symbols))
+	for symbol := range s.symbols {
+		out = append(out, symbol)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Dropped returns the number of ticks lost because C was full.
+func (s *TickSubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close removes the subscription from the hub and closes C. Safe to call more than once.
+func (s *TickSubscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	if s.closed {
+		h.mu.Unlock()
+		return
+	}
+	s.closed = true
+	delete(h.subs, s)
+	shrunk := false
+	for symbol := range s.symbols {
+		shrunk = h.releaseLocked(symbol) || shrunk
+	}
+	close(s.ch)
+	h.mu.Unlock()
+	if shrunk {
+		h.notify()
+	}
+}
+
+// releaseLocked drops one reference to symbol and reports whether it left the union.
+// Caller holds h.mu.
+func (h *TickHub) releaseLocked(symbol string) bool {
+	if h.refs[symbol]--; h.refs[symbol] > 0 {
+		return false
+	}
+	delete(h.refs, symbol)
+	delete(h.last, symbol)
+	return true
+}
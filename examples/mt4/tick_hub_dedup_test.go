@@ -0,0 +1,72 @@
+package mt4
+
+import (
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// tickAt returns an EURUSD tick at ms past a fixed second.
+func tickAt(ms int64, bid float64) *pb.OnSymbolMqlTickInfo {
+	at := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC).Add(time.Duration(ms) * time.Millisecond)
+	return &pb.OnSymbolMqlTickInfo{Symbol: "EURUSD", Bid: bid, Ask: bid + 0.0001, Time: timestamppb.New(at), TimeMsc: at.UnixMilli()}
+}
+
+func TestStaleTick(t *testing.T) {
+	untimed := &pb.OnSymbolMqlTickInfo{Symbol: "EURUSD", Bid: 1.1, Ask: 1.1001}
+	secondsOnly := func(bid float64) *pb.OnSymbolMqlTickInfo {
+		tick := tickAt(0, bid)
+		tick.TimeMsc = 0
+		return tick
+	}
+	tests := []struct {
+		name       string
+		prev, tick *pb.OnSymbolMqlTickInfo
+		want       bool
+	}{
+		{"first tick", nil, tickAt(0, 1.1), false},
+		{"newer", tickAt(0, 1.1), tickAt(1, 1.1), false},
+		{"same time, other price", tickAt(0, 1.1), tickAt(0, 1.2), false},
+		{"repeat", tickAt(0, 1.1), tickAt(0, 1.1), true},
+		{"older", tickAt(5, 1.2), tickAt(1, 1.1), true},
+		{"Time without TimeMsc", secondsOnly(1.1), secondsOnly(1.1), true},
+		{"Time without TimeMsc, other price", secondsOnly(1.1), secondsOnly(1.2), false},
+		{"no time, repeat", untimed, untimed, true},
+		{"no time, other price", untimed, &pb.OnSymbolMqlTickInfo{Symbol: "EURUSD", Bid: 1.2, Ask: 1.2001}, false},
+	}
+	for _, tt := range tests {
+		if got := staleTick(tt.prev, tt.tick); got != tt.want {
+			t.Errorf("%s: staleTick = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTickHubDispatchOverlappingStreams(t *testing.T) {
+	h := &TickHub{
+		subs: make(map[*TickSubscription]struct{}),
+		refs: map[string]int{"EURUSD": 1},
+		last: make(map[string]*pb.OnSymbolMqlTickInfo),
+	}
+	ch := make(chan *pb.OnSymbolMqlTickInfo, 8)
+	sub := &TickSubscription{C: ch, hub: h, ch: ch, symbols: map[string]bool{"EURUSD": true}}
+	h.subs[sub] = struct{}{}
+
+	// The old stream delivers A and B; the new one replays A and B, then continues with C.
+	a, b, c := tickAt(0, 1.1), tickAt(1, 1.2), tickAt(2, 1.3)
+	for _, tick := range []*pb.OnSymbolMqlTickInfo{a, b, tickAt(0, 1.1), tickAt(1, 1.2), c} {
+		h.dispatch(tick)
+	}
+	close(ch)
+	var bids []float64
+	for tick := range ch {
+		bids = append(bids, tick.GetBid())
+	}
+	if len(bids) != 3 || bids[0] != 1.1 || bids[1] != 1.2 || bids[2] != 1.3 {
+		t.Errorf("delivered %v, want 1.1 1.2 1.3 once each", bids)
+	}
+	if h.last["EURUSD"] != c {
+		t.Errorf("last = %v, want the newest tick", h.last["EURUSD"])
+	}
+}
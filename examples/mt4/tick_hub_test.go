@@ -0,0 +1,168 @@
+package mt4_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+// receiveTick pushes symbol at bid until sub delivers it, skipping older ticks.
+func receiveTick(t *testing.T, srv *mt4test.Server, sub *mt4.TickSubscription, symbol string, bid float64) {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		srv.PushTick(symbol, bid, bid+0.0001)
+		select {
+		case tick, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("subscription closed waiting for %s %v", symbol, bid)
+			}
+			if tick.GetSymbol() == symbol && tick.GetBid() == bid {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no %s tick at %v", symbol, bid)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// newTestHub returns a hub of account, closed when the test ends.
+func newTestHub(t *testing.T, account *mt4.MT4Account, cfg mt4.TickHubConfig) *mt4.TickHub {
+	t.Helper()
+	hub := mt4.NewTickHub(testContext(t), account, cfg)
+	t.Cleanup(hub.Close)
+	return hub
+}
+
+func TestTickHubFanOut(t *testing.T) {
+	srv, account := newTestAccount(t)
+	hub := newTestHub(t, account, mt4.TickHubConfig{})
+	a, b := hub.Subscribe("EURUSD"), hub.Subscribe("EURUSD", "GBPUSD")
+
+	receiveTick(t, srv, a, "EURUSD", 1.2)
+	receiveTick(t, srv, b, "EURUSD", 1.2)
+	receiveTick(t, srv, b, "GBPUSD", 1.3)
+	if got := hub.Symbols(); !slices.Equal(got, []string{"EURUSD", "GBPUSD"}) {
+		t.Errorf("Symbols = %v", got)
+	}
+	if tick := hub.Last("GBPUSD"); tick.GetBid() != 1.3 {
+		t.Errorf("Last(GBPUSD) = %v", tick)
+	}
+
+	// a never sees GBPUSD.
+	for len(a.C) > 0 {
+		if tick := <-a.C; tick.GetSymbol() != "EURUSD" {
+			t.Errorf("a received %s", tick.GetSymbol())
+		}
+	}
+	if got := srv.Calls("OnSymbolTick"); got > 2 {
+		t.Errorf("OnSymbolTick streams = %d, want one per union change", got)
+	}
+}
+
+func TestTickHubReissuesOnUnionChange(t *testing.T) {
+	srv, account := newTestAccount(t)
+	hub := newTestHub(t, account, mt4.TickHubConfig{})
+	sub := hub.Subscribe("EURUSD")
+	receiveTick(t, srv, sub, "EURUSD", 1.2)
+	streams := srv.Calls("OnSymbolTick")
+
+	// Already in the union: no new upstream.
+	other := hub.Subscribe("EURUSD")
+	receiveTick(t, srv, other, "EURUSD", 1.21)
+	if got := srv.Calls("OnSymbolTick"); got != streams {
+		t.Errorf("OnSymbolTick streams = %d after a known symbol, want %d", got, streams)
+	}
+
+	sub.Subscribe("USDJPY")
+	receiveTick(t, srv, sub, "USDJPY", 151)
+	if got := srv.Calls("OnSymbolTick"); got != streams+1 {
+		t.Errorf("OnSymbolTick streams = %d after a new symbol, want %d", got, streams+1)
+	}
+	receiveTick(t, srv, other, "EURUSD", 1.22)
+
+	sub.Unsubscribe("USDJPY")
+	if got := sub.Symbols(); !slices.Equal(got, []string{"EURUSD"}) {
+		t.Errorf("sub.Symbols = %v", got)
+	}
+	other.Close()
+	if got := hub.Symbols(); !slices.Equal(got, []string{"EURUSD"}) {
+		t.Errorf("hub.Symbols = %v", got)
+	}
+	sub.Close()
+	if got := hub.Symbols(); len(got) != 0 {
+		t.Errorf("hub.Symbols after the last Close = %v", got)
+	}
+	for range sub.C { // buffered ticks, then closed
+	}
+	sub.Close() // idempotent
+}
+
+func TestTickHubDropsForSlowSubscriber(t *testing.T) {
+	srv, account := newTestAccount(t)
+	hub := newTestHub(t, account, mt4.TickHubConfig{Buffer: 1})
+	fast, slow := hub.Subscribe("EURUSD"), hub.Subscribe("EURUSD")
+
+	receiveTick(t, srv, fast, "EURUSD", 1.2)
+	for i := 1; i <= 5; i++ {
+		receiveTick(t, srv, fast, "EURUSD", 1.2+float64(i)/1000)
+	}
+	if slow.Dropped() == 0 {
+		t.Error("no ticks dropped for a full subscriber")
+	}
+	if len(slow.C) != 1 {
+		t.Errorf("slow buffer holds %d ticks, want 1", len(slow.C))
+	}
+}
+
+func TestTickHubResumesAfterDisconnect(t *testing.T) {
+	srv, account := newTestAccount(t)
+	hub := newTestHub(t, account, mt4.TickHubConfig{})
+	sub := hub.Subscribe("EURUSD")
+	receiveTick(t, srv, sub, "EURUSD", 1.2)
+
+	srv.Disconnect()
+	receiveTick(t, srv, sub, "EURUSD", 1.3)
+}
+
+func TestTickHubClose(t *testing.T) {
+	_, account := newTestAccount(t)
+	hub := mt4.NewTickHub(testContext(t), account, mt4.TickHubConfig{})
+	sub := hub.Subscribe("EURUSD")
+
+	hub.Close()
+	for range sub.C {
+	}
+	late := hub.Subscribe("EURUSD")
+	if _, ok := <-late.C; ok {
+		t.Error("subscription on a stopped hub is open")
+	}
+	late.Subscribe("GBPUSD")
+	if got := late.Symbols(); len(got) != 0 {
+		t.Errorf("closed subscription symbols = %v", got)
+	}
+}
+
+func TestAccountTickHub(t *testing.T) {
+	_, account := newTestAccount(t)
+	hub := account.TickHub()
+	if account.TickHub() != hub {
+		t.Fatal("TickHub returned a new hub while the first runs")
+	}
+	sub := hub.Subscribe("EURUSD")
+
+	if err := account.Disconnect(); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	select {
+	case <-hub.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("hub still running after Disconnect")
+	}
+	for range sub.C {
+	}
+}
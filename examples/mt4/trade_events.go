@@ -0,0 +1,332 @@
+package mt4
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Semantic trade events ===
+//
+// OnTrade reports raw diffs: NewOrders, UpdatedOrders (Previous / Current), RemovedOrders
+// and NewHistoryOrders. DecodeTradeEvents classifies them the way MT4 produces them:
+//
+//	NewOrders (market)                           → OrderOpened
+//	NewOrders (pending)                          → PendingPlaced
+//	UpdatedOrders pending → market               → PendingTriggered
+//	UpdatedOrders SL / TP / price / expiration   → StopsModified
+//	Removed + history (market)                   → OrderClosed (reason from comment or stops)
+//	Removed + history + NewOrders "from #ticket" → PartiallyClosed
+//	Removed + history (pending)                  → PendingDeleted / PendingExpired
+//
+// Profit-only updates produce no event.
+
+// TradeEventKind classifies a TradeEvent.
+type TradeEventKind int
+
+const (
+	// EventOrderOpened: a market order was opened (OrderSend or a manual trade).
+	EventOrderOpened TradeEventKind = iota + 1
+	// EventPendingPlaced: a pending order was placed.
+	EventPendingPlaced
+	// EventPendingTriggered: a pending order became a market position.
+	EventPendingTriggered
+	// EventOrderClosed: a market position was closed completely (see CloseReason).
+	EventOrderClosed
+	// EventPartiallyClosed: part of a position was closed; the rest lives on under RemainingTicket.
+	EventPartiallyClosed
+	// EventStopsModified: SL / TP (or, for pending orders, price / expiration) changed.
+	EventStopsModified
+	// EventPendingDeleted: a pending order was deleted (by the trader or the server).
+	EventPendingDeleted
+	// EventPendingExpired: a pending order reached its expiration time.
+	EventPendingExpired
+)
+
+// String returns the event name.
+func (k TradeEventKind) String() string {
+	switch k {
+	case EventOrderOpened:
+		return "OrderOpened"
+	case EventPendingPlaced:
+		return "PendingPlaced"
+	case EventPendingTriggered:
+		return "PendingTriggered"
+	case EventOrderClosed:
+		return "OrderClosed"
+	case EventPartiallyClosed:
+		return "PartiallyClosed"
+	case EventStopsModified:
+		return "StopsModified"
+	case EventPendingDeleted:
+		return "PendingDeleted"
+	case EventPendingExpired:
+		return "PendingExpired"
+	}
+	return "Unknown"
+}
+
+// CloseReason tells why a position was closed.
+type CloseReason int
+
+const (
+	// CloseManual: closed by OrderClose / OrderCloseBy or by hand.
+	CloseManual CloseReason = iota
+	// CloseStopLoss: the stop loss was hit.
+	CloseStopLoss
+	// CloseTakeProfit: the take profit was hit.
+	CloseTakeProfit
+	// CloseStopOut: closed by the broker on margin stop-out.
+	CloseStopOut
+)
+
+// String returns the reason name.
+func (r CloseReason) String() string {
+	switch r {
+	case CloseStopLoss:
+		return "sl"
+	case CloseTakeProfit:
+		return "tp"
+	case CloseStopOut:
+		return "stop-out"
+	}
+	return "manual"
+}
+
+// TradeEvent is one classified change of an order.
+type TradeEvent struct {
+	Kind TradeEventKind
+
+	// Ticket is the order the event is about.
+	Ticket int32
+
+	// Order is the order after the change (for closes and deletions: the history record).
+	Order *pb.OnTradeOrderInfo
+
+	// Previous is the order before the change (nil for OrderOpened / PendingPlaced;
+	// may be nil for closes if the server only sent the history record).
+	Previous *pb.OnTradeOrderInfo
+
+	// Reason is set for OrderClosed and PartiallyClosed.
+	Reason CloseReason
+
+	// ClosedLots is the closed volume for OrderClosed and PartiallyClosed.
+	ClosedLots float64
+
+	// RemainingTicket is the ticket of the remaining position for PartiallyClosed.
+	RemainingTicket int32
+
+	// Account is the account snapshot delivered with the OnTrade event.
+	Account *pb.OnEventAccountInfo
+}
+
+// partialCloseComment matches the comment of the remainder of a partial close.
+var partialCloseComment = regexp.MustCompile(`^from #(\d+)`)
+
+// DecodeTradeEvents classifies the diffs of one OnTrade message, in the order
+// closes, opens, updates.
+func DecodeTradeEvents(data *pb.OnTradeData) []TradeEvent {
+	ev := data.GetEventData()
+	if ev == nil {
+		return nil
+	}
+	account := data.GetAccountInfo()
+	var out []TradeEvent
+
+	// Remainders of partial closes: closed ticket → remaining order.
+	remainders := make(map[int32]*pb.OnTradeOrderInfo)
+	isRemainder := make(map[*pb.OnTradeOrderInfo]bool)
+	for _, o := range ev.GetNewOrders() {
+		if m := partialCloseComment.FindStringSubmatch(o.GetComment()); m != nil {
+			if from, err := strconv.ParseInt(m[1], 10, 32); err == nil {
+				remainders[int32(from)] = o
+				isRemainder[o] = true
+			}
+		}
+	}
+
+	// Closes and deletions: pair removed orders with their history records.
+	removed := make(map[int32]*pb.OnTradeOrderInfo)
+	for _, o := range ev.GetRemovedOrders() {
+		removed[o.GetTicket()] = o
+	}
+	closed := make(map[int32]bool)
+	closeEvent := func(prev, hist *pb.OnTradeOrderInfo) {
+		ref := hist
+		if ref == nil {
+			ref = prev
+		}
+		ticket := ref.GetTicket()
+		if closed[ticket] {
+			return
+		}
+		closed[ticket] = true
+
+		e := TradeEvent{Ticket: ticket, Order: ref, Previous: prev, Account: account}
+		if isPendingType(ref.GetType()) {
+			e.Kind = EventPendingDeleted
+			if pendingExpired(ref) {
+				e.Kind = EventPendingExpired
+			}
+			out = append(out, e)
+			return
+		}
+		e.Kind = EventOrderClosed
+		e.Reason = closeReason(ref, prev)
+		e.ClosedLots = ref.GetLots()
+		if rest, ok := remainders[ticket]; ok {
+			e.Kind = EventPartiallyClosed
+			e.RemainingTicket = rest.GetTicket()
+			if prev != nil && hist == nil {
+				e.ClosedLots = prev.GetLots() - rest.GetLots()
+			}
+		}
+		out = append(out, e)
+	}
+	for _, h := range ev.GetNewHistoryOrders() {
+		closeEvent(removed[h.GetTicket()], h)
+	}
+	for _, o := range ev.GetRemovedOrders() {
+		closeEvent(o, nil)
+	}
+
+	// Opens (the remainder of a partial close is not a new position).
+	for _, o := range ev.GetNewOrders() {
+		if o.GetIsHistory() || isRemainder[o] {
+			continue
+		}
+		kind := EventOrderOpened
+		if isPendingType(o.GetType()) {
+			kind = EventPendingPlaced
+		}
+		out = append(out, TradeEvent{Kind: kind, Ticket: o.GetTicket(), Order: o, Account: account})
+	}
+
+	// Updates.
+	for _, u := range ev.GetUpdatedOrders() {
+		prev, cur := u.GetPrevious(), u.GetCurrent()
+		if cur == nil {
+			continue
+		}
+		e := TradeEvent{Ticket: cur.GetTicket(), Order: cur, Previous: prev, Account: account}
+		if prev != nil && isPendingType(prev.GetType()) && !isPendingType(cur.GetType()) {
+			e.Kind = EventPendingTriggered
+			out = append(out, e)
+			if stopsChanged(prev, cur, false) {
+				e.Kind = EventStopsModified
+				out = append(out, e)
+			}
+			continue
+		}
+		if prev != nil && stopsChanged(prev, cur, isPendingType(cur.GetType())) {
+			e.Kind = EventStopsModified
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// OnTradeEvents is OnTrade decoded with DecodeTradeEvents: every classified change is
+// delivered as a TradeEvent together with the account snapshot of its OnTrade message.
+//
+// Returns:
+//   - A receive-only channel of TradeEvent (closed when the stream ends).
+//   - A receive-only error channel (same semantics as OnTrade).
+func (a *MT4Account) OnTradeEvents(ctx context.Context) (<-chan TradeEvent, <-chan error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	trades, errs := a.OnTrade(ctx)
+
+	out := make(chan TradeEvent)
+	go func() {
+		defer close(out)
+		for data := range trades {
+			for _, e := range DecodeTradeEvents(data) {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, errs
+}
+
+// isPendingType reports whether t is a limit or stop order.
+func isPendingType(t pb.SUB_ORDER_OPERATION_TYPE) bool {
+	return t != pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_BUY && t != pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_SELL
+}
+
+// pendingExpired reports whether a deleted pending order expired: MT4 tags it
+// "[expiration]", and it is closed at or after its expiration time.
+func pendingExpired(o *pb.OnTradeOrderInfo) bool {
+	if strings.Contains(o.GetComment(), "[expiration]") {
+		return true
+	}
+	exp, closedAt := o.GetExpiration(), o.GetCloseTime()
+	if exp.GetSeconds() <= 0 || closedAt.GetSeconds() <= 0 {
+		return false
+	}
+	// Expiration is checked on the server's tick, allow a second of skew.
+	return !closedAt.AsTime().Before(exp.AsTime().Add(-time.Second))
+}
+
+// closeReason infers why a market order was closed. MT4 tags the history comment with
+// "[sl]", "[tp]" or "so: ..." (stop-out); without a tag, a close price at or beyond a stop
+// means that stop was hit.
+func closeReason(hist, prev *pb.OnTradeOrderInfo) CloseReason {
+	comment := strings.ToLower(hist.GetComment())
+	switch {
+	case strings.Contains(comment, "[sl]"):
+		return CloseStopLoss
+	case strings.Contains(comment, "[tp]"):
+		return CloseTakeProfit
+	case strings.HasPrefix(comment, "so:") || strings.Contains(comment, "[so]") || strings.Contains(comment, "stop out"):
+		return CloseStopOut
+	}
+
+	price := hist.GetClosePrice()
+	if price == 0 {
+		return CloseManual
+	}
+	sl, tp := hist.GetStopLoss(), hist.GetTakeProfit()
+	if prev != nil {
+		sl, tp = prev.GetStopLoss(), prev.GetTakeProfit()
+	}
+	eps := price * 1e-6
+	switch hist.GetType() {
+	case pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_BUY:
+		if sl > 0 && price <= sl+eps {
+			return CloseStopLoss
+		}
+		if tp > 0 && price >= tp-eps {
+			return CloseTakeProfit
+		}
+	case pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_SELL:
+		if sl > 0 && price >= sl-eps {
+			return CloseStopLoss
+		}
+		if tp > 0 && price <= tp+eps {
+			return CloseTakeProfit
+		}
+	}
+	return CloseManual
+}
+
+// stopsChanged reports whether SL / TP changed, or for pending orders also price / expiration.
+func stopsChanged(prev, cur *pb.OnTradeOrderInfo, pending bool) bool {
+	if prev.GetStopLoss() != cur.GetStopLoss() || prev.GetTakeProfit() != cur.GetTakeProfit() {
+		return true
+	}
+	if !pending {
+		return false
+	}
+	return prev.GetOpenPrice() != cur.GetOpenPrice() ||
+		prev.GetExpiration().AsTime() != cur.GetExpiration().AsTime()
+}
@@ -0,0 +1,201 @@
+package mt4_test
+
+import (
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+const (
+	subBuy      = pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_BUY
+	subSell     = pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_SELL
+	subBuyLimit = pb.SUB_ORDER_OPERATION_TYPE_SUB_OP_BUYLIMIT
+)
+
+func TestDecodeTradeEvents(t *testing.T) {
+	expiry := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	buy := &pb.OnTradeOrderInfo{Ticket: 1, Type: subBuy, Lots: 1, OpenPrice: 1.1, StopLoss: 1.09, TakeProfit: 1.12}
+	sell := &pb.OnTradeOrderInfo{Ticket: 2, Type: subSell, Lots: 1, OpenPrice: 1.1, StopLoss: 1.11, TakeProfit: 1.08}
+	limit := &pb.OnTradeOrderInfo{Ticket: 3, Type: subBuyLimit, Lots: 1, OpenPrice: 1.09, Expiration: timestamppb.New(expiry)}
+
+	// with returns a copy of o changed by set.
+	with := func(o *pb.OnTradeOrderInfo, set func(*pb.OnTradeOrderInfo)) *pb.OnTradeOrderInfo {
+		c := &pb.OnTradeOrderInfo{Ticket: o.Ticket, Type: o.Type, Lots: o.Lots, OpenPrice: o.OpenPrice,
+			StopLoss: o.StopLoss, TakeProfit: o.TakeProfit, Expiration: o.Expiration, Comment: o.Comment}
+		set(c)
+		return c
+	}
+	closedAt := func(price float64, comment string) func(*pb.OnTradeOrderInfo) {
+		return func(o *pb.OnTradeOrderInfo) { o.IsHistory, o.ClosePrice, o.Comment = true, price, comment }
+	}
+	type want struct {
+		kind      mt4.TradeEventKind
+		ticket    int32
+		reason    mt4.CloseReason
+		lots      float64
+		remaining int32
+	}
+	tests := []struct {
+		name string
+		ev   *pb.OnTadeEventData
+		want []want
+	}{
+		{"market open", &pb.OnTadeEventData{NewOrders: []*pb.OnTradeOrderInfo{buy}},
+			[]want{{kind: mt4.EventOrderOpened, ticket: 1}}},
+		{"pending placed", &pb.OnTadeEventData{NewOrders: []*pb.OnTradeOrderInfo{limit}},
+			[]want{{kind: mt4.EventPendingPlaced, ticket: 3}}},
+		{"pending triggered", &pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{
+			{Previous: limit, Current: with(limit, func(o *pb.OnTradeOrderInfo) { o.Type = subBuy })}}},
+			[]want{{kind: mt4.EventPendingTriggered, ticket: 3}}},
+		{"pending triggered with new stops", &pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{
+			{Previous: limit, Current: with(limit, func(o *pb.OnTradeOrderInfo) { o.Type, o.StopLoss = subBuy, 1.08 })}}},
+			[]want{{kind: mt4.EventPendingTriggered, ticket: 3}, {kind: mt4.EventStopsModified, ticket: 3}}},
+		{"stop loss moved", &pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{
+			{Previous: buy, Current: with(buy, func(o *pb.OnTradeOrderInfo) { o.StopLoss = 1.095 })}}},
+			[]want{{kind: mt4.EventStopsModified, ticket: 1}}},
+		{"pending price moved", &pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{
+			{Previous: limit, Current: with(limit, func(o *pb.OnTradeOrderInfo) { o.OpenPrice = 1.08 })}}},
+			[]want{{kind: mt4.EventStopsModified, ticket: 3}}},
+		{"profit only", &pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{
+			{Previous: buy, Current: with(buy, func(o *pb.OnTradeOrderInfo) { o.OrderProfit = 12 })}}},
+			nil},
+		{"manual close", &pb.OnTadeEventData{RemovedOrders: []*pb.OnTradeOrderInfo{buy},
+			NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.1, ""))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseManual, lots: 1}}},
+		{"sl tag", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.1, "[sl]"))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseStopLoss, lots: 1}}},
+		{"tp tag", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.1, "[tp]"))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseTakeProfit, lots: 1}}},
+		{"stop-out tag", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.05, "so: 20.0%/1000.0/5000.0"))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseStopOut, lots: 1}}},
+		{"buy at stop loss price", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.0899, ""))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseStopLoss, lots: 1}}},
+		{"sell at take profit price", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(sell, closedAt(1.08, ""))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 2, reason: mt4.CloseTakeProfit, lots: 1}}},
+		{"stops from the previous order", &pb.OnTadeEventData{
+			RemovedOrders:    []*pb.OnTradeOrderInfo{buy},
+			NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, func(o *pb.OnTradeOrderInfo) { closedAt(1.12, "")(o); o.TakeProfit = 0 })}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, reason: mt4.CloseTakeProfit, lots: 1}}},
+		{"removed without history", &pb.OnTadeEventData{RemovedOrders: []*pb.OnTradeOrderInfo{sell}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 2, reason: mt4.CloseManual, lots: 1}}},
+		{"partial close", &pb.OnTadeEventData{
+			RemovedOrders:    []*pb.OnTradeOrderInfo{buy},
+			NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, func(o *pb.OnTradeOrderInfo) { closedAt(1.1, "to #9")(o); o.Lots = 0.4 })},
+			NewOrders:        []*pb.OnTradeOrderInfo{with(buy, func(o *pb.OnTradeOrderInfo) { o.Ticket, o.Lots, o.Comment = 9, 0.6, "from #1" })}},
+			[]want{{kind: mt4.EventPartiallyClosed, ticket: 1, lots: 0.4, remaining: 9}}},
+		{"partial close without history", &pb.OnTadeEventData{
+			RemovedOrders: []*pb.OnTradeOrderInfo{buy},
+			NewOrders:     []*pb.OnTradeOrderInfo{with(buy, func(o *pb.OnTradeOrderInfo) { o.Ticket, o.Lots, o.Comment = 9, 0.25, "from #1" })}},
+			[]want{{kind: mt4.EventPartiallyClosed, ticket: 1, lots: 0.75, remaining: 9}}},
+		{"pending deleted", &pb.OnTadeEventData{RemovedOrders: []*pb.OnTradeOrderInfo{limit},
+			NewHistoryOrders: []*pb.OnTradeOrderInfo{with(limit, func(o *pb.OnTradeOrderInfo) {
+				o.IsHistory, o.CloseTime = true, timestamppb.New(expiry.Add(-time.Hour))
+			})}},
+			[]want{{kind: mt4.EventPendingDeleted, ticket: 3}}},
+		{"pending expired by tag", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(limit, closedAt(0, "[expiration]"))}},
+			[]want{{kind: mt4.EventPendingExpired, ticket: 3}}},
+		{"pending expired by time", &pb.OnTadeEventData{NewHistoryOrders: []*pb.OnTradeOrderInfo{with(limit, func(o *pb.OnTradeOrderInfo) {
+			o.IsHistory, o.CloseTime = true, timestamppb.New(expiry.Add(-500*time.Millisecond))
+		})}},
+			[]want{{kind: mt4.EventPendingExpired, ticket: 3}}},
+		{"closes before opens", &pb.OnTadeEventData{
+			NewOrders:        []*pb.OnTradeOrderInfo{sell},
+			NewHistoryOrders: []*pb.OnTradeOrderInfo{with(buy, closedAt(1.1, ""))}},
+			[]want{{kind: mt4.EventOrderClosed, ticket: 1, lots: 1}, {kind: mt4.EventOrderOpened, ticket: 2}}},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		account := &pb.OnEventAccountInfo{Balance: 1000}
+		got := mt4.DecodeTradeEvents(&pb.OnTradeData{EventData: tt.ev, AccountInfo: account})
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %d events %v, want %d", tt.name, len(got), got, len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			e := got[i]
+			if e.Kind != w.kind || e.Ticket != w.ticket || e.Reason != w.reason || e.RemainingTicket != w.remaining || e.Account != account {
+				t.Errorf("%s: event %d = %v #%d %v rest #%d, want %v #%d %v rest #%d",
+					tt.name, i, e.Kind, e.Ticket, e.Reason, e.RemainingTicket, w.kind, w.ticket, w.reason, w.remaining)
+			}
+			if w.lots != 0 && (e.ClosedLots < w.lots-1e-9 || e.ClosedLots > w.lots+1e-9) {
+				t.Errorf("%s: ClosedLots = %v, want %v", tt.name, e.ClosedLots, w.lots)
+			}
+		}
+	}
+	if got := mt4.DecodeTradeEvents(nil); got != nil {
+		t.Errorf("nil message: %v", got)
+	}
+}
+
+func TestTradeEventStrings(t *testing.T) {
+	if s := mt4.EventPartiallyClosed.String(); s != "PartiallyClosed" {
+		t.Errorf("EventPartiallyClosed = %q", s)
+	}
+	if s := mt4.TradeEventKind(0).String(); s != "Unknown" {
+		t.Errorf("zero kind = %q", s)
+	}
+	if s := mt4.CloseStopOut.String(); s != "stop-out" {
+		t.Errorf("CloseStopOut = %q", s)
+	}
+}
+
+func TestOnTradeEvents(t *testing.T) {
+	srv, account := newTestAccount(t)
+	events, errs := account.OnTradeEvents(testContext(t))
+
+	next := func(kind mt4.TradeEventKind) mt4.TradeEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Kind != kind {
+				t.Fatalf("event = %v #%d, want %v", e.Kind, e.Ticket, kind)
+			}
+			return e
+		case err := <-errs:
+			t.Fatalf("stream error: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no %v event", kind)
+		}
+		return mt4.TradeEvent{}
+	}
+
+	// The subscription is registered asynchronously; retry the first trade until it is seen.
+	var ticket int32
+	deadline := time.After(2 * time.Second)
+	for ticket == 0 {
+		tk := buy(t, account, "EURUSD", 1)
+		select {
+		case e := <-events:
+			if e.Kind == mt4.EventOrderOpened && e.Ticket == tk {
+				ticket = tk
+			}
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no OrderOpened event")
+		}
+	}
+
+	if _, err := account.OrderModify(testContext(t), ticket, nil, ptr(1.05), nil, nil); err != nil {
+		t.Fatalf("OrderModify: %v", err)
+	}
+	if e := next(mt4.EventStopsModified); e.Order.GetStopLoss() != 1.05 || e.Previous.GetStopLoss() != 0 {
+		t.Errorf("StopsModified = %v → %v", e.Previous.GetStopLoss(), e.Order.GetStopLoss())
+	}
+
+	if _, err := account.OrderClose(testContext(t), ticket, ptr(0.4), nil, nil); err != nil {
+		t.Fatalf("partial OrderClose: %v", err)
+	}
+	partial := next(mt4.EventPartiallyClosed)
+	if partial.Ticket != ticket || partial.RemainingTicket == 0 || partial.ClosedLots != 0.4 {
+		t.Errorf("PartiallyClosed = %+v", partial)
+	}
+
+	srv.PushTick("EURUSD", 1.04, 1.0402)
+	if e := next(mt4.EventOrderClosed); e.Ticket != partial.RemainingTicket || e.Reason != mt4.CloseStopLoss {
+		t.Errorf("OrderClosed = #%d %v, want #%d sl", e.Ticket, e.Reason, partial.RemainingTicket)
+	}
+}
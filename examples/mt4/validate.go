@@ -0,0 +1,697 @@
+package mt4
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+)
+
+//=== 📂 Pre-trade validation ===
+//
+// OrderSend and OrderModify pass their arguments through as given, so a bad lot size or a
+// stop too close to the market is only discovered when the server rejects the request.
+// The pre-trade checks compare a request with the symbol specification (SymbolParams,
+// cached) and the current Quote before anything is sent:
+//
+//	trade mode    DISABLED rejects everything, CLOSEONLY rejects new orders, LONGONLY / SHORTONLY the other side
+//	volume        within [VolumeMin, VolumeMax] and on the VolumeStep grid
+//	prices        on the tick grid; pending prices on the right side of the market, TradeStopsLevel points away
+//	SL / TP       on the right side, TradeStopsLevel points from the reference price; none on new
+//	              market orders of a market-execution symbol (set them with OrderModify after the fill)
+//	freeze level  OrderModify is refused while the market is within TradeFreezeLevel points of the
+//	              open price (pending orders) or of the SL / TP (market orders)
+//	margin        with CheckMargin: market orders must fit the free margin (see MarginEstimator)
+//
+// A failed check is a *ValidationError; it satisfies errors.Is with the sentinel the server
+// would have answered with (ErrTradeDisabled, ErrInvalidVolume, ErrInvalidPrice,
+// ErrInvalidStops, ErrModifyDenied, ErrNotEnoughMoney). With ValidationPolicy.Normalize, volumes off the step
+// grid are rounded down and prices are rounded to the tick grid instead of being rejected.
+//
+// ValidateOrderSend / ValidateOrderModify run the checks on demand. With a policy set
+// (WithTradeValidation, ContextWithValidationPolicy) OrderSend, OrderModify and their
+// idempotent variants run them before every request and send the normalized values.
+
+// DefaultSymbolParamsTTL is how long validation caches a symbol specification when
+// ValidationPolicy leaves ParamsTTL zero.
+const DefaultSymbolParamsTTL = time.Minute
+
+// ValidationPolicy configures the pre-trade checks.
+//
+// Example:
+//
+//	account, err := mt4.NewMT4Account(login, password,
+//	    mt4.WithTradeValidation(&mt4.ValidationPolicy{Normalize: true}),
+//	)
+//	...
+//	// 0.123 lots is sent as 0.12; a stop loss inside the stops level never reaches the server.
+//	_, err = account.OrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.123, nil, nil, &sl, nil, nil, nil, nil)
+//	if errors.Is(err, mt4.ErrInvalidStops) { ... }
+type ValidationPolicy struct {
+	// Normalize rounds volumes down to VolumeStep and prices to the tick grid instead of
+	// rejecting them. Volumes out of range and stop distances are always rejected.
+	Normalize bool
+
+	// ParamsTTL is how long a symbol specification is cached (0 = DefaultSymbolParamsTTL).
+	ParamsTTL time.Duration
+
+	// CheckMargin refuses market orders the free margin does not cover, estimated with a
+	// MarginEstimator (ErrNotEnoughMoney). Pending orders hold no margin and are not checked.
+	CheckMargin bool
+
+	// MinMarginLevel, with CheckMargin, also refuses market orders that would leave the
+	// margin level below this percent (0 = free margin only).
+	MinMarginLevel float64
+}
+
+type validationPolicyCtxKey struct{}
+
+// ContextWithValidationPolicy returns a context that enables (or changes) the pre-trade checks
+// of the order calls made with it.
+func ContextWithValidationPolicy(ctx context.Context, p *ValidationPolicy) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, validationPolicyCtxKey{}, p)
+}
+
+// ValidationPolicyFromContext returns the policy set by ContextWithValidationPolicy, if any.
+func ValidationPolicyFromContext(ctx context.Context) (*ValidationPolicy, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	p, ok := ctx.Value(validationPolicyCtxKey{}).(*ValidationPolicy)
+	return p, ok && p != nil
+}
+
+// validationPolicyFor resolves the policy of an order call: ContextWithValidationPolicy →
+// MT4Account.TradeValidation. ok is false when validation is off.
+func (a *MT4Account) validationPolicyFor(ctx context.Context) (p ValidationPolicy, ok bool) {
+	if cp, found := ValidationPolicyFromContext(ctx); found {
+		p, ok = *cp, true
+	} else if a != nil && a.TradeValidation != nil {
+		p, ok = *a.TradeValidation, true
+	}
+	if p.ParamsTTL <= 0 {
+		p.ParamsTTL = DefaultSymbolParamsTTL
+	}
+	return p, ok
+}
+
+// ValidationError describes a request refused by the pre-trade checks.
+// errors.Is(err, Err) holds for the sentinel in Err.
+type ValidationError struct {
+	// Symbol is the symbol of the request.
+	Symbol string
+
+	// Field is the offending argument: "symbol", "volume", "price", "stoploss", "takeprofit" or "order".
+	Field string
+
+	// Value is the offending value (0 for "symbol").
+	Value float64
+
+	// Reason explains the check that failed, with the limit that applied.
+	Reason string
+
+	// Err is the matching sentinel (ErrTradeDisabled, ErrInvalidVolume, ErrInvalidPrice,
+	// ErrInvalidStops, ErrModifyDenied or ErrNotEnoughMoney).
+	Err error
+}
+
+// Error returns a message like "pre-trade check: EURUSD volume 0.005: below VolumeMin 0.01".
+func (e *ValidationError) Error() string {
+	if e.Field == "symbol" {
+		return fmt.Sprintf("pre-trade check: %s: %s", e.Symbol, e.Reason)
+	}
+	return fmt.Sprintf("pre-trade check: %s %s %s: %s", e.Symbol, e.Field, formatFloat(e.Value), e.Reason)
+}
+
+// Unwrap returns the sentinel, so errors.Is(err, ErrInvalidStops) etc. work as for server rejections.
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// OrderCheck is a request that passed the pre-trade checks, with normalized values.
+type OrderCheck struct {
+	// Symbol is the symbol of the request.
+	Symbol string
+
+	// Volume is the volume to send (ValidateOrderSend only).
+	Volume float64
+
+	// Price, StopLoss and TakeProfit are the values to send (nil where the caller passed nil).
+	Price, StopLoss, TakeProfit *float64
+
+	// Adjusted reports whether Normalize changed the volume or a price.
+	Adjusted bool
+
+	// Params and Quote are the specification and market the request was checked against.
+	Params *pb.SymbolParamsManyInfo
+	Quote  *pb.QuoteData
+}
+
+// ValidateOrderSend checks an OrderSend request without sending it.
+//
+// Parameters:
+//   - ctx: Context for the SymbolParams / Quote calls; its ValidationPolicy (or the account's)
+//     decides whether values are normalized.
+//   - symbol, operationType, volume, price, stoploss, takeprofit: Same as OrderSend
+//     (price is required for pending orders; nil or 0 SL/TP = none).
+//
+// Returns:
+//   - The checked request with normalized values.
+//   - A *ValidationError, or the error of the SymbolParams / Quote call.
+//
+// Example:
+//
+//	chk, err := account.ValidateOrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUYLIMIT, 0.1, &price, &sl, &tp)
+//	var verr *mt4.ValidationError
+//	if errors.As(err, &verr) {
+//	    log.Printf("not sent: %s %s", verr.Field, verr.Reason)
+//	}
+func (a *MT4Account) ValidateOrderSend(
+	ctx context.Context,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price, stoploss, takeprofit *float64,
+) (*OrderCheck, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	policy, _ := a.validationPolicyFor(ctx)
+	return a.validateOrderSend(ctx, policy, symbol, operationType, volume, price, stoploss, takeprofit)
+}
+
+// ValidateOrderModify checks an OrderModify request without sending it. The order is read
+// with OrderSelect; SL / TP not passed are checked at their current values.
+//
+// Parameters:
+//   - ctx: Context for the OrderSelect / SymbolParams / Quote calls.
+//   - ticket, price, stoploss, takeprofit: Same as OrderModify (price applies to pending orders only).
+//
+// Returns:
+//   - The checked request with normalized values.
+//   - A *ValidationError, or the error of the OrderSelect / SymbolParams / Quote call.
+func (a *MT4Account) ValidateOrderModify(
+	ctx context.Context,
+	ticket int32,
+	price, stoploss, takeprofit *float64,
+) (*OrderCheck, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !a.isConnected() {
+		return nil, ErrNotConnected
+	}
+	policy, _ := a.validationPolicyFor(ctx)
+	return a.validateOrderModify(ctx, policy, ticket, price, stoploss, takeprofit)
+}
+
+// NormalizeVolume rounds volume down to the VolumeStep grid of p (unchanged when p has no step).
+// Range limits are not applied.
+func NormalizeVolume(p *pb.SymbolParamsManyInfo, volume float64) float64 {
+	step := p.GetVolumeStep()
+	if step <= 0 {
+		return volume
+	}
+	return roundDecimals(math.Floor(volume/step+1e-9)*step, 8)
+}
+
+// NormalizePrice rounds price to the tick grid of p (TradeTickSize, else Point) and to Digits.
+func NormalizePrice(p *pb.SymbolParamsManyInfo, price float64) float64 {
+	tick := priceTick(p)
+	if tick <= 0 && p.GetDigits() <= 0 {
+		return price // no specification
+	}
+	if tick > 0 {
+		price = math.Round(price/tick) * tick
+	}
+	return roundDecimals(price, int(p.GetDigits()))
+}
+
+// validateOrderSend implements ValidateOrderSend for a resolved policy.
+func (a *MT4Account) validateOrderSend(
+	ctx context.Context,
+	policy ValidationPolicy,
+	symbol string,
+	operationType pb.OrderSendOperationType,
+	volume float64,
+	price, stoploss, takeprofit *float64,
+) (*OrderCheck, error) {
+	v, err := a.newTradeCheck(ctx, policy, symbol)
+	if err != nil {
+		return nil, err
+	}
+	t := pb.OpenedOrderType(operationType)
+	buy, pending := isBuyOrderType(t), isPendingOrderType(t)
+
+	if err := v.tradeMode(buy, true); err != nil {
+		return nil, err
+	}
+	chk := v.result()
+	if chk.Volume, err = v.volume(volume); err != nil {
+		return nil, err
+	}
+	if chk.Price, err = v.price("price", price, ErrInvalidPrice); err != nil {
+		return nil, err
+	}
+	if chk.StopLoss, err = v.price("stoploss", stoploss, ErrInvalidStops); err != nil {
+		return nil, err
+	}
+	if chk.TakeProfit, err = v.price("takeprofit", takeprofit, ErrInvalidStops); err != nil {
+		return nil, err
+	}
+
+	sl, tp := deref(chk.StopLoss), deref(chk.TakeProfit)
+	var ref float64
+	if pending {
+		if deref(chk.Price) <= 0 {
+			return nil, v.fail("price", 0, ErrInvalidPrice, "required for pending orders")
+		}
+		ref = *chk.Price
+		if err := v.pendingPrice(t, ref); err != nil {
+			return nil, err
+		}
+	} else {
+		if (sl > 0 || tp > 0) && v.params.GetTradeExeMode() == pb.SP_ENUM_SYMBOL_TRADE_EXECUTION_SYMBOL_TRADE_EXECUTION_MARKET {
+			field, value := "stoploss", sl
+			if sl <= 0 {
+				field, value = "takeprofit", tp
+			}
+			return nil, v.fail(field, value, ErrInvalidStops, "market execution symbol: set SL/TP with OrderModify after the fill")
+		}
+		ref = v.closePrice(buy)
+	}
+	if err := v.stops(buy, ref, sl, tp); err != nil {
+		return nil, err
+	}
+	if policy.CheckMargin && !pending {
+		if err := a.checkMargin(ctx, v, operationType, chk.Volume); err != nil {
+			return nil, err
+		}
+	}
+	chk.Adjusted = v.adjusted
+	return chk, nil
+}
+
+// checkMargin refuses an order the free margin (or MinMarginLevel) does not allow.
+func (a *MT4Account) checkMargin(ctx context.Context, v *tradeCheck, operationType pb.OrderSendOperationType, volume float64) error {
+	est, err := NewMarginEstimator(a, MarginEstimatorConfig{}).Estimate(ctx, v.symbol, operationType, volume, nil)
+	if err != nil {
+		return err
+	}
+	if !est.Fits() {
+		return v.fail("volume", volume, ErrNotEnoughMoney, "needs margin %.2f %s, free margin is %.2f %s",
+			est.Margin, est.Currency, est.FreeMargin, est.Currency)
+	}
+	if lvl := v.policy.MinMarginLevel; lvl > 0 && est.MarginLevelAfter < lvl {
+		return v.fail("volume", volume, ErrNotEnoughMoney, "margin level after the order would be %.1f%%, minimum is %s%%",
+			est.MarginLevelAfter, formatFloat(lvl))
+	}
+	return nil
+}
+
+// validateOrderModify implements ValidateOrderModify for a resolved policy.
+func (a *MT4Account) validateOrderModify(
+	ctx context.Context,
+	policy ValidationPolicy,
+	ticket int32,
+	price, stoploss, takeprofit *float64,
+) (*OrderCheck, error) {
+	order, err := a.OrderSelect(ctx, ticket)
+	if err != nil {
+		return nil, err
+	}
+	v, err := a.newTradeCheck(ctx, policy, order.GetSymbol())
+	if err != nil {
+		return nil, err
+	}
+	t := order.GetOrderType()
+	buy, pending := isBuyOrderType(t), isPendingOrderType(t)
+
+	if err := v.tradeMode(buy, false); err != nil {
+		return nil, err
+	}
+	if err := v.frozen(order); err != nil {
+		return nil, err
+	}
+
+	chk := v.result()
+	chk.Price = price
+	if pending {
+		if chk.Price, err = v.price("price", price, ErrInvalidPrice); err != nil {
+			return nil, err
+		}
+	}
+	if chk.StopLoss, err = v.price("stoploss", stoploss, ErrInvalidStops); err != nil {
+		return nil, err
+	}
+	if chk.TakeProfit, err = v.price("takeprofit", takeprofit, ErrInvalidStops); err != nil {
+		return nil, err
+	}
+
+	ref := v.closePrice(buy)
+	if pending {
+		ref = order.GetOpenPrice()
+		if chk.Price != nil {
+			ref = *chk.Price
+			if err := v.pendingPrice(t, ref); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sl, tp := order.GetStopLoss(), order.GetTakeProfit()
+	if chk.StopLoss != nil {
+		sl = *chk.StopLoss
+	}
+	if chk.TakeProfit != nil {
+		tp = *chk.TakeProfit
+	}
+	if err := v.stops(buy, ref, sl, tp); err != nil {
+		return nil, err
+	}
+	chk.Adjusted = v.adjusted
+	return chk, nil
+}
+
+// tradeCheck holds what one validation runs against.
+type tradeCheck struct {
+	policy   ValidationPolicy
+	symbol   string
+	params   *pb.SymbolParamsManyInfo
+	quote    *pb.QuoteData
+	adjusted bool
+}
+
+// newTradeCheck loads the (cached) specification and the current quote of symbol.
+func (a *MT4Account) newTradeCheck(ctx context.Context, policy ValidationPolicy, symbol string) (*tradeCheck, error) {
+	params, err := a.symbolSpecs.get(ctx, a, symbol, policy.ParamsTTL)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := a.Quote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	return &tradeCheck{policy: policy, symbol: symbol, params: params, quote: quote}, nil
+}
+
+func (v *tradeCheck) result() *OrderCheck {
+	return &OrderCheck{Symbol: v.symbol, Params: v.params, Quote: v.quote}
+}
+
+func (v *tradeCheck) fail(field string, value float64, sentinel error, format string, args ...any) *ValidationError {
+	return &ValidationError{
+		Symbol: v.symbol,
+		Field:  field,
+		Value:  value,
+		Reason: fmt.Sprintf(format, args...),
+		Err:    sentinel,
+	}
+}
+
+// tradeMode applies the symbol trade mode; opening is false for modifications.
+func (v *tradeCheck) tradeMode(buy, opening bool) error {
+	switch v.params.GetTradeMode() {
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_DISABLED:
+		return v.fail("symbol", 0, ErrTradeDisabled, "trading is disabled for the symbol")
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_CLOSEONLY:
+		if opening {
+			return v.fail("symbol", 0, ErrTradeDisabled, "symbol is close-only, new orders are not allowed")
+		}
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_LONGONLY:
+		if opening && !buy {
+			return v.fail("symbol", 0, ErrTradeDisabled, "symbol is long-only, sell orders are not allowed")
+		}
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_SHORTONLY:
+		if opening && buy {
+			return v.fail("symbol", 0, ErrTradeDisabled, "symbol is short-only, buy orders are not allowed")
+		}
+	}
+	return nil
+}
+
+// volume checks (or normalizes) volume against the step grid and the range.
+func (v *tradeCheck) volume(volume float64) (float64, error) {
+	p := v.params
+	if volume <= 0 {
+		return 0, v.fail("volume", volume, ErrInvalidVolume, "must be positive")
+	}
+	if step := p.GetVolumeStep(); step > 0 {
+		if n := NormalizeVolume(p, volume); math.Abs(n-volume) > 1e-9 {
+			if !v.policy.Normalize {
+				return 0, v.fail("volume", volume, ErrInvalidVolume, "not a multiple of VolumeStep %s", formatFloat(step))
+			}
+			volume, v.adjusted = n, true
+		}
+	}
+	if lo := p.GetVolumeMin(); lo > 0 && volume < lo-1e-9 {
+		return 0, v.fail("volume", volume, ErrInvalidVolume, "below VolumeMin %s", formatFloat(lo))
+	}
+	if hi := p.GetVolumeMax(); hi > 0 && volume > hi+1e-9 {
+		return 0, v.fail("volume", volume, ErrInvalidVolume, "above VolumeMax %s", formatFloat(hi))
+	}
+	return volume, nil
+}
+
+// price checks (or normalizes) an optional price against the tick grid; nil and 0 pass unchanged.
+func (v *tradeCheck) price(field string, price *float64, sentinel error) (*float64, error) {
+	if price == nil || *price == 0 {
+		return price, nil
+	}
+	if *price < 0 {
+		return nil, v.fail(field, *price, sentinel, "must not be negative")
+	}
+	n := NormalizePrice(v.params, *price)
+	if math.Abs(n-*price) <= v.epsilon() {
+		return price, nil
+	}
+	if !v.policy.Normalize {
+		return nil, v.fail(field, *price, sentinel, "not on the tick grid (%d digits, tick %s)", v.params.GetDigits(), formatFloat(priceTick(v.params)))
+	}
+	v.adjusted = true
+	return &n, nil
+}
+
+// pendingPrice checks the open price of a pending order against the market and the stops level.
+func (v *tradeCheck) pendingPrice(t pb.OpenedOrderType, price float64) error {
+	dist, side := v.pendingDistance(t, price)
+	if dist <= 0 {
+		return v.fail("price", price, ErrInvalidPrice, "%s must be %s", orderTypeName(t), side)
+	}
+	if dist < v.stopsDistance()-v.epsilon() {
+		return v.fail("price", price, ErrInvalidPrice, "%s points from the market, TradeStopsLevel is %d", formatFloat(roundDecimals(dist/v.point(), 1)), v.params.GetTradeStopsLevel())
+	}
+	return nil
+}
+
+// pendingDistance returns how far price is from the market on its required side
+// (e.g. "below Ask 1.10012" for a buy limit).
+func (v *tradeCheck) pendingDistance(t pb.OpenedOrderType, price float64) (dist float64, side string) {
+	bid, ask := v.quote.GetBid(), v.quote.GetAsk()
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT:
+		return ask - price, "below Ask " + formatFloat(ask)
+	case pb.OpenedOrderType_OO_OP_SELLLIMIT:
+		return price - bid, "above Bid " + formatFloat(bid)
+	case pb.OpenedOrderType_OO_OP_BUYSTOP:
+		return price - ask, "above Ask " + formatFloat(ask)
+	case pb.OpenedOrderType_OO_OP_SELLSTOP:
+		return bid - price, "below Bid " + formatFloat(bid)
+	}
+	return math.Inf(1), ""
+}
+
+// stops checks SL / TP (0 = none) against ref: the open price of pending orders, the
+// close price (Bid for buys, Ask for sells) of market orders.
+func (v *tradeCheck) stops(buy bool, ref, sl, tp float64) error {
+	dir, slSide, tpSide := 1.0, "below", "above"
+	if !buy {
+		dir, slSide, tpSide = -1, "above", "below"
+	}
+	minDist := v.stopsDistance()
+	check := func(field string, level, dist float64, side string) error {
+		if level == 0 {
+			return nil
+		}
+		if dist <= 0 {
+			return v.fail(field, level, ErrInvalidStops, "must be %s %s", side, formatFloat(ref))
+		}
+		if dist < minDist-v.epsilon() {
+			return v.fail(field, level, ErrInvalidStops, "%s points from %s, TradeStopsLevel is %d", formatFloat(roundDecimals(dist/v.point(), 1)), formatFloat(ref), v.params.GetTradeStopsLevel())
+		}
+		return nil
+	}
+	if err := check("stoploss", sl, (ref-sl)*dir, slSide); err != nil {
+		return err
+	}
+	return check("takeprofit", tp, (tp-ref)*dir, tpSide)
+}
+
+// frozen refuses modifications while the market is within the freeze level of the order.
+func (v *tradeCheck) frozen(order *pb.OpenedOrderInfo) error {
+	freeze := float64(v.params.GetTradeFreezeLevel()) * v.point()
+	if freeze <= 0 {
+		return nil
+	}
+	level := v.params.GetTradeFreezeLevel()
+	t := order.GetOrderType()
+	if isPendingOrderType(t) {
+		if dist, _ := v.pendingDistance(t, order.GetOpenPrice()); dist <= freeze+v.epsilon() {
+			return v.fail("order", order.GetOpenPrice(), ErrModifyDenied, "order #%d open price is within TradeFreezeLevel %d of the market", order.GetTicket(), level)
+		}
+		return nil
+	}
+	buy := isBuyOrderType(t)
+	dir := 1.0
+	if !buy {
+		dir = -1
+	}
+	closePrice := v.closePrice(buy)
+	if sl := order.GetStopLoss(); sl != 0 && (closePrice-sl)*dir <= freeze+v.epsilon() {
+		return v.fail("order", sl, ErrModifyDenied, "order #%d stop loss is within TradeFreezeLevel %d of the market", order.GetTicket(), level)
+	}
+	if tp := order.GetTakeProfit(); tp != 0 && (tp-closePrice)*dir <= freeze+v.epsilon() {
+		return v.fail("order", tp, ErrModifyDenied, "order #%d take profit is within TradeFreezeLevel %d of the market", order.GetTicket(), level)
+	}
+	return nil
+}
+
+// closePrice is the price a market order closes at: Bid for buys, Ask for sells.
+func (v *tradeCheck) closePrice(buy bool) float64 {
+	if buy {
+		return v.quote.GetBid()
+	}
+	return v.quote.GetAsk()
+}
+
+func (v *tradeCheck) point() float64 {
+	return symbolPoint(v.params)
+}
+
+func (v *tradeCheck) stopsDistance() float64 {
+	return float64(v.params.GetTradeStopsLevel()) * v.point()
+}
+
+// epsilon absorbs floating point noise in price comparisons.
+func (v *tradeCheck) epsilon() float64 {
+	return v.point() * 1e-3
+}
+
+// symbolParamsCache caches SymbolParams replies for the pre-trade checks, position sizing
+// and currency conversion.
+type symbolParamsCache struct {
+	mu      sync.Mutex
+	entries map[string]symbolParamsEntry
+	list    []*pb.SymbolParamsManyInfo // all symbols (see all)
+	listAt  time.Time
+}
+
+type symbolParamsEntry struct {
+	params *pb.SymbolParamsManyInfo
+	at     time.Time
+}
+
+// get returns the specification of symbol, fetching it when missing or older than ttl.
+func (c *symbolParamsCache) get(ctx context.Context, a *MT4Account, symbol string, ttl time.Duration) (*pb.SymbolParamsManyInfo, error) {
+	c.mu.Lock()
+	e, ok := c.entries[symbol]
+	c.mu.Unlock()
+	if ok && time.Since(e.at) < ttl {
+		return e.params, nil
+	}
+	params, err := a.SymbolParams(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]symbolParamsEntry)
+	}
+	c.entries[symbol] = symbolParamsEntry{params: params, at: time.Now()}
+	c.mu.Unlock()
+	return params, nil
+}
+
+// all returns the specifications of all symbols, fetching them when older than ttl.
+func (c *symbolParamsCache) all(ctx context.Context, a *MT4Account, ttl time.Duration) ([]*pb.SymbolParamsManyInfo, error) {
+	c.mu.Lock()
+	list, at := c.list, c.listAt
+	c.mu.Unlock()
+	if list != nil && time.Since(at) < ttl {
+		return list, nil
+	}
+	data, err := a.SymbolParamsMany(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	list = data.GetSymbolInfos()
+	c.mu.Lock()
+	c.list, c.listAt = list, time.Now()
+	c.mu.Unlock()
+	return list, nil
+}
+
+// isBuyOrderType reports whether t buys (market or pending).
+func isBuyOrderType(t pb.OpenedOrderType) bool {
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUY, pb.OpenedOrderType_OO_OP_BUYLIMIT, pb.OpenedOrderType_OO_OP_BUYSTOP:
+		return true
+	}
+	return false
+}
+
+// orderTypeName returns "buy limit", "sell stop", ... for messages.
+func orderTypeName(t pb.OpenedOrderType) string {
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT:
+		return "buy limit"
+	case pb.OpenedOrderType_OO_OP_SELLLIMIT:
+		return "sell limit"
+	case pb.OpenedOrderType_OO_OP_BUYSTOP:
+		return "buy stop"
+	case pb.OpenedOrderType_OO_OP_SELLSTOP:
+		return "sell stop"
+	}
+	return t.String()
+}
+
+// symbolPoint returns the point of p (10^-digits when the server leaves it zero).
+func symbolPoint(p *pb.SymbolParamsManyInfo) float64 {
+	if pt := p.GetPoint(); pt > 0 {
+		return pt
+	}
+	return math.Pow10(-int(p.GetDigits()))
+}
+
+func priceTick(p *pb.SymbolParamsManyInfo) float64 {
+	if t := p.GetTradeTickSize(); t > 0 {
+		return t
+	}
+	return p.GetPoint()
+}
+
+func roundDecimals(v float64, decimals int) float64 {
+	if decimals <= 0 {
+		return math.Round(v)
+	}
+	pow := math.Pow10(decimals)
+	return math.Round(v*pow) / pow
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func deref(p *float64) float64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,158 @@
+package mt4_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"github.com/MetaRPC/GoMT4/mt4test"
+)
+
+func TestNormalizeVolume(t *testing.T) {
+	tests := []struct {
+		step, volume, want float64
+	}{
+		{0.01, 0.123, 0.12},
+		{0.01, 0.129, 0.12},
+		{0.01, 0.3, 0.3},
+		{0.01, 0.005, 0},
+		{0.1, 1.25, 1.2},
+		{1, 2.999, 2},
+		{0, 0.123, 0.123},
+	}
+	for _, tt := range tests {
+		if got := mt4.NormalizeVolume(&pb.SymbolParamsManyInfo{VolumeStep: tt.step}, tt.volume); got != tt.want {
+			t.Errorf("NormalizeVolume(step %v, %v) = %v, want %v", tt.step, tt.volume, got, tt.want)
+		}
+	}
+	if got := mt4.NormalizeVolume(nil, 0.123); got != 0.123 {
+		t.Errorf("NormalizeVolume(nil) = %v", got)
+	}
+}
+
+func TestNormalizePrice(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     *pb.SymbolParamsManyInfo
+		price float64
+		want  float64
+	}{
+		{"5 digits", mt4test.ForexSymbol("EURUSD", 5), 1.123456, 1.12346},
+		{"3 digits", mt4test.ForexSymbol("USDJPY", 3), 150.1234, 150.123},
+		{"quarter tick", &pb.SymbolParamsManyInfo{Digits: 2, Point: 0.01, TradeTickSize: 0.25}, 4501.13, 4501.25},
+		{"point only", &pb.SymbolParamsManyInfo{Digits: 4, Point: 0.0001}, 1.23456, 1.2346},
+		{"digits only", &pb.SymbolParamsManyInfo{Digits: 1}, 12.34, 12.3},
+		{"no specification", &pb.SymbolParamsManyInfo{}, 1.234567, 1.234567},
+	}
+	for _, tt := range tests {
+		if got := mt4.NormalizePrice(tt.p, tt.price); got != tt.want {
+			t.Errorf("%s: NormalizePrice(%v) = %v, want %v", tt.name, tt.price, got, tt.want)
+		}
+	}
+}
+
+func TestValidateOrderSend(t *testing.T) {
+	srv, account := newTestAccount(t)
+	eurusd := mt4test.ForexSymbol("EURUSD", 5)
+	eurusd.TradeStopsLevel = 10
+	srv.AddSymbol(eurusd, 1.10000, 1.10010)
+	disabled := mt4test.ForexSymbol("GBPUSD", 5)
+	disabled.TradeMode = pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_DISABLED
+	srv.AddSymbol(disabled, 1.27, 1.27012)
+
+	const (
+		buy      = pb.OrderSendOperationType_OC_OP_BUY
+		buyLimit = pb.OrderSendOperationType_OC_OP_BUYLIMIT
+	)
+	tests := []struct {
+		name      string
+		symbol    string
+		op        pb.OrderSendOperationType
+		volume    float64
+		price, sl *float64
+		want      error
+	}{
+		{"valid", "EURUSD", buy, 0.1, nil, ptr(1.09), nil},
+		{"below VolumeMin", "EURUSD", buy, 0.005, nil, nil, mt4.ErrInvalidVolume},
+		{"above VolumeMax", "EURUSD", buy, 200, nil, nil, mt4.ErrInvalidVolume},
+		{"off the step grid", "EURUSD", buy, 0.123, nil, nil, mt4.ErrInvalidVolume},
+		{"stop loss above bid", "EURUSD", buy, 0.1, nil, ptr(1.2), mt4.ErrInvalidStops},
+		{"stop loss inside stops level", "EURUSD", buy, 0.1, nil, ptr(1.09995), mt4.ErrInvalidStops},
+		{"limit above ask", "EURUSD", buyLimit, 0.1, ptr(1.2), nil, mt4.ErrInvalidPrice},
+		{"limit without price", "EURUSD", buyLimit, 0.1, nil, nil, mt4.ErrInvalidPrice},
+		{"trade disabled", "GBPUSD", buy, 0.1, nil, nil, mt4.ErrTradeDisabled},
+	}
+	for _, tt := range tests {
+		chk, err := account.ValidateOrderSend(testContext(t), tt.symbol, tt.op, tt.volume, tt.price, tt.sl, nil)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		var verr *mt4.ValidationError
+		if tt.want != nil && !errors.As(err, &verr) {
+			t.Errorf("%s: %T is not a *ValidationError", tt.name, err)
+		}
+		if tt.want == nil && (chk.Volume != tt.volume || chk.Adjusted) {
+			t.Errorf("%s: check = %+v", tt.name, chk)
+		}
+	}
+
+	// Normalize rounds instead of rejecting.
+	ctx := mt4.ContextWithValidationPolicy(testContext(t), &mt4.ValidationPolicy{Normalize: true})
+	chk, err := account.ValidateOrderSend(ctx, "EURUSD", buyLimit, 0.123, ptr(1.0912345), nil, nil)
+	if err != nil {
+		t.Fatalf("normalized: %v", err)
+	}
+	if chk.Volume != 0.12 || *chk.Price != 1.09123 || !chk.Adjusted {
+		t.Errorf("normalized check = volume %v price %v adjusted %v", chk.Volume, *chk.Price, chk.Adjusted)
+	}
+}
+
+func TestOrderSendValidation(t *testing.T) {
+	srv, account := newTestAccount(t, mt4.WithTradeValidation(&mt4.ValidationPolicy{Normalize: true}))
+
+	_, err := account.OrderSend(testContext(t), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.005, nil, nil, nil, nil, nil, nil, nil)
+	if !errors.Is(err, mt4.ErrInvalidVolume) {
+		t.Fatalf("OrderSend = %v, want ErrInvalidVolume", err)
+	}
+	if got := srv.Calls("OrderSend"); got != 0 {
+		t.Errorf("refused order reached the server (%d calls)", got)
+	}
+
+	ticket := send(t, account, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.129)
+	if o := srv.Order(ticket); o.GetLots() != 0.12 {
+		t.Errorf("sent lots = %v, want the normalized 0.12", o.GetLots())
+	}
+}
+
+// TestValidationHasItsOwnDeadline checks that slow pre-trade checks do not eat into the
+// Trade timeout of the order call.
+func TestValidationHasItsOwnDeadline(t *testing.T) {
+	srv, account := newTestAccount(t,
+		mt4.WithTradeValidation(&mt4.ValidationPolicy{}),
+		mt4.WithDefaultTimeouts(mt4.Timeouts{Read: 500 * time.Millisecond, Trade: 500 * time.Millisecond}),
+		mt4.WithRetryPolicy(&mt4.RetryPolicy{MaxAttempts: 1}),
+	)
+	srv.SetLatency("Quote", 300*time.Millisecond)
+	srv.SetLatency("OrderSend", 300*time.Millisecond)
+	srv.SetLatency("OrderModify", 300*time.Millisecond)
+
+	// No deadline on ctx: checks (300ms) + order (300ms) exceed one Trade timeout, but each fits its own.
+	data, err := account.OrderSend(context.Background(), "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("OrderSend: %v", err)
+	}
+	if _, err := account.OrderModify(context.Background(), data.GetTicket(), nil, ptr(1.05), nil, nil); err != nil {
+		t.Fatalf("OrderModify: %v", err)
+	}
+	if _, err := account.OrderSendIdempotent(context.Background(), "", "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("OrderSendIdempotent: %v", err)
+	}
+	if _, err := account.OrderModifyIdempotent(context.Background(), data.GetTicket(), nil, ptr(1.06), nil, nil); err != nil {
+		t.Fatalf("OrderModifyIdempotent: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+package mt4test
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//=== 📂 Simulated broker ===
+//
+// Every tick (PushTick, PushTickAt, Replay, Feed, MirrorTicks) runs the matching engine:
+// pending orders trigger or expire, SL/TP close positions, swaps are charged at rollover
+// and positions are stopped out when the margin level falls below BrokerRules.StopOutLevel.
+// Results are published as OnTrade events exactly like trades sent through OrderSend.
+
+// BrokerRules configures the simulated broker.
+type BrokerRules struct {
+	// CommissionPerLot is charged (booked as a negative commission) when a position opens,
+	// either by a market OrderSend or a triggered pending order.
+	CommissionPerLot float64
+
+	// StopOutLevel is the margin level (%) below which the most losing position is closed (0 = disabled).
+	StopOutLevel float64
+
+	// RolloverHour is the server hour (0-23) at which daily swaps are charged.
+	RolloverHour int
+
+	// DisableSwaps turns off swap charges.
+	DisableSwaps bool
+}
+
+// DefaultBrokerRules returns the rules used by NewServer: no commission, 50% stop-out, rollover at 00:00.
+func DefaultBrokerRules() BrokerRules {
+	return BrokerRules{StopOutLevel: 50}
+}
+
+// SetBrokerRules replaces the simulated broker rules.
+func (s *Server) SetBrokerRules(r BrokerRules) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rules = r
+}
+
+// clockLocked returns the server time: the simulated time of the last PushTickAt, or the wall clock.
+func (s *Server) clockLocked() time.Time {
+	if !s.simTime.IsZero() {
+		return s.simTime
+	}
+	return s.now()
+}
+
+// advanceClockLocked moves the simulated clock to t (never backwards) and charges swaps
+// for every rollover crossed.
+func (s *Server) advanceClockLocked(t time.Time) {
+	if t.IsZero() || (!s.simTime.IsZero() && !t.After(s.simTime)) {
+		return
+	}
+	s.simTime = t
+	s.rolloverLocked()
+}
+
+// rolloverLocked charges swaps for every rollover between the last one and now.
+func (s *Server) rolloverLocked() {
+	now := s.clockLocked()
+	next := func(t time.Time) time.Time {
+		r := time.Date(t.Year(), t.Month(), t.Day(), s.rules.RolloverHour, 0, 0, 0, t.Location())
+		if !r.After(t) {
+			r = r.AddDate(0, 0, 1)
+		}
+		return r
+	}
+	if s.lastRollover.IsZero() || s.lastRollover.After(now) {
+		s.lastRollover = next(now).AddDate(0, 0, -1)
+		return
+	}
+	for r := next(s.lastRollover); !r.After(now); r = next(r) {
+		s.lastRollover = r
+		if s.rules.DisableSwaps || r.Weekday() == time.Saturday || r.Weekday() == time.Sunday {
+			continue
+		}
+		for _, o := range s.orders {
+			if isPending(o.GetOrderType()) {
+				continue
+			}
+			days := 1.0
+			if int(r.Weekday()) == tripleSwapDay(s.symbols[o.GetSymbol()].params) {
+				days = 3
+			}
+			o.Swap = round2(o.GetSwap() + s.swapLocked(o)*days)
+		}
+	}
+}
+
+// tripleSwapDay returns the weekday on which a triple swap is charged (Wednesday by default).
+func tripleSwapDay(p *pb.SymbolParamsManyInfo) int {
+	if d := p.GetSwapRollover3Days(); d > 0 && d < 6 {
+		return int(d)
+	}
+	return int(time.Wednesday)
+}
+
+// swapLocked returns the daily swap of a position in account currency (MT4 SwapMode semantics).
+func (s *Server) swapLocked(o *pb.OpenedOrderInfo) float64 {
+	st, ok := s.symbols[o.GetSymbol()]
+	if !ok {
+		return 0
+	}
+	p := st.params
+	rate := p.GetSwapShort()
+	if o.GetOrderType() == pb.OpenedOrderType_OO_OP_BUY {
+		rate = p.GetSwapLong()
+	}
+	if rate == 0 {
+		return 0
+	}
+	acct := s.account.GetAccountCurrency()
+	switch p.GetSwapMode() {
+	case 1: // base currency per lot
+		return s.convertLocked(rate*o.GetLots(), p.GetCurrencyBase(), acct)
+	case 2: // annual interest, % of the position value
+		value := o.GetLots() * p.GetTradeContractSize() * s.closePriceLocked(o.GetSymbol(), o.GetOrderType())
+		return s.convertLocked(value*rate/100/360, p.GetCurrencyProfit(), acct)
+	case 3: // margin currency per lot
+		return s.convertLocked(rate*o.GetLots(), marginCurrency(p), acct)
+	default: // points
+		if p.GetTradeTickSize() <= 0 {
+			return 0
+		}
+		return rate * p.GetPoint() / p.GetTradeTickSize() * p.GetTradeTickValue() * o.GetLots()
+	}
+}
+
+// marginLocked returns the margin required by a position in account currency (MT4 TradeCalcMode semantics).
+func (s *Server) marginLocked(o *pb.OpenedOrderInfo) float64 {
+	st, ok := s.symbols[o.GetSymbol()]
+	if !ok || isPending(o.GetOrderType()) {
+		return 0
+	}
+	p := st.params
+	leverage := float64(s.account.GetAccountLeverage())
+	if leverage <= 0 {
+		leverage = 1
+	}
+
+	var margin float64
+	ccy := marginCurrency(p)
+	switch p.GetTradeCalcMode() {
+	case pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FUTURES:
+		margin = o.GetLots() * p.GetMarginInitial()
+	case pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_CFD:
+		margin = o.GetLots() * p.GetTradeContractSize() * s.closePriceLocked(o.GetSymbol(), o.GetOrderType()) / leverage
+		ccy = p.GetCurrencyProfit()
+	default: // forex
+		if p.GetMarginInitial() > 0 {
+			margin = o.GetLots() * p.GetMarginInitial()
+		} else {
+			margin = o.GetLots() * p.GetTradeContractSize() / leverage
+		}
+	}
+	return s.convertLocked(margin, ccy, s.account.GetAccountCurrency())
+}
+
+// marginCurrency returns CurrencyMargin, falling back to CurrencyBase.
+func marginCurrency(p *pb.SymbolParamsManyInfo) string {
+	if c := p.GetCurrencyMargin(); c != "" {
+		return c
+	}
+	return p.GetCurrencyBase()
+}
+
+// convertLocked converts amount between currencies through a direct or inverse symbol quote.
+// Returns amount unchanged if no such symbol exists.
+func (s *Server) convertLocked(amount float64, from, to string) float64 {
+	if from == "" || to == "" || from == to || amount == 0 {
+		return amount
+	}
+	for _, st := range s.symbols {
+		p := st.params
+		switch {
+		case p.GetCurrencyBase() == from && p.GetCurrencyProfit() == to && st.quote.GetBid() > 0:
+			return amount * st.quote.GetBid()
+		case p.GetCurrencyBase() == to && p.GetCurrencyProfit() == from && st.quote.GetAsk() > 0:
+			return amount / st.quote.GetAsk()
+		}
+	}
+	return amount
+}
+
+// updateTickValueLocked recomputes TradeTickValue of forex symbols quoted in a foreign currency,
+// as the terminal does on every tick (e.g. USDJPY for a USD account).
+func (s *Server) updateTickValueLocked(st *symbolState) {
+	p := st.params
+	acct := s.account.GetAccountCurrency()
+	if p.GetTradeCalcMode() != pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FOREX ||
+		p.GetCurrencyProfit() == "" || p.GetCurrencyProfit() == acct || p.GetTradeTickSize() <= 0 {
+		return
+	}
+	local := p.GetTradeContractSize() * p.GetTradeTickSize()
+	if p.GetCurrencyBase() == acct && st.quote.GetBid() > 0 {
+		p.TradeTickValue = local / st.quote.GetBid()
+		return
+	}
+	if v := s.convertLocked(local, p.GetCurrencyProfit(), acct); v != local {
+		p.TradeTickValue = v
+	}
+}
+
+// matchLocked runs the matching engine for one symbol after its quote changed.
+func (s *Server) matchLocked(symbol string) {
+	st, ok := s.symbols[symbol]
+	if !ok {
+		return
+	}
+	now := s.clockLocked()
+	bid, ask := st.quote.GetBid(), st.quote.GetAsk()
+
+	tickets := make([]int32, 0, len(s.orders))
+	for t := range s.orders {
+		tickets = append(tickets, t)
+	}
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i] < tickets[j] })
+
+	for _, t := range tickets {
+		o, ok := s.orders[t]
+		if !ok {
+			continue
+		}
+
+		if isPending(o.GetOrderType()) {
+			if exp := o.GetExpirationTime(); exp.GetSeconds() > 0 && !exp.AsTime().After(now) {
+				s.deleteOrderLocked(o, taggedComment(o.GetComment(), "[expiration]"))
+				continue
+			}
+			if o.GetSymbol() != symbol {
+				continue
+			}
+			if fill, ok := triggerPrice(o, bid, ask); ok {
+				s.activateLocked(o, fill, now)
+			}
+			o = s.orders[t]
+			if o == nil || isPending(o.GetOrderType()) {
+				continue
+			}
+		}
+		if o.GetSymbol() != symbol {
+			continue
+		}
+
+		// SL/TP: positions close at the market price that crossed the level (gaps included).
+		buy := o.GetOrderType() == pb.OpenedOrderType_OO_OP_BUY
+		price := ask
+		if buy {
+			price = bid
+		}
+		switch {
+		case o.GetStopLoss() > 0 && ((buy && bid <= o.GetStopLoss()) || (!buy && ask >= o.GetStopLoss())):
+			s.closeOrderLocked(o, o.GetLots(), price, taggedComment(o.GetComment(), "[sl]"))
+		case o.GetTakeProfit() > 0 && ((buy && bid >= o.GetTakeProfit()) || (!buy && ask <= o.GetTakeProfit())):
+			s.closeOrderLocked(o, o.GetLots(), price, taggedComment(o.GetComment(), "[tp]"))
+		}
+	}
+}
+
+// triggerPrice reports whether a pending order triggers at bid/ask and its fill price.
+// Limits fill at the order price; stops fill at the market (slippage on gaps).
+func triggerPrice(o *pb.OpenedOrderInfo, bid, ask float64) (float64, bool) {
+	price := o.GetOpenPrice()
+	switch o.GetOrderType() {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT:
+		return price, ask <= price
+	case pb.OpenedOrderType_OO_OP_SELLLIMIT:
+		return price, bid >= price
+	case pb.OpenedOrderType_OO_OP_BUYSTOP:
+		return ask, ask >= price
+	case pb.OpenedOrderType_OO_OP_SELLSTOP:
+		return bid, bid <= price
+	}
+	return 0, false
+}
+
+// activateLocked turns a triggered pending order into a position (same ticket) and emits the update.
+// Orders that cannot be covered by free margin are deleted with "[no money]".
+func (s *Server) activateLocked(o *pb.OpenedOrderInfo, fill float64, now time.Time) {
+	prev := proto.Clone(o).(*pb.OpenedOrderInfo)
+	next := proto.Clone(o).(*pb.OpenedOrderInfo)
+	next.OrderType = marketType(o.GetOrderType())
+	next.OpenPrice = fill
+	next.OpenTime = timestamppb.New(now)
+	next.ExpirationTime = nil
+	next.Commision = -round2(s.rules.CommissionPerLot * next.GetLots())
+	s.repriceLocked(next)
+
+	if s.eventAccountInfoLocked().GetFreeMargin()-s.marginLocked(next) < 0 {
+		s.deleteOrderLocked(o, taggedComment(o.GetComment(), "[no money]"))
+		return
+	}
+
+	s.orders[o.GetTicket()] = next
+	s.emitTradeLocked(&pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{{
+		Previous: tradeOrderInfo(prev),
+		Current:  tradeOrderInfo(next),
+	}}})
+}
+
+// stopOutLocked closes the most losing positions while the margin level is below StopOutLevel.
+func (s *Server) stopOutLocked() {
+	if s.rules.StopOutLevel <= 0 {
+		return
+	}
+	for {
+		info := s.eventAccountInfoLocked()
+		if info.GetMargin() <= 0 || info.GetMarginLevel() >= s.rules.StopOutLevel {
+			return
+		}
+		var worst *pb.OpenedOrderInfo
+		for _, o := range s.orders {
+			if isPending(o.GetOrderType()) {
+				continue
+			}
+			if worst == nil || netProfit(o) < netProfit(worst) {
+				worst = o
+			}
+		}
+		if worst == nil {
+			return
+		}
+		comment := fmt.Sprintf("so: %.1f%%/%.1f/%.1f", info.GetMarginLevel(), info.GetEquity(), info.GetMargin())
+		s.closeOrderLocked(worst, worst.GetLots(), s.closePriceLocked(worst.GetSymbol(), worst.GetOrderType()), comment)
+	}
+}
+
+// netProfit returns profit including swap and commission.
+func netProfit(o *pb.OpenedOrderInfo) float64 {
+	return o.GetProfit() + o.GetSwap() + o.GetCommision()
+}
+
+// marketType returns the position type a pending order opens.
+func marketType(t pb.OpenedOrderType) pb.OpenedOrderType {
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT, pb.OpenedOrderType_OO_OP_BUYSTOP:
+		return pb.OpenedOrderType_OO_OP_BUY
+	case pb.OpenedOrderType_OO_OP_SELLLIMIT, pb.OpenedOrderType_OO_OP_SELLSTOP:
+		return pb.OpenedOrderType_OO_OP_SELL
+	}
+	return t
+}
+
+// checkPendingPrice rejects pending prices on the wrong side of the market or inside the stops level.
+func checkPendingPrice(p *pb.SymbolParamsManyInfo, t pb.OpenedOrderType, price, bid, ask float64) *pb.Error {
+	minDist := float64(p.GetTradeStopsLevel())*p.GetPoint() - volumeEpsilon
+	var ok bool
+	switch t {
+	case pb.OpenedOrderType_OO_OP_BUYLIMIT:
+		ok = ask-price >= minDist && price < ask
+	case pb.OpenedOrderType_OO_OP_SELLLIMIT:
+		ok = price-bid >= minDist && price > bid
+	case pb.OpenedOrderType_OO_OP_BUYSTOP:
+		ok = price-ask >= minDist && price > ask
+	case pb.OpenedOrderType_OO_OP_SELLSTOP:
+		ok = bid-price >= minDist && price < bid
+	default:
+		ok = true
+	}
+	if !ok {
+		return tradeError(pb.MqlErrorCode_ERR_INVALID_PRICE)
+	}
+	return nil
+}
+
+// taggedComment appends an MT4 close reason ("[sl]", "[tp]", ...) keeping the 31-char limit.
+func taggedComment(comment, tag string) string {
+	const maxCommentLen = 31
+	if len(comment)+len(tag) > maxCommentLen {
+		comment = comment[:maxCommentLen-len(tag)]
+	}
+	return comment + tag
+}
@@ -0,0 +1,260 @@
+package mt4test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// monday is a Monday noon used as the simulated clock origin.
+var monday = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func lastHistory(t *testing.T, s *Server) *pb.HistoryOrderInfo {
+	t.Helper()
+	h := s.History()
+	if len(h) == 0 {
+		t.Fatal("history is empty")
+	}
+	return h[len(h)-1]
+}
+
+func TestTriggerPrice(t *testing.T) {
+	const bid, ask = 1.1000, 1.1002
+	tests := []struct {
+		typ   pb.OpenedOrderType
+		price float64
+		fill  float64
+		ok    bool
+	}{
+		{pb.OpenedOrderType_OO_OP_BUYLIMIT, 1.1002, 1.1002, true},
+		{pb.OpenedOrderType_OO_OP_BUYLIMIT, 1.0990, 1.0990, false},
+		{pb.OpenedOrderType_OO_OP_SELLLIMIT, 1.0995, 1.0995, true},
+		{pb.OpenedOrderType_OO_OP_SELLLIMIT, 1.1010, 1.1010, false},
+		{pb.OpenedOrderType_OO_OP_BUYSTOP, 1.0995, ask, true}, // gapped through: fills at market
+		{pb.OpenedOrderType_OO_OP_BUYSTOP, 1.1010, ask, false},
+		{pb.OpenedOrderType_OO_OP_SELLSTOP, 1.1005, bid, true},
+		{pb.OpenedOrderType_OO_OP_SELLSTOP, 1.0990, bid, false},
+		{pb.OpenedOrderType_OO_OP_BUY, 1.1, 0, false},
+	}
+	for _, tt := range tests {
+		fill, ok := triggerPrice(&pb.OpenedOrderInfo{OrderType: tt.typ, OpenPrice: tt.price}, bid, ask)
+		if ok != tt.ok || (ok && fill != tt.fill) {
+			t.Errorf("%v at %v: got %v, %v; want %v, %v", tt.typ, tt.price, fill, ok, tt.fill, tt.ok)
+		}
+	}
+}
+
+func TestPendingOrderTriggers(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetBrokerRules(BrokerRules{CommissionPerLot: 7})
+	limit := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUYLIMIT, Lots: 1, OpenPrice: 1.0950})
+	stop := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELLSTOP, Lots: 1, OpenPrice: 1.0980})
+
+	s.PushTick("EURUSD", 1.0990, 1.0991)
+	if o := s.Order(limit); o.GetOrderType() != pb.OpenedOrderType_OO_OP_BUYLIMIT {
+		t.Fatalf("buy limit triggered early: %v", o.GetOrderType())
+	}
+
+	// Gap down through both levels.
+	s.PushTick("EURUSD", 1.0940, 1.0942)
+	if o := s.Order(limit); o.GetOrderType() != pb.OpenedOrderType_OO_OP_BUY || o.GetOpenPrice() != 1.0950 {
+		t.Errorf("buy limit = %v at %v, want BUY at the limit price", o.GetOrderType(), o.GetOpenPrice())
+	}
+	if o := s.Order(stop); o.GetOrderType() != pb.OpenedOrderType_OO_OP_SELL || o.GetOpenPrice() != 1.0940 {
+		t.Errorf("sell stop = %v at %v, want SELL at the gapped bid", o.GetOrderType(), o.GetOpenPrice())
+	}
+	if c := s.Order(limit).GetCommision(); c != -7 {
+		t.Errorf("commission = %v, want -7", c)
+	}
+}
+
+func TestPendingOrderExpires(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.PushTickAt("EURUSD", 1.1, 1.1001, monday)
+	ticket := s.AddOrder(&pb.OpenedOrderInfo{
+		Symbol:         "EURUSD",
+		OrderType:      pb.OpenedOrderType_OO_OP_BUYLIMIT,
+		Lots:           0.1,
+		OpenPrice:      1.09,
+		Comment:        "grid",
+		ExpirationTime: timestamppb.New(monday.Add(time.Hour)),
+	})
+
+	s.PushTickAt("EURUSD", 1.1, 1.1001, monday.Add(30*time.Minute))
+	if s.Order(ticket) == nil {
+		t.Fatal("order expired early")
+	}
+	s.PushTickAt("EURUSD", 1.1, 1.1001, monday.Add(time.Hour))
+	if s.Order(ticket) != nil {
+		t.Fatal("order did not expire")
+	}
+	if c := lastHistory(t, s).GetComment(); c != "grid[expiration]" {
+		t.Errorf("comment = %q", c)
+	}
+}
+
+func TestStopLossAndTakeProfit(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	long := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 1, OpenPrice: 1.1001, StopLoss: 1.0950})
+	short := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_SELL, Lots: 1, OpenPrice: 1.1000, TakeProfit: 1.0960})
+	balance := s.Account().GetAccountBalance()
+
+	s.PushTick("EURUSD", 1.0945, 1.0946)
+	if s.Order(long) != nil || s.Order(short) != nil {
+		t.Fatal("SL/TP not executed")
+	}
+	h := s.History()
+	if len(h) != 2 {
+		t.Fatalf("history = %d, want 2", len(h))
+	}
+	byTicket := map[int32]*pb.HistoryOrderInfo{h[0].GetTicket(): h[0], h[1].GetTicket(): h[1]}
+	if sl := byTicket[long]; sl.GetComment() != "[sl]" || sl.GetClosePrice() != 1.0945 || sl.GetProfit() != -560 {
+		t.Errorf("stop loss = %q at %v profit %v", sl.GetComment(), sl.GetClosePrice(), sl.GetProfit())
+	}
+	if tp := byTicket[short]; tp.GetComment() != "[tp]" || tp.GetClosePrice() != 1.0946 || tp.GetProfit() != 540 {
+		t.Errorf("take profit = %q at %v profit %v", tp.GetComment(), tp.GetClosePrice(), tp.GetProfit())
+	}
+	if got := s.Account().GetAccountBalance(); got != balance-20 {
+		t.Errorf("balance = %v, want %v", got, balance-20)
+	}
+}
+
+func TestStopOut(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetBalance(1000)
+	// 1 lot EURUSD at 1:100 holds 1000 EUR (≈1100 USD) of margin.
+	ticket := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 1, OpenPrice: 1.1000})
+
+	s.PushTick("EURUSD", 1.0980, 1.0981) // 800 / 1098 ≈ 73%
+	if s.Order(ticket) == nil {
+		t.Fatal("stopped out above the stop-out level")
+	}
+	s.PushTick("EURUSD", 1.0940, 1.0941) // 400 / 1094 ≈ 37%
+	if s.Order(ticket) != nil {
+		t.Fatal("position not stopped out")
+	}
+	if c := lastHistory(t, s).GetComment(); !strings.HasPrefix(c, "so: ") {
+		t.Errorf("comment = %q, want a stop-out comment", c)
+	}
+
+	s.SetBrokerRules(BrokerRules{})
+	s.SetBalance(1000)
+	ticket = s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 1, OpenPrice: 1.0940})
+	s.PushTick("EURUSD", 1.0840, 1.0841)
+	if s.Order(ticket) == nil {
+		t.Error("stopped out with StopOutLevel 0")
+	}
+}
+
+func TestPendingOrderWithoutMarginIsDeleted(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetBalance(100)
+	ticket := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUYLIMIT, Lots: 1, OpenPrice: 1.0990})
+
+	s.PushTick("EURUSD", 1.0985, 1.0987)
+	if s.Order(ticket) != nil {
+		t.Fatal("unaffordable pending order activated")
+	}
+	if c := lastHistory(t, s).GetComment(); c != "[no money]" {
+		t.Errorf("comment = %q", c)
+	}
+}
+
+func TestSwapsAtRollover(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	p := ForexSymbol("EURUSD", 5)
+	p.SwapLong = -2 // points per lot: 2 USD per day for 1 lot
+	s.AddSymbol(p, 1.1, 1.1001)
+	s.PushTickAt("EURUSD", 1.1, 1.1001, monday)
+	ticket := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 1, OpenPrice: 1.1001})
+
+	tests := []struct {
+		at   time.Time
+		want float64
+	}{
+		{monday.Add(6 * time.Hour), 0},                           // before rollover
+		{monday.Add(13 * time.Hour), -2},                         // Tuesday 01:00
+		{monday.Add(2*24*time.Hour + 13*time.Hour), -2 - 6 - 2},  // Wednesday triple, Thursday
+		{monday.Add(6*24*time.Hour + 13*time.Hour), -10 - 2 - 2}, // Friday and Monday: weekend rollovers are skipped
+	}
+	for _, tt := range tests {
+		s.PushTickAt("EURUSD", 1.1, 1.1001, tt.at)
+		if got := s.Order(ticket).GetSwap(); got != tt.want {
+			t.Errorf("swap at %v = %v, want %v", tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+
+	s.SetBrokerRules(BrokerRules{DisableSwaps: true})
+	s.PushTickAt("EURUSD", 1.1, 1.1001, monday.Add(8*24*time.Hour))
+	if got := s.Order(ticket).GetSwap(); got != -14 {
+		t.Errorf("swap with DisableSwaps = %v, want -14", got)
+	}
+}
+
+func TestOrderSendChargesCommission(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetBrokerRules(BrokerRules{CommissionPerLot: 7})
+
+	data, apiErr := s.orderSend(&pb.OrderSendRequest{Symbol: "EURUSD", OperationType: pb.OrderSendOperationType_OC_OP_BUY, Volume: 0.5})
+	if apiErr != nil {
+		t.Fatalf("orderSend: %v", apiErr)
+	}
+	if c := s.Order(data.GetTicket()).GetCommision(); c != -3.5 {
+		t.Errorf("commission = %v, want -3.5", c)
+	}
+
+	pending, apiErr := s.orderSend(&pb.OrderSendRequest{Symbol: "EURUSD", OperationType: pb.OrderSendOperationType_OC_OP_BUYLIMIT, Volume: 0.5, Price: ptr(1.09)})
+	if apiErr != nil {
+		t.Fatalf("orderSend pending: %v", apiErr)
+	}
+	if c := s.Order(pending.GetTicket()).GetCommision(); c != 0 {
+		t.Errorf("pending commission = %v, want 0 until it triggers", c)
+	}
+}
+
+func TestCheckPendingPrice(t *testing.T) {
+	p := ForexSymbol("EURUSD", 5)
+	p.TradeStopsLevel = 10
+	const bid, ask = 1.1000, 1.1002
+	tests := []struct {
+		typ   pb.OpenedOrderType
+		price float64
+		ok    bool
+	}{
+		{pb.OpenedOrderType_OO_OP_BUYLIMIT, 1.0992, true},
+		{pb.OpenedOrderType_OO_OP_BUYLIMIT, 1.10015, false}, // inside stops level
+		{pb.OpenedOrderType_OO_OP_SELLLIMIT, 1.1010, true},
+		{pb.OpenedOrderType_OO_OP_SELLLIMIT, 1.0990, false}, // wrong side
+		{pb.OpenedOrderType_OO_OP_BUYSTOP, 1.1012, true},
+		{pb.OpenedOrderType_OO_OP_SELLSTOP, 1.0990, true},
+		{pb.OpenedOrderType_OO_OP_SELLSTOP, 1.1005, false},
+	}
+	for _, tt := range tests {
+		if got := checkPendingPrice(p, tt.typ, tt.price, bid, ask) == nil; got != tt.ok {
+			t.Errorf("%v at %v: ok = %v, want %v", tt.typ, tt.price, got, tt.ok)
+		}
+	}
+}
+
+func TestTaggedComment(t *testing.T) {
+	if got := taggedComment("grid", "[sl]"); got != "grid[sl]" {
+		t.Errorf("taggedComment = %q", got)
+	}
+	long := strings.Repeat("x", 31)
+	if got := taggedComment(long, "[tp]"); len(got) != 31 || !strings.HasSuffix(got, "[tp]") {
+		t.Errorf("taggedComment(long) = %q", got)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
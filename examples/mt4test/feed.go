@@ -0,0 +1,221 @@
+package mt4test
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+)
+
+//=== 📂 Tick sources ===
+
+// Tick is one quote update fed into the simulated broker.
+type Tick struct {
+	Time   time.Time // zero = server clock
+	Symbol string
+	Bid    float64
+	Ask    float64
+}
+
+// PushTickAt is PushTick in simulated time: the server clock jumps to t (never backwards),
+// so pending expiration, swaps and timestamps follow the replayed data.
+func (s *Server) PushTickAt(symbol string, bid, ask float64, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushTickLocked(symbol, bid, ask, t)
+}
+
+// Replay pushes ticks in order.
+// speed scales the original pacing (1 = real time, 60 = a minute per second, 0 = as fast as possible).
+func (s *Server) Replay(ctx context.Context, ticks []Tick, speed float64) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for i, t := range ticks {
+		if speed > 0 && i > 0 && !t.Time.IsZero() && !ticks[i-1].Time.IsZero() {
+			gap := time.Duration(float64(t.Time.Sub(ticks[i-1].Time)) / speed)
+			if err := sleep(ctx, gap); err != nil {
+				return err
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.PushTickAt(t.Symbol, t.Bid, t.Ask, t.Time)
+	}
+	return nil
+}
+
+// Feed pushes ticks received from ch until ch is closed or ctx is done.
+func (s *Server) Feed(ctx context.Context, ch <-chan Tick) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case t, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			s.PushTickAt(t.Symbol, t.Bid, t.Ask, t.Time)
+		}
+	}
+}
+
+// MirrorTicks subscribes to OnSymbolTick on a live account and feeds every tick into the fake
+// until ctx is done or the stream fails. Use it for paper trading on live prices.
+func (s *Server) MirrorTicks(ctx context.Context, account *mt4.MT4Account, symbols []string) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	dataCh, errCh := account.OnSymbolTick(ctx, symbols)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err, ok := <-errCh:
+			if ok && err != nil {
+				return err
+			}
+			return nil
+		case data, ok := <-dataCh:
+			if !ok {
+				return nil
+			}
+			tick := data.GetSymbolTick()
+			s.PushTick(tick.GetSymbol(), tick.GetBid(), tick.GetAsk())
+		}
+	}
+}
+
+// LoadQuoteHistory downloads bars from a live account and expands them into ticks (see TicksFromBars).
+func LoadQuoteHistory(
+	ctx context.Context,
+	account *mt4.MT4Account,
+	symbol string,
+	timeframe pb.ENUM_QUOTE_HISTORY_TIMEFRAME,
+	from, to time.Time,
+) ([]Tick, error) {
+	params, err := account.SymbolParams(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	data, err := account.QuoteHistory(ctx, symbol, timeframe, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return TicksFromBars(data.GetHistoricalQuotes(), TimeframeDuration(timeframe), params.GetPoint()), nil
+}
+
+// TicksFromBars expands OHLC bars into four ticks per bar spread across the bar:
+// open, low, high, close for bullish bars and open, high, low, close for bearish ones,
+// so SL/TP inside the bar range are hit in a plausible order. Ask = bid + Spread*point.
+func TicksFromBars(bars []*pb.HistoryQuote, barDuration time.Duration, point float64) []Tick {
+	ticks := make([]Tick, 0, len(bars)*4)
+	for _, b := range bars {
+		start := b.GetTime().AsTime()
+		spread := float64(b.GetSpread()) * point
+		prices := []float64{b.GetOpen(), b.GetLow(), b.GetHigh(), b.GetClose()}
+		if b.GetClose() < b.GetOpen() {
+			prices[1], prices[2] = b.GetHigh(), b.GetLow()
+		}
+		for i, p := range prices {
+			ticks = append(ticks, Tick{
+				Time:   start.Add(barDuration * time.Duration(i) / 4),
+				Symbol: b.GetSymbol(),
+				Bid:    p,
+				Ask:    p + spread,
+			})
+		}
+	}
+	return ticks
+}
+
+// TimeframeDuration returns the bar length of a QuoteHistory timeframe (MN1 ≈ 30 days).
+func TimeframeDuration(tf pb.ENUM_QUOTE_HISTORY_TIMEFRAME) time.Duration {
+	return mt4.TimeframeDuration(tf)
+}
+
+//=== 📂 Recorded tick files ===
+//
+// Format: CSV lines "time,symbol,bid,ask". time is RFC 3339 (nanoseconds allowed) or Unix milliseconds.
+// An optional header line starting with "time" is skipped, as are empty lines and lines starting with '#'.
+
+// ReadTicksCSV parses recorded ticks.
+func ReadTicksCSV(r io.Reader) ([]Tick, error) {
+	var ticks []Tick
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") || (line == 1 && strings.HasPrefix(strings.ToLower(text), "time")) {
+			continue
+		}
+		f := strings.Split(text, ",")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("line %d: want 4 fields (time,symbol,bid,ask), got %d", line, len(f))
+		}
+		t, err := parseTickTime(strings.TrimSpace(f[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		bid, err := strconv.ParseFloat(strings.TrimSpace(f[2]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bid: %w", line, err)
+		}
+		ask, err := strconv.ParseFloat(strings.TrimSpace(f[3]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: ask: %w", line, err)
+		}
+		ticks = append(ticks, Tick{Time: t, Symbol: strings.TrimSpace(f[1]), Bid: bid, Ask: ask})
+	}
+	return ticks, sc.Err()
+}
+
+// LoadTicksFile reads a recorded tick file (see ReadTicksCSV).
+func LoadTicksFile(path string) ([]Tick, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTicksCSV(f)
+}
+
+// WriteTicksCSV records ticks in the format read by ReadTicksCSV.
+func WriteTicksCSV(w io.Writer, ticks []Tick) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "symbol", "bid", "ask"}); err != nil {
+		return err
+	}
+	for _, t := range ticks {
+		rec := []string{
+			t.Time.UTC().Format(time.RFC3339Nano),
+			t.Symbol,
+			strconv.FormatFloat(t.Bid, 'f', -1, 64),
+			strconv.FormatFloat(t.Ask, 'f', -1, 64),
+		}
+		if err := cw.Write(rec); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// parseTickTime accepts RFC 3339 or Unix milliseconds.
+func parseTickTime(s string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,154 @@
+package mt4test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestTicksFromBars(t *testing.T) {
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	bars := []*pb.HistoryQuote{
+		{Symbol: "EURUSD", Time: timestamppb.New(start), Open: 1.1000, High: 1.1020, Low: 1.0990, Close: 1.1010, Spread: 10},
+		{Symbol: "EURUSD", Time: timestamppb.New(start.Add(time.Hour)), Open: 1.1010, High: 1.1015, Low: 1.0980, Close: 1.0985},
+	}
+	ticks := TicksFromBars(bars, time.Hour, 0.00001)
+	if len(ticks) != 8 {
+		t.Fatalf("ticks = %d, want 8", len(ticks))
+	}
+
+	tests := []struct {
+		i    int
+		at   time.Duration
+		bid  float64
+		note string
+	}{
+		{0, 0, 1.1000, "bullish open"},
+		{1, 15 * time.Minute, 1.0990, "bullish low first"},
+		{2, 30 * time.Minute, 1.1020, "bullish high second"},
+		{3, 45 * time.Minute, 1.1010, "bullish close"},
+		{5, 75 * time.Minute, 1.1015, "bearish high first"},
+		{6, 90 * time.Minute, 1.0980, "bearish low second"},
+	}
+	for _, tt := range tests {
+		tick := ticks[tt.i]
+		if tick.Bid != tt.bid || !tick.Time.Equal(start.Add(tt.at)) || tick.Symbol != "EURUSD" {
+			t.Errorf("%s: tick %d = %+v", tt.note, tt.i, tick)
+		}
+	}
+	if spread := ticks[0].Ask - ticks[0].Bid; spread < 0.000099 || spread > 0.000101 {
+		t.Errorf("spread = %v, want 10 points", spread)
+	}
+	if ticks[4].Ask != ticks[4].Bid {
+		t.Errorf("zero-spread bar: ask %v != bid %v", ticks[4].Ask, ticks[4].Bid)
+	}
+}
+
+func TestTicksCSVRoundTrip(t *testing.T) {
+	in := []Tick{
+		{Time: time.Date(2024, 1, 2, 10, 0, 0, 123456789, time.UTC), Symbol: "EURUSD", Bid: 1.1, Ask: 1.10012},
+		{Time: time.Date(2024, 1, 2, 10, 0, 1, 0, time.UTC), Symbol: "USDJPY", Bid: 150.123, Ask: 150.135},
+	}
+	var buf bytes.Buffer
+	if err := WriteTicksCSV(&buf, in); err != nil {
+		t.Fatalf("WriteTicksCSV: %v", err)
+	}
+	out, err := ReadTicksCSV(&buf)
+	if err != nil {
+		t.Fatalf("ReadTicksCSV: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestReadTicksCSV(t *testing.T) {
+	const input = `time,symbol,bid,ask
+# recorded on demo
+
+1704189600000, EURUSD, 1.1, 1.1001
+2024-01-02T10:00:01Z,GBPUSD,1.27,1.2702
+`
+	ticks, err := ReadTicksCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadTicksCSV: %v", err)
+	}
+	want := []Tick{
+		{Time: time.UnixMilli(1704189600000).UTC(), Symbol: "EURUSD", Bid: 1.1, Ask: 1.1001},
+		{Time: time.Date(2024, 1, 2, 10, 0, 1, 0, time.UTC), Symbol: "GBPUSD", Bid: 1.27, Ask: 1.2702},
+	}
+	if !reflect.DeepEqual(ticks, want) {
+		t.Errorf("ticks = %+v, want %+v", ticks, want)
+	}
+
+	for _, bad := range []string{
+		"2024-01-02T10:00:00Z,EURUSD,1.1\n",
+		"yesterday,EURUSD,1.1,1.1001\n",
+		"2024-01-02T10:00:00Z,EURUSD,x,1.1001\n",
+		"2024-01-02T10:00:00Z,EURUSD,1.1,x\n",
+	} {
+		if _, err := ReadTicksCSV(strings.NewReader(bad)); err == nil || !strings.HasPrefix(err.Error(), "line 1:") {
+			t.Errorf("ReadTicksCSV(%q) error = %v, want a line 1 error", bad, err)
+		}
+	}
+}
+
+func TestReplayRunsTheEngine(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	ticket := s.AddOrder(&pb.OpenedOrderInfo{Symbol: "EURUSD", OrderType: pb.OpenedOrderType_OO_OP_BUY, Lots: 0.1, OpenPrice: 1.1001, TakeProfit: 1.1020})
+
+	ticks := TicksFromBars([]*pb.HistoryQuote{
+		{Symbol: "EURUSD", Time: timestamppb.New(monday), Open: 1.1000, High: 1.1025, Low: 1.0995, Close: 1.1015},
+	}, time.Hour, 0.00001)
+	if err := s.Replay(context.Background(), ticks, 0); err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if s.Order(ticket) != nil {
+		t.Fatal("take profit not hit during replay")
+	}
+	h := lastHistory(t, s)
+	if h.GetComment() != "[tp]" || !h.GetCloseTime().AsTime().Equal(monday.Add(30*time.Minute)) {
+		t.Errorf("closed %q at %v, want [tp] at the bar's high tick", h.GetComment(), h.GetCloseTime().AsTime())
+	}
+}
+
+func TestReplayHonoursContext(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	ticks := []Tick{
+		{Time: monday, Symbol: "EURUSD", Bid: 1.1, Ask: 1.1001},
+		{Time: monday.Add(time.Hour), Symbol: "EURUSD", Bid: 1.2, Ask: 1.2001},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Replay(ctx, ticks, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Replay = %v, want DeadlineExceeded", err)
+	}
+	if q := s.symbols["EURUSD"].quote; q.GetBid() != 1.1 {
+		t.Errorf("bid = %v, want only the first tick applied", q.GetBid())
+	}
+}
+
+func TestFeed(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	ch := make(chan Tick, 2)
+	ch <- Tick{Symbol: "GBPUSD", Bid: 1.3, Ask: 1.3002}
+	ch <- Tick{Symbol: "UNKNOWN", Bid: 1, Ask: 1}
+	close(ch)
+	if err := s.Feed(context.Background(), ch); err != nil {
+		t.Fatalf("Feed: %v", err)
+	}
+	if q := s.symbols["GBPUSD"].quote; q.GetBid() != 1.3 || q.GetAsk() != 1.3002 {
+		t.Errorf("GBPUSD quote = %v/%v", q.GetBid(), q.GetAsk())
+	}
+}
@@ -0,0 +1,479 @@
+// Package mt4test provides an in-process fake of the MT4 terminal gRPC API for hermetic tests.
+//
+// The fake serves ConnectionServer, AccountHelperServer, TradingHelperServer, MarketInfoServer and
+// SubscriptionServiceServer over an in-memory bufconn listener, backed by a scriptable account
+// (balance, orders, symbols, tick feed). Errors, latency and disconnects can be injected per method.
+//
+// Example:
+//
+//	srv := mt4test.NewServer()
+//	defer srv.Close()
+//
+//	srv.FailNext("OrderSend", 1, status.Error(codes.Unavailable, "boom"))
+//
+//	account, err := srv.NewAccount(ctx)
+//	if err != nil {
+//	    t.Fatal(err)
+//	}
+//	defer account.Disconnect()
+//
+//	data, err := account.OrderSend(ctx, "EURUSD", pb.OrderSendOperationType_OC_OP_BUY, 0.1, nil, nil, nil, nil, nil, nil, nil)
+package mt4test
+
+import (
+	"context"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/MetaRPC/GoMT4/mt4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// bufSize is the in-memory listener buffer size.
+	bufSize = 1 << 20
+	// connectionService is the gRPC service that does not require the "id" header.
+	connectionService = "mt4_term_api.Connection"
+)
+
+// Fault describes an injected failure for a gRPC method.
+type Fault struct {
+	// Err is returned as the transport error (e.g. status.Error(codes.Unavailable, "...")).
+	Err error
+
+	// APIError is returned inside the reply's Error field (application-level failure).
+	APIError *pb.Error
+
+	// Latency delays the call before it is handled (or fails).
+	Latency time.Duration
+
+	// DropReply executes the call but replaces the reply with Err
+	// (or codes.Unavailable when Err is nil), simulating a reply lost on the wire.
+	DropReply bool
+
+	// Times is the number of calls the fault applies to (0 = every call until ClearFaults).
+	Times int
+}
+
+// Server is an in-process fake MT4 terminal API.
+// All methods are safe for concurrent use.
+type Server struct {
+	lis  *bufconn.Listener
+	grpc *grpc.Server
+
+	mu sync.Mutex
+
+	// credentials accepted by Connect/ConnectEx (user 0 = accept any)
+	user     uint64
+	password string
+
+	terminals map[string]bool
+	brokers   []*pb.GetBrokerServersByBrokerNameData_BrokerResult
+	stepDelay time.Duration // pause between ConnectStream progress events
+	account   *pb.AccountSummaryData
+	symbols   map[string]*symbolState
+	order     []string // symbol insertion order (SymbolIndex)
+	orders    map[int32]*pb.OpenedOrderInfo
+	history   []*pb.HistoryOrderInfo
+	ticket    int32
+
+	faults  map[string][]*Fault
+	latency map[string]time.Duration
+	calls   map[string]int
+
+	ticks  *hub[*pb.OnSymbolMqlTickInfo]
+	trades *hub[*pb.OnTradeData]
+
+	// dropped is closed by Disconnect to abort all active streams.
+	dropped chan struct{}
+
+	// simulated broker (see engine.go)
+	rules        BrokerRules
+	simTime      time.Time // time of the last PushTickAt (zero = wall clock)
+	lastRollover time.Time
+
+	now func() time.Time
+}
+
+// NewServer starts a fake server on an in-memory listener,
+// seeded with a USD demo account, EURUSD, GBPUSD and USDJPY quotes and DefaultBrokerRules.
+// opts are passed to grpc.NewServer (e.g. grpc.Creds for TLS when serving over TCP with Serve).
+func NewServer(opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		lis:       bufconn.Listen(bufSize),
+		terminals: make(map[string]bool),
+		symbols:   make(map[string]*symbolState),
+		orders:    make(map[int32]*pb.OpenedOrderInfo),
+		ticket:    1000,
+		faults:    make(map[string][]*Fault),
+		latency:   make(map[string]time.Duration),
+		calls:     make(map[string]int),
+		ticks:     newHub[*pb.OnSymbolMqlTickInfo](),
+		trades:    newHub[*pb.OnTradeData](),
+		dropped:   make(chan struct{}),
+		rules:     DefaultBrokerRules(),
+		now:       time.Now,
+	}
+	s.account = &pb.AccountSummaryData{
+		AccountLogin:       100000,
+		AccountBalance:     10000,
+		AccountEquity:      10000,
+		AccountUserName:    "mt4test",
+		AccountLeverage:    100,
+		AccountTradeMode:   pb.EnumAccountTradeMode_ACCOUNT_TRADE_MODE_DEMO,
+		AccountCompanyName: "mt4test",
+		AccountCurrency:    "USD",
+	}
+	s.AddSymbol(ForexSymbol("EURUSD", 5), 1.10000, 1.10010)
+	s.AddSymbol(ForexSymbol("GBPUSD", 5), 1.27000, 1.27012)
+	s.AddSymbol(ForexSymbol("USDJPY", 3), 150.000, 150.012)
+
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	}, opts...)
+	s.grpc = grpc.NewServer(opts...)
+	pb.RegisterConnectionServer(s.grpc, &connectionServer{s: s})
+	pb.RegisterAccountHelperServer(s.grpc, &accountHelperServer{s: s})
+	pb.RegisterTradingHelperServer(s.grpc, &tradingHelperServer{s: s})
+	pb.RegisterMarketInfoServer(s.grpc, &marketInfoServer{s: s})
+	pb.RegisterSubscriptionServiceServer(s.grpc, &subscriptionServer{s: s})
+
+	go func() { _ = s.grpc.Serve(s.lis) }()
+	return s
+}
+
+// Serve additionally serves the fake on lis (e.g. a TCP listener) until Close.
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Close stops the server and aborts all active streams.
+func (s *Server) Close() {
+	s.grpc.Stop()
+	_ = s.lis.Close()
+}
+
+// DialOption returns the option that routes a client connection to the in-memory listener.
+// Use it with any target, e.g. grpc.NewClient("passthrough:///mt4test", srv.DialOption(), ...).
+func (s *Server) DialOption() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return s.lis.DialContext(ctx)
+	})
+}
+
+// Dial opens a plaintext client connection to the fake.
+func (s *Server) Dial(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		s.DialOption(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	return grpc.NewClient("passthrough:///mt4test", opts...)
+}
+
+// AccountOptions returns the options that wire an mt4.MT4Account or mt4.AccountPool to the fake
+// (in-memory transport, no TLS).
+func (s *Server) AccountOptions() []mt4.Option {
+	return []mt4.Option{
+		mt4.WithEndpoint("passthrough:///mt4test"),
+		mt4.WithInsecure(),
+		mt4.WithDialOptions(s.DialOption()),
+	}
+}
+
+// NewAccount returns an mt4.MT4Account wired to the fake and already connected
+// (ConnectByHostPort with the configured credentials and the first symbol as base chart).
+// opts are applied after the in-memory transport, e.g. mt4.WithRetryPolicy or mt4.WithLogger.
+func (s *Server) NewAccount(ctx context.Context, opts ...mt4.Option) (*mt4.MT4Account, error) {
+	s.mu.Lock()
+	user, password := s.user, s.password
+	if user == 0 {
+		user = uint64(s.account.GetAccountLogin())
+	}
+	base := "EURUSD"
+	if len(s.order) > 0 {
+		base = s.order[0]
+	}
+	s.mu.Unlock()
+
+	account, err := mt4.NewMT4Account(user, password, append(s.AccountOptions(), opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	if err := account.ConnectByHostPort(ctx, "mt4test", 443, base, true, 30); err != nil {
+		_ = account.Disconnect()
+		return nil, err
+	}
+	return account, nil
+}
+
+//=== 📂 Fault injection ===
+
+// InjectFault queues f for the given method (short name, e.g. "OrderSend" or "OnSymbolTick").
+// Faults for the same method are applied in the order they were injected.
+func (s *Server) InjectFault(method string, f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = append(s.faults[method], &f)
+}
+
+// FailNext makes the next n calls of method fail with the transport error err.
+func (s *Server) FailNext(method string, n int, err error) {
+	s.InjectFault(method, Fault{Err: err, Times: n})
+}
+
+// FailNextAPI makes the next n calls of method reply with an API error.
+func (s *Server) FailNextAPI(method string, n int, code string, mql pb.MqlErrorCode) {
+	s.InjectFault(method, Fault{APIError: APIError(code, mql), Times: n})
+}
+
+// DropNextReplies executes the next n calls of method but loses their replies (codes.Unavailable).
+func (s *Server) DropNextReplies(method string, n int) {
+	s.InjectFault(method, Fault{DropReply: true, Times: n})
+}
+
+// SetLatency delays every call of method by d (0 removes the delay).
+func (s *Server) SetLatency(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d <= 0 {
+		delete(s.latency, method)
+		return
+	}
+	s.latency[method] = d
+}
+
+// ClearFaults removes all injected faults and latencies.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string][]*Fault)
+	s.latency = make(map[string]time.Duration)
+}
+
+// Calls returns how many times method was invoked (including failed calls).
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Disconnect aborts every active stream with codes.Unavailable, as if the network dropped.
+// New calls and streams are accepted right away.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	close(s.dropped)
+	s.dropped = make(chan struct{})
+}
+
+// DropTerminals forgets every terminal instance, so calls with an old "id" header
+// get TERMINAL_INSTANCE_NOT_FOUND until the client connects again.
+func (s *Server) DropTerminals() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.terminals = make(map[string]bool)
+	close(s.dropped)
+	s.dropped = make(chan struct{})
+}
+
+// APIError builds a pb.Error as returned by the terminal.
+func APIError(code string, mql pb.MqlErrorCode) *pb.Error {
+	e := &pb.Error{
+		ErrorCode:    code,
+		ErrorMessage: code,
+		MqlErrorCode: mql,
+	}
+	if mql != pb.MqlErrorCode_ERR_NO_ERROR {
+		e.Type = pb.ErrorType_MQL_EXECUTION
+		e.MqlErrorIntCode = int32(mql)
+		e.MqlErrorDescription = strings.ToLower(strings.ReplaceAll(strings.TrimPrefix(mql.String(), "ERR_"), "_", " "))
+	}
+	return e
+}
+
+// nextFault pops the next fault for method and counts the call.
+func (s *Server) nextFault(method string) (*Fault, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+	var f *Fault
+	if q := s.faults[method]; len(q) > 0 {
+		f = q[0]
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults[method] = q[1:]
+			}
+		}
+	}
+	return f, s.latency[method]
+}
+
+// checkTerminal verifies the "id" header of non-connection calls.
+func (s *Server) checkTerminal(ctx context.Context, fullMethod string) *pb.Error {
+	if strings.HasPrefix(fullMethod, "/"+connectionService+"/") {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get("id")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(ids) == 0 || !s.terminals[ids[0]] {
+		return APIError("TERMINAL_INSTANCE_NOT_FOUND", pb.MqlErrorCode_ERR_NO_ERROR)
+	}
+	return nil
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	f, latency := s.nextFault(path.Base(info.FullMethod))
+	if f != nil {
+		latency += f.Latency
+	}
+	if err := sleep(ctx, latency); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+
+	if apiErr := s.checkTerminal(ctx, info.FullMethod); apiErr != nil {
+		return errorReply(info.FullMethod, apiErr)
+	}
+
+	if f != nil && !f.DropReply {
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		if f.APIError != nil {
+			return errorReply(info.FullMethod, f.APIError)
+		}
+	}
+
+	resp, err := handler(ctx, req)
+	if f != nil && f.DropReply {
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		return nil, status.Error(codes.Unavailable, "mt4test: reply dropped")
+	}
+	return resp, err
+}
+
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	f, latency := s.nextFault(path.Base(info.FullMethod))
+	if f != nil {
+		latency += f.Latency
+	}
+	if err := sleep(ss.Context(), latency); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	if apiErr := s.checkTerminal(ss.Context(), info.FullMethod); apiErr != nil {
+		reply, err := errorReply(info.FullMethod, apiErr)
+		if err != nil {
+			return err
+		}
+		return ss.SendMsg(reply)
+	}
+
+	if f != nil {
+		if f.Err != nil {
+			return f.Err
+		}
+		if f.APIError != nil {
+			reply, err := errorReply(info.FullMethod, f.APIError)
+			if err != nil {
+				return err
+			}
+			return ss.SendMsg(reply)
+		}
+	}
+	return handler(srv, ss)
+}
+
+// errorReply builds the reply message of fullMethod with its "error" oneof set to apiErr.
+func errorReply(fullMethod string, apiErr *pb.Error) (proto.Message, error) {
+	service, method := path.Split(strings.TrimPrefix(fullMethod, "/"))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(strings.TrimSuffix(service, "/")))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mt4test: %v", err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "mt4test: %s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, status.Errorf(codes.Internal, "mt4test: unknown method %s", fullMethod)
+	}
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "mt4test: %v", err)
+	}
+	reply := mt.New()
+	fd := reply.Descriptor().Fields().ByName("error")
+	if fd == nil {
+		return nil, status.Errorf(codes.Internal, "mt4test: %s has no error field", md.Output().FullName())
+	}
+	reply.Set(fd, protoreflect.ValueOfMessage(proto.Clone(apiErr).ProtoReflect()))
+	return reply.Interface(), nil
+}
+
+// sleep waits for d unless ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// hub fans values out to subscribers; slow subscribers miss values instead of blocking publishers.
+type hub[T any] struct {
+	mu   sync.Mutex
+	subs map[chan T]struct{}
+}
+
+func newHub[T any]() *hub[T] {
+	return &hub[T]{subs: make(map[chan T]struct{})}
+}
+
+func (h *hub[T]) subscribe() (<-chan T, func()) {
+	ch := make(chan T, 256)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+func (h *hub[T]) publish(v T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- v:
+		default:
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package mt4test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// connectRaw dials s and connects a terminal, returning the connection and a
+// context carrying the terminal "id" header.
+func connectRaw(t *testing.T, s *Server) (*grpc.ClientConn, context.Context) {
+	t.Helper()
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	reply, err := pb.NewConnectionClient(conn).Connect(ctx, &pb.ConnectRequest{User: 100000})
+	if err != nil || reply.GetError() != nil {
+		t.Fatalf("Connect: %v %v", err, reply.GetError())
+	}
+	return conn, metadata.AppendToOutgoingContext(ctx, "id", reply.GetData().GetTerminalInstanceGuid())
+}
+
+func newRawServer(t *testing.T) (*Server, *grpc.ClientConn, context.Context) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	conn, ctx := connectRaw(t, s)
+	return s, conn, ctx
+}
+
+func TestFailNextAppliesNTimes(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	client := pb.NewMarketInfoClient(conn)
+	s.FailNext("Quote", 2, status.Error(codes.Unavailable, "down"))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Quote(ctx, &pb.QuoteRequest{Symbol: "EURUSD"}); status.Code(err) != codes.Unavailable {
+			t.Fatalf("call %d: err = %v, want Unavailable", i, err)
+		}
+	}
+	reply, err := client.Quote(ctx, &pb.QuoteRequest{Symbol: "EURUSD"})
+	if err != nil || reply.GetData().GetBid() != 1.1 {
+		t.Fatalf("third call: %v, %v", reply, err)
+	}
+	if got := s.Calls("Quote"); got != 3 {
+		t.Errorf("Calls(Quote) = %d, want 3", got)
+	}
+}
+
+func TestFailNextAPIReturnsReplyError(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	s.FailNextAPI("OrderSend", 1, "MQL_ERROR", pb.MqlErrorCode_ERR_REQUOTE)
+
+	reply, err := pb.NewTradingHelperClient(conn).OrderSend(ctx, &pb.OrderSendRequest{
+		Symbol: "EURUSD", OperationType: pb.OrderSendOperationType_OC_OP_BUY, Volume: 0.1,
+	})
+	if err != nil {
+		t.Fatalf("OrderSend transport error: %v", err)
+	}
+	if got := reply.GetError().GetMqlErrorCode(); got != pb.MqlErrorCode_ERR_REQUOTE {
+		t.Errorf("reply error = %v, want ERR_REQUOTE", got)
+	}
+	if len(s.Orders()) != 0 {
+		t.Error("rejected OrderSend opened an order")
+	}
+}
+
+func TestDropNextRepliesExecutesCall(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	s.DropNextReplies("OrderSend", 1)
+
+	_, err := pb.NewTradingHelperClient(conn).OrderSend(ctx, &pb.OrderSendRequest{
+		Symbol: "EURUSD", OperationType: pb.OrderSendOperationType_OC_OP_BUY, Volume: 0.1,
+	})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("OrderSend err = %v, want Unavailable", err)
+	}
+	if got := len(s.Orders()); got != 1 {
+		t.Errorf("orders = %d, want 1: the call must execute even though its reply is lost", got)
+	}
+}
+
+func TestFaultsQueueInOrder(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	first, second := errors.New("first"), errors.New("second")
+	s.FailNext("Quote", 1, first)
+	s.FailNext("Quote", 1, second)
+
+	for _, want := range []error{first, second, nil} {
+		f, _ := s.nextFault("Quote")
+		var got error
+		if f != nil {
+			got = f.Err
+		}
+		if got != want {
+			t.Fatalf("fault = %v, want %v", got, want)
+		}
+	}
+
+	// Times == 0 applies until ClearFaults.
+	s.InjectFault("Quote", Fault{Err: first})
+	for i := 0; i < 3; i++ {
+		if f, _ := s.nextFault("Quote"); f == nil {
+			t.Fatalf("permanent fault gone after %d calls", i)
+		}
+	}
+	s.ClearFaults()
+	if f, _ := s.nextFault("Quote"); f != nil {
+		t.Error("fault survived ClearFaults")
+	}
+}
+
+func TestSetLatency(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	client := pb.NewMarketInfoClient(conn)
+	s.SetLatency("Quote", time.Second)
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Quote(short, &pb.QuoteRequest{Symbol: "EURUSD"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Quote err = %v, want DeadlineExceeded", err)
+	}
+
+	s.SetLatency("Quote", 0)
+	short, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if _, err := client.Quote(short, &pb.QuoteRequest{Symbol: "EURUSD"}); err != nil {
+		t.Fatalf("Quote after removing latency: %v", err)
+	}
+}
+
+func TestCheckTerminal(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.terminals["live"] = true
+	withID := func(id string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("id", id))
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		found  bool
+	}{
+		{"live terminal", withID("live"), "/mt4_term_api.MarketInfo/Quote", true},
+		{"unknown terminal", withID("gone"), "/mt4_term_api.MarketInfo/Quote", false},
+		{"no header", context.Background(), "/mt4_term_api.MarketInfo/Quote", false},
+		{"connection service needs no header", context.Background(), "/mt4_term_api.Connection/Connect", true},
+	}
+	for _, tt := range tests {
+		apiErr := s.checkTerminal(tt.ctx, tt.method)
+		if (apiErr == nil) != tt.found {
+			t.Errorf("%s: checkTerminal = %v", tt.name, apiErr)
+		}
+		if apiErr != nil && apiErr.GetErrorCode() != "TERMINAL_INSTANCE_NOT_FOUND" {
+			t.Errorf("%s: code = %s", tt.name, apiErr.GetErrorCode())
+		}
+	}
+}
+
+func TestDropTerminals(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	s.DropTerminals()
+
+	reply, err := pb.NewAccountHelperClient(conn).AccountSummary(ctx, &pb.AccountSummaryRequest{})
+	if err != nil {
+		t.Fatalf("AccountSummary: %v", err)
+	}
+	if got := reply.GetError().GetErrorCode(); got != "TERMINAL_INSTANCE_NOT_FOUND" {
+		t.Fatalf("error code = %q, want TERMINAL_INSTANCE_NOT_FOUND", got)
+	}
+
+	// Connecting again with the old id revives it.
+	if _, err := pb.NewConnectionClient(conn).Connect(ctx, &pb.ConnectRequest{User: 100000}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if reply, err := pb.NewAccountHelperClient(conn).AccountSummary(ctx, &pb.AccountSummaryRequest{}); err != nil || reply.GetError() != nil {
+		t.Fatalf("AccountSummary after reconnect: %v %v", err, reply.GetError())
+	}
+}
+
+func TestDisconnectAbortsStreams(t *testing.T) {
+	s, conn, ctx := newRawServer(t)
+	stream, err := pb.NewSubscriptionServiceClient(conn).OnSymbolTick(ctx, &pb.OnSymbolTickRequest{SymbolNames: []string{"EURUSD"}})
+	if err != nil {
+		t.Fatalf("OnSymbolTick: %v", err)
+	}
+	// Ticks pushed before the handler subscribes are lost, so keep pushing until one arrives.
+	received := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-received:
+				return
+			case <-time.After(5 * time.Millisecond):
+				s.PushTick("EURUSD", 1.2, 1.2001)
+			}
+		}
+	}()
+	reply, err := stream.Recv()
+	close(received)
+	if err != nil || reply.GetData().GetSymbolTick().GetBid() != 1.2 {
+		t.Fatalf("Recv: %v, %v", reply, err)
+	}
+
+	s.Disconnect()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Recv after Disconnect: %v, want Unavailable", err)
+	}
+
+	// New streams are accepted right away.
+	if _, err := pb.NewSubscriptionServiceClient(conn).OnSymbolTick(ctx, &pb.OnSymbolTickRequest{}); err != nil {
+		t.Fatalf("OnSymbolTick after Disconnect: %v", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	e := APIError("MQL_ERROR", pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)
+	if e.GetMqlErrorIntCode() != int32(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME) || e.GetMqlErrorDescription() != "invalid trade volume" {
+		t.Errorf("APIError = %+v", e)
+	}
+	if e := APIError("TERMINAL_INSTANCE_NOT_FOUND", pb.MqlErrorCode_ERR_NO_ERROR); e.GetMqlErrorIntCode() != 0 || e.GetType() != pb.ErrorType(0) {
+		t.Errorf("APIError without MQL code = %+v", e)
+	}
+}
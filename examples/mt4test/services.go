@@ -0,0 +1,992 @@
+package mt4test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// volumeEpsilon is the tolerance used when checking volumes against VolumeStep.
+const volumeEpsilon = 1e-8
+
+// tradeError builds an MQL trade rejection.
+func tradeError(mql pb.MqlErrorCode) *pb.Error {
+	return APIError("MQL_ERROR", mql)
+}
+
+//=== 📂 Connection ===
+
+type connectionServer struct {
+	pb.UnimplementedConnectionServer
+	s *Server
+}
+
+// connect validates credentials and registers a terminal instance.
+// The "id" header of ctx, if any, is reused as the instance id (as the real server does with GetId ids).
+func (s *Server) connect(ctx context.Context, user uint64, password string) (string, *pb.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.user != 0 && (user != s.user || password != s.password) {
+		return "", APIError("INVALID_ACCOUNT", pb.MqlErrorCode_ERR_INVALID_ACCOUNT)
+	}
+	guid := uuid.NewString()
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get("id"); len(ids) > 0 {
+		if _, err := uuid.Parse(ids[0]); err == nil {
+			guid = ids[0]
+		}
+	}
+	s.terminals[guid] = true
+	return guid, nil
+}
+
+// checkServerName rejects server names missing from the broker directory (see AddBrokerServer).
+// Any name is accepted while the directory is empty.
+func (s *Server) checkServerName(name string) *pb.Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.brokers) == 0 {
+		return nil
+	}
+	for _, b := range s.brokers {
+		for _, srv := range b.GetResults() {
+			if srv.GetName() == name {
+				return nil
+			}
+		}
+	}
+	return APIError("INVALID_SERVER", pb.MqlErrorCode_ERR_NO_ERROR)
+}
+
+// terminalFromContext returns the "id" header of ctx if it refers to a live terminal.
+func (s *Server) terminalFromContext(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ids := md.Get("id")
+	if len(ids) == 0 {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ids[0], s.terminals[ids[0]]
+}
+
+// terminalNotFound is the reply error for calls on a dropped terminal.
+func terminalNotFound() *pb.Error {
+	return APIError("TERMINAL_INSTANCE_NOT_FOUND", pb.MqlErrorCode_ERR_NO_ERROR)
+}
+
+func (c *connectionServer) Connect(ctx context.Context, req *pb.ConnectRequest) (*pb.ConnectReply, error) {
+	guid, apiErr := c.s.connect(ctx, req.GetUser(), req.GetPassword())
+	if apiErr != nil {
+		return &pb.ConnectReply{Response: &pb.ConnectReply_Error{Error: apiErr}}, nil
+	}
+	data := &pb.ConnectData{TerminalInstanceGuid: guid, TerminalType: pb.TerminalType_MT4}
+	return &pb.ConnectReply{Response: &pb.ConnectReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) ConnectEx(ctx context.Context, req *pb.ConnectExRequest) (*pb.ConnectExReply, error) {
+	if apiErr := c.s.checkServerName(req.GetMtClusterName()); apiErr != nil {
+		return &pb.ConnectExReply{Response: &pb.ConnectExReply_Error{Error: apiErr}}, nil
+	}
+	guid, apiErr := c.s.connect(ctx, req.GetUser(), req.GetPassword())
+	if apiErr != nil {
+		return &pb.ConnectExReply{Response: &pb.ConnectExReply_Error{Error: apiErr}}, nil
+	}
+	data := &pb.ConnectData{TerminalInstanceGuid: guid, TerminalType: pb.TerminalType_MT4}
+	return &pb.ConnectExReply{Response: &pb.ConnectExReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) ConnectProxy(ctx context.Context, req *pb.ConnectProxyRequest) (*pb.ConnectProxyReply, error) {
+	if req.GetProxyHost() == "" || req.GetProxyType() == pb.ProxyTypes_None {
+		apiErr := APIError("INVALID_PROXY", pb.MqlErrorCode_ERR_INVALID_FUNCTION_PARAMVALUE)
+		return &pb.ConnectProxyReply{Response: &pb.ConnectProxyReply_Error{Error: apiErr}}, nil
+	}
+	guid, apiErr := c.s.connect(ctx, req.GetUser(), req.GetPassword())
+	if apiErr != nil {
+		return &pb.ConnectProxyReply{Response: &pb.ConnectProxyReply_Error{Error: apiErr}}, nil
+	}
+	data := &pb.ConnectProxyData{UniqueIdentifier: guid, TerminalType: pb.TerminalType_MT4}
+	return &pb.ConnectProxyReply{Response: &pb.ConnectProxyReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) CheckConnect(ctx context.Context, _ *pb.CheckConnectRequest) (*pb.CheckConnectReply, error) {
+	id, alive := c.s.terminalFromContext(ctx)
+	data := &pb.CheckConnectData{
+		UniqueIdentifier: id,
+		HealthCheck: &pb.TerminalHealthCheck{
+			IsAlive:                       alive,
+			ApiIsAlive:                    alive,
+			TerminalIsConnectedToMtServer: alive,
+		},
+	}
+	return &pb.CheckConnectReply{Response: &pb.CheckConnectReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) Disconnect(ctx context.Context, _ *pb.DisconnectRequest) (*pb.DisconnectReply, error) {
+	id, alive := c.s.terminalFromContext(ctx)
+	if !alive {
+		return &pb.DisconnectReply{Response: &pb.DisconnectReply_Error{Error: terminalNotFound()}}, nil
+	}
+	c.s.mu.Lock()
+	delete(c.s.terminals, id)
+	c.s.mu.Unlock()
+	data := &pb.DisconnectData{UniqueIdentifier: id}
+	return &pb.DisconnectReply{Response: &pb.DisconnectReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) Reconnect(ctx context.Context, req *pb.ReconnectRequest) (*pb.ReconnectReply, error) {
+	id, alive := c.s.terminalFromContext(ctx)
+	if id == "" {
+		return &pb.ReconnectReply{Response: &pb.ReconnectReply_Error{Error: terminalNotFound()}}, nil
+	}
+	recreate := !alive || req.GetForceReconnection()
+	c.s.mu.Lock()
+	c.s.terminals[id] = true
+	c.s.mu.Unlock()
+	data := &pb.ReconnectData{
+		TerminalWasRecreated: recreate,
+		TerminalType:         pb.TerminalType_MT4,
+		TerminalInstanceGuid: id,
+	}
+	return &pb.ReconnectReply{Response: &pb.ReconnectReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) GetId(_ context.Context, req *pb.GetIdRequest) (*pb.GetIdReply, error) {
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(req.GetUser()+":"+req.GetPassword()))
+	data := &pb.GetIdData{Id: id.String()}
+	return &pb.GetIdReply{Response: &pb.GetIdReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) Screenshot(ctx context.Context, _ *pb.ScreenshotRequest) (*pb.ScreenshotReply, error) {
+	id, alive := c.s.terminalFromContext(ctx)
+	if !alive {
+		return &pb.ScreenshotReply{Response: &pb.ScreenshotReply_Error{Error: terminalNotFound()}}, nil
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := &pb.ScreenshotData{ImageData: buf.Bytes(), ContentType: "image/png", TerminalId: id}
+	return &pb.ScreenshotReply{Response: &pb.ScreenshotReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) GetBrokerServersByBrokerName(_ context.Context, req *pb.GetBrokerServersByBrokerNameRequest) (*pb.GetBrokerServersByBrokerNameReply, error) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	name := strings.ToLower(req.GetBrokerName())
+	data := &pb.GetBrokerServersByBrokerNameData{}
+	for _, b := range c.s.brokers {
+		if strings.Contains(strings.ToLower(b.GetCompany()), name) {
+			data.Result = append(data.Result, proto.Clone(b).(*pb.GetBrokerServersByBrokerNameData_BrokerResult))
+		}
+	}
+	return &pb.GetBrokerServersByBrokerNameReply{Response: &pb.GetBrokerServersByBrokerNameReply_Data{Data: data}}, nil
+}
+
+func (c *connectionServer) ConnectStream(req *pb.ConnectRequest, stream pb.Connection_ConnectStreamServer) error {
+	return c.s.connectStream(stream.Context(), req.GetUser(), req.GetPassword(), "", stream.Send)
+}
+
+func (c *connectionServer) ConnectExStream(req *pb.ConnectExRequest, stream pb.Connection_ConnectExStreamServer) error {
+	return c.s.connectStream(stream.Context(), req.GetUser(), req.GetPassword(), req.GetMtClusterName(), stream.Send)
+}
+
+// connectStream emits the progress steps of a cold start, then the final event
+// with ConnectData or ErrorData. serverName is empty for ConnectStream.
+func (s *Server) connectStream(ctx context.Context, user uint64, password, serverName string, send func(*pb.ConnectStreamEvent) error) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("id")) == 0 {
+		return status.Error(codes.InvalidArgument, "id header is required (use GetId)")
+	}
+
+	s.mu.Lock()
+	delay := s.stepDelay
+	s.mu.Unlock()
+
+	start := time.Now()
+	event := func(step, message, level string) *pb.ConnectStreamEvent {
+		return &pb.ConnectStreamEvent{
+			Step:      step,
+			Message:   message,
+			Level:     level,
+			ElapsedMs: time.Since(start).Milliseconds(),
+			Timestamp: timestamppb.Now(),
+		}
+	}
+
+	steps := [][2]string{
+		{"Init", "request accepted"},
+		{"Validation", "credentials checked"},
+		{"ColdStart-CreateInstance", "terminal instance created"},
+		{"ColdStart-ReadinessCheck", "waiting for terminal"},
+		{"Journal", fmt.Sprintf("'%d': login", user)},
+	}
+	for _, st := range steps {
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+		if err := send(event(st[0], st[1], "Info")); err != nil {
+			return err
+		}
+	}
+
+	var guid string
+	apiErr := s.checkServerName(serverName)
+	if serverName == "" {
+		apiErr = nil
+	}
+	if apiErr == nil {
+		guid, apiErr = s.connect(ctx, user, password)
+	}
+	var final *pb.ConnectStreamEvent
+	if apiErr != nil {
+		final = event("Error", apiErr.GetErrorMessage(), "Error")
+		final.ErrorData = apiErr
+	} else {
+		final = event("Complete", "connected", "Info")
+		final.ConnectData = &pb.ConnectData{TerminalInstanceGuid: guid, TerminalType: pb.TerminalType_MT4}
+	}
+	final.IsFinal = true
+	return send(final)
+}
+
+//=== 📂 Account helper ===
+
+type accountHelperServer struct {
+	pb.UnimplementedAccountHelperServer
+	s *Server
+}
+
+func (h *accountHelperServer) AccountSummary(context.Context, *pb.AccountSummaryRequest) (*pb.AccountSummaryReply, error) {
+	data := h.s.Account()
+	return &pb.AccountSummaryReply{Response: &pb.AccountSummaryReply_Data{Data: data}}, nil
+}
+
+func (h *accountHelperServer) OpenedOrders(_ context.Context, req *pb.OpenedOrdersRequest) (*pb.OpenedOrdersReply, error) {
+	orders := h.s.Orders()
+	switch req.GetSortType() {
+	case pb.EnumOpenedOrderSortType_SORT_BY_OPEN_TIME_ASC:
+		sort.SliceStable(orders, func(i, j int) bool {
+			return orders[i].GetOpenTime().AsTime().Before(orders[j].GetOpenTime().AsTime())
+		})
+	case pb.EnumOpenedOrderSortType_SORT_BY_OPEN_TIME_DESC:
+		sort.SliceStable(orders, func(i, j int) bool {
+			return orders[i].GetOpenTime().AsTime().After(orders[j].GetOpenTime().AsTime())
+		})
+	case pb.EnumOpenedOrderSortType_SORT_BY_ORDER_TICKET_ID_DESC:
+		sort.SliceStable(orders, func(i, j int) bool { return orders[i].GetTicket() > orders[j].GetTicket() })
+	}
+	for i, o := range orders {
+		o.SortIndex = int32(i)
+	}
+	data := &pb.OpenedOrdersData{OrderInfos: orders}
+	return &pb.OpenedOrdersReply{Response: &pb.OpenedOrdersReply_Data{Data: data}}, nil
+}
+
+func (h *accountHelperServer) OpenedOrdersTickets(context.Context, *pb.OpenedOrdersTicketsRequest) (*pb.OpenedOrdersTicketsReply, error) {
+	data := &pb.OpenedOrdersTicketsData{}
+	for _, o := range h.s.Orders() {
+		data.Tickets = append(data.Tickets, o.GetTicket())
+	}
+	return &pb.OpenedOrdersTicketsReply{Response: &pb.OpenedOrdersTicketsReply_Data{Data: data}}, nil
+}
+
+func (h *accountHelperServer) OrdersHistory(_ context.Context, req *pb.OrdersHistoryRequest) (*pb.OrdersHistoryReply, error) {
+	var orders []*pb.HistoryOrderInfo
+	for _, o := range h.s.History() {
+		ct := o.GetCloseTime().AsTime()
+		if req.InputFrom != nil && ct.Before(req.GetInputFrom().AsTime()) {
+			continue
+		}
+		if req.InputTo != nil && ct.After(req.GetInputTo().AsTime()) {
+			continue
+		}
+		orders = append(orders, o)
+	}
+
+	var less func(i, j int) bool
+	switch req.GetInputSortMode() {
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_OPEN_TIME_ASC:
+		less = func(i, j int) bool { return orders[i].GetOpenTime().AsTime().Before(orders[j].GetOpenTime().AsTime()) }
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_OPEN_TIME_DESC:
+		less = func(i, j int) bool { return orders[i].GetOpenTime().AsTime().After(orders[j].GetOpenTime().AsTime()) }
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_CLOSE_TIME_ASC:
+		less = func(i, j int) bool {
+			return orders[i].GetCloseTime().AsTime().Before(orders[j].GetCloseTime().AsTime())
+		}
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_CLOSE_TIME_DESC:
+		less = func(i, j int) bool { return orders[i].GetCloseTime().AsTime().After(orders[j].GetCloseTime().AsTime()) }
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_ORDER_TICKET_ID_ASC:
+		less = func(i, j int) bool { return orders[i].GetTicket() < orders[j].GetTicket() }
+	case pb.EnumOrderHistorySortType_HISTORY_SORT_BY_ORDER_TICKET_ID_DESC:
+		less = func(i, j int) bool { return orders[i].GetTicket() > orders[j].GetTicket() }
+	}
+	if less != nil {
+		sort.SliceStable(orders, less)
+	}
+
+	total := int32(len(orders))
+	if req.PageNumber != nil && req.ItemsPerPage != nil && req.GetItemsPerPage() > 0 {
+		page := req.GetPageNumber()
+		if page < 1 {
+			page = 1
+		}
+		start := int((page - 1) * req.GetItemsPerPage())
+		end := start + int(req.GetItemsPerPage())
+		if start > len(orders) {
+			start = len(orders)
+		}
+		if end > len(orders) {
+			end = len(orders)
+		}
+		orders = orders[start:end]
+	}
+	for i, o := range orders {
+		o.SortIndex = int32(i)
+	}
+
+	data := &pb.OrdersHistoryData{OrdersInfo: orders, TotalCount: total}
+	return &pb.OrdersHistoryReply{Response: &pb.OrdersHistoryReply_Data{Data: data}}, nil
+}
+
+func (h *accountHelperServer) SymbolParamsMany(_ context.Context, req *pb.SymbolParamsManyRequest) (*pb.SymbolParamsManyReply, error) {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := &pb.SymbolParamsManyData{}
+	for _, name := range s.order {
+		if req.SymbolName != nil && req.GetSymbolName() != name {
+			continue
+		}
+		data.SymbolInfos = append(data.SymbolInfos, proto.Clone(s.symbols[name].params).(*pb.SymbolParamsManyInfo))
+	}
+	return &pb.SymbolParamsManyReply{Response: &pb.SymbolParamsManyReply_Data{Data: data}}, nil
+}
+
+func (h *accountHelperServer) TickValueWithSize(_ context.Context, req *pb.TickValueWithSizeRequest) (*pb.TickValueWithSizeReply, error) {
+	s := h.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := &pb.TickValueWithSizeData{}
+	for i, name := range req.GetSymbolNames() {
+		st, ok := s.symbols[name]
+		if !ok {
+			apiErr := tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)
+			return &pb.TickValueWithSizeReply{Response: &pb.TickValueWithSizeReply_Error{Error: apiErr}}, nil
+		}
+		data.Infos = append(data.Infos, &pb.SymbolTickValueWithSizeInfo{
+			Index:             int32(i),
+			SymbolName:        name,
+			TradeTickValue:    st.params.GetTradeTickValue(),
+			TradeTickSize:     st.params.GetTradeTickSize(),
+			TradeContractSize: st.params.GetTradeContractSize(),
+		})
+	}
+	return &pb.TickValueWithSizeReply{Response: &pb.TickValueWithSizeReply_Data{Data: data}}, nil
+}
+
+//=== 📂 Market info ===
+
+type marketInfoServer struct {
+	pb.UnimplementedMarketInfoServer
+	s *Server
+}
+
+func (m *marketInfoServer) Quote(_ context.Context, req *pb.QuoteRequest) (*pb.QuoteReply, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.symbols[req.GetSymbol()]
+	if !ok {
+		return &pb.QuoteReply{Response: &pb.QuoteReply_Error{Error: tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)}}, nil
+	}
+	data := proto.Clone(st.quote).(*pb.QuoteData)
+	return &pb.QuoteReply{Response: &pb.QuoteReply_Data{Data: data}}, nil
+}
+
+func (m *marketInfoServer) QuoteMany(_ context.Context, req *pb.QuoteManyRequest) (*pb.QuoteManyReply, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := &pb.QuoteManyData{}
+	for _, name := range req.GetSymbols() {
+		st, ok := s.symbols[name]
+		if !ok {
+			return &pb.QuoteManyReply{Response: &pb.QuoteManyReply_Error{Error: tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)}}, nil
+		}
+		data.Quotes = append(data.Quotes, proto.Clone(st.quote).(*pb.QuoteData))
+	}
+	return &pb.QuoteManyReply{Response: &pb.QuoteManyReply_Data{Data: data}}, nil
+}
+
+func (m *marketInfoServer) Symbols(context.Context, *pb.SymbolsRequest) (*pb.SymbolsReply, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := &pb.SymbolsData{}
+	for i, name := range s.order {
+		data.SymbolNameInfos = append(data.SymbolNameInfos, &pb.SymbolNameInfo{SymbolName: name, SymbolIndex: int32(i)})
+	}
+	return &pb.SymbolsReply{Response: &pb.SymbolsReply_Data{Data: data}}, nil
+}
+
+func (m *marketInfoServer) QuoteHistory(_ context.Context, req *pb.QuoteHistoryRequest) (*pb.QuoteHistoryReply, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.symbols[req.GetSymbol()]
+	if !ok {
+		return &pb.QuoteHistoryReply{Response: &pb.QuoteHistoryReply_Error{Error: tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)}}, nil
+	}
+	data := &pb.QuoteHistoryData{}
+	for _, b := range st.bars {
+		t := b.GetTime().AsTime()
+		if req.FromTime != nil && t.Before(req.GetFromTime().AsTime()) {
+			continue
+		}
+		if req.ToTime != nil && t.After(req.GetToTime().AsTime()) {
+			continue
+		}
+		data.HistoricalQuotes = append(data.HistoricalQuotes, proto.Clone(b).(*pb.HistoryQuote))
+	}
+	return &pb.QuoteHistoryReply{Response: &pb.QuoteHistoryReply_Data{Data: data}}, nil
+}
+
+func (m *marketInfoServer) SymbolSelect(_ context.Context, req *pb.SymbolSelectRequest) (*pb.SymbolSelectReply, error) {
+	s := m.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.symbols[req.GetSymbol()]
+	if !ok {
+		return &pb.SymbolSelectReply{Response: &pb.SymbolSelectReply_Error{Error: tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)}}, nil
+	}
+	st.params.IsSelected = req.GetSelect()
+	st.params.Visible = req.GetSelect()
+	return &pb.SymbolSelectReply{Response: &pb.SymbolSelectReply_Data{Data: &pb.SymbolSelectData{Success: true}}}, nil
+}
+
+//=== 📂 Trading helper ===
+
+type tradingHelperServer struct {
+	pb.UnimplementedTradingHelperServer
+	s *Server
+}
+
+func (t *tradingHelperServer) OrderSend(_ context.Context, req *pb.OrderSendRequest) (*pb.OrderSendReply, error) {
+	data, apiErr := t.s.orderSend(req)
+	if apiErr != nil {
+		return &pb.OrderSendReply{Response: &pb.OrderSendReply_Error{Error: apiErr}}, nil
+	}
+	return &pb.OrderSendReply{Response: &pb.OrderSendReply_Data{Data: data}}, nil
+}
+
+func (t *tradingHelperServer) OrderModify(_ context.Context, req *pb.OrderModifyRequest) (*pb.OrderModifyReply, error) {
+	data, apiErr := t.s.orderModify(req)
+	if apiErr != nil {
+		return &pb.OrderModifyReply{Response: &pb.OrderModifyReply_Error{Error: apiErr}}, nil
+	}
+	return &pb.OrderModifyReply{Response: &pb.OrderModifyReply_Data{Data: data}}, nil
+}
+
+func (t *tradingHelperServer) OrderCloseDelete(_ context.Context, req *pb.OrderCloseDeleteRequest) (*pb.OrderCloseDeleteReply, error) {
+	data, apiErr := t.s.orderCloseDelete(req)
+	if apiErr != nil {
+		return &pb.OrderCloseDeleteReply{Response: &pb.OrderCloseDeleteReply_Error{Error: apiErr}}, nil
+	}
+	return &pb.OrderCloseDeleteReply{Response: &pb.OrderCloseDeleteReply_Data{Data: data}}, nil
+}
+
+func (t *tradingHelperServer) OrderCloseBy(_ context.Context, req *pb.OrderCloseByRequest) (*pb.OrderCloseByReply, error) {
+	data, apiErr := t.s.orderCloseBy(req)
+	if apiErr != nil {
+		return &pb.OrderCloseByReply{Response: &pb.OrderCloseByReply_Error{Error: apiErr}}, nil
+	}
+	return &pb.OrderCloseByReply{Response: &pb.OrderCloseByReply_Data{Data: data}}, nil
+}
+
+func (s *Server) orderSend(req *pb.OrderSendRequest) (*pb.OrderSendData, *pb.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.symbols[req.GetSymbol()]
+	if !ok {
+		return nil, tradeError(pb.MqlErrorCode_ERR_UNKNOWN_SYMBOL)
+	}
+	p := st.params
+	opType := pb.OpenedOrderType(req.GetOperationType())
+	buy := opType == pb.OpenedOrderType_OO_OP_BUY || opType == pb.OpenedOrderType_OO_OP_BUYLIMIT || opType == pb.OpenedOrderType_OO_OP_BUYSTOP
+
+	if apiErr := checkTradeMode(p, buy); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := checkVolume(p, req.GetVolume()); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var price float64
+	if isPending(opType) {
+		price = req.GetPrice()
+		if price <= 0 {
+			return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_PRICE)
+		}
+		if apiErr := checkPendingPrice(p, opType, price, st.quote.GetBid(), st.quote.GetAsk()); apiErr != nil {
+			return nil, apiErr
+		}
+	} else {
+		price = st.quote.GetBid()
+		if buy {
+			price = st.quote.GetAsk()
+		}
+		if req.Price != nil && req.Slippage != nil && math.Abs(req.GetPrice()-price) > float64(req.GetSlippage())*p.GetPoint()+volumeEpsilon {
+			return nil, tradeError(pb.MqlErrorCode_ERR_REQUOTE)
+		}
+	}
+	if apiErr := checkStops(p, buy, price, req.GetStoploss(), req.GetTakeprofit()); apiErr != nil {
+		return nil, apiErr
+	}
+
+	now := s.clockLocked()
+	o := &pb.OpenedOrderInfo{
+		Ticket:         s.nextTicketLocked(),
+		Symbol:         req.GetSymbol(),
+		OrderType:      opType,
+		Lots:           req.GetVolume(),
+		OpenPrice:      price,
+		StopLoss:       req.GetStoploss(),
+		TakeProfit:     req.GetTakeprofit(),
+		Comment:        req.GetComment(),
+		MagicNumber:    req.GetMagicNumber(),
+		ExpirationTime: req.GetExpiration(),
+		OpenTime:       timestamppb.New(now),
+		AccountLogin:   s.account.GetAccountLogin(),
+	}
+	if !isPending(opType) {
+		o.Commision = -round2(s.rules.CommissionPerLot * o.GetLots())
+	}
+	s.repriceLocked(o)
+
+	if !isPending(opType) {
+		info := s.eventAccountInfoLocked()
+		if info.GetFreeMargin()-s.marginLocked(o) < 0 {
+			s.ticket--
+			return nil, tradeError(pb.MqlErrorCode_ERR_NOT_ENOUGH_MONEY)
+		}
+	}
+
+	s.orders[o.Ticket] = o
+	s.emitTradeLocked(&pb.OnTadeEventData{NewOrders: []*pb.OnTradeOrderInfo{tradeOrderInfo(o)}})
+
+	return &pb.OrderSendData{
+		Ticket:   o.GetTicket(),
+		Volume:   o.GetLots(),
+		Price:    o.GetOpenPrice(),
+		OpenTime: o.GetOpenTime(),
+	}, nil
+}
+
+func (s *Server) orderModify(req *pb.OrderModifyRequest) (*pb.OrderModifyData, *pb.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[req.GetOrderTicket()]
+	if !ok {
+		return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TICKET)
+	}
+	prev := proto.Clone(o).(*pb.OpenedOrderInfo)
+	next := proto.Clone(o).(*pb.OpenedOrderInfo)
+
+	if req.NewPrice != nil && isPending(o.GetOrderType()) {
+		q := s.symbols[o.GetSymbol()].quote
+		if apiErr := checkPendingPrice(s.symbols[o.GetSymbol()].params, o.GetOrderType(), req.GetNewPrice(), q.GetBid(), q.GetAsk()); apiErr != nil {
+			return nil, apiErr
+		}
+		next.OpenPrice = req.GetNewPrice()
+	}
+	if req.NewStopLoss != nil {
+		next.StopLoss = req.GetNewStopLoss()
+	}
+	if req.NewTakeProfit != nil {
+		next.TakeProfit = req.GetNewTakeProfit()
+	}
+	if req.NewExpiration != nil {
+		if !isPending(o.GetOrderType()) {
+			return nil, tradeError(pb.MqlErrorCode_ERR_TRADE_EXPIRATION_DENIED)
+		}
+		next.ExpirationTime = req.GetNewExpiration()
+	}
+
+	buy := next.GetOrderType() == pb.OpenedOrderType_OO_OP_BUY || next.GetOrderType() == pb.OpenedOrderType_OO_OP_BUYLIMIT || next.GetOrderType() == pb.OpenedOrderType_OO_OP_BUYSTOP
+	ref := next.GetOpenPrice()
+	if !isPending(next.GetOrderType()) {
+		ref = s.closePriceLocked(next.GetSymbol(), next.GetOrderType())
+	}
+	if apiErr := checkStops(s.symbols[next.GetSymbol()].params, buy, ref, next.GetStopLoss(), next.GetTakeProfit()); apiErr != nil {
+		return nil, apiErr
+	}
+
+	if proto.Equal(prev, next) {
+		return &pb.OrderModifyData{OrderWasModified: false}, nil
+	}
+	s.orders[o.GetTicket()] = next
+	s.emitTradeLocked(&pb.OnTadeEventData{UpdatedOrders: []*pb.OnTradeUpdatedOrderInfo{{
+		Previous: tradeOrderInfo(prev),
+		Current:  tradeOrderInfo(next),
+	}}})
+	return &pb.OrderModifyData{OrderWasModified: true}, nil
+}
+
+func (s *Server) orderCloseDelete(req *pb.OrderCloseDeleteRequest) (*pb.OrderCloseDeleteData, *pb.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[req.GetOrderTicket()]
+	if !ok {
+		return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TICKET)
+	}
+
+	if isPending(o.GetOrderType()) {
+		h := s.deleteOrderLocked(o, "")
+		return &pb.OrderCloseDeleteData{
+			Mode:                pb.OrderCloseDeleteMode_OCD_PENDING_ORDER,
+			HistoryOrderComment: proto.String(h.GetComment()),
+		}, nil
+	}
+
+	lots := o.GetLots()
+	if req.Lots != nil && req.GetLots() > 0 {
+		lots = req.GetLots()
+		if lots > o.GetLots()+volumeEpsilon {
+			return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)
+		}
+		if lots < o.GetLots()-volumeEpsilon {
+			if apiErr := checkVolume(s.symbols[o.GetSymbol()].params, lots); apiErr != nil {
+				return nil, apiErr
+			}
+		}
+	}
+
+	price := s.closePriceLocked(o.GetSymbol(), o.GetOrderType())
+	if req.ClosingPrice != nil && req.Slippage != nil {
+		point := s.symbols[o.GetSymbol()].params.GetPoint()
+		if math.Abs(req.GetClosingPrice()-price) > float64(req.GetSlippage())*point+volumeEpsilon {
+			return nil, tradeError(pb.MqlErrorCode_ERR_REQUOTE)
+		}
+	}
+
+	h, _ := s.closeOrderLocked(o, lots, price, "")
+	return &pb.OrderCloseDeleteData{
+		Mode:                pb.OrderCloseDeleteMode_OCD_MARKET_ORDER,
+		HistoryOrderComment: proto.String(h.GetComment()),
+	}, nil
+}
+
+func (s *Server) orderCloseBy(req *pb.OrderCloseByRequest) (*pb.OrderCloseByData, *pb.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.orders[req.GetTicketToClose()]
+	if !ok {
+		return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TICKET)
+	}
+	by, ok := s.orders[req.GetOppositeTicketClosingBy()]
+	if !ok {
+		return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TICKET)
+	}
+	if isPending(o.GetOrderType()) || isPending(by.GetOrderType()) ||
+		o.GetSymbol() != by.GetSymbol() || o.GetOrderType() == by.GetOrderType() {
+		return nil, tradeError(pb.MqlErrorCode_ERR_INVALID_TICKET)
+	}
+
+	// Both orders close at the opposite order's open price; the larger one leaves a remainder.
+	lots := math.Min(o.GetLots(), by.GetLots())
+	price := by.GetOpenPrice()
+	h, _ := s.closeOrderLocked(o, lots, price, fmt.Sprintf("close hedge by #%d", by.GetTicket()))
+	s.closeOrderLocked(by, lots, price, fmt.Sprintf("partial close by #%d", o.GetTicket()))
+
+	return &pb.OrderCloseByData{
+		ClosePrice: h.GetClosePrice(),
+		Profit:     h.GetProfit(),
+		CloseTime:  h.GetCloseTime(),
+	}, nil
+}
+
+// closeOrderLocked closes lots of a market order at price, books the result to the balance and
+// emits the OnTrade event. A partial close reopens the remainder under a new ticket ("from #N").
+// Returns the history record and the remainder (nil on full close).
+func (s *Server) closeOrderLocked(o *pb.OpenedOrderInfo, lots, price float64, comment string) (*pb.HistoryOrderInfo, *pb.OpenedOrderInfo) {
+	now := s.clockLocked()
+	closed := proto.Clone(o).(*pb.OpenedOrderInfo)
+	closed.Lots = lots
+	closed.Profit = s.profitLocked(o.GetSymbol(), o.GetOrderType(), lots, o.GetOpenPrice(), price)
+
+	var rest *pb.OpenedOrderInfo
+	if o.GetLots()-lots > volumeEpsilon {
+		share := lots / o.GetLots()
+		closed.Swap = round2(o.GetSwap() * share)
+		closed.Commision = round2(o.GetCommision() * share)
+
+		rest = proto.Clone(o).(*pb.OpenedOrderInfo)
+		rest.Ticket = s.nextTicketLocked()
+		rest.Lots = round8(o.GetLots() - lots)
+		rest.Swap = round2(o.GetSwap() - closed.GetSwap())
+		rest.Commision = round2(o.GetCommision() - closed.GetCommision())
+		rest.Comment = fmt.Sprintf("from #%d", o.GetTicket())
+		s.repriceLocked(rest)
+		if comment == "" {
+			comment = fmt.Sprintf("to #%d", rest.GetTicket())
+		}
+	}
+	if comment != "" {
+		closed.Comment = comment
+	}
+
+	h := historyOrder(closed, price, now)
+	delete(s.orders, o.GetTicket())
+	s.history = append(s.history, h)
+	s.account.AccountBalance = round2(s.account.GetAccountBalance() + h.GetProfit() + h.GetSwap() + h.GetCommision())
+
+	ev := &pb.OnTadeEventData{
+		RemovedOrders:    []*pb.OnTradeOrderInfo{tradeOrderInfo(o)},
+		NewHistoryOrders: []*pb.OnTradeOrderInfo{historyTradeOrderInfo(h)},
+	}
+	if rest != nil {
+		s.orders[rest.GetTicket()] = rest
+		ev.NewOrders = []*pb.OnTradeOrderInfo{tradeOrderInfo(rest)}
+	}
+	s.emitTradeLocked(ev)
+	return h, rest
+}
+
+// deleteOrderLocked removes a pending order into history and emits the OnTrade event.
+func (s *Server) deleteOrderLocked(o *pb.OpenedOrderInfo, comment string) *pb.HistoryOrderInfo {
+	deleted := proto.Clone(o).(*pb.OpenedOrderInfo)
+	if comment != "" {
+		deleted.Comment = comment
+	}
+	h := historyOrder(deleted, s.closePriceLocked(o.GetSymbol(), pb.OpenedOrderType_OO_OP_BUY), s.clockLocked())
+	delete(s.orders, o.GetTicket())
+	s.history = append(s.history, h)
+	s.emitTradeLocked(&pb.OnTadeEventData{
+		RemovedOrders:    []*pb.OnTradeOrderInfo{tradeOrderInfo(o)},
+		NewHistoryOrders: []*pb.OnTradeOrderInfo{historyTradeOrderInfo(h)},
+	})
+	return h
+}
+
+// checkTradeMode rejects orders the symbol trade mode does not allow.
+func checkTradeMode(p *pb.SymbolParamsManyInfo, buy bool) *pb.Error {
+	switch p.GetTradeMode() {
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_DISABLED, pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_CLOSEONLY:
+		return tradeError(pb.MqlErrorCode_ERR_TRADE_DISABLED)
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_LONGONLY:
+		if !buy {
+			return tradeError(pb.MqlErrorCode_ERR_SHORTS_NOT_ALLOWED)
+		}
+	case pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_SHORTONLY:
+		if buy {
+			return tradeError(pb.MqlErrorCode_ERR_LONGS_NOT_ALLOWED)
+		}
+	}
+	return nil
+}
+
+// checkVolume rejects volumes outside [VolumeMin, VolumeMax] or off the VolumeStep grid.
+func checkVolume(p *pb.SymbolParamsManyInfo, volume float64) *pb.Error {
+	if volume <= 0 ||
+		(p.GetVolumeMin() > 0 && volume < p.GetVolumeMin()-volumeEpsilon) ||
+		(p.GetVolumeMax() > 0 && volume > p.GetVolumeMax()+volumeEpsilon) {
+		return tradeError(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)
+	}
+	if step := p.GetVolumeStep(); step > 0 {
+		n := volume / step
+		if math.Abs(n-math.Round(n)) > 1e-6 {
+			return tradeError(pb.MqlErrorCode_ERR_INVALID_TRADE_VOLUME)
+		}
+	}
+	return nil
+}
+
+// checkStops rejects SL/TP on the wrong side of price or closer than TradeStopsLevel points.
+func checkStops(p *pb.SymbolParamsManyInfo, buy bool, price, sl, tp float64) *pb.Error {
+	minDist := float64(p.GetTradeStopsLevel()) * p.GetPoint()
+	dir := 1.0
+	if !buy {
+		dir = -1
+	}
+	if sl != 0 && (price-sl)*dir < minDist-volumeEpsilon {
+		return tradeError(pb.MqlErrorCode_ERR_INVALID_STOPS)
+	}
+	if tp != 0 && (tp-price)*dir < minDist-volumeEpsilon {
+		return tradeError(pb.MqlErrorCode_ERR_INVALID_STOPS)
+	}
+	if (sl != 0 && sl == price) || (tp != 0 && tp == price) {
+		return tradeError(pb.MqlErrorCode_ERR_INVALID_STOPS)
+	}
+	return nil
+}
+
+// round8 trims floating point noise from lot arithmetic.
+func round8(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
+
+//=== 📂 Subscriptions ===
+
+type subscriptionServer struct {
+	pb.UnimplementedSubscriptionServiceServer
+	s *Server
+}
+
+// droppedChan returns the channel closed by the next Disconnect.
+func (s *Server) droppedChan() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// errDisconnected is returned to streams aborted by Server.Disconnect.
+var errDisconnected = status.Error(codes.Unavailable, "mt4test: disconnected")
+
+func (sub *subscriptionServer) OnSymbolTick(req *pb.OnSymbolTickRequest, stream pb.SubscriptionService_OnSymbolTickServer) error {
+	s := sub.s
+	want := make(map[string]bool, len(req.GetSymbolNames()))
+	for _, name := range req.GetSymbolNames() {
+		want[name] = true
+	}
+	id, _ := s.terminalFromContext(stream.Context())
+	ticks, unsubscribe := s.ticks.subscribe()
+	defer unsubscribe()
+	dropped := s.droppedChan()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-dropped:
+			return errDisconnected
+		case tick := <-ticks:
+			if len(want) > 0 && !want[tick.GetSymbol()] {
+				continue
+			}
+			data := &pb.OnSymbolTickData{SymbolTick: tick, TerminalInstanceGuidId: id}
+			if err := stream.Send(&pb.OnSymbolTickReply{Response: &pb.OnSymbolTickReply_Data{Data: data}}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (sub *subscriptionServer) OnTrade(_ *pb.OnTradeRequest, stream pb.SubscriptionService_OnTradeServer) error {
+	s := sub.s
+	id, _ := s.terminalFromContext(stream.Context())
+	events, unsubscribe := s.trades.subscribe()
+	defer unsubscribe()
+	dropped := s.droppedChan()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-dropped:
+			return errDisconnected
+		case ev := <-events:
+			data := proto.Clone(ev).(*pb.OnTradeData)
+			data.TerminalInstanceGuidId = id
+			if err := stream.Send(&pb.OnTradeReply{Response: &pb.OnTradeReply_Data{Data: data}}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (sub *subscriptionServer) OnOpenedOrdersProfit(req *pb.OnOpenedOrdersProfitRequest, stream pb.SubscriptionService_OnOpenedOrdersProfitServer) error {
+	s := sub.s
+	id, _ := s.terminalFromContext(stream.Context())
+	return s.poll(stream.Context(), req.GetTimerPeriodMilliseconds(), func() error {
+		s.mu.Lock()
+		data := &pb.OnOpenedOrdersProfitData{
+			Type:                   pb.MT4_SUB_ENUM_EVENT_GROUP_TYPE_OrderProfit,
+			AccountInfo:            s.eventAccountInfoLocked(),
+			TerminalInstanceGuidId: id,
+		}
+		for _, o := range s.openedOrdersLocked() {
+			data.OpenedOrdersWithProfitUpdated = append(data.OpenedOrdersWithProfitUpdated, &pb.OnOpenedOrdersProfitOrderInfo{
+				Index:       o.GetPositionIndex(),
+				Ticket:      o.GetTicket(),
+				Comment:     o.GetComment(),
+				Commission:  o.GetCommision(),
+				Expiration:  o.GetExpirationTime(),
+				Lots:        o.GetLots(),
+				MagicNumber: o.GetMagicNumber(),
+				OpenPrice:   o.GetOpenPrice(),
+				OpenTime:    o.GetOpenTime(),
+				OrderProfit: o.GetProfit(),
+				StopLoss:    o.GetStopLoss(),
+				Swap:        o.GetSwap(),
+				Symbol:      o.GetSymbol(),
+				TakeProfit:  o.GetTakeProfit(),
+				Type:        pb.SUB_ORDER_OPERATION_TYPE(o.GetOrderType()),
+			})
+		}
+		s.mu.Unlock()
+		return stream.Send(&pb.OnOpenedOrdersProfitReply{Response: &pb.OnOpenedOrdersProfitReply_Data{Data: data}})
+	})
+}
+
+func (sub *subscriptionServer) OnOpenedOrdersTickets(req *pb.OnOpenedOrdersTicketsRequest, stream pb.SubscriptionService_OnOpenedOrdersTicketsServer) error {
+	s := sub.s
+	id, _ := s.terminalFromContext(stream.Context())
+	return s.poll(stream.Context(), req.GetPullIntervalMilliseconds(), func() error {
+		s.mu.Lock()
+		data := &pb.OnOpenedOrdersTicketsData{
+			ServerTime:             timestamppb.New(s.clockLocked()),
+			TerminalInstanceGuidId: id,
+		}
+		for _, o := range s.openedOrdersLocked() {
+			if isPending(o.GetOrderType()) {
+				data.PendingOrderTickets = append(data.PendingOrderTickets, o.GetTicket())
+			} else {
+				data.PositionTickets = append(data.PositionTickets, o.GetTicket())
+			}
+		}
+		s.mu.Unlock()
+		return stream.Send(&pb.OnOpenedOrdersTicketsReply{Response: &pb.OnOpenedOrdersTicketsReply_Data{Data: data}})
+	})
+}
+
+// poll calls send every intervalMs (default 1s) until ctx is done or the server disconnects.
+func (s *Server) poll(ctx context.Context, intervalMs int32, send func() error) error {
+	interval := time.Duration(intervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	dropped := s.droppedChan()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-dropped:
+			return errDisconnected
+		case <-ticker.C:
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+}
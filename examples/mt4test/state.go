@@ -0,0 +1,432 @@
+package mt4test
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	pb "git.mtapi.io/root/mrpc-proto.git/mt4/libraries/go"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// symbolState holds the specification, last quote and bar history of a symbol.
+type symbolState struct {
+	params *pb.SymbolParamsManyInfo
+	quote  *pb.QuoteData
+	bars   []*pb.HistoryQuote
+}
+
+// ForexSymbol returns specification defaults for a forex pair (100k contract, volume 0.01..100 step 0.01,
+// full trade mode, no swaps). The tick value is recomputed on every tick when the pair is not quoted
+// in the account currency.
+func ForexSymbol(name string, digits int32) *pb.SymbolParamsManyInfo {
+	point := math.Pow10(-int(digits))
+	base, profit := name, "USD"
+	if len(name) >= 6 {
+		base, profit = name[:3], name[3:6]
+	}
+	return &pb.SymbolParamsManyInfo{
+		SymbolName:        name,
+		Digits:            digits,
+		Point:             point,
+		TradeTickSize:     point,
+		TradeTickValue:    100000 * point,
+		TradeContractSize: 100000,
+		VolumeMin:         0.01,
+		VolumeMax:         100,
+		VolumeStep:        0.01,
+		TradeMode:         pb.SP_ENUM_SYMBOL_TRADE_MODE_SYMBOL_TRADE_MODE_FULL,
+		TradeCalcMode:     pb.SP_ENUM_TRADE_CALC_MODE_SYMBOL_TRADE_MARGINE_CALC_MODE_FOREX,
+		CurrencyBase:      base,
+		CurrencyProfit:    profit,
+		CurrencyMargin:    base,
+		IsSelected:        true,
+		Visible:           true,
+	}
+}
+
+//=== 📂 Scriptable account state ===
+
+// SetCredentials makes Connect/ConnectEx accept only user/password (user 0 = accept any).
+func (s *Server) SetCredentials(user uint64, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user, s.password = user, password
+}
+
+// AddBrokerServer lists server under company for GetBrokerServersByBrokerName.
+// access are the server's access points (e.g. "mt4-demo.example.com:443").
+func (s *Server) AddBrokerServer(company, server string, access ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &pb.GetBrokerServersByBrokerNameData_BrokerServer{Name: server, Access: access}
+	for _, b := range s.brokers {
+		if b.Company == company {
+			b.Results = append(b.Results, entry)
+			return
+		}
+	}
+	s.brokers = append(s.brokers, &pb.GetBrokerServersByBrokerNameData_BrokerResult{
+		Company: company,
+		Results: []*pb.GetBrokerServersByBrokerNameData_BrokerServer{entry},
+	})
+}
+
+// SetConnectStepDelay sets the pause between ConnectStream / ConnectExStream progress events.
+func (s *Server) SetConnectStepDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stepDelay = d
+}
+
+// SetClock replaces the server clock (defaults to time.Now); useful for deterministic timestamps.
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// SetAccount replaces the account summary (equity is recomputed from balance, credit and open orders).
+func (s *Server) SetAccount(summary *pb.AccountSummaryData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account = proto.Clone(summary).(*pb.AccountSummaryData)
+}
+
+// SetBalance sets the account balance.
+func (s *Server) SetBalance(balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account.AccountBalance = balance
+}
+
+// Account returns a snapshot of the account summary.
+func (s *Server) Account() *pb.AccountSummaryData {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accountSummaryLocked()
+}
+
+// AddSymbol adds (or replaces) a symbol with its specification and initial quote.
+func (s *Server) AddSymbol(params *pb.SymbolParamsManyInfo, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := params.GetSymbolName()
+	if _, ok := s.symbols[name]; !ok {
+		s.order = append(s.order, name)
+	}
+	p := proto.Clone(params).(*pb.SymbolParamsManyInfo)
+	p.Bid = bid
+	s.symbols[name] = &symbolState{
+		params: p,
+		quote: &pb.QuoteData{
+			Symbol:   name,
+			Bid:      bid,
+			Ask:      ask,
+			High:     bid,
+			Low:      bid,
+			DateTime: timestamppb.New(s.clockLocked()),
+		},
+	}
+	s.updateTickValueLocked(s.symbols[name])
+}
+
+// AddBars appends history bars returned by QuoteHistory for symbol.
+func (s *Server) AddBars(symbol string, bars ...*pb.HistoryQuote) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.symbols[symbol]
+	if !ok {
+		return
+	}
+	for _, b := range bars {
+		b = proto.Clone(b).(*pb.HistoryQuote)
+		b.Symbol = symbol
+		st.bars = append(st.bars, b)
+	}
+	sort.SliceStable(st.bars, func(i, j int) bool {
+		return st.bars[i].GetTime().AsTime().Before(st.bars[j].GetTime().AsTime())
+	})
+	for i, b := range st.bars {
+		b.Index = int32(i)
+	}
+}
+
+// PushTick updates the quote of symbol, publishes the tick to OnSymbolTick subscribers and runs
+// the matching engine (pending orders, SL/TP, stop-out). Unknown symbols are ignored.
+func (s *Server) PushTick(symbol string, bid, ask float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushTickLocked(symbol, bid, ask, time.Time{})
+}
+
+// AddOrder inserts an opened order (market or pending) as is, assigning a ticket if it has none.
+// Returns the ticket.
+func (s *Server) AddOrder(o *pb.OpenedOrderInfo) int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o = proto.Clone(o).(*pb.OpenedOrderInfo)
+	if o.Ticket == 0 {
+		o.Ticket = s.nextTicketLocked()
+	} else if o.Ticket > s.ticket {
+		s.ticket = o.Ticket
+	}
+	if o.OpenTime == nil {
+		o.OpenTime = timestamppb.New(s.clockLocked())
+	}
+	o.AccountLogin = s.account.GetAccountLogin()
+	s.repriceLocked(o)
+	s.orders[o.Ticket] = o
+	s.emitTradeLocked(&pb.OnTadeEventData{NewOrders: []*pb.OnTradeOrderInfo{tradeOrderInfo(o)}})
+	return o.Ticket
+}
+
+// AddHistory appends closed orders returned by OrdersHistory.
+func (s *Server) AddHistory(orders ...*pb.HistoryOrderInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range orders {
+		s.history = append(s.history, proto.Clone(o).(*pb.HistoryOrderInfo))
+	}
+}
+
+// Orders returns a snapshot of opened orders sorted by ticket.
+func (s *Server) Orders() []*pb.OpenedOrderInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.openedOrdersLocked()
+}
+
+// Order returns a snapshot of the opened order with ticket, or nil.
+func (s *Server) Order(ticket int32) *pb.OpenedOrderInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o, ok := s.orders[ticket]; ok {
+		return proto.Clone(o).(*pb.OpenedOrderInfo)
+	}
+	return nil
+}
+
+// History returns a snapshot of closed/deleted orders in close order.
+func (s *Server) History() []*pb.HistoryOrderInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]*pb.HistoryOrderInfo, len(s.history))
+	for i, o := range s.history {
+		out[i] = proto.Clone(o).(*pb.HistoryOrderInfo)
+	}
+	return out
+}
+
+//=== 📂 Internal state helpers (s.mu held) ===
+
+func (s *Server) nextTicketLocked() int32 {
+	s.ticket++
+	return s.ticket
+}
+
+func (s *Server) openedOrdersLocked() []*pb.OpenedOrderInfo {
+	out := make([]*pb.OpenedOrderInfo, 0, len(s.orders))
+	for _, o := range s.orders {
+		out = append(out, proto.Clone(o).(*pb.OpenedOrderInfo))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetTicket() < out[j].GetTicket() })
+	for i, o := range out {
+		o.PositionIndex = int32(i)
+		o.SortIndex = int32(i)
+	}
+	return out
+}
+
+func (s *Server) pushTickLocked(symbol string, bid, ask float64, t time.Time) {
+	st, ok := s.symbols[symbol]
+	if !ok {
+		return
+	}
+	if t.IsZero() {
+		s.rolloverLocked()
+	} else {
+		s.advanceClockLocked(t)
+	}
+	now := s.clockLocked()
+
+	q := st.quote
+	q.Bid, q.Ask, q.DateTime = bid, ask, timestamppb.New(now)
+	q.High = math.Max(q.High, bid)
+	q.Low = math.Min(q.Low, bid)
+	st.params.Bid = bid
+	s.updateTickValueLocked(st)
+
+	s.ticks.publish(&pb.OnSymbolMqlTickInfo{
+		Symbol:  symbol,
+		Bid:     bid,
+		Ask:     ask,
+		Last:    bid,
+		Time:    timestamppb.New(now),
+		TimeMsc: now.UnixMilli(),
+	})
+
+	for _, o := range s.orders {
+		s.repriceLocked(o)
+	}
+	s.matchLocked(symbol)
+	s.stopOutLocked()
+}
+
+// closePrice returns the price a market order of type t would close at.
+func (s *Server) closePriceLocked(symbol string, t pb.OpenedOrderType) float64 {
+	st, ok := s.symbols[symbol]
+	if !ok {
+		return 0
+	}
+	if t == pb.OpenedOrderType_OO_OP_BUY {
+		return st.quote.GetBid()
+	}
+	return st.quote.GetAsk()
+}
+
+// repriceLocked recomputes the floating profit of a market order.
+func (s *Server) repriceLocked(o *pb.OpenedOrderInfo) {
+	if isPending(o.GetOrderType()) {
+		o.Profit = 0
+		return
+	}
+	o.Profit = s.profitLocked(o.GetSymbol(), o.GetOrderType(), o.GetLots(), o.GetOpenPrice(), s.closePriceLocked(o.GetSymbol(), o.GetOrderType()))
+}
+
+// profitLocked computes the profit of lots moved from open to close in account currency.
+func (s *Server) profitLocked(symbol string, t pb.OpenedOrderType, lots, open, close float64) float64 {
+	st, ok := s.symbols[symbol]
+	if !ok {
+		return 0
+	}
+	diff := close - open
+	if t == pb.OpenedOrderType_OO_OP_SELL {
+		diff = -diff
+	}
+	p := st.params
+	if p.GetTradeTickSize() > 0 && p.GetTradeTickValue() > 0 {
+		return round2(diff / p.GetTradeTickSize() * p.GetTradeTickValue() * lots)
+	}
+	return round2(diff * p.GetTradeContractSize() * lots)
+}
+
+// eventAccountInfoLocked builds the account snapshot attached to trade/profit events.
+func (s *Server) eventAccountInfoLocked() *pb.OnEventAccountInfo {
+	var profit, margin float64
+	for _, o := range s.orders {
+		profit += o.GetProfit() + o.GetSwap() + o.GetCommision()
+		margin += s.marginLocked(o)
+	}
+	equity := s.account.GetAccountBalance() + s.account.GetAccountCredit() + profit
+	info := &pb.OnEventAccountInfo{
+		Balance:    s.account.GetAccountBalance(),
+		Credit:     s.account.GetAccountCredit(),
+		Equity:     round2(equity),
+		Margin:     round2(margin),
+		FreeMargin: round2(equity - margin),
+		Profit:     round2(profit),
+		Login:      s.account.GetAccountLogin(),
+	}
+	if margin > 0 {
+		info.MarginLevel = round2(equity / margin * 100)
+	}
+	return info
+}
+
+func (s *Server) accountSummaryLocked() *pb.AccountSummaryData {
+	a := proto.Clone(s.account).(*pb.AccountSummaryData)
+	a.AccountEquity = s.eventAccountInfoLocked().GetEquity()
+	a.ServerTime = timestamppb.New(s.clockLocked())
+	return a
+}
+
+// emitTradeLocked publishes an OnTrade event with the current account snapshot.
+func (s *Server) emitTradeLocked(ev *pb.OnTadeEventData) {
+	s.trades.publish(&pb.OnTradeData{
+		Type:        pb.MT4_SUB_ENUM_EVENT_GROUP_TYPE_OrderUpdate,
+		EventData:   ev,
+		AccountInfo: s.eventAccountInfoLocked(),
+	})
+}
+
+// historyOrder converts an opened order into its closed history record.
+func historyOrder(o *pb.OpenedOrderInfo, closePrice float64, closeTime time.Time) *pb.HistoryOrderInfo {
+	return &pb.HistoryOrderInfo{
+		Comment:        o.GetComment(),
+		Commision:      o.GetCommision(),
+		ExpirationTime: o.GetExpirationTime(),
+		Lots:           o.GetLots(),
+		MagicNumber:    o.GetMagicNumber(),
+		OpenPrice:      o.GetOpenPrice(),
+		Profit:         o.GetProfit(),
+		StopLoss:       o.GetStopLoss(),
+		Swap:           o.GetSwap(),
+		Symbol:         o.GetSymbol(),
+		TakeProfit:     o.GetTakeProfit(),
+		Ticket:         o.GetTicket(),
+		OrderType:      o.GetOrderType(),
+		OpenTime:       o.GetOpenTime(),
+		CloseTime:      timestamppb.New(closeTime),
+		ClosePrice:     closePrice,
+		AccountLogin:   o.GetAccountLogin(),
+	}
+}
+
+// tradeOrderInfo converts an opened order into its OnTrade representation.
+func tradeOrderInfo(o *pb.OpenedOrderInfo) *pb.OnTradeOrderInfo {
+	return &pb.OnTradeOrderInfo{
+		Index:        o.GetPositionIndex(),
+		Ticket:       o.GetTicket(),
+		Comment:      o.GetComment(),
+		Commission:   o.GetCommision(),
+		Expiration:   o.GetExpirationTime(),
+		Lots:         o.GetLots(),
+		MagicNumber:  o.GetMagicNumber(),
+		OpenPrice:    o.GetOpenPrice(),
+		OpenTime:     o.GetOpenTime(),
+		OrderProfit:  o.GetProfit(),
+		StopLoss:     o.GetStopLoss(),
+		Swap:         o.GetSwap(),
+		Symbol:       o.GetSymbol(),
+		TakeProfit:   o.GetTakeProfit(),
+		Type:         pb.SUB_ORDER_OPERATION_TYPE(o.GetOrderType()),
+		AccountLogin: o.GetAccountLogin(),
+	}
+}
+
+// historyTradeOrderInfo converts a history record into its OnTrade representation.
+func historyTradeOrderInfo(h *pb.HistoryOrderInfo) *pb.OnTradeOrderInfo {
+	return &pb.OnTradeOrderInfo{
+		Ticket:       h.GetTicket(),
+		IsHistory:    true,
+		Comment:      h.GetComment(),
+		Commission:   h.GetCommision(),
+		Expiration:   h.GetExpirationTime(),
+		Lots:         h.GetLots(),
+		MagicNumber:  h.GetMagicNumber(),
+		OpenPrice:    h.GetOpenPrice(),
+		OpenTime:     h.GetOpenTime(),
+		OrderProfit:  h.GetProfit(),
+		StopLoss:     h.GetStopLoss(),
+		Swap:         h.GetSwap(),
+		Symbol:       h.GetSymbol(),
+		TakeProfit:   h.GetTakeProfit(),
+		Type:         pb.SUB_ORDER_OPERATION_TYPE(h.GetOrderType()),
+		ClosePrice:   h.GetClosePrice(),
+		CloseTime:    h.GetCloseTime(),
+		AccountLogin: h.GetAccountLogin(),
+	}
+}
+
+// isPending reports whether t is a pending (limit/stop) order type.
+func isPending(t pb.OpenedOrderType) bool {
+	return t >= pb.OpenedOrderType_OO_OP_BUYLIMIT
+}
+
+// round2 rounds money values to cents.
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}